@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+)
+
+// BlobPath is where the signed URLs of the local blob storage point to
+const BlobPath = "/blobs"
+
+// Uploads to the local blob storage are limited to 10 MiB
+const maxBlobSize = 10 << 20
+
+// BlobHandler serves the signed upload and download URLs of the local blob
+// storage. The signature authorizes the request, so no session is needed.
+type BlobHandler struct {
+	Store *repository.LocalBlobStore
+}
+
+func NewBlobHandler(store *repository.LocalBlobStore) *BlobHandler {
+	return &BlobHandler{
+		Store: store,
+	}
+}
+
+func (h *BlobHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	if h.Store == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := r.PathValue("key")
+	body := http.MaxBytesReader(w, r.Body, maxBlobSize)
+	err := h.Store.PutSigned(key, r.URL.Query(), r.Header.Get("Content-Type"), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, repository.ErrInvalidBlobSignature):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, repository.ErrBlobChecksumMismatch):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.As(err, &tooLarge):
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		default:
+			log.Printf("Failed to store blob %s: %v", key, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *BlobHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if h.Store == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := r.PathValue("key")
+	file, info, err := h.Store.OpenSigned(key, r.URL.Query())
+	if errors.Is(err, repository.ErrInvalidBlobSignature) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, repository.ErrBlobNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to open blob %s: %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	// Files are served from the origin of the app, so anything but an image
+	// is downloaded instead of rendered
+	contentType := info.ContentType
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = "application/octet-stream"
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=900")
+
+	stat, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.ServeContent(w, r, "", stat.ModTime(), file)
+}
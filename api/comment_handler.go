@@ -2,24 +2,45 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"regexp"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 	"github.com/HENNGE/snsclone-202506-golang-luca/service"
 )
 
 type CommentHandler struct {
 	service service.DefaultCommentService
+	Broker  *entity.Broker
 }
 
-func NewCommentHandler(service service.DefaultCommentService) *CommentHandler {
+func NewCommentHandler(service service.DefaultCommentService, broker *entity.Broker) *CommentHandler {
 	return &CommentHandler{
 		service: service,
+		Broker:  broker,
 	}
 }
 
+// publish sends a comment event to the clients that subscribed to the post,
+// except to the users who hid the actor
+func (h *CommentHandler) publish(r *http.Request, name, postId, actorId string, payload any) {
+	eventData, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to marshal %s event: %v", name, err)
+		return
+	}
+
+	h.Broker.Publish(r.Context(), entity.SSEEvent{
+		Name:     name,
+		Data:     string(eventData),
+		Audience: entity.ToTopic(entity.PostTopic(postId)),
+		ActorID:  actorId,
+	})
+}
+
 func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
 	postId := r.PathValue("post_id")
 	if postId == "" {
@@ -55,11 +76,25 @@ func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	comment, err := h.service.Create(r.Context(), postId, claims.UserID, claims.UserName, &request)
+	if errors.Is(err, service.ErrBlocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, service.ErrPostNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrCommentNotFound) {
+		http.Error(w, "parent comment not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	h.publish(r, "new_comment", postId, comment.UserID, comment)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(comment)
@@ -72,14 +107,37 @@ func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
 func (h *CommentHandler) GetByPostID(w http.ResponseWriter, r *http.Request) {
 	postId := r.PathValue("post_id")
 
-	comments, err := h.service.GetByPostID(r.Context(), postId)
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Without a parent the top level comments are returned
+	parentId := r.URL.Query().Get("parent")
+
+	page, err := h.service.GetByPostID(r.Context(), claims.UserID, postId, parentId, limit, cursor)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrPostNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(comments)
+	err = json.NewEncoder(w).Encode(page)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -118,11 +176,19 @@ func (h *CommentHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	updatedComment, err := h.service.Update(r.Context(), postId, commentId, &request)
+	if errors.Is(err, service.ErrCommentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	commentDto := new(dto.Comment)
+	commentDto.FromEntity(updatedComment)
+	h.publish(r, "update_comment", postId, commentDto.UserID, commentDto)
+
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(updatedComment)
 	if err != nil {
@@ -142,7 +208,17 @@ func (h *CommentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.service.Delete(r.Context(), postId, commentId)
+	deleted, err := h.service.Delete(r.Context(), postId, commentId)
+
+	// Comments removed before a failure are gone as well
+	for _, comment := range deleted {
+		h.publish(r, "delete_comment", postId, userId, comment)
+	}
+
+	if errors.Is(err, service.ErrCommentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2,35 +2,53 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
 	"github.com/HENNGE/snsclone-202506-golang-luca/service"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type Handlers struct {
-	PingHandler      *PingHandler
-	UserHandler      *UserHandler
-	PostHandler      *PostHandler
-	CommentHandler   *CommentHandler
-	AuthHandler      *AuthHandler
-	ServeHandler     *ServeHandler
-	S3PresignHandler *S3PresignHandler
-	Broker           *entity.Broker
+	PingHandler         *PingHandler
+	UserHandler         *UserHandler
+	PostHandler         *PostHandler
+	CommentHandler      *CommentHandler
+	AuthHandler         *AuthHandler
+	ServeHandler        *ServeHandler
+	PresignHandler      *PresignHandler
+	BlobHandler         *BlobHandler
+	TimelineHandler     *TimelineHandler
+	SearchHandler       *SearchHandler
+	TagHandler          *TagHandler
+	NotificationHandler *NotificationHandler
+	WebSocketHandler    *WebSocketHandler
+	MessageHandler      *MessageHandler
+	Broker              *entity.Broker
 }
 
-func InitHandlers(services *service.Services, authConfig *AuthConfig, fs http.Handler, client *s3.PresignClient) *Handlers {
-	broker := entity.NewBroker()
+func InitHandlers(services *service.Services, authConfig *AuthConfig, fs http.Handler, blobs repository.BlobStore, broker *entity.Broker) *Handlers {
+	// Only the local blob storage has URLs served by the API itself
+	localBlobs, _ := blobs.(*repository.LocalBlobStore)
+
 	return &Handlers{
-		PingHandler:      NewPingHandler(),
-		UserHandler:      NewUserHandler(*services.UserService),
-		PostHandler:      NewPostHandler(*services.PostService, broker),
-		CommentHandler:   NewCommentHandler(*services.CommentService),
-		AuthHandler:      NewAuthHandler(*services.UserService, authConfig),
-		ServeHandler:     NewServeHandler(fs),
-		S3PresignHandler: NewS3PresignHandler(client),
-		Broker:           broker,
+		PingHandler:         NewPingHandler(),
+		UserHandler:         NewUserHandler(*services.UserService),
+		PostHandler:         NewPostHandler(*services.PostService, broker),
+		CommentHandler:      NewCommentHandler(*services.CommentService, broker),
+		AuthHandler:         NewAuthHandler(*services.UserService, authConfig),
+		ServeHandler:        NewServeHandler(fs),
+		PresignHandler:      NewPresignHandler(blobs),
+		BlobHandler:         NewBlobHandler(localBlobs),
+		TimelineHandler:     NewTimelineHandler(services.TimelineService),
+		SearchHandler:       NewSearchHandler(services.SearchService),
+		TagHandler:          NewTagHandler(services.PostService, services.TrendingService),
+		NotificationHandler: NewNotificationHandler(services.NotificationService, services.PostService, broker),
+		WebSocketHandler:    NewWebSocketHandler(services.PostService, broker),
+		MessageHandler:      NewMessageHandler(services.MessageService),
+		Broker:              broker,
 	}
 }
 
@@ -46,3 +64,25 @@ func IsAuthorized(ctx context.Context, userId string) bool {
 
 	return true
 }
+
+const defaultPageSize = 20
+const maxPageSize = 100
+
+var errInvalidLimit = errors.New("limit must be a number between 1 and 100")
+
+// parsePageParams reads the limit and cursor query parameters used by the
+// paginated endpoints.
+func parsePageParams(r *http.Request) (int32, string, error) {
+	query := r.URL.Query()
+
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return 0, "", errInvalidLimit
+		}
+		limit = parsed
+	}
+
+	return int32(limit), query.Get("cursor"), nil
+}
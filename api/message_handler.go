@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/service"
+)
+
+// Messages are longer than posts but still bounded
+const maxMessageLength = 1000
+
+type MessageHandler struct {
+	Service service.MessageService
+}
+
+func NewMessageHandler(service service.MessageService) *MessageHandler {
+	return &MessageHandler{
+		Service: service,
+	}
+}
+
+func (h *MessageHandler) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	request := dto.CreateConversationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conversation, err := h.Service.CreateConversation(r.Context(), claims.UserID, &request)
+	switch {
+	case errors.Is(err, service.ErrInvalidParticipants), errors.Is(err, service.ErrTooManyParticipants):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrDMsRestricted), errors.Is(err, service.ErrBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(conversation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *MessageHandler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Service.ListConversations(r.Context(), claims.UserID, limit, cursor)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *MessageHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Service.ListMessages(r.Context(), claims.UserID, r.PathValue("id"), limit, cursor)
+	switch {
+	case errors.Is(err, service.ErrInvalidCursor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrConversationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	request := dto.SendMessageRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Remove invisible characters from request text, line breaks are kept
+	var re = regexp.MustCompile("[\u0000-\u0009\u000B-\u001F\u00A0\u115F\u1160\u2000-\u200D\u2028-\u202F\u205F\u2060\u3000\u3164\uFEFF\r]")
+	request.Text = re.ReplaceAllString(request.Text, "")
+
+	if request.Text == "" {
+		http.Error(w, "message cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Text) > maxMessageLength {
+		http.Error(w, "message length exceeds the maximum", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.Service.Send(r.Context(), claims.UserID, claims.UserName, r.PathValue("id"), &request)
+	switch {
+	case errors.Is(err, service.ErrConversationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrDMsRestricted), errors.Is(err, service.ErrBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *MessageHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// An empty body marks the whole conversation as read
+	request := dto.MarkConversationReadRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.MarkRead(r.Context(), claims.UserID, r.PathValue("id"), &request)
+	switch {
+	case errors.Is(err, service.ErrInvalidMessageID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrConversationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
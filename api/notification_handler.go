@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/service"
+)
+
+type NotificationHandler struct {
+	Service service.NotificationService
+	Posts   service.PostService
+	Broker  *entity.Broker
+}
+
+func NewNotificationHandler(service service.NotificationService, posts service.PostService, broker *entity.Broker) *NotificationHandler {
+	return &NotificationHandler{
+		Service: service,
+		Posts:   posts,
+		Broker:  broker,
+	}
+}
+
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Service.List(r.Context(), claims.UserID, limit, cursor)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// An empty body marks all notifications as read
+	request := dto.MarkReadRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.MarkRead(r.Context(), claims.UserID, &request)
+	if errors.Is(err, service.ErrInvalidNotificationID) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := h.Service.UnreadCount(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// A stream follows the comments of at most this many posts
+const maxPostSubscriptions = 50
+
+// Events streams the events sent to everyone together with the
+// notifications of the signed in user. The comment events of posts are
+// included for the comma separated ids in the posts query parameter, if the
+// user can see them.
+func (h *NotificationHandler) Events(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var postIds []string
+	if posts := r.URL.Query().Get("posts"); posts != "" {
+		for _, postId := range strings.Split(posts, ",") {
+			if postId != "" {
+				postIds = append(postIds, postId)
+			}
+		}
+	}
+
+	if len(postIds) > maxPostSubscriptions {
+		http.Error(w, "too many posts", http.StatusBadRequest)
+		return
+	}
+
+	topics := make([]string, 0, len(postIds))
+	for _, postId := range postIds {
+		err := h.Posts.CheckCanSeePost(r.Context(), claims.UserID, postId)
+		if errors.Is(err, service.ErrPostNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		topics = append(topics, entity.PostTopic(postId))
+	}
+
+	h.Broker.Serve(w, r, claims.UserID, topics...)
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"regexp"
 
@@ -39,32 +41,41 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var re = regexp.MustCompile("[\u0000-\u0009\u000B-\u000C\u000E-\u001F\u00A0\u115F\u1160\u2000-\u200D\u202A-\u202F\u205F\u2060\u3000\u3164\uFEFF]")
 	request.Text = re.ReplaceAllString(request.Text, "")
 
-	if request.Text == "" && request.Image == "" {
+	if request.Text == "" && request.Image == "" && len(request.Media) == 0 && request.ReferencedPostID == "" {
 		http.Error(w, "post cannot be empty", http.StatusBadRequest)
 		return
 	}
 
+	if request.Image != "" && len(request.Media) > 0 {
+		http.Error(w, "set either image or media", http.StatusBadRequest)
+		return
+	}
+
 	if len(request.Text) > 280 {
 		http.Error(w, "post length exceeds the maximum", http.StatusBadRequest)
 		return
 	}
 
 	post, err := h.Service.Create(r.Context(), claims.UserID, claims.UserName, &request)
+	if errors.Is(err, service.ErrPostNotFound) {
+		http.Error(w, "referenced post not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidImage) || errors.Is(err, service.ErrInvalidMedia) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	eventData, err := json.Marshal(post)
+	event, err := h.Service.PostEvent(r.Context(), "new_post", post)
 	if err != nil {
 		http.Error(w, "Failed to create post", http.StatusInternalServerError)
 		return
 	}
-	event := entity.SSEEvent{
-		Name: "new_post",
-		Data: string(eventData),
-	}
-	h.Broker.Messages <- event
+	h.Broker.Publish(r.Context(), event)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -76,14 +87,30 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *PostHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	posts, err := h.Service.GetAll(r.Context())
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Service.GetAll(r.Context(), claims.UserID, limit, cursor)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(posts)
+	err = json.NewEncoder(w).Encode(page)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -91,9 +118,19 @@ func (h *PostHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *PostHandler) GetByUserID(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	userId := r.PathValue("user_id")
 
-	posts, err := h.Service.GetByUserID(r.Context(), userId)
+	posts, err := h.Service.GetByUserID(r.Context(), claims.UserID, userId)
+	if errors.Is(err, service.ErrPrivateAccount) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -127,32 +164,37 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 	var re = regexp.MustCompile(`[\x{200B}-\x{200D}\x{FEFF}\x{2060}-\x{206F}]`)
 	request.Text = re.ReplaceAllString(request.Text, "")
 
-	if request.Text == "" && request.Image == "" {
+	if request.Text == "" && request.Image == "" && len(request.Media) == 0 {
 		http.Error(w, "post cannot be empty", http.StatusBadRequest)
 		return
 	}
 
+	if request.Image != "" && len(request.Media) > 0 {
+		http.Error(w, "set either image or media", http.StatusBadRequest)
+		return
+	}
+
 	if len(request.Text) > 280 {
 		http.Error(w, "post length exceeds the maximum", http.StatusBadRequest)
 		return
 	}
 
 	updatedPost, err := h.Service.Update(r.Context(), userId, postId, &request)
+	if errors.Is(err, service.ErrInvalidImage) || errors.Is(err, service.ErrInvalidMedia) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	eventData, err := json.Marshal(updatedPost)
+	event, err := h.Service.PostEvent(r.Context(), "update_post", updatedPost)
 	if err != nil {
 		http.Error(w, "Failed to create post", http.StatusInternalServerError)
 		return
 	}
-	event := entity.SSEEvent{
-		Name: "update_post",
-		Data: string(eventData),
-	}
-	h.Broker.Messages <- event
+	h.Broker.Publish(r.Context(), event)
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(updatedPost)
@@ -184,10 +226,75 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	event := entity.SSEEvent{
-		Name: "delete_post",
-		Data: string(eventData),
+		Name:     "delete_post",
+		Data:     string(eventData),
+		Audience: h.Service.EventAudience(r.Context(), userId),
+		ActorID:  userId,
 	}
-	h.Broker.Messages <- event
+	h.Broker.Publish(r.Context(), event)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *PostHandler) Like(w http.ResponseWriter, r *http.Request) {
+	h.toggleLike(w, r, h.Service.Like)
+}
+
+func (h *PostHandler) Unlike(w http.ResponseWriter, r *http.Request) {
+	h.toggleLike(w, r, func(ctx context.Context, userId, _, postId string) (*dto.Like, error) {
+		return h.Service.Unlike(ctx, userId, postId)
+	})
+}
+
+func (h *PostHandler) toggleLike(w http.ResponseWriter, r *http.Request, toggle func(ctx context.Context, userId, userName, postId string) (*dto.Like, error)) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	postId := r.PathValue("post_id")
+	if postId == "" {
+		http.Error(w, "post id cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	like, err := toggle(r.Context(), claims.UserID, claims.UserName, postId)
+	switch {
+	case errors.Is(err, service.ErrPostNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrAlreadyLiked), errors.Is(err, service.ErrNotLiked):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// liked_by_me only holds for the user who liked, so send it as "liked"
+	eventData, err := json.Marshal(map[string]any{
+		"post_id":    like.PostID,
+		"user_id":    like.UserID,
+		"like_count": like.LikeCount,
+		"liked":      like.LikedByMe,
+	})
+	if err != nil {
+		http.Error(w, "Failed to like post", http.StatusInternalServerError)
+		return
+	}
+	event := entity.SSEEvent{
+		Name:     "like_post",
+		Data:     string(eventData),
+		Audience: h.Service.EventAudience(r.Context(), like.AuthorID),
+		ActorID:  claims.UserID,
+	}
+	h.Broker.Publish(r.Context(), event)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(like)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -4,22 +4,19 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"os"
-	"time"
+	"path"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
 	"github.com/google/uuid"
 )
 
-type S3PresignHandler struct {
-	PresignClient *s3.PresignClient
+type PresignHandler struct {
+	Blobs repository.BlobStore
 }
 
-func NewS3PresignHandler(client *s3.PresignClient) *S3PresignHandler {
-	return &S3PresignHandler{
-		PresignClient: client,
+func NewPresignHandler(blobs repository.BlobStore) *PresignHandler {
+	return &PresignHandler{
+		Blobs: blobs,
 	}
 }
 
@@ -34,37 +31,39 @@ type PresignResponse struct {
 	Key string `json:"key"`
 }
 
-func (p *S3PresignHandler) Upload(w http.ResponseWriter, r *http.Request) {
-	var reqBody PresignRequest
-	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+func (p *PresignHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
 		return
 	}
 
-	bucketName := os.Getenv("BUCKET_NAME")
-	if bucketName == "" {
-		http.Error(w, "Undefined bucket name", http.StatusInternalServerError)
+	// Without a blob storage there is nowhere to upload to
+	if p.Blobs == nil {
+		http.Error(w, "Image uploads are not supported by this storage", http.StatusNotImplemented)
 		return
 	}
 
-	uuid := uuid.New().String()
-	objectKey := "uploads/" + uuid + "_" + reqBody.FileName
+	var reqBody PresignRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
-	presignRequest, err := p.PresignClient.PresignPutObject(r.Context(), &s3.PutObjectInput{
-		Bucket:            aws.String(bucketName),
-		Key:               aws.String(objectKey),
-		ContentType:       aws.String(reqBody.FileType),
-		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
-		ChecksumSHA256:    &reqBody.FileHash,
-	}, s3.WithPresignExpires(*aws.Duration(15 * time.Minute)))
+	// Uploads are kept per user, so only their uploader can attach them to a
+	// post. Only the base name is kept, so the key has no further path
+	// segments.
+	uuid := uuid.New().String()
+	objectKey := "uploads/" + claims.UserID + "/" + uuid + "_" + path.Base(reqBody.FileName)
 
+	url, err := p.Blobs.PresignUpload(r.Context(), objectKey, reqBody.FileType, reqBody.FileHash)
 	if err != nil {
-		log.Printf("Couldn't get a presigned request to put %s in bucket %s. Here's why: %v\n", reqBody.FileName, bucketName, err)
+		log.Printf("Couldn't get a presigned request to put %s. Here's why: %v\n", reqBody.FileName, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	response := PresignResponse{URL: presignRequest.URL, Key: objectKey}
+	response := PresignResponse{URL: url, Key: objectKey}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
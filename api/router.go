@@ -14,30 +14,62 @@ func NewRouter(h *Handlers, jwtSecret string) *http.ServeMux {
 	mux.HandleFunc("GET /ping", h.PingHandler.Ping)
 
 	mux.Handle("GET /me", authMiddleware(http.HandlerFunc(h.UserHandler.Me)))
+	mux.Handle("PUT /me/settings", authMiddleware(http.HandlerFunc(h.UserHandler.UpdateSettings)))
+	mux.Handle("GET /me/follow_requests", authMiddleware(http.HandlerFunc(h.UserHandler.FollowRequests)))
+	mux.Handle("POST /me/follow_requests/{id}/approve", authMiddleware(http.HandlerFunc(h.UserHandler.ApproveFollowRequest)))
+	mux.Handle("POST /me/follow_requests/{id}/reject", authMiddleware(http.HandlerFunc(h.UserHandler.RejectFollowRequest)))
 	mux.HandleFunc("POST /users", h.UserHandler.Create)
 	mux.Handle("GET /users/{id}", authMiddleware(http.HandlerFunc(h.UserHandler.GetByID)))
 	mux.HandleFunc("GET /users", h.UserHandler.GetAll)
+	mux.Handle("GET /users/{id}/followers", authMiddleware(http.HandlerFunc(h.UserHandler.GetFollowers)))
+	mux.Handle("GET /users/{id}/following", authMiddleware(http.HandlerFunc(h.UserHandler.GetFollowing)))
 	mux.Handle("POST /users/follow", authMiddleware(http.HandlerFunc(h.UserHandler.Follow)))
 	mux.Handle("DELETE /users/unfollow", authMiddleware(http.HandlerFunc(h.UserHandler.Unfollow)))
+	mux.Handle("POST /users/{id}/block", authMiddleware(http.HandlerFunc(h.UserHandler.Block)))
+	mux.Handle("DELETE /users/{id}/block", authMiddleware(http.HandlerFunc(h.UserHandler.Unblock)))
+	mux.Handle("POST /users/{id}/mute", authMiddleware(http.HandlerFunc(h.UserHandler.Mute)))
+	mux.Handle("DELETE /users/{id}/mute", authMiddleware(http.HandlerFunc(h.UserHandler.Unmute)))
 
 	mux.Handle("POST /posts", authMiddleware(http.HandlerFunc(h.PostHandler.Create)))
 	mux.Handle("GET /posts", authMiddleware(http.HandlerFunc(h.PostHandler.GetAll)))
 	mux.Handle("GET /posts/{user_id}", authMiddleware(http.HandlerFunc(h.PostHandler.GetByUserID)))
+	mux.Handle("POST /posts/{post_id}/likes", authMiddleware(http.HandlerFunc(h.PostHandler.Like)))
+	mux.Handle("DELETE /posts/{post_id}/likes", authMiddleware(http.HandlerFunc(h.PostHandler.Unlike)))
 	mux.Handle("PUT /users/{user_id}/posts/{post_id}", authMiddleware(http.HandlerFunc(h.PostHandler.Update)))
 	mux.Handle("DELETE /users/{user_id}/posts/{post_id}", authMiddleware(http.HandlerFunc(h.PostHandler.Delete)))
 
+	mux.Handle("GET /timeline/home", authMiddleware(http.HandlerFunc(h.TimelineHandler.Home)))
+
 	mux.Handle("POST /posts/{post_id}/comments", authMiddleware(http.HandlerFunc(h.CommentHandler.Create)))
 	mux.Handle("GET /posts/{post_id}/comments", authMiddleware(http.HandlerFunc(h.CommentHandler.GetByPostID)))
 	mux.Handle("PUT /users/{user_id}/posts/{post_id}/comments/{comment_id}", authMiddleware(http.HandlerFunc(h.CommentHandler.Update)))
 	mux.Handle("DELETE /users/{user_id}/posts/{post_id}/comments/{comment_id}", authMiddleware(http.HandlerFunc(h.CommentHandler.Delete)))
 
-	mux.Handle("POST /presign", authMiddleware(http.HandlerFunc(h.S3PresignHandler.Upload)))
+	mux.Handle("GET /tags/trending", authMiddleware(http.HandlerFunc(h.TagHandler.Trending)))
+	mux.Handle("GET /tags/{tag}/posts", authMiddleware(http.HandlerFunc(h.TagHandler.GetPosts)))
+
+	mux.Handle("GET /notifications", authMiddleware(http.HandlerFunc(h.NotificationHandler.List)))
+	mux.Handle("POST /notifications/read", authMiddleware(http.HandlerFunc(h.NotificationHandler.MarkRead)))
+	mux.Handle("GET /notifications/unread_count", authMiddleware(http.HandlerFunc(h.NotificationHandler.UnreadCount)))
+
+	mux.Handle("POST /conversations", authMiddleware(http.HandlerFunc(h.MessageHandler.CreateConversation)))
+	mux.Handle("GET /conversations", authMiddleware(http.HandlerFunc(h.MessageHandler.ListConversations)))
+	mux.Handle("GET /conversations/{id}/messages", authMiddleware(http.HandlerFunc(h.MessageHandler.ListMessages)))
+	mux.Handle("POST /conversations/{id}/messages", authMiddleware(http.HandlerFunc(h.MessageHandler.Send)))
+	mux.Handle("POST /conversations/{id}/read", authMiddleware(http.HandlerFunc(h.MessageHandler.MarkRead)))
+
+	mux.Handle("GET /search", authMiddleware(http.HandlerFunc(h.SearchHandler.Search)))
+
+	mux.Handle("POST /presign", authMiddleware(http.HandlerFunc(h.PresignHandler.Upload)))
+	mux.HandleFunc("PUT "+BlobPath+"/{key...}", h.BlobHandler.Upload)
+	mux.HandleFunc("GET "+BlobPath+"/{key...}", h.BlobHandler.Download)
 
 	mux.HandleFunc("/auth/google/login", h.AuthHandler.Login)
 	mux.HandleFunc("/auth/google/callback", h.AuthHandler.Callback)
 	mux.HandleFunc("/auth/logout", h.AuthHandler.Logout)
 
-	mux.Handle("/events", authMiddleware(http.HandlerFunc(h.Broker.ServeHTTP)))
+	mux.Handle("/events", authMiddleware(http.HandlerFunc(h.NotificationHandler.Events)))
+	mux.Handle("GET /ws", authMiddleware(http.HandlerFunc(h.WebSocketHandler.Serve)))
 
 	return mux
 }
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/service"
+)
+
+const defaultTrendingSize = 10
+
+type TagHandler struct {
+	PostService     service.PostService
+	TrendingService service.TrendingService
+}
+
+func NewTagHandler(postService service.PostService, trendingService service.TrendingService) *TagHandler {
+	return &TagHandler{
+		PostService:     postService,
+		TrendingService: trendingService,
+	}
+}
+
+func (h *TagHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.PostService.GetByTag(r.Context(), claims.UserID, r.PathValue("tag"), limit, cursor)
+	if errors.Is(err, service.ErrInvalidTag) || errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *TagHandler) Trending(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTrendingSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			http.Error(w, errInvalidLimit.Error(), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	tags := h.TrendingService.Trending(r.Context(), limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
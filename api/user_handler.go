@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -38,10 +40,32 @@ func (h *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blocked, err := h.service.GetBlockedIDs(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	muted, err := h.service.GetMutedIDs(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	response := dto.UserProfileResponse{
-		ID:        claims.UserID,
-		Name:      user.Name,
-		Following: following.FollowingIDs,
+		ID:             claims.UserID,
+		Name:           user.Name,
+		Handle:         user.Handle,
+		Following:      following.FollowingIDs,
+		Blocked:        blocked,
+		Muted:          muted,
+		FollowersCount: user.FollowersCount,
+		FollowingCount: user.FollowingCount,
+		PostsCount:     user.PostsCount,
+		Settings: dto.UserSettings{
+			DMsFollowingOnly: user.DMsFollowingOnly,
+			Private:          user.Private,
+		},
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -104,6 +128,44 @@ func (h *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
+func (h *UserHandler) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.listUsers(w, r, h.service.ListFollowers)
+}
+
+func (h *UserHandler) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	h.listUsers(w, r, h.service.ListFollowing)
+}
+
+func (h *UserHandler) listUsers(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error)) {
+	id := r.PathValue("id")
+
+	if id == "" {
+		log.Printf("id is empty")
+		http.Error(w, "id cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := list(r.Context(), id, limit, cursor)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
 func (h *UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
 	if !ok {
@@ -124,13 +186,36 @@ func (h *UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
 	}
 
 	follow, err := h.service.Follow(r.Context(), claims.UserID, &request)
+	switch {
+	case errors.Is(err, service.ErrCannotFollowSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrAlreadyFollowing):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, service.ErrAlreadyRequested):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Private users have to approve the follow first
+	status := http.StatusCreated
+	if follow.Pending {
+		status = http.StatusAccepted
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(follow)
 }
 
@@ -154,6 +239,117 @@ func (h *UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := h.service.Unfollow(r.Context(), claims.UserID, &request)
+	if errors.Is(err, service.ErrNotFollowing) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	request := dto.UpdateSettingsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.service.UpdateSettings(r.Context(), claims.UserID, &request)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (h *UserHandler) Block(w http.ResponseWriter, r *http.Request) {
+	h.toggleRelation(w, r, h.service.Block)
+}
+
+func (h *UserHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	h.toggleRelation(w, r, h.service.Unblock)
+}
+
+func (h *UserHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	h.toggleRelation(w, r, h.service.Mute)
+}
+
+func (h *UserHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	h.toggleRelation(w, r, h.service.Unmute)
+}
+
+// toggleRelation blocks, unblocks, mutes or unmutes the user in the path for
+// the signed in user
+func (h *UserHandler) toggleRelation(w http.ResponseWriter, r *http.Request, toggle func(ctx context.Context, userID, otherID string) error) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		log.Printf("id is empty")
+		http.Error(w, "id cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	err := toggle(r.Context(), claims.UserID, id)
+	switch {
+	case errors.Is(err, service.ErrCannotBlockSelf), errors.Is(err, service.ErrCannotMuteSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrNotBlocked), errors.Is(err, service.ErrNotMuted):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrAlreadyBlocked), errors.Is(err, service.ErrAlreadyMuted):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) FollowRequests(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.ListFollowRequests(r.Context(), claims.UserID, limit, cursor)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -161,4 +357,45 @@ func (h *UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *UserHandler) ApproveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	h.answerFollowRequest(w, r, h.service.ApproveFollowRequest)
+}
+
+func (h *UserHandler) RejectFollowRequest(w http.ResponseWriter, r *http.Request) {
+	h.answerFollowRequest(w, r, h.service.RejectFollowRequest)
+}
+
+// answerFollowRequest approves or rejects the request of the user in the path
+func (h *UserHandler) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer func(ctx context.Context, userID, requesterID string) error) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		log.Printf("id is empty")
+		http.Error(w, "id cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	err := answer(r.Context(), claims.UserID, id)
+	switch {
+	case errors.Is(err, service.ErrRequestNotFound), errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrAlreadyFollowing):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
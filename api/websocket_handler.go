@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/service"
+	"github.com/HENNGE/snsclone-202506-golang-luca/websocket"
+)
+
+// Messages sent by clients
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsTyping      = "typing"
+	wsAck         = "ack"
+)
+
+// typingInterval is how often a connection may publish typing indicators for
+// a post. Indicators go through the event bus to every instance, clients
+// sending one per keystroke are only forwarded once per interval.
+const typingInterval = 3 * time.Second
+
+// wsClientMessage is a message from a client. Ref is echoed in the reply so
+// clients can match them.
+type wsClientMessage struct {
+	Type   string `json:"type"`
+	Ref    string `json:"ref,omitempty"`
+	PostID string `json:"post_id,omitempty"`
+	// ID is the last event the client processed, sent with acks
+	ID string `json:"id,omitempty"`
+}
+
+// wsServerMessage is an event or the reply to a client message
+type wsServerMessage struct {
+	Type  string          `json:"type"`
+	Ref   string          `json:"ref,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type WebSocketHandler struct {
+	Posts  service.PostService
+	Broker *entity.Broker
+}
+
+func NewWebSocketHandler(posts service.PostService, broker *entity.Broker) *WebSocketHandler {
+	return &WebSocketHandler{
+		Posts:  posts,
+		Broker: broker,
+	}
+}
+
+// sameOrigin rejects handshakes started by other sites. Browsers send the
+// auth cookie with WebSocket requests from any origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == r.Host
+}
+
+// Serve carries the same events as /events over a WebSocket. Clients can
+// resume with the last_event_id query parameter, subscribe to the comments of
+// a post, send typing indicators and acknowledge events.
+func (h *WebSocketHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(userClaimsKey).(*AppClaims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if !sameOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r)
+	if err != nil {
+		log.Printf("failed to accept websocket: %v", err)
+		return
+	}
+	defer conn.Close(websocket.CloseGoingAway, "")
+
+	s, missed := h.Broker.Subscribe(r.Context(), claims.UserID, r.URL.Query().Get("last_event_id"))
+	defer func() {
+		h.Broker.Unsubscribe(s)
+	}()
+
+	// Kept to restore the subscription after the client fell behind
+	topics := map[string]bool{}
+	lastAcked := ""
+	lastSent := ""
+	// Last typing indicator published for each subscribed post
+	typing := map[string]time.Time{}
+
+	for _, event := range missed {
+		err := writeWebSocketEvent(conn, event)
+		if err != nil {
+			return
+		}
+		lastSent = event.ID
+	}
+
+	incoming := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(incoming)
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				var closeErr *websocket.CloseError
+				if !errors.As(err, &closeErr) && !errors.Is(err, io.EOF) {
+					log.Printf("failed to read websocket message: %v", err)
+				}
+				return
+			}
+			select {
+			case incoming <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(entity.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-s.Messages:
+			if !ok {
+				// The client fell behind, resubscribe and send what it has
+				// not acknowledged yet
+				resumeFrom := lastAcked
+				if resumeFrom == "" {
+					resumeFrom = lastSent
+				}
+
+				s, missed = h.Broker.Subscribe(r.Context(), claims.UserID, resumeFrom, slices.Collect(maps.Keys(topics))...)
+
+				for _, event := range missed {
+					err := writeWebSocketEvent(conn, event)
+					if err != nil {
+						return
+					}
+					lastSent = event.ID
+				}
+				continue
+			}
+
+			err := writeWebSocketEvent(conn, event)
+			if err != nil {
+				return
+			}
+			lastSent = event.ID
+		case message, ok := <-incoming:
+			if !ok {
+				return
+			}
+
+			request := wsClientMessage{}
+			err := json.Unmarshal(message, &request)
+			if err != nil {
+				writeWebSocketReply(conn, wsServerMessage{Type: "error", Error: "invalid message"})
+				continue
+			}
+
+			reply := wsServerMessage{Type: "ok", Ref: request.Ref}
+
+			switch request.Type {
+			case wsSubscribe, wsUnsubscribe, wsTyping:
+				if request.PostID == "" {
+					reply = wsServerMessage{Type: "error", Ref: request.Ref, Error: "post id cannot be empty"}
+					break
+				}
+
+				topic := entity.PostTopic(request.PostID)
+				switch request.Type {
+				case wsSubscribe:
+					if topics[topic] {
+						break
+					}
+					if len(topics) >= maxPostSubscriptions {
+						reply = wsServerMessage{Type: "error", Ref: request.Ref, Error: "too many posts"}
+						break
+					}
+					err := h.Posts.CheckCanSeePost(r.Context(), claims.UserID, request.PostID)
+					if errors.Is(err, service.ErrPostNotFound) {
+						reply = wsServerMessage{Type: "error", Ref: request.Ref, Error: err.Error()}
+						break
+					}
+					if err != nil {
+						log.Printf("failed to check post %s: %v", request.PostID, err)
+						reply = wsServerMessage{Type: "error", Ref: request.Ref, Error: "internal error"}
+						break
+					}
+					topics[topic] = true
+					h.Broker.SubscribeTopic(s, topic)
+				case wsUnsubscribe:
+					delete(topics, topic)
+					delete(typing, request.PostID)
+					h.Broker.UnsubscribeTopic(s, topic)
+				case wsTyping:
+					// Subscribing checked that the user can see the post
+					if !topics[topic] {
+						reply = wsServerMessage{Type: "error", Ref: request.Ref, Error: "not subscribed to the post"}
+						break
+					}
+					if time.Since(typing[request.PostID]) < typingInterval {
+						break
+					}
+					typing[request.PostID] = time.Now()
+					h.Broker.Publish(r.Context(), typingEvent(claims, request.PostID))
+				}
+			case wsAck:
+				lastAcked = request.ID
+			default:
+				reply = wsServerMessage{Type: "error", Ref: request.Ref, Error: "unknown message type"}
+			}
+
+			err = writeWebSocketReply(conn, reply)
+			if err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			err := conn.Ping()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// typingEvent tells the other readers of a post that the user is writing a
+// comment
+func typingEvent(claims *AppClaims, postId string) entity.SSEEvent {
+	data, _ := json.Marshal(map[string]string{
+		"post_id":   postId,
+		"user_id":   claims.UserID,
+		"user_name": claims.UserName,
+	})
+
+	return entity.SSEEvent{
+		Name:      "typing",
+		Data:      string(data),
+		Audience:  entity.ToTopic(entity.PostTopic(postId)),
+		Transient: true,
+		ActorID:   claims.UserID,
+	}
+}
+
+func writeWebSocketEvent(conn *websocket.Conn, event entity.SSEEvent) error {
+	return writeWebSocketReply(conn, wsServerMessage{
+		Type:  "event",
+		ID:    event.ID,
+		Event: event.Name,
+		Data:  json.RawMessage(event.Data),
+	})
+}
+
+func writeWebSocketReply(conn *websocket.Conn, message wsServerMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(data)
+}
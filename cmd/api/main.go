@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/api"
 	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 	"github.com/HENNGE/snsclone-202506-golang-luca/frontend"
 	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
 	"github.com/HENNGE/snsclone-202506-golang-luca/service"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/joho/godotenv"
@@ -25,37 +32,102 @@ func main() {
 		log.Printf("No .env file found")
 	}
 
-	awsRegion, exists := os.LookupEnv("AWS_REGION")
-	if !exists {
-		log.Fatal("Undefined AWS region")
-	}
+	storage := os.Getenv("STORAGE")
 
-	awsEndpoint, exists := os.LookupEnv("AWS_ENDPOINT")
-	if !exists {
-		log.Print("Undefined AWS endpoint, falling back to default")
+	// Images are kept in S3 by default with the dynamodb storage. The local
+	// blob storage keeps them on disk and serves them from this server.
+	blobStorage := os.Getenv("BLOB_STORAGE")
+	if blobStorage == "" && (storage == "" || storage == "dynamodb") {
+		blobStorage = "s3"
 	}
 
-	db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
-	if err != nil {
-		log.Fatal("Failed to get database")
-	}
+	var blobs repository.BlobStore
+	switch blobStorage {
+	case "s3":
+		s3Client, err := database.GetS3Client(ctx, os.Getenv("AWS_REGION"), os.Getenv("AWS_ENDPOINT"))
+		if err != nil {
+			log.Fatal("Failed to get s3 client")
+		}
 
-	s3Client, err := database.GetS3Client(ctx, awsRegion, awsEndpoint)
-	if err != nil {
-		log.Fatal("Failed to get s3 client")
-	}
+		bucketName := os.Getenv("BUCKET_NAME")
+		if bucketName == "" {
+			log.Fatal("Undefined bucket name")
+			return
+		}
 
-	presignClient := s3.NewPresignClient(s3Client)
+		blobs = repository.NewS3BlobStore(s3Client, s3.NewPresignClient(s3Client), bucketName)
+	case "local":
+		blobDir, exists := os.LookupEnv("BLOB_DIR")
+		if !exists {
+			log.Fatal("Undefined blob directory")
+		}
 
-	tableName, exists := os.LookupEnv("TABLE_NAME")
-	if !exists {
-		log.Fatal("Undefined table name")
+		blobSecret, exists := os.LookupEnv("BLOB_SECRET")
+		if !exists {
+			log.Fatal("Undefined blob secret")
+		}
+
+		localBlobs, err := repository.NewLocalBlobStore(blobDir, api.BlobPath, blobSecret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		blobs = localBlobs
+	case "":
+		log.Print("No blob storage, posts cannot have images")
+	default:
+		log.Fatalf("Unknown blob storage %q", blobStorage)
 	}
 
-	bucketName := os.Getenv("BUCKET_NAME")
-	if bucketName == "" {
-		log.Fatal("Undefined bucket name")
-		return
+	// With STORAGE=memory nothing is persisted and no AWS account is needed,
+	// sqlite and postgres keep the data in a SQL database instead of DynamoDB
+	var repositories *repository.Repositories
+	var db *dynamodb.Client
+	var awsRegion, awsEndpoint, tableName string
+
+	switch storage {
+	case "", "dynamodb":
+		var exists bool
+		awsRegion, exists = os.LookupEnv("AWS_REGION")
+		if !exists {
+			log.Fatal("Undefined AWS region")
+		}
+
+		awsEndpoint, exists = os.LookupEnv("AWS_ENDPOINT")
+		if !exists {
+			log.Print("Undefined AWS endpoint, falling back to default")
+		}
+
+		var err error
+		db, err = database.GetDatabase(ctx, awsRegion, awsEndpoint)
+		if err != nil {
+			log.Fatal("Failed to get database")
+		}
+
+		tableName, exists = os.LookupEnv("TABLE_NAME")
+		if !exists {
+			log.Fatal("Undefined table name")
+		}
+
+		repositories = repository.InitRepositories(db, blobs, tableName)
+	case "memory":
+		log.Print("Keeping all data in memory")
+		repositories = repository.InitMemoryRepositories(blobs)
+	case "sqlite", "postgres":
+		databaseUrl, exists := os.LookupEnv("DATABASE_URL")
+		if !exists {
+			log.Fatal("Undefined database url")
+		}
+
+		store, err := repository.OpenSQLStore(ctx, storage, databaseUrl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+
+		log.Printf("Storing data in %s", storage)
+		repositories = repository.InitSQLRepositories(store, blobs)
+	default:
+		log.Fatalf("Unknown storage %q", storage)
 	}
 
 	clientID, exists := os.LookupEnv("GOOGLE_OAUTH2_CLIENT_ID")
@@ -108,12 +180,83 @@ func main() {
 	// the frontend folder
 	fs := http.FileServer(http.FS(frontend.DistFS))
 
-	repositories := repository.InitRepositories(db, s3Client, presignClient, tableName, bucketName)
-	services := service.InitServices(repositories)
-	handlers := api.InitHandlers(services, authConfig, fs, presignClient)
+	// Without a path the search index only lives in memory
+	index, err := search.Open(os.Getenv("SEARCH_INDEX_PATH"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The index is saved one last time after the server stopped, so no
+	// request changes it afterwards
+	saveCtx, stopSaving := context.WithCancel(ctx)
+	saved := make(chan struct{})
+	go func() {
+		index.AutoSave(saveCtx, 30*time.Second)
+		close(saved)
+	}()
+
+	// With several instances behind a load balancer, events are passed
+	// between them through the stream of the table
+	var bus entity.EventBus = entity.NewMemoryBus()
+	if os.Getenv("EVENT_BUS") == "dynamodb" {
+		if db == nil {
+			log.Fatal("The dynamodb event bus needs the dynamodb storage")
+		}
+
+		streams, err := database.GetStreamsClient(ctx, awsRegion, awsEndpoint)
+		if err != nil {
+			log.Fatal("Failed to get streams client")
+		}
+
+		dynamoBus := repository.NewDynamoEventBus(db, streams, tableName)
+		go func() {
+			err := dynamoBus.Run(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}()
+		bus = dynamoBus
+	}
+
+	// Services and handlers publish events to the same clients, and changes
+	// to the search index to every instance
+	broker := entity.NewBroker(repositories.UserRepository.GetFollowerIDs, service.HiddenUsersFunc(repositories.UserRepository), bus)
+	services, err := service.InitServices(repositories, os.Getenv("TIMELINE_STRATEGY"), search.Share(index, bus), broker)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go services.TrendingService.Run(ctx)
+
+	handlers := api.InitHandlers(services, authConfig, fs, blobs, broker)
 
 	router := api.NewRouter(handlers, secret)
 
+	server := &http.Server{Addr: fmt.Sprintf(":%s", port), Handler: router}
+
+	// On SIGINT or SIGTERM the server waits for running requests before the
+	// index is saved. Event streams never finish, so the wait is limited.
+	stopped := make(chan struct{})
+	go func() {
+		signals, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-signals.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("Failed to shut down gracefully: %v", err)
+		}
+		close(stopped)
+	}()
+
 	log.Printf("Listening on %s", baseUrl)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), router))
+	err = server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+
+	<-stopped
+	stopSaving()
+	<-saved
 }
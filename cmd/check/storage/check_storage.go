@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository/conformance"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/joho/godotenv"
+)
+
+// OpenStorage creates the repositories of a storage backend. The returned
+// function releases them.
+func OpenStorage(ctx context.Context, storage string) (*repository.Repositories, func(), error) {
+	switch storage {
+	case "memory":
+		return repository.InitMemoryRepositories(nil), func() {}, nil
+	case "sqlite":
+		// A fresh database, so the checks start from an empty schema
+		dir, err := os.MkdirTemp("", "check_storage")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		store, err := repository.OpenSQLStore(ctx, "sqlite", filepath.Join(dir, "check.db"))
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, nil, err
+		}
+
+		return repository.InitSQLRepositories(store, nil), func() {
+			store.Close()
+			os.RemoveAll(dir)
+		}, nil
+	case "postgres":
+		databaseUrl, exists := os.LookupEnv("DATABASE_URL")
+		if !exists {
+			return nil, nil, fmt.Errorf("undefined database url")
+		}
+
+		store, err := repository.OpenSQLStore(ctx, "postgres", databaseUrl)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return repository.InitSQLRepositories(store, nil), func() { store.Close() }, nil
+	case "dynamodb":
+		awsRegion, exists := os.LookupEnv("AWS_REGION")
+		if !exists {
+			return nil, nil, fmt.Errorf("undefined AWS region")
+		}
+
+		awsEndpoint := os.Getenv("AWS_ENDPOINT")
+
+		db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get database: %w", err)
+		}
+
+		s3Client, err := database.GetS3Client(ctx, awsRegion, awsEndpoint)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get s3 client: %w", err)
+		}
+
+		tableName, exists := os.LookupEnv("TABLE_NAME")
+		if !exists {
+			return nil, nil, fmt.Errorf("undefined table name")
+		}
+
+		blobs := repository.NewS3BlobStore(s3Client, s3.NewPresignClient(s3Client), os.Getenv("BUCKET_NAME"))
+		repositories := repository.InitRepositories(db, blobs, tableName)
+		return repositories, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage %q", storage)
+	}
+}
+
+// Runs the conformance checks against the storage backends given as
+// arguments, by default against memory and a temporary SQLite database.
+// Postgres and DynamoDB are configured like for the API. The checks write
+// data, so only point them at a database or table used for testing.
+func main() {
+	ctx := context.Background()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found")
+	}
+
+	storages := os.Args[1:]
+	if len(storages) == 0 {
+		storages = []string{"memory", "sqlite"}
+	}
+
+	failed := false
+	for _, storage := range storages {
+		repositories, release, err := OpenStorage(ctx, storage)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", storage, err)
+		}
+
+		failures := conformance.RunAll(ctx, repositories)
+		release()
+
+		for _, failure := range failures {
+			log.Printf("%s: %v", storage, failure)
+		}
+		if len(failures) > 0 {
+			failed = true
+			continue
+		}
+
+		log.Printf("%s: all %d checks passed", storage, len(conformance.Checks))
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/database"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -88,11 +89,34 @@ func InitTable(ctx context.Context, client *dynamodb.Client, tableName string) e
 		AttributeDefinitions:   attributeDefinitions,
 		GlobalSecondaryIndexes: gsi,
 		BillingMode:            types.BillingModePayPerRequest,
+		// The stream passes events between API instances
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewImage,
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create table %s: %w", tableName, err)
 	}
 
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	err = waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: &tableName}, time.Minute)
+	if err != nil {
+		return fmt.Errorf("failed to wait for table %s: %w", tableName, err)
+	}
+
+	// Published events expire after an hour
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: &tableName,
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("expires_at"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable time to live on table %s: %w", tableName, err)
+	}
+
 	log.Printf("Table %s created successfully...\n", tableName)
 
 	return nil
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/joho/godotenv"
+)
+
+// QueryAll reads every page of a query and unmarshals the items into out
+func QueryAll(ctx context.Context, client *dynamodb.Client, input *dynamodb.QueryInput, out any) error {
+	var allRawItems []map[string]types.AttributeValue
+
+	paginator := dynamodb.NewQueryPaginator(client, input)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get next page of query results: %w", err)
+		}
+		allRawItems = append(allRawItems, page.Items...)
+	}
+
+	err := attributevalue.UnmarshalListOfMaps(allRawItems, out)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	return nil
+}
+
+func IndexUsers(ctx context.Context, client *dynamodb.Client, tableName string, index *search.Index) error {
+	var users []*entity.User
+	err := QueryAll(ctx, client, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "user"},
+		},
+	}, &users)
+	if err != nil {
+		return fmt.Errorf("failed to query users: %w", err)
+	}
+
+	for _, user := range users {
+		index.Put(search.UserDocument(user))
+	}
+
+	log.Printf("Indexed %d users\n", len(users))
+	return nil
+}
+
+func IndexPosts(ctx context.Context, client *dynamodb.Client, tableName string, index *search.Index) error {
+	var posts []*entity.Post
+	err := QueryAll(ctx, client, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String("gsi1"),
+		KeyConditionExpression: aws.String("gsi1_pk = :gsi1_pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":gsi1_pk": &types.AttributeValueMemberS{Value: "timeline"},
+		},
+	}, &posts)
+	if err != nil {
+		return fmt.Errorf("failed to query posts: %w", err)
+	}
+
+	comments := 0
+	for _, post := range posts {
+		index.PutPost(post)
+
+		var postComments []*entity.Comment
+		err := QueryAll(ctx, client, &dynamodb.QueryInput{
+			TableName:              aws.String(tableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":        &types.AttributeValueMemberS{Value: "post#" + post.ID},
+				":sk_prefix": &types.AttributeValueMemberS{Value: "comment#"},
+			},
+		}, &postComments)
+		if err != nil {
+			return fmt.Errorf("failed to query comments of post %s: %w", post.ID, err)
+		}
+
+		for _, comment := range postComments {
+			index.PutComment(post.ID, comment)
+		}
+		comments += len(postComments)
+	}
+
+	log.Printf("Indexed %d posts and %d comments\n", len(posts), comments)
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("No .env file found")
+	}
+
+	awsRegion, exists := os.LookupEnv("AWS_REGION")
+	if !exists {
+		log.Fatal("Undefined AWS region")
+	}
+
+	awsEndpoint, exists := os.LookupEnv("AWS_ENDPOINT")
+	if !exists {
+		log.Fatal("Undefined AWS endpoint")
+	}
+
+	db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
+	if err != nil {
+		log.Fatal("failed to get database: ", err)
+	}
+
+	tableName, exists := os.LookupEnv("TABLE_NAME")
+	if !exists {
+		log.Fatal("Undefined table name")
+	}
+
+	indexPath, exists := os.LookupEnv("SEARCH_INDEX_PATH")
+	if !exists {
+		log.Fatal("Undefined search index path")
+	}
+
+	// Start from an empty index so removed items do not survive a rebuild.
+	// The old file is only replaced once everything was indexed.
+	index := search.New()
+
+	err = IndexUsers(ctx, db, tableName, index)
+	if err != nil {
+		log.Fatal("Failed to index users: ", err)
+	}
+
+	err = IndexPosts(ctx, db, tableName, index)
+	if err != nil {
+		log.Fatal("Failed to index posts: ", err)
+	}
+
+	err = index.SaveTo(indexPath)
+	if err != nil {
+		log.Fatal("Failed to save search index: ", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/joho/godotenv"
+)
+
+// IndexComments adds the thread index key to every comment without one.
+// Comments written before comments were paged by thread are not listed until
+// then.
+func IndexComments(ctx context.Context, client *dynamodb.Client, tableName string) error {
+	posts := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String("gsi1"),
+		KeyConditionExpression: aws.String("gsi1_pk = :gsi1_pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":gsi1_pk": &types.AttributeValueMemberS{Value: "timeline"},
+		},
+		ProjectionExpression: aws.String("id"),
+	})
+
+	for posts.HasMorePages() {
+		page, err := posts.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query posts: %w", err)
+		}
+
+		var pagePosts []*entity.Post
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pagePosts)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal posts: %w", err)
+		}
+
+		for _, post := range pagePosts {
+			err = indexPostComments(ctx, client, tableName, post.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func indexPostComments(ctx context.Context, client *dynamodb.Client, tableName, postId string) error {
+	comments := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		FilterExpression:       aws.String("attribute_not_exists(gsi1_pk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: "post#" + postId},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "comment#"},
+		},
+	})
+
+	count := 0
+	for comments.HasMorePages() {
+		page, err := comments.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query comments of post %s: %w", postId, err)
+		}
+
+		var pageComments []*entity.Comment
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageComments)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal comments: %w", err)
+		}
+
+		for _, comment := range pageComments {
+			_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(tableName),
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: comment.PK},
+					"sk": &types.AttributeValueMemberS{Value: comment.SK},
+				},
+				UpdateExpression: aws.String("SET gsi1_pk = :gsi1_pk, gsi1_sk = :gsi1_sk"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":gsi1_pk": &types.AttributeValueMemberS{Value: entity.CommentThread(postId, comment.ParentID)},
+					":gsi1_sk": &types.AttributeValueMemberS{Value: strings.TrimPrefix(comment.SK, "comment#")},
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to index comment %s: %w", comment.SK, err)
+			}
+			count++
+		}
+	}
+
+	if count > 0 {
+		log.Printf("Post %s: indexed %d comments\n", postId, count)
+	}
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("No .env file found")
+	}
+
+	awsRegion, exists := os.LookupEnv("AWS_REGION")
+	if !exists {
+		log.Fatal("Undefined AWS region")
+	}
+
+	awsEndpoint, exists := os.LookupEnv("AWS_ENDPOINT")
+	if !exists {
+		log.Fatal("Undefined AWS endpoint")
+	}
+
+	db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
+	if err != nil {
+		log.Fatal("failed to get database: ", err)
+	}
+
+	tableName, exists := os.LookupEnv("TABLE_NAME")
+	if !exists {
+		log.Fatal("Undefined table name")
+	}
+
+	err = IndexComments(ctx, db, tableName)
+	if err != nil {
+		log.Fatal("Failed to index comments: ", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/joho/godotenv"
+)
+
+// CountItems counts the items in the partition of a user whose sort key
+// starts with the given prefix
+func CountItems(ctx context.Context, client *dynamodb.Client, tableName, userID, prefix string) (int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: "user#" + userID},
+			":sk_prefix": &types.AttributeValueMemberS{Value: prefix},
+		},
+		Select: types.SelectCount,
+	}
+
+	paginator := dynamodb.NewQueryPaginator(client, input)
+
+	count := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count %s items of user %s: %w", prefix, userID, err)
+		}
+		count += int(page.Count)
+	}
+
+	return count, nil
+}
+
+// RepairCounters recomputes the counters of every user. Follower counts are
+// read from the mirrored Follower items, so follows from before the follower
+// index need cmd/repair/followers first.
+func RepairCounters(ctx context.Context, client *dynamodb.Client, tableName string) error {
+	var users []*entity.User
+
+	paginator := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "user"},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query users: %w", err)
+		}
+
+		var pageUsers []*entity.User
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageUsers)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal users: %w", err)
+		}
+		users = append(users, pageUsers...)
+	}
+
+	for _, user := range users {
+		following, err := CountItems(ctx, client, tableName, user.ID, "follower#")
+		if err != nil {
+			return err
+		}
+
+		followers, err := CountItems(ctx, client, tableName, user.ID, "followed_by#")
+		if err != nil {
+			return err
+		}
+
+		posts, err := CountItems(ctx, client, tableName, user.ID, "post#")
+		if err != nil {
+			return err
+		}
+
+		_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(tableName),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: "user"},
+				"sk": &types.AttributeValueMemberS{Value: user.ID},
+			},
+			UpdateExpression: aws.String("SET followers_count = :followers, following_count = :following, posts_count = :posts"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":followers": &types.AttributeValueMemberN{Value: strconv.Itoa(followers)},
+				":following": &types.AttributeValueMemberN{Value: strconv.Itoa(following)},
+				":posts":     &types.AttributeValueMemberN{Value: strconv.Itoa(posts)},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update counters of user %s: %w", user.ID, err)
+		}
+
+		log.Printf("User %s: %d followers, %d following, %d posts\n", user.ID, followers, following, posts)
+	}
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("No .env file found")
+	}
+
+	awsRegion, exists := os.LookupEnv("AWS_REGION")
+	if !exists {
+		log.Fatal("Undefined AWS region")
+	}
+
+	awsEndpoint, exists := os.LookupEnv("AWS_ENDPOINT")
+	if !exists {
+		log.Fatal("Undefined AWS endpoint")
+	}
+
+	db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
+	if err != nil {
+		log.Fatal("failed to get database: ", err)
+	}
+
+	tableName, exists := os.LookupEnv("TABLE_NAME")
+	if !exists {
+		log.Fatal("Undefined table name")
+	}
+
+	err = RepairCounters(ctx, db, tableName)
+	if err != nil {
+		log.Fatal("Failed to repair counters: ", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/joho/godotenv"
+)
+
+// RestoreFollowers writes the mirrored Follower item for every follow edge
+// of the user. Follows created before the reverse index existed lack them.
+func RestoreFollowers(ctx context.Context, client *dynamodb.Client, tableName, userID string) (int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: "user#" + userID},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "follower#"},
+		},
+	}
+
+	paginator := dynamodb.NewQueryPaginator(client, input)
+
+	restored := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query follows of user %s: %w", userID, err)
+		}
+
+		var follows []*entity.Follow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &follows)
+		if err != nil {
+			return 0, fmt.Errorf("failed to unmarshal follows of user %s: %w", userID, err)
+		}
+
+		for _, follow := range follows {
+			follower, err := entity.NewFollower(userID, follow.FollowedID)
+			if err != nil {
+				return 0, err
+			}
+
+			av, err := attributevalue.MarshalMap(follower)
+			if err != nil {
+				return 0, fmt.Errorf("failed to marshal follower: %w", err)
+			}
+
+			_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName: aws.String(tableName),
+				Item:      av,
+			})
+			if err != nil {
+				return 0, fmt.Errorf("failed to put follower (PK: %s): %w", follower.PK, err)
+			}
+			restored++
+		}
+	}
+
+	return restored, nil
+}
+
+func RepairFollowers(ctx context.Context, client *dynamodb.Client, tableName string) error {
+	paginator := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "user"},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query users: %w", err)
+		}
+
+		var users []*entity.User
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &users)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal users: %w", err)
+		}
+
+		for _, user := range users {
+			restored, err := RestoreFollowers(ctx, client, tableName, user.ID)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("User %s: %d follows\n", user.ID, restored)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("No .env file found")
+	}
+
+	awsRegion, exists := os.LookupEnv("AWS_REGION")
+	if !exists {
+		log.Fatal("Undefined AWS region")
+	}
+
+	awsEndpoint, exists := os.LookupEnv("AWS_ENDPOINT")
+	if !exists {
+		log.Fatal("Undefined AWS endpoint")
+	}
+
+	db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
+	if err != nil {
+		log.Fatal("failed to get database: ", err)
+	}
+
+	tableName, exists := os.LookupEnv("TABLE_NAME")
+	if !exists {
+		log.Fatal("Undefined table name")
+	}
+
+	err = RepairFollowers(ctx, db, tableName)
+	if err != nil {
+		log.Fatal("Failed to repair followers: ", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/joho/godotenv"
+)
+
+// Number of handles tried for every user
+const handleAttempts = 20
+
+// AssignHandles gives every user without a handle one based on their name.
+// Users created before handles existed cannot be mentioned until then.
+func AssignHandles(ctx context.Context, users *repository.DefaultUserRepository) error {
+	all, err := users.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range all {
+		if user.Handle != "" {
+			continue
+		}
+
+		claimed := false
+		for _, handle := range entity.HandleCandidates(user.Name, handleAttempts) {
+			err = users.ClaimHandle(ctx, user.ID, handle)
+			if errors.Is(err, repository.ErrHandleTaken) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			log.Printf("User %s: @%s\n", user.ID, handle)
+			claimed = true
+			break
+		}
+
+		if !claimed {
+			return fmt.Errorf("no free handle for user %s", user.ID)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("No .env file found")
+	}
+
+	awsRegion, exists := os.LookupEnv("AWS_REGION")
+	if !exists {
+		log.Fatal("Undefined AWS region")
+	}
+
+	awsEndpoint, exists := os.LookupEnv("AWS_ENDPOINT")
+	if !exists {
+		log.Fatal("Undefined AWS endpoint")
+	}
+
+	db, err := database.GetDatabase(ctx, awsRegion, awsEndpoint)
+	if err != nil {
+		log.Fatal("failed to get database: ", err)
+	}
+
+	tableName, exists := os.LookupEnv("TABLE_NAME")
+	if !exists {
+		log.Fatal("Undefined table name")
+	}
+
+	err = AssignHandles(ctx, repository.NewDefaultUserRepository(db, tableName))
+	if err != nil {
+		log.Fatal("Failed to assign handles: ", err)
+	}
+}
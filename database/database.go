@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
@@ -30,6 +31,26 @@ func GetDatabase(ctx context.Context, awsRegion, awsEndpoint string) (*dynamodb.
 	return client, nil
 }
 
+func GetStreamsClient(ctx context.Context, awsRegion, awsEndpoint string) (*dynamodbstreams.Client, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(awsRegion),
+	)
+	if err != nil {
+		return &dynamodbstreams.Client{}, fmt.Errorf("cannot load the AWS configs: %w", err)
+	}
+
+	var opts []func(*dynamodbstreams.Options)
+	if awsEndpoint != "" {
+		opts = append(opts, func(o *dynamodbstreams.Options) {
+			o.BaseEndpoint = aws.String(awsEndpoint)
+		})
+	}
+
+	client := dynamodbstreams.NewFromConfig(awsCfg, opts...)
+
+	return client, nil
+}
+
 func GetS3Client(ctx context.Context, awsRegion, awsEndpoint string) (*s3.Client, error) {
 	awsCfg, err := config.LoadDefaultConfig(ctx,
 		config.WithRegion(awsRegion),
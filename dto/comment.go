@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"strings"
 	"time"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
@@ -8,25 +9,63 @@ import (
 
 type SaveCommentRequest struct {
 	Text string `json:"text"`
+	// Only used when creating a reply
+	ParentID string `json:"parent_id,omitempty"`
 }
 
+// Text of comments that were deleted while they had replies
+const DeletedCommentText = "[deleted]"
+
 type Comment struct {
-	ID        string     `json:"id"`
-	UserID    string     `json:"user_id"`
-	UserName  string     `json:"user_name"`
-	Text      string     `json:"text"`
-	Timestamp time.Time  `json:"timestamp"`
-	Edited    *time.Time `json:"edited"`
+	ID         string        `json:"id"`
+	PostID     string        `json:"post_id"`
+	UserID     string        `json:"user_id"`
+	UserName   string        `json:"user_name"`
+	Text       string        `json:"text"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Edited     *time.Time    `json:"edited"`
+	ParentID   string        `json:"parent_id,omitempty"`
+	ReplyCount int           `json:"reply_count"`
+	Deleted    bool          `json:"deleted"`
+	Entities   []*TextEntity `json:"entities"`
+}
+
+// DeletedComment is a comment removed by a delete. Comments with replies stay
+// as placeholders.
+type DeletedComment struct {
+	ID          string `json:"id"`
+	PostID      string `json:"post_id"`
+	ParentID    string `json:"parent_id,omitempty"`
+	Placeholder bool   `json:"placeholder"`
+}
+
+type CommentPage struct {
+	Comments   []*Comment `json:"comments"`
+	NextCursor string     `json:"next_cursor,omitempty"`
 }
 
 func (c *Comment) FromEntity(comment *entity.Comment) {
 	c.ID = comment.ID
+	c.PostID = strings.TrimPrefix(comment.PK, "post#")
 	c.UserID = comment.UserID
 	c.UserName = comment.UserName
 	c.Text = comment.Text
 	c.Timestamp = comment.Timestamp
 
+	c.ParentID = comment.ParentID
+	c.ReplyCount = comment.ReplyCount
+	c.Entities = textEntities(comment.Text, comment.Mentions)
+
 	if comment.Edited != nil {
 		c.Edited = comment.Edited
 	}
+
+	if comment.Deleted {
+		c.UserID = ""
+		c.UserName = ""
+		c.Text = DeletedCommentText
+		c.Edited = nil
+		c.Deleted = true
+		c.Entities = []*TextEntity{}
+	}
 }
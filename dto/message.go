@@ -0,0 +1,87 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// CreateConversationRequest starts a conversation with the given users. With
+// a single participant the existing direct conversation is returned.
+type CreateConversationRequest struct {
+	ParticipantIDs []string `json:"participant_ids"`
+}
+
+type SendMessageRequest struct {
+	Text string `json:"text"`
+}
+
+// MarkConversationReadRequest marks the messages up to and including UpTo as
+// read, or all of them if UpTo is empty
+type MarkConversationReadRequest struct {
+	UpTo string `json:"up_to"`
+}
+
+type Conversation struct {
+	ID             string   `json:"id"`
+	ParticipantIDs []string `json:"participant_ids"`
+	LastMessage    *Message `json:"last_message,omitempty"`
+	LastReadID     string   `json:"last_read_id,omitempty"`
+	Unread         bool     `json:"unread"`
+}
+
+type ConversationPage struct {
+	Conversations []*Conversation `json:"conversations"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+}
+
+type Message struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	SenderID       string    `json:"sender_id"`
+	SenderName     string    `json:"sender_name"`
+	Text           string    `json:"text"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// MessagePage holds a page of messages, newest first, together with the read
+// receipts of the participants
+type MessagePage struct {
+	Messages   []*Message     `json:"messages"`
+	ReadBy     []*ReadReceipt `json:"read_by"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ReadReceipt tells up to which message a participant read a conversation
+type ReadReceipt struct {
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	LastReadID     string `json:"last_read_id"`
+}
+
+func (c *Conversation) FromEntity(member *entity.ConversationMember) {
+	c.ID = member.ConversationID
+	c.ParticipantIDs = member.ParticipantIDs
+	c.LastReadID = member.LastReadID
+	if member.LastMessage != nil {
+		c.LastMessage = new(Message)
+		c.LastMessage.FromEntity(member.LastMessage)
+		// Ids are ULIDs, so older messages sort before the receipt
+		c.Unread = member.LastMessage.ID > member.LastReadID
+	}
+}
+
+func (m *Message) FromEntity(message *entity.Message) {
+	m.ID = message.ID
+	m.ConversationID = message.ConversationID
+	m.SenderID = message.SenderID
+	m.SenderName = message.SenderName
+	m.Text = message.Text
+	m.Timestamp = message.Timestamp
+}
+
+func (r *ReadReceipt) FromEntity(member *entity.ConversationMember) {
+	r.ConversationID = member.ConversationID
+	r.UserID = member.UserID
+	r.LastReadID = member.LastReadID
+}
@@ -0,0 +1,45 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+type Notification struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ActorID   string    `json:"actor_id"`
+	ActorName string    `json:"actor_name"`
+	PostID    string    `json:"post_id,omitempty"`
+	CommentID string    `json:"comment_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Read      bool      `json:"read"`
+}
+
+type NotificationPage struct {
+	Notifications []*Notification `json:"notifications"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+}
+
+// MarkReadRequest marks the notifications up to and including UpTo as read,
+// or all of them if UpTo is empty
+type MarkReadRequest struct {
+	UpTo string `json:"up_to"`
+}
+
+type UnreadCount struct {
+	Count int `json:"count"`
+}
+
+func (n *Notification) FromEntity(notification *entity.Notification, lastReadId string) {
+	n.ID = notification.ID
+	n.Type = notification.Type
+	n.ActorID = notification.ActorID
+	n.ActorName = notification.ActorName
+	n.PostID = notification.PostID
+	n.CommentID = notification.CommentID
+	n.Timestamp = notification.Timestamp
+	// Ids are ULIDs, so older notifications sort before the marker
+	n.Read = notification.ID <= lastReadId
+}
@@ -1,30 +1,116 @@
 package dto
 
 import (
+	"sort"
 	"time"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 )
 
 type CreatePostRequest struct {
-	Text  string `json:"text"`
-	Image string `json:"image,omitempty"`
+	Text string `json:"text"`
+	// Image is the only image of clients from before Media, a request sets
+	// either of them
+	Image string          `json:"image,omitempty"`
+	Media []*MediaRequest `json:"media,omitempty"`
+	// Reposts the post with this id, or quotes it if text or images are set
+	ReferencedPostID string `json:"referenced_post_id,omitempty"`
 }
 
 type UpdatePostRequest struct {
-	Text  string `json:"text"`
+	Text string `json:"text"`
+	// Without Media, Image replaces only the first image of the post and the
+	// others are kept
 	Image string `json:"image,omitempty"`
+	// Media replaces all images of the post, an empty list removes them
+	Media []*MediaRequest `json:"media"`
+}
+
+// MediaRequest attaches an image to a post. The key is that of an upload, or
+// of an image the post already has.
+type MediaRequest struct {
+	Key     string `json:"key"`
+	AltText string `json:"alt_text,omitempty"`
 }
 
 type Post struct {
-	ID        string     `json:"id"`
-	UserID    string     `json:"user_id"`
-	UserName  string     `json:"user_name"`
-	Text      string     `json:"text"`
-	Image     string     `json:"image,omitempty"`
-	Timestamp time.Time  `json:"timestamp"`
-	ImageURL  string     `json:"image_url,omitempty"`
-	Edited    *time.Time `json:"edited"`
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+	Media     []*Media  `json:"media"`
+	// Image and its URLs repeat the first medium for clients from before
+	// Media
+	Image        string         `json:"image,omitempty"`
+	ImageURL     string         `json:"image_url,omitempty"`
+	ThumbnailURL string         `json:"thumbnail_url,omitempty"`
+	MediumURL    string         `json:"medium_url,omitempty"`
+	Edited       *time.Time     `json:"edited"`
+	LikeCount    int            `json:"like_count"`
+	LikedByMe    bool           `json:"liked_by_me"`
+	Reference    *PostReference `json:"reference,omitempty"`
+	Tags         []string       `json:"tags"`
+	Entities     []*TextEntity  `json:"entities"`
+}
+
+// Media is an image of a post. The size and content type are missing for
+// images from before they were processed, and so are the URLs of the smaller
+// variants.
+type Media struct {
+	Key          string `json:"key"`
+	AltText      string `json:"alt_text"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	URL          string `json:"url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	MediumURL    string `json:"medium_url,omitempty"`
+}
+
+const (
+	EntityHashtag = "hashtag"
+	EntityMention = "mention"
+)
+
+// TextEntity marks a part of the text of a post or comment. Start and End
+// are byte offsets into the text.
+type TextEntity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Tag    string `json:"tag,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	Handle string `json:"handle,omitempty"`
+}
+
+type TrendingTag struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// PostReference embeds the original of a repost or quote. Unavailable is set
+// when the original was deleted or the viewer cannot see it.
+type PostReference struct {
+	Kind        string `json:"kind"`
+	UserID      string `json:"user_id"`
+	PostID      string `json:"post_id"`
+	Unavailable bool   `json:"unavailable"`
+	Post        *Post  `json:"post,omitempty"`
+}
+
+type Like struct {
+	PostID    string `json:"post_id"`
+	UserID    string `json:"user_id"`
+	LikeCount int    `json:"like_count"`
+	LikedByMe bool   `json:"liked_by_me"`
+	// AuthorID is the author of the post, it addresses the live event
+	AuthorID string `json:"-"`
+}
+
+type PostPage struct {
+	Posts      []*Post `json:"posts"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 func (p *Post) FromEntity(post *entity.Post) {
@@ -32,14 +118,98 @@ func (p *Post) FromEntity(post *entity.Post) {
 	p.UserID = post.UserID
 	p.UserName = post.UserName
 	p.Text = post.Text
-	p.Image = post.Image
 	p.Timestamp = post.Timestamp
+	p.LikeCount = post.LikeCount
+
+	p.Tags = post.Tags
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+
+	p.Entities = textEntities(post.Text, post.Mentions)
 
 	if post.Edited != nil {
 		p.Edited = post.Edited
 	}
 
-	if post.ImageURL != nil {
-		p.ImageURL = *post.ImageURL
+	p.Media = make([]*Media, 0, len(post.Media))
+	for _, medium := range post.Media {
+		m := new(Media)
+		m.FromEntity(&medium)
+		p.Media = append(p.Media, m)
 	}
+
+	if len(p.Media) > 0 {
+		p.Image = p.Media[0].Key
+		p.ImageURL = p.Media[0].URL
+		p.ThumbnailURL = p.Media[0].ThumbnailURL
+		p.MediumURL = p.Media[0].MediumURL
+	}
+
+	if post.Reference != nil {
+		p.Reference = &PostReference{
+			Kind:        post.Reference.Kind,
+			UserID:      post.Reference.UserID,
+			PostID:      post.Reference.PostID,
+			Unavailable: post.Referenced == nil,
+		}
+
+		if post.Referenced != nil {
+			original := new(Post)
+			original.FromEntity(post.Referenced)
+			// Only one level of references is embedded
+			original.Reference = nil
+			p.Reference.Post = original
+		}
+	}
+}
+
+func (m *Media) FromEntity(medium *entity.Media) {
+	m.Key = medium.Key
+	m.AltText = medium.AltText
+	m.Width = medium.Width
+	m.Height = medium.Height
+	m.ContentType = medium.ContentType
+
+	if medium.URL != nil {
+		m.URL = *medium.URL
+	}
+
+	if medium.ThumbnailURL != nil {
+		m.ThumbnailURL = *medium.ThumbnailURL
+	}
+
+	if medium.MediumURL != nil {
+		m.MediumURL = *medium.MediumURL
+	}
+}
+
+// textEntities lists the hashtags and resolved mentions of a text in order
+func textEntities(text string, mentions []entity.Mention) []*TextEntity {
+	entities := []*TextEntity{}
+
+	for _, hashtag := range entity.ParseHashtags(text) {
+		entities = append(entities, &TextEntity{
+			Type:  EntityHashtag,
+			Start: hashtag.Start,
+			End:   hashtag.End,
+			Tag:   hashtag.Tag,
+		})
+	}
+
+	for _, mention := range mentions {
+		entities = append(entities, &TextEntity{
+			Type:   EntityMention,
+			Start:  mention.Start,
+			End:    mention.End,
+			UserID: mention.UserID,
+			Handle: mention.Handle,
+		})
+	}
+
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].Start < entities[j].Start
+	})
+
+	return entities
 }
@@ -0,0 +1,34 @@
+package dto
+
+import "github.com/HENNGE/snsclone-202506-golang-luca/search"
+
+type SearchHit struct {
+	Type  string  `json:"type"`
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	// Fields holds the indexed and stored values of the document
+	Fields map[string]string `json:"fields"`
+	// Highlights holds HTML snippets with the matches wrapped in <mark>
+	Highlights map[string]string `json:"highlights"`
+}
+
+type SearchPage struct {
+	Hits       []*SearchHit `json:"hits"`
+	Total      int          `json:"total"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+func (h *SearchHit) FromHit(hit *search.Hit) {
+	h.Type = hit.Document.Type
+	h.ID = hit.Document.ID
+	h.Score = hit.Score
+	h.Highlights = hit.Highlights
+
+	h.Fields = make(map[string]string, len(hit.Document.Fields)+len(hit.Document.Stored))
+	for name, value := range hit.Document.Stored {
+		h.Fields[name] = value
+	}
+	for name, value := range hit.Document.Fields {
+		h.Fields[name] = value
+	}
+}
@@ -3,9 +3,16 @@ package dto
 import "github.com/HENNGE/snsclone-202506-golang-luca/entity"
 
 type UserProfileResponse struct {
-	ID        string   `json:"id"`
-	Name      string   `json:"name"`
-	Following []string `json:"following"`
+	ID             string       `json:"id"`
+	Name           string       `json:"name"`
+	Handle         string       `json:"handle"`
+	Following      []string     `json:"following"`
+	Blocked        []string     `json:"blocked"`
+	Muted          []string     `json:"muted"`
+	FollowersCount int          `json:"followers_count"`
+	FollowingCount int          `json:"following_count"`
+	PostsCount     int          `json:"posts_count"`
+	Settings       UserSettings `json:"settings"`
 }
 
 type CreateUserRequest struct {
@@ -23,15 +30,41 @@ type UnfollowRequest struct {
 	UnfollowingID string `json:"unfollowing_id"`
 }
 
+type UserSettings struct {
+	DMsFollowingOnly bool `json:"dms_following_only"`
+	Private          bool `json:"private"`
+}
+
+// UpdateSettingsRequest changes the settings that are present
+type UpdateSettingsRequest struct {
+	DMsFollowingOnly *bool `json:"dms_following_only"`
+	Private          *bool `json:"private"`
+}
+
 type User struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Picture string `json:"picture"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Handle         string `json:"handle"`
+	Email          string `json:"email"`
+	Picture        string `json:"picture"`
+	FollowersCount int    `json:"followers_count"`
+	FollowingCount int    `json:"following_count"`
+	PostsCount     int    `json:"posts_count"`
+	// DMsFollowingOnly tells clients that only the accounts the user follows
+	// can message them
+	DMsFollowingOnly bool `json:"dms_following_only"`
+	Private          bool `json:"private"`
+}
+
+type UserPage struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 type Follow struct {
 	FollowingID string `json:"following_id"`
+	// Pending is set when a private user still has to approve the follow
+	Pending bool `json:"pending"`
 }
 
 type Following struct {
@@ -41,8 +74,19 @@ type Following struct {
 func (u *User) FromEntity(user *entity.User) {
 	u.ID = user.ID
 	u.Name = user.Name
+	u.Handle = user.Handle
 	u.Email = user.Email
 	u.Picture = user.Picture
+	u.FollowersCount = user.FollowersCount
+	u.FollowingCount = user.FollowingCount
+	u.PostsCount = user.PostsCount
+	u.DMsFollowingOnly = user.DMsFollowingOnly
+	u.Private = user.Private
+}
+
+func (s *UserSettings) FromEntity(user *entity.User) {
+	s.DMsFollowingOnly = user.DMsFollowingOnly
+	s.Private = user.Private
 }
 
 func (f *Follow) FromEntity(follow *entity.Follow) {
@@ -0,0 +1,92 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// EventBus carries published events to the brokers of every API instance.
+// Events reach the bus with their audience resolved to user ids.
+type EventBus interface {
+	Publish(ctx context.Context, event SSEEvent) error
+	// Subscribe registers a handler for the events published on any instance
+	Subscribe(handler func(SSEEvent))
+}
+
+// MemoryBus delivers events within a single instance
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers []func(SSEEvent)
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (m *MemoryBus) Publish(ctx context.Context, event SSEEvent) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, handler := range m.handlers {
+		handler(event)
+	}
+
+	return nil
+}
+
+func (m *MemoryBus) Subscribe(handler func(SSEEvent)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+}
+
+// How long published events stay in the table before DynamoDB expires them
+const busEventTTL = time.Hour
+
+// BusEvent is an event written to the table so the other instances can read
+// it from the table's stream
+type BusEvent struct {
+	PK           string   `dynamodbav:"pk"`
+	SK           string   `dynamodbav:"sk"`
+	Node         string   `dynamodbav:"node"`
+	Name         string   `dynamodbav:"name"`
+	Data         string   `dynamodbav:"data"`
+	AudienceKind int      `dynamodbav:"audience_kind"`
+	UserIDs      []string `dynamodbav:"user_ids,omitempty"`
+	Topic        string   `dynamodbav:"topic,omitempty"`
+	Transient    bool     `dynamodbav:"transient,omitempty"`
+	ActorID      string   `dynamodbav:"actor_id,omitempty"`
+	// ExpiresAt is the TTL attribute of the table in Unix seconds
+	ExpiresAt int64 `dynamodbav:"expires_at"`
+}
+
+func NewBusEvent(node string, event SSEEvent) *BusEvent {
+	return &BusEvent{
+		PK:           fmt.Sprintf("event#%s", ulid.Make().String()),
+		SK:           "event",
+		Node:         node,
+		Name:         event.Name,
+		Data:         event.Data,
+		AudienceKind: event.Audience.Kind,
+		UserIDs:      event.Audience.UserIDs,
+		Topic:        event.Audience.Topic,
+		Transient:    event.Transient,
+		ActorID:      event.ActorID,
+		ExpiresAt:    time.Now().Add(busEventTTL).Unix(),
+	}
+}
+
+func (e *BusEvent) SSEEvent() SSEEvent {
+	return SSEEvent{
+		Name:      e.Name,
+		Data:      e.Data,
+		Audience:  Audience{Kind: e.AudienceKind, UserIDs: e.UserIDs, Topic: e.Topic},
+		Transient: e.Transient,
+		ActorID:   e.ActorID,
+	}
+}
@@ -10,26 +10,47 @@ import (
 type Comment struct {
 	PK        string     `dynamodbav:"pk"`
 	SK        string     `dynamodbav:"sk"`
+	GSIPK     string     `dynamodbav:"gsi1_pk,omitempty"`
+	GSISK     string     `dynamodbav:"gsi1_sk,omitempty"`
 	ID        string     `dynamodbav:"id"`
 	UserID    string     `dynamodbav:"user_id"`
 	UserName  string     `dynamodbav:"name"`
 	Text      string     `dynamodbav:"text"`
 	Timestamp time.Time  `dynamodbav:"timestamp"`
 	Edited    *time.Time `dynamodbav:"edited"`
+	// ParentID is empty for comments on the post itself
+	ParentID   string `dynamodbav:"parent_id,omitempty"`
+	ReplyCount int    `dynamodbav:"reply_count"`
+	// Deleted comments with replies are kept as placeholders
+	Deleted bool `dynamodbav:"deleted,omitempty"`
+	// Mentions are the @handles of the text that belong to a user
+	Mentions []Mention `dynamodbav:"mentions,omitempty"`
 }
 
-func NewComment(postId, userId, userName, text string) (*Comment, error) {
+func NewComment(postId, userId, userName, text, parentId string) (*Comment, error) {
 	ulid := ulid.Make().String()
 	p := &Comment{
 		PK:        fmt.Sprintf("post#%s", postId),
 		SK:        fmt.Sprintf("comment#%s", ulid),
+		GSIPK:     CommentThread(postId, parentId),
+		GSISK:     ulid,
 		ID:        ulid,
 		UserID:    userId,
 		UserName:  userName,
 		Text:      text,
 		Timestamp: time.Now(),
 		Edited:    nil,
+		ParentID:  parentId,
 	}
 
 	return p, nil
 }
+
+// CommentThread returns the index key of the direct replies to a comment, or
+// of the top level comments of the post when parentId is empty
+func CommentThread(postId, parentId string) string {
+	if parentId == "" {
+		parentId = "root"
+	}
+	return fmt.Sprintf("comments#%s#%s", postId, parentId)
+}
@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+type Like struct {
+	PK        string    `dynamodbav:"pk"`
+	SK        string    `dynamodbav:"sk"`
+	PostID    string    `dynamodbav:"post_id"`
+	UserID    string    `dynamodbav:"user_id"`
+	Timestamp time.Time `dynamodbav:"timestamp"`
+}
+
+func NewLike(postId, userId string) (*Like, error) {
+	l := &Like{
+		PK:        fmt.Sprintf("post#%s", postId),
+		SK:        fmt.Sprintf("like#%s", userId),
+		PostID:    postId,
+		UserID:    userId,
+		Timestamp: time.Now(),
+	}
+	return l, nil
+}
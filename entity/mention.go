@@ -0,0 +1,133 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Longer handles are not recognized
+const MaxHandleLength = 15
+
+// Only the first mentioned users of a post or comment are resolved
+const MaxMentions = 10
+
+// UserHandle reserves a handle for a user. The conditional put of this item
+// keeps handles unique.
+type UserHandle struct {
+	PK     string `dynamodbav:"pk"`
+	SK     string `dynamodbav:"sk"`
+	UserID string `dynamodbav:"user_id"`
+}
+
+func NewUserHandle(handle, userId string) *UserHandle {
+	return &UserHandle{
+		PK:     "handle",
+		SK:     handle,
+		UserID: userId,
+	}
+}
+
+// Mention is an @handle in a text that was resolved to a user. Start and End
+// are byte offsets of the whole mention including the @.
+type Mention struct {
+	UserID string `dynamodbav:"user_id"`
+	Handle string `dynamodbav:"handle"`
+	Start  int    `dynamodbav:"start"`
+	End    int    `dynamodbav:"end"`
+}
+
+func isHandleByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '_'
+}
+
+// NormalizeHandle lower cases a handle and strips a leading @. It returns
+// false if the result is not a valid handle.
+func NormalizeHandle(handle string) (string, bool) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+
+	if handle == "" || len(handle) > MaxHandleLength {
+		return "", false
+	}
+
+	for i := 0; i < len(handle); i++ {
+		if !isHandleByte(handle[i]) {
+			return "", false
+		}
+	}
+
+	return handle, true
+}
+
+// ParseMentions finds all @handles in a text. Their user ids are left empty
+// until they are resolved. An @ preceded by a letter, digit or underscore,
+// like in an email address, does not start a mention.
+func ParseMentions(text string) []Mention {
+	var mentions []Mention
+
+	previous := ' '
+	for offset := 0; offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r != '@' || isTagRune(previous) {
+			previous = r
+			offset += size
+			continue
+		}
+
+		end := offset + 1
+		for end < len(text) && isHandleByte(toLowerASCII(text[end])) {
+			end++
+		}
+
+		handle, ok := NormalizeHandle(text[offset:end])
+		if ok {
+			mentions = append(mentions, Mention{Handle: handle, Start: offset, End: end})
+		}
+
+		previous, _ = utf8.DecodeLastRuneInString(text[:end])
+		offset = end
+	}
+
+	return mentions
+}
+
+func toLowerASCII(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// HandleCandidates suggests handles for a new user based on their name. The
+// first candidate is the name itself, the next ones add a number to it and
+// the rest a random suffix.
+func HandleCandidates(name string, count int) []string {
+	var b strings.Builder
+	for i := 0; i < len(name) && b.Len() < MaxHandleLength-3; i++ {
+		c := toLowerASCII(name[i])
+		if isHandleByte(c) {
+			b.WriteByte(c)
+		}
+	}
+
+	// Names without any ASCII letters or digits
+	base := b.String()
+	if base == "" {
+		base = "user"
+	}
+
+	candidates := []string{base}
+	for i := 2; len(candidates) < count; i++ {
+		if i < 10 {
+			candidates = append(candidates, fmt.Sprintf("%s%d", base, i))
+			continue
+		}
+		// The last characters of a ULID are random
+		suffix := strings.ToLower(ulid.Make().String()[23:])
+		candidates = append(candidates, base+suffix)
+	}
+
+	return candidates
+}
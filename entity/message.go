@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// A conversation has at most this many participants, its creator included
+const MaxConversationParticipants = 10
+
+// Conversation is stored in its own partition together with its messages
+type Conversation struct {
+	PK             string    `dynamodbav:"pk"`
+	SK             string    `dynamodbav:"sk"`
+	ID             string    `dynamodbav:"id"`
+	CreatorID      string    `dynamodbav:"creator_id"`
+	ParticipantIDs []string  `dynamodbav:"participant_ids"`
+	Timestamp      time.Time `dynamodbav:"timestamp"`
+}
+
+// ConversationMember is the entry of a conversation in the partition of a
+// participant. The index key holds the id of the newest message, so the
+// conversations of a user are listed by last activity.
+type ConversationMember struct {
+	PK             string   `dynamodbav:"pk"`
+	SK             string   `dynamodbav:"sk"`
+	GSI1PK         string   `dynamodbav:"gsi1_pk"`
+	GSI1SK         string   `dynamodbav:"gsi1_sk"`
+	ConversationID string   `dynamodbav:"conversation_id"`
+	UserID         string   `dynamodbav:"user_id"`
+	ParticipantIDs []string `dynamodbav:"participant_ids"`
+	LastMessage    *Message `dynamodbav:"last_message,omitempty"`
+	// LastReadID is the newest message the participant has read
+	LastReadID string `dynamodbav:"last_read_id,omitempty"`
+}
+
+type Message struct {
+	PK             string    `dynamodbav:"pk,omitempty"`
+	SK             string    `dynamodbav:"sk,omitempty"`
+	ID             string    `dynamodbav:"id"`
+	ConversationID string    `dynamodbav:"conversation_id"`
+	SenderID       string    `dynamodbav:"sender_id"`
+	SenderName     string    `dynamodbav:"sender_name"`
+	Text           string    `dynamodbav:"text"`
+	Timestamp      time.Time `dynamodbav:"timestamp"`
+}
+
+// DirectConversationID returns the id of the conversation between two users.
+// It does not depend on who started it, so there is only one per pair.
+func DirectConversationID(userId, otherId string) string {
+	ids := []string{userId, otherId}
+	slices.Sort(ids)
+	return strings.Join(ids, "_")
+}
+
+// NewConversation creates a conversation and the entries of its participants.
+// Two participants share a direct conversation, more get a new group.
+func NewConversation(creatorId string, participantIds []string) (*Conversation, []*ConversationMember, error) {
+	if len(participantIds) < 2 {
+		return nil, nil, fmt.Errorf("a conversation needs at least two participants")
+	}
+
+	id := ulid.Make().String()
+	activity := id
+	if len(participantIds) == 2 {
+		id = DirectConversationID(participantIds[0], participantIds[1])
+		activity = ulid.Make().String()
+	}
+
+	c := &Conversation{
+		PK:             fmt.Sprintf("conversation#%s", id),
+		SK:             "meta",
+		ID:             id,
+		CreatorID:      creatorId,
+		ParticipantIDs: participantIds,
+		Timestamp:      time.Now(),
+	}
+
+	members := make([]*ConversationMember, 0, len(participantIds))
+	for _, userId := range participantIds {
+		members = append(members, &ConversationMember{
+			PK:             fmt.Sprintf("user#%s", userId),
+			SK:             fmt.Sprintf("conversation#%s", id),
+			GSI1PK:         fmt.Sprintf("conversations#%s", userId),
+			GSI1SK:         activity,
+			ConversationID: id,
+			UserID:         userId,
+			ParticipantIDs: participantIds,
+		})
+	}
+
+	return c, members, nil
+}
+
+func NewMessage(conversationId, senderId, senderName, text string) (*Message, error) {
+	ulid := ulid.Make().String()
+	m := &Message{
+		PK:             fmt.Sprintf("conversation#%s", conversationId),
+		SK:             fmt.Sprintf("message#%s", ulid),
+		ID:             ulid,
+		ConversationID: conversationId,
+		SenderID:       senderId,
+		SenderName:     senderName,
+		Text:           text,
+		Timestamp:      time.Now(),
+	}
+	return m, nil
+}
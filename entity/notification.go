@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	NotificationFollow  = "follow"
+	NotificationLike    = "like"
+	NotificationComment = "comment"
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	// Sent to private users when someone asks to follow them
+	NotificationFollowRequest = "follow_request"
+	// Sent to the requester when a private user approved their request
+	NotificationFollowAccepted = "follow_accepted"
+)
+
+// Notification tells a user about something another user did. It is stored
+// in the partition of the recipient.
+type Notification struct {
+	PK        string    `dynamodbav:"pk"`
+	SK        string    `dynamodbav:"sk"`
+	ID        string    `dynamodbav:"id"`
+	Type      string    `dynamodbav:"type"`
+	UserID    string    `dynamodbav:"user_id"`
+	ActorID   string    `dynamodbav:"actor_id"`
+	ActorName string    `dynamodbav:"actor_name"`
+	PostID    string    `dynamodbav:"post_id,omitempty"`
+	CommentID string    `dynamodbav:"comment_id,omitempty"`
+	Timestamp time.Time `dynamodbav:"timestamp"`
+}
+
+// NotificationsRead marks the notifications of a user up to and including
+// LastReadID as read
+type NotificationsRead struct {
+	PK         string `dynamodbav:"pk"`
+	SK         string `dynamodbav:"sk"`
+	LastReadID string `dynamodbav:"last_read_id"`
+}
+
+func NewNotification(notificationType, userId, actorId, actorName, postId, commentId string) (*Notification, error) {
+	ulid := ulid.Make().String()
+	n := &Notification{
+		PK:        fmt.Sprintf("user#%s", userId),
+		SK:        fmt.Sprintf("notif#%s", ulid),
+		ID:        ulid,
+		Type:      notificationType,
+		UserID:    userId,
+		ActorID:   actorId,
+		ActorName: actorName,
+		PostID:    postId,
+		CommentID: commentId,
+		Timestamp: time.Now(),
+	}
+	return n, nil
+}
@@ -8,21 +8,64 @@ import (
 )
 
 type Post struct {
-	PK        string     `dynamodbav:"pk"`
-	SK        string     `dynamodbav:"sk"`
-	GSIPK     string     `dynamodbav:"gsi1_pk"`
-	GSISK     string     `dynamodbav:"gsi1_sk"`
-	ID        string     `dynamodbav:"id"`
-	UserID    string     `dynamodbav:"user_id"`
-	UserName  string     `dynamodbav:"name"`
-	Text      string     `dynamodbav:"text"`
-	Timestamp time.Time  `dynamodbav:"timestamp"`
-	Image     string     `dynamodbav:"image"`
-	Edited    *time.Time `dynamodbav:"edited"`
-	ImageURL  *string
+	PK        string         `dynamodbav:"pk"`
+	SK        string         `dynamodbav:"sk"`
+	GSIPK     string         `dynamodbav:"gsi1_pk,omitempty"`
+	GSISK     string         `dynamodbav:"gsi1_sk,omitempty"`
+	ID        string         `dynamodbav:"id"`
+	UserID    string         `dynamodbav:"user_id"`
+	UserName  string         `dynamodbav:"name"`
+	Text      string         `dynamodbav:"text"`
+	Timestamp time.Time      `dynamodbav:"timestamp"`
+	Edited    *time.Time     `dynamodbav:"edited"`
+	LikeCount int            `dynamodbav:"like_count"`
+	Reference *PostReference `dynamodbav:"reference,omitempty"`
+	// Tags are the indexed hashtags of the text
+	Tags []string `dynamodbav:"tags,omitempty"`
+	// Mentions are the @handles of the text that belong to a user
+	Mentions []Mention `dynamodbav:"mentions,omitempty"`
+	// Media are the images of the post in order. Posts from before media
+	// lists kept the key of their only image in the image attribute, the
+	// repositories read it as their only medium.
+	Media []Media `dynamodbav:"media,omitempty"`
+	// Referenced is the post Reference points to, nil if it was deleted
+	Referenced *Post `dynamodbav:"-"`
 }
 
-func NewPost(userId, userName, text, image string) (*Post, error) {
+// MaxMedia is the number of images a post can have
+const MaxMedia = 4
+
+// MaxAltTextLength limits the alt text of an image, in bytes
+const MaxAltTextLength = 1000
+
+// Media is an image of a post. Width, Height and ContentType are only known
+// for processed images.
+type Media struct {
+	Key         string `dynamodbav:"key"`
+	AltText     string `dynamodbav:"alt_text,omitempty"`
+	Width       int    `dynamodbav:"width,omitempty"`
+	Height      int    `dynamodbav:"height,omitempty"`
+	ContentType string `dynamodbav:"content_type,omitempty"`
+	// URLs are signed when the post is read and never stored. Only processed
+	// images have the smaller variants.
+	URL          *string `dynamodbav:"-" json:"-"`
+	ThumbnailURL *string `dynamodbav:"-" json:"-"`
+	MediumURL    *string `dynamodbav:"-" json:"-"`
+}
+
+const (
+	ReferenceRepost = "repost"
+	ReferenceQuote  = "quote"
+)
+
+// PostReference points from a repost or quote to the original post
+type PostReference struct {
+	Kind   string `dynamodbav:"kind"`
+	UserID string `dynamodbav:"user_id"`
+	PostID string `dynamodbav:"post_id"`
+}
+
+func NewPost(userId, userName, text string, media []Media, reference *PostReference) (*Post, error) {
 	ulid := ulid.Make().String()
 	p := &Post{
 		PK:        fmt.Sprintf("user#%s", userId),
@@ -34,9 +77,23 @@ func NewPost(userId, userName, text, image string) (*Post, error) {
 		UserName:  userName,
 		Text:      text,
 		Timestamp: time.Now(),
-		Image:     image,
+		Media:     media,
 		Edited:    nil,
+		Reference: reference,
+		Tags:      ParseTags(text),
 	}
 
 	return p, nil
 }
+
+// NewInboxPost copies a post into the inbox of one of the author's followers.
+// The copies of a post can be found on gsi1 through its id.
+func NewInboxPost(ownerId string, post *Post) *Post {
+	p := *post
+	p.PK = fmt.Sprintf("inbox#%s", ownerId)
+	p.SK = fmt.Sprintf("post#%s", post.ID)
+	p.GSIPK = fmt.Sprintf("inbox_post#%s", post.ID)
+	p.GSISK = ownerId
+	p.Referenced = nil
+	return &p
+}
@@ -1,63 +1,405 @@
 package entity
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+const (
+	// Events kept for clients that reconnect
+	replayBufferSize = 1024
+	// Events a client may fall behind before it is disconnected
+	clientBufferSize = 64
+	// Comments sent on idle streams so proxies keep them open
+	HeartbeatInterval = 15 * time.Second
+	// How long browsers wait before reconnecting
+	retryInterval = 3 * time.Second
+)
+
+const (
+	AudienceEveryone = iota
+	AudienceUsers
+	AudienceFollowers
+	AudienceTopic
+	// AudienceInstances is handled by the API instances themselves and never
+	// delivered to a client
+	AudienceInstances
+)
+
+// Audience selects the clients an event is delivered to. The zero value
+// delivers to everyone.
+type Audience struct {
+	Kind    int
+	UserIDs []string
+	// AuthorID is the user whose followers receive the event. The author
+	// receives it as well.
+	AuthorID string
+	// Topic is delivered to the clients that subscribed to it
+	Topic string
+}
+
+func ToEveryone() Audience {
+	return Audience{Kind: AudienceEveryone}
+}
+
+func ToUsers(userIDs ...string) Audience {
+	return Audience{Kind: AudienceUsers, UserIDs: userIDs}
+}
+
+func ToFollowers(authorID string) Audience {
+	return Audience{Kind: AudienceFollowers, AuthorID: authorID}
+}
+
+func ToTopic(topic string) Audience {
+	return Audience{Kind: AudienceTopic, Topic: topic}
+}
+
+func ToInstances() Audience {
+	return Audience{Kind: AudienceInstances}
+}
+
+// PostTopic receives the comment events of a post
+func PostTopic(postID string) string {
+	return "post#" + postID
+}
+
+// includes reports whether a subscription receives events sent to the
+// audience. Followers must already be resolved to user ids. The caller must
+// hold the lock of the broker.
+func (a Audience) includes(s *Subscription) bool {
+	switch a.Kind {
+	case AudienceEveryone:
+		return true
+	case AudienceTopic:
+		return s.topics[a.Topic]
+	default:
+		return s.UserID != "" && slices.Contains(a.UserIDs, s.UserID)
+	}
+}
+
 type SSEEvent struct {
-	Name string
-	Data string
+	// ID is assigned by the broker when the event is published
+	ID       string
+	Name     string
+	Data     string
+	Audience Audience
+	// Transient events, like typing indicators, are not replayed
+	Transient bool
+	// ActorID is the user who caused the event, like the author of a post or
+	// the user who liked it. Users who muted or blocked them do not receive
+	// it.
+	ActorID string
+}
+
+// Subscription is one connection of a user, over SSE or WebSocket. A user has
+// a subscription for every open tab.
+type Subscription struct {
+	UserID string
+	// Messages is closed by the broker when the client falls behind
+	Messages chan SSEEvent
+	topics   map[string]bool
+	// hidden holds the users whose events the user does not receive
+	hidden map[string]bool
+}
+
+// receives reports whether a subscription receives an event. The caller must
+// hold the lock of the broker.
+func (s *Subscription) receives(event SSEEvent) bool {
+	return event.Audience.includes(s) && !s.hidden[event.ActorID]
 }
 
+// FollowersFunc returns the ids of the users following a user
+type FollowersFunc func(ctx context.Context, userID string) ([]string, error)
+
+// HiddenFunc returns the users whose events a user does not receive, because
+// the user muted or blocked them
+type HiddenFunc func(ctx context.Context, userID string) (map[string]bool, error)
+
 type Broker struct {
-	Clients        map[chan SSEEvent]bool
-	NewClients     chan chan SSEEvent
-	ClosingClients chan chan SSEEvent
-	Messages       chan SSEEvent
-	Lock           sync.RWMutex
+	// Clients holds the connections of every user. Connections without a
+	// user are stored under the empty id.
+	Clients   map[string]map[*Subscription]bool
+	messages  chan SSEEvent
+	followers FollowersFunc
+	hidden    HiddenFunc
+	bus       EventBus
+	Lock      sync.RWMutex
+
+	// Event ids are "<epoch>-<sequence>". The epoch changes when the server
+	// restarts, so ids from an earlier run are never replayed.
+	epoch    string
+	sequence uint64
+	history  []SSEEvent
 }
 
-func NewBroker() *Broker {
+func NewBroker(followers FollowersFunc, hidden HiddenFunc, bus EventBus) *Broker {
 	b := &Broker{
-		Clients:        make(map[chan SSEEvent]bool),
-		NewClients:     make(chan chan SSEEvent),
-		ClosingClients: make(chan chan SSEEvent),
-		Messages:       make(chan SSEEvent),
+		Clients:   make(map[string]map[*Subscription]bool),
+		messages:  make(chan SSEEvent),
+		followers: followers,
+		hidden:    hidden,
+		bus:       bus,
+		epoch:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		history:   make([]SSEEvent, replayBufferSize),
 	}
 	go b.listen()
+	bus.Subscribe(b.deliver)
 	return b
 }
 
+// Publish sends an event to its audience on every instance. Followers are
+// looked up here so that the broker never waits for the database while
+// delivering.
+func (b *Broker) Publish(ctx context.Context, event SSEEvent) {
+	if event.Audience.Kind == AudienceFollowers {
+		authorID := event.Audience.AuthorID
+
+		var followerIDs []string
+		if b.followers != nil {
+			var err error
+			followerIDs, err = b.followers(ctx, authorID)
+			if err != nil {
+				// The author still gets the event
+				log.Printf("failed to get followers of user %s: %v", authorID, err)
+			}
+		}
+
+		event.Audience = ToUsers(append(followerIDs, authorID)...)
+	}
+
+	err := b.bus.Publish(ctx, event)
+	if err != nil {
+		log.Printf("failed to publish event %s: %v", event.Name, err)
+	}
+}
+
+// deliver passes an event from the bus to the local clients
+func (b *Broker) deliver(event SSEEvent) {
+	if event.Audience.Kind == AudienceInstances {
+		if event.Name == hiddenChangedEvent {
+			b.refreshHidden(context.Background(), event.Data)
+		}
+		return
+	}
+	b.messages <- event
+}
+
+// Subscribe registers a new connection of a user and its topics. It returns
+// the events published after lastEventID, if the client reconnected.
+func (b *Broker) Subscribe(ctx context.Context, userID, lastEventID string, topics ...string) (*Subscription, []SSEEvent) {
+	s := &Subscription{
+		UserID:   userID,
+		Messages: make(chan SSEEvent, clientBufferSize),
+		topics:   map[string]bool{},
+		hidden:   b.hiddenUsers(ctx, userID),
+	}
+	for _, topic := range topics {
+		s.topics[topic] = true
+	}
+
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	if b.Clients[userID] == nil {
+		b.Clients[userID] = make(map[*Subscription]bool)
+	}
+	b.Clients[userID][s] = true
+
+	return s, b.replay(s, lastEventID)
+}
+
+// hiddenChangedEvent tells every instance that a user muted or blocked
+// someone. Its data is the id of the user.
+const hiddenChangedEvent = "hidden_changed"
+
+// RefreshHidden looks up again the users a user hid, after the user muted or
+// blocked someone. The connections of the user on every instance are updated.
+func (b *Broker) RefreshHidden(ctx context.Context, userID string) {
+	err := b.bus.Publish(ctx, SSEEvent{Name: hiddenChangedEvent, Data: userID, Audience: ToInstances()})
+	if err != nil {
+		log.Printf("failed to publish %s event of user %s: %v", hiddenChangedEvent, userID, err)
+	}
+}
+
+// refreshHidden updates the connections of a user on this instance
+func (b *Broker) refreshHidden(ctx context.Context, userID string) {
+	hidden := b.hiddenUsers(ctx, userID)
+
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	for s := range b.Clients[userID] {
+		s.hidden = hidden
+	}
+}
+
+// hiddenUsers returns the users whose events a user does not receive. If they
+// cannot be looked up, the user receives every event.
+func (b *Broker) hiddenUsers(ctx context.Context, userID string) map[string]bool {
+	if b.hidden == nil || userID == "" {
+		return nil
+	}
+
+	hidden, err := b.hidden(ctx, userID)
+	if err != nil {
+		log.Printf("failed to get hidden users of user %s: %v", userID, err)
+		return nil
+	}
+	return hidden
+}
+
+// Unsubscribe removes a connection. The other tabs of its user stay
+// connected.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	b.remove(s)
+}
+
+// SubscribeTopic makes a connection receive the events sent to a topic
+func (b *Broker) SubscribeTopic(s *Subscription, topic string) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	s.topics[topic] = true
+}
+
+func (b *Broker) UnsubscribeTopic(s *Subscription, topic string) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	delete(s.topics, topic)
+}
+
 func (b *Broker) listen() {
-	for {
-		select {
-		case s := <-b.NewClients:
-			b.Lock.Lock()
-			// A new client connected
-			b.Clients[s] = true
-			b.Lock.Unlock()
-		case s := <-b.ClosingClients:
-			b.Lock.Lock()
-			// A client disconnected
-			delete(b.Clients, s)
-			b.Lock.Unlock()
-		case msg := <-b.Messages:
-			b.Lock.RLock()
-			// When receiving a message, broadcast it to all connected clients
-			for clientChan := range b.Clients {
-				select {
-				case clientChan <- msg:
-				default:
+	for msg := range b.messages {
+		b.Lock.Lock()
+		b.sequence++
+		msg.ID = b.eventID(b.sequence)
+		if !msg.Transient {
+			b.history[b.sequence%replayBufferSize] = msg
+		}
+
+		for _, s := range b.recipients(msg.Audience) {
+			if s.hidden[msg.ActorID] {
+				continue
+			}
+			select {
+			case s.Messages <- msg:
+			default:
+				// The client fell behind. Closing its channel makes it
+				// reconnect and catch up from the replay buffer.
+				b.remove(s)
+				close(s.Messages)
+			}
+		}
+		b.Lock.Unlock()
+	}
+}
+
+// remove unregisters a connection. The caller must hold the lock.
+func (b *Broker) remove(s *Subscription) {
+	delete(b.Clients[s.UserID], s)
+	if len(b.Clients[s.UserID]) == 0 {
+		delete(b.Clients, s.UserID)
+	}
+}
+
+func (b *Broker) eventID(sequence uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, sequence)
+}
+
+// replay returns the events of a connection published after lastEventID. If
+// they are no longer buffered, or the id is unknown, a single resync event
+// tells the client to reload instead. The caller must hold the lock.
+func (b *Broker) replay(s *Subscription, lastEventID string) []SSEEvent {
+	if lastEventID == "" {
+		return nil
+	}
+
+	resync := []SSEEvent{{ID: b.eventID(b.sequence), Name: "resync", Data: "{}"}}
+
+	epoch, value, ok := strings.Cut(lastEventID, "-")
+	if !ok || epoch != b.epoch {
+		return resync
+	}
+
+	last, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || last > b.sequence {
+		return resync
+	}
+
+	// The buffer holds the events after oldest
+	oldest := uint64(0)
+	if b.sequence > replayBufferSize {
+		oldest = b.sequence - replayBufferSize
+	}
+	if last < oldest {
+		return resync
+	}
+
+	var events []SSEEvent
+	for sequence := last + 1; sequence <= b.sequence; sequence++ {
+		event := b.history[sequence%replayBufferSize]
+		// Transient events leave their slot untouched, so it may hold an
+		// older event
+		if event.ID == b.eventID(sequence) && s.receives(event) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// recipients returns the connections in an audience. The caller must hold
+// the lock.
+func (b *Broker) recipients(audience Audience) []*Subscription {
+	var recipients []*Subscription
+
+	switch audience.Kind {
+	case AudienceEveryone, AudienceTopic:
+		for _, clients := range b.Clients {
+			for s := range clients {
+				if audience.includes(s) {
+					recipients = append(recipients, s)
 				}
 			}
-			b.Lock.RUnlock()
+		}
+	default:
+		seen := map[string]bool{}
+		for _, userID := range audience.UserIDs {
+			// Anonymous clients only receive events sent to everyone
+			if userID == "" || seen[userID] {
+				continue
+			}
+			seen[userID] = true
+
+			for s := range b.Clients[userID] {
+				recipients = append(recipients, s)
+			}
 		}
 	}
+
+	return recipients
 }
 
 func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.Serve(w, r, "")
+}
+
+// Serve streams events to the client of a user until it disconnects. Clients
+// without a user only receive events that are sent to everyone, and topics
+// are fixed for the lifetime of the stream. A client that reconnects with a
+// Last-Event-ID header first receives what it missed.
+func (b *Broker) Serve(w http.ResponseWriter, r *http.Request, userID string, topics ...string) {
 	// Make sure that the writer supports flushing.
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -71,21 +413,45 @@ func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// TODO set this to the actual base url
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	// Create a channel for the client
-	messageChan := make(chan SSEEvent)
-	b.NewClients <- messageChan
+	s, missed := b.Subscribe(r.Context(), userID, r.Header.Get("Last-Event-ID"), topics...)
+	defer b.Unsubscribe(s)
 
-	defer func() {
-		b.ClosingClients <- messageChan
-	}()
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", retryInterval.Milliseconds())
+	if err != nil {
+		fmt.Printf("Error writing to client: %v", err)
+		return
+	}
+
+	for _, event := range missed {
+		err := writeEvent(w, event)
+		if err != nil {
+			fmt.Printf("Error writing to client: %v", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
 
 	// Block until the client disconnects
 	ctx := r.Context()
 	for {
 		select {
-		case event := <-messageChan:
-			// Respond with the message in SSE format
-			_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+		case event, ok := <-s.Messages:
+			// The broker closed the channel because the client fell
+			// behind, it catches up when it reconnects
+			if !ok {
+				return
+			}
+			err := writeEvent(w, event)
+			if err != nil {
+				fmt.Printf("Error writing to client: %v", err)
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
 			if err != nil {
 				fmt.Printf("Error writing to client: %v", err)
 				return
@@ -96,3 +462,9 @@ func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// writeEvent writes an event in SSE format
+func writeEvent(w http.ResponseWriter, event SSEEvent) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Name, event.Data)
+	return err
+}
@@ -0,0 +1,268 @@
+package entity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestBroker(followers map[string][]string) *Broker {
+	return NewBroker(func(ctx context.Context, userID string) ([]string, error) {
+		return followers[userID], nil
+	}, nil, NewMemoryBus())
+}
+
+// receive returns the next event of a subscription
+func receive(t *testing.T, s *Subscription) SSEEvent {
+	t.Helper()
+
+	select {
+	case event := <-s.Messages:
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event for user %q", s.UserID)
+		return SSEEvent{}
+	}
+}
+
+// received publishes a marker to everyone and returns the names of the
+// events a subscription received before it. The broker delivers in order, so
+// every earlier event has been delivered once the marker arrives.
+func received(t *testing.T, b *Broker, subscriptions ...*Subscription) map[*Subscription][]string {
+	t.Helper()
+
+	b.Publish(context.Background(), SSEEvent{Name: "marker", Audience: ToEveryone()})
+
+	names := map[*Subscription][]string{}
+	for _, s := range subscriptions {
+		names[s] = []string{}
+		for {
+			event := receive(t, s)
+			if event.Name == "marker" {
+				break
+			}
+			names[s] = append(names[s], event.Name)
+		}
+	}
+	return names
+}
+
+func TestBrokerDeliversToEveryTab(t *testing.T) {
+	b := newTestBroker(nil)
+	first, _ := b.Subscribe(context.Background(), "alice", "")
+	second, _ := b.Subscribe(context.Background(), "alice", "")
+
+	b.Publish(context.Background(), SSEEvent{Name: "both", Audience: ToUsers("alice")})
+	got := received(t, b, first, second)
+	if !slices.Equal(got[first], []string{"both"}) || !slices.Equal(got[second], []string{"both"}) {
+		t.Errorf("tabs received %v and %v, want both events", got[first], got[second])
+	}
+
+	// Closing one tab leaves the other connected
+	b.Unsubscribe(first)
+	b.Publish(context.Background(), SSEEvent{Name: "second only", Audience: ToUsers("alice")})
+	got = received(t, b, second)
+	if !slices.Equal(got[second], []string{"second only"}) {
+		t.Errorf("remaining tab received %v", got[second])
+	}
+}
+
+func TestBrokerFiltersByAudience(t *testing.T) {
+	b := newTestBroker(map[string][]string{"carol": {"bob"}})
+	alice, _ := b.Subscribe(context.Background(), "alice", "")
+	bob, _ := b.Subscribe(context.Background(), "bob", "")
+	carol, _ := b.Subscribe(context.Background(), "carol", "", PostTopic("1"))
+	anonymous, _ := b.Subscribe(context.Background(), "", "", PostTopic("1"))
+
+	ctx := context.Background()
+	b.Publish(ctx, SSEEvent{Name: "users", Audience: ToUsers("alice", "")})
+	b.Publish(ctx, SSEEvent{Name: "followers", Audience: ToFollowers("carol")})
+	b.Publish(ctx, SSEEvent{Name: "topic", Audience: ToTopic(PostTopic("1"))})
+	b.Publish(ctx, SSEEvent{Name: "other topic", Audience: ToTopic(PostTopic("2"))})
+	b.Publish(ctx, SSEEvent{Name: "everyone", Audience: ToEveryone()})
+
+	got := received(t, b, alice, bob, carol, anonymous)
+	want := map[*Subscription][]string{
+		alice: {"users", "everyone"},
+		// Followers receive the events of the author, and so does the author
+		bob:   {"followers", "everyone"},
+		carol: {"followers", "topic", "everyone"},
+		// Anonymous clients never receive events sent to users
+		anonymous: {"topic", "everyone"},
+	}
+	for s, names := range want {
+		if !slices.Equal(got[s], names) {
+			t.Errorf("user %q received %v, want %v", s.UserID, got[s], names)
+		}
+	}
+}
+
+func TestBrokerLeavesOutHiddenUsers(t *testing.T) {
+	hidden := map[string]bool{"mallory": true}
+	b := NewBroker(nil, func(ctx context.Context, userID string) (map[string]bool, error) {
+		if userID == "alice" {
+			return hidden, nil
+		}
+		return nil, nil
+	}, NewMemoryBus())
+
+	ctx := context.Background()
+	alice, _ := b.Subscribe(ctx, "alice", "", PostTopic("1"))
+	bob, _ := b.Subscribe(ctx, "bob", "", PostTopic("1"))
+
+	b.Publish(ctx, SSEEvent{Name: "post", Audience: ToEveryone(), ActorID: "mallory"})
+	b.Publish(ctx, SSEEvent{Name: "comment", Audience: ToTopic(PostTopic("1")), ActorID: "mallory"})
+	b.Publish(ctx, SSEEvent{Name: "other", Audience: ToEveryone(), ActorID: "carol"})
+
+	got := received(t, b, alice, bob)
+	if !slices.Equal(got[alice], []string{"other"}) {
+		t.Errorf("alice received %v, want only the event of carol", got[alice])
+	}
+	if !slices.Equal(got[bob], []string{"post", "comment", "other"}) {
+		t.Errorf("bob received %v, want every event", got[bob])
+	}
+
+	// Replays leave them out as well
+	b.Unsubscribe(alice)
+	alice, missed := b.Subscribe(ctx, "alice", b.eventID(0), PostTopic("1"))
+	var names []string
+	for _, event := range missed {
+		names = append(names, event.Name)
+	}
+	if !slices.Equal(names, []string{"other", "marker"}) {
+		t.Errorf("replayed %v, want only the events of others", names)
+	}
+
+	// Unmuting applies to open connections
+	hidden = nil
+	b.RefreshHidden(ctx, "alice")
+	b.Publish(ctx, SSEEvent{Name: "unmuted", Audience: ToEveryone(), ActorID: "mallory"})
+	if got := received(t, b, alice); !slices.Equal(got[alice], []string{"unmuted"}) {
+		t.Errorf("alice received %v after unmuting", got[alice])
+	}
+}
+
+func TestBrokerReplaysMissedEvents(t *testing.T) {
+	b := newTestBroker(nil)
+	alice, _ := b.Subscribe(context.Background(), "alice", "")
+
+	ctx := context.Background()
+	b.Publish(ctx, SSEEvent{Name: "seen", Audience: ToUsers("alice")})
+	last := receive(t, alice)
+
+	b.Publish(ctx, SSEEvent{Name: "missed", Audience: ToUsers("alice")})
+	b.Publish(ctx, SSEEvent{Name: "typing", Audience: ToUsers("alice"), Transient: true})
+	b.Publish(ctx, SSEEvent{Name: "for bob", Audience: ToUsers("bob")})
+	b.Publish(ctx, SSEEvent{Name: "everyone", Audience: ToEveryone()})
+	received(t, b, alice)
+	b.Unsubscribe(alice)
+
+	_, missed := b.Subscribe(context.Background(), "alice", last.ID)
+	var names []string
+	for _, event := range missed {
+		names = append(names, event.Name)
+	}
+	// Transient events and events of other users are left out
+	want := []string{"missed", "everyone", "marker"}
+	if !slices.Equal(names, want) {
+		t.Errorf("replayed %v, want %v", names, want)
+	}
+
+	b.Lock.RLock()
+	future := b.eventID(b.sequence + 1)
+	b.Lock.RUnlock()
+
+	for _, lastEventID := range []string{"other-1", "not an id", future} {
+		_, missed := b.Subscribe(context.Background(), "alice", lastEventID)
+		if len(missed) != 1 || missed[0].Name != "resync" {
+			t.Errorf("Last-Event-ID %q replayed %v, want a resync", lastEventID, missed)
+		}
+	}
+
+	_, missed = b.Subscribe(context.Background(), "alice", "")
+	if len(missed) != 0 {
+		t.Errorf("new connection replayed %v", missed)
+	}
+}
+
+func TestBrokerResyncsAfterBufferOverflow(t *testing.T) {
+	b := newTestBroker(nil)
+
+	ctx := context.Background()
+	b.Publish(ctx, SSEEvent{Name: "first", Audience: ToEveryone()})
+	b.Lock.RLock()
+	first := b.eventID(b.sequence)
+	b.Lock.RUnlock()
+
+	// The buffer holds the events after the first one, but not the first
+	// event the client missed
+	for range replayBufferSize + 1 {
+		b.Publish(ctx, SSEEvent{Name: "later", Audience: ToEveryone()})
+	}
+	waitFor(t, b, func() bool { return b.sequence == replayBufferSize+2 })
+
+	_, missed := b.Subscribe(context.Background(), "alice", first)
+	if len(missed) != 1 || missed[0].Name != "resync" {
+		t.Errorf("replayed %d events, want a resync", len(missed))
+	}
+}
+
+func TestBrokerRemovesClientsOnDisconnect(t *testing.T) {
+	b := newTestBroker(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request := httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		b.Serve(httptest.NewRecorder(), request, "alice")
+		close(done)
+	}()
+
+	waitFor(t, b, func() bool { return len(b.Clients["alice"]) == 1 })
+
+	cancel()
+	<-done
+
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+	if _, ok := b.Clients["alice"]; ok {
+		t.Errorf("disconnected client is still registered")
+	}
+}
+
+func TestBrokerDropsClientsThatFallBehind(t *testing.T) {
+	b := newTestBroker(nil)
+	slow, _ := b.Subscribe(context.Background(), "alice", "")
+
+	for range clientBufferSize + 1 {
+		b.Publish(context.Background(), SSEEvent{Name: "event", Audience: ToUsers("alice")})
+	}
+	waitFor(t, b, func() bool { return len(b.Clients["alice"]) == 0 })
+
+	for range clientBufferSize {
+		<-slow.Messages
+	}
+	if _, ok := <-slow.Messages; ok {
+		t.Errorf("channel of a client that fell behind is still open")
+	}
+}
+
+// waitFor waits until the condition holds under the lock of the broker
+func waitFor(t *testing.T, b *Broker, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		b.Lock.RLock()
+		ok := condition()
+		b.Lock.RUnlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("condition not met in time")
+}
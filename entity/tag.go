@@ -0,0 +1,144 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Only the first tags of a post are indexed so that a post and its tag items
+// fit into a single transaction
+const MaxTagsPerPost = 10
+
+// Longer tags are not recognized
+const MaxTagLength = 50
+
+// Hashtag is a #tag in the text of a post. Start and End are byte offsets of
+// the whole hashtag including the #, Tag is the normalized name.
+type Hashtag struct {
+	Tag   string
+	Start int
+	End   int
+}
+
+// TagPost points from a tag to a post using it. The items of all tags added
+// on the same day share a gsi1 partition, so recently used tags can be
+// counted by time without writing every tag to a single partition.
+type TagPost struct {
+	PK     string `dynamodbav:"pk"`
+	SK     string `dynamodbav:"sk"`
+	GSIPK  string `dynamodbav:"gsi1_pk"`
+	GSISK  string `dynamodbav:"gsi1_sk"`
+	Tag    string `dynamodbav:"tag"`
+	PostID string `dynamodbav:"post_id"`
+	UserID string `dynamodbav:"user_id"`
+	// Timestamp is when the tag was added to the post
+	Timestamp time.Time `dynamodbav:"timestamp"`
+}
+
+func NewTagPost(tag string, post *Post) *TagPost {
+	now := time.Now()
+	return &TagPost{
+		PK:        fmt.Sprintf("tag#%s", tag),
+		SK:        fmt.Sprintf("post#%s", post.ID),
+		GSIPK:     TagShard(now),
+		GSISK:     fmt.Sprintf("%s#%s", ulid.Make().String(), post.ID),
+		Tag:       tag,
+		PostID:    post.ID,
+		UserID:    post.UserID,
+		Timestamp: now,
+	}
+}
+
+// TagShard returns the gsi1 partition of the tags added at the given time,
+// one per day in UTC
+func TagShard(t time.Time) string {
+	return "tags#" + t.UTC().Format(time.DateOnly)
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// NormalizeTag lower cases a tag and strips a leading #. It returns false if
+// the result is not a valid tag.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+		return "", false
+	}
+
+	// Tags made of digits only are usually numbers, like #1
+	hasLetter := false
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", false
+		}
+		if !unicode.IsDigit(r) {
+			hasLetter = true
+		}
+	}
+
+	return tag, hasLetter
+}
+
+// ParseHashtags finds all hashtags in a text. A hashtag starts with # that
+// is not preceded by a letter, digit or underscore, so anchors in words like
+// "a#b" are ignored.
+func ParseHashtags(text string) []Hashtag {
+	var hashtags []Hashtag
+
+	previous := ' '
+	for offset := 0; offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r != '#' || isTagRune(previous) {
+			previous = r
+			offset += size
+			continue
+		}
+
+		end := offset + size
+		for end < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[end:])
+			if !isTagRune(next) {
+				break
+			}
+			end += nextSize
+		}
+
+		tag, ok := NormalizeTag(text[offset:end])
+		if ok {
+			hashtags = append(hashtags, Hashtag{Tag: tag, Start: offset, End: end})
+		}
+
+		previous, _ = utf8.DecodeLastRuneInString(text[:end])
+		offset = end
+	}
+
+	return hashtags
+}
+
+// ParseTags returns the distinct tags of a text in order of appearance, at
+// most MaxTagsPerPost
+func ParseTags(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	for _, hashtag := range ParseHashtags(text) {
+		if seen[hashtag.Tag] {
+			continue
+		}
+		if len(tags) == MaxTagsPerPost {
+			break
+		}
+		seen[hashtag.Tag] = true
+		tags = append(tags, hashtag.Tag)
+	}
+
+	return tags
+}
@@ -1,6 +1,9 @@
 package entity
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type User struct {
 	PK      string `dynamodbav:"pk"`
@@ -9,7 +12,22 @@ type User struct {
 	Name    string `dynamodbav:"name"`
 	Email   string `dynamodbav:"email"`
 	Picture string `dynamodbav:"picture"`
+	// Handle is the unique name used in @mentions
+	Handle string `dynamodbav:"handle,omitempty"`
 	// Image
+	FollowersCount int `dynamodbav:"followers_count"`
+	FollowingCount int `dynamodbav:"following_count"`
+	PostsCount     int `dynamodbav:"posts_count"`
+	// DMsFollowingOnly only lets the accounts the user follows message them
+	DMsFollowingOnly bool `dynamodbav:"dms_following_only,omitempty"`
+	// Private accounts approve their followers and only show them their posts
+	Private bool `dynamodbav:"private,omitempty"`
+}
+
+// UserSettings holds the settings to change, nil fields are left as they are
+type UserSettings struct {
+	DMsFollowingOnly *bool
+	Private          *bool
 }
 
 type Follow struct {
@@ -18,6 +36,14 @@ type Follow struct {
 	FollowedID string `dynamodbav:"id"`
 }
 
+// Follower mirrors a Follow under the partition of the followed user so
+// that the followers of a user can be listed.
+type Follower struct {
+	PK         string `dynamodbav:"pk"`
+	SK         string `dynamodbav:"sk"`
+	FollowerID string `dynamodbav:"id"`
+}
+
 type Unfollow struct {
 	PK string `dynamodbav:"pk"`
 	SK string `dynamodbav:"sk"`
@@ -32,6 +58,15 @@ func NewFollow(followerId, followingId string) (*Follow, error) {
 	return f, nil
 }
 
+func NewFollower(followerId, followingId string) (*Follower, error) {
+	f := &Follower{
+		PK:         fmt.Sprintf("user#%s", followingId),
+		SK:         fmt.Sprintf("followed_by#%s", followerId),
+		FollowerID: followerId,
+	}
+	return f, nil
+}
+
 func NewUnfollow(followerId, followingId string) (*Unfollow, error) {
 	f := &Unfollow{
 		PK: fmt.Sprintf("user#%s", followerId),
@@ -40,6 +75,15 @@ func NewUnfollow(followerId, followingId string) (*Unfollow, error) {
 	return f, nil
 }
 
+// NewRemoveFollower creates the key of the Follower item to remove on unfollow
+func NewRemoveFollower(followerId, followingId string) (*Unfollow, error) {
+	f := &Unfollow{
+		PK: fmt.Sprintf("user#%s", followingId),
+		SK: fmt.Sprintf("followed_by#%s", followerId),
+	}
+	return f, nil
+}
+
 func NewUser(id, name, email, picture string) (*User, error) {
 	u := &User{
 		PK:      "user",
@@ -51,3 +95,55 @@ func NewUser(id, name, email, picture string) (*User, error) {
 	}
 	return u, nil
 }
+
+// FollowRequest waits in the partition of a private user until they approve
+// or reject it
+type FollowRequest struct {
+	PK          string    `dynamodbav:"pk"`
+	SK          string    `dynamodbav:"sk"`
+	RequesterID string    `dynamodbav:"id"`
+	Timestamp   time.Time `dynamodbav:"timestamp"`
+}
+
+func NewFollowRequest(requesterId, followingId string) (*FollowRequest, error) {
+	f := &FollowRequest{
+		PK:          fmt.Sprintf("user#%s", followingId),
+		SK:          fmt.Sprintf("follow_request#%s", requesterId),
+		RequesterID: requesterId,
+		Timestamp:   time.Now(),
+	}
+	return f, nil
+}
+
+// Block stops the blocked user from following, commenting on the posts of or
+// mentioning the blocker
+type Block struct {
+	PK        string `dynamodbav:"pk"`
+	SK        string `dynamodbav:"sk"`
+	BlockedID string `dynamodbav:"id"`
+}
+
+// Mute hides the posts and comments of the muted user from the muter
+type Mute struct {
+	PK      string `dynamodbav:"pk"`
+	SK      string `dynamodbav:"sk"`
+	MutedID string `dynamodbav:"id"`
+}
+
+func NewBlock(blockerId, blockedId string) (*Block, error) {
+	b := &Block{
+		PK:        fmt.Sprintf("user#%s", blockerId),
+		SK:        fmt.Sprintf("block#%s", blockedId),
+		BlockedID: blockedId,
+	}
+	return b, nil
+}
+
+func NewMute(muterId, mutedId string) (*Mute, error) {
+	m := &Mute{
+		PK:      fmt.Sprintf("user#%s", muterId),
+		SK:      fmt.Sprintf("mute#%s", mutedId),
+		MutedID: mutedId,
+	}
+	return m, nil
+}
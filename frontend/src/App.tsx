@@ -14,7 +14,7 @@ type TimelineView = "global" | "personal";
 
 function App() {
   const { isAuthenticated, userId, userName, following, isLoading } = useAuth();
-  const { posts } = useSSE();
+  const { posts, hasMorePosts, loadMorePosts } = useSSE();
 
   const [activeView, setActiveView] = useState<ActiveView>("timeline");
   const [activeTimeline, setActiveTimeline] = useState<TimelineView>("global");
@@ -159,6 +159,14 @@ function App() {
                   setSelectedUser={setSelectedUser}
                   setIsViewingProfile={setIsViewingProfile}
                 />
+                {!isViewingProfile && hasMorePosts && (
+                  <button
+                    onClick={loadMorePosts}
+                    className="w-full mt-4 py-2 cursor-pointer text-sm font-bold rounded-lg bg-gray-200 hover:bg-gray-300"
+                  >
+                    Load more
+                  </button>
+                )}
               </div>
             </div>
           )}
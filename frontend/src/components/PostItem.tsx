@@ -4,7 +4,7 @@ import Comments from "../assets/comment.svg";
 import Edit from "../assets/edit.svg";
 import Delete from "../assets/delete.svg";
 import EditPostForm from "./EditPostForm";
-import type { Comment } from "../types/Comment";
+import type { Comment, CommentPage } from "../types/Comment";
 import { useAuth } from "../context/AuthContext";
 import CommentForm from "./CommentForm";
 import CommentItem from "./CommentItem";
@@ -67,8 +67,8 @@ export const PostItem: React.FC<PostItemProps> = ({
       const response = await fetch(`/posts/${post.id}/comments`);
       if (!response.ok)
         throw new Error(`HTTP error! status: ${response.status}`);
-      const data: Comment[] = await response.json();
-      setComments(data);
+      const data: CommentPage = await response.json();
+      setComments(data.comments);
     } catch (e) {
       setComments([]);
     }
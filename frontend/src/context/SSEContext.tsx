@@ -1,10 +1,12 @@
 import React, { useState, useEffect, useCallback } from "react";
 import { createContext, useContext } from "react";
-import type { Post } from "../types/Post";
+import type { LikeEvent, Post, PostPage } from "../types/Post";
 import { useAuth } from "./AuthContext";
 
 interface ISSEContext {
   posts: Post[];
+  hasMorePosts: boolean;
+  loadMorePosts: () => void;
 }
 
 const baseUrl = import.meta.env.VITE_BASE_URL;
@@ -12,22 +14,46 @@ const baseUrl = import.meta.env.VITE_BASE_URL;
 export const SSEContext = createContext<ISSEContext>(null!);
 
 export function SSEProvider({ children }: { children: React.ReactNode }) {
-  const { isAuthenticated } = useAuth();
+  const { isAuthenticated, userId } = useAuth();
 
   const [posts, setPosts] = useState<Post[]>([]);
+  const [nextCursor, setNextCursor] = useState<string>("");
 
   const fetchAllPosts = useCallback(async () => {
     try {
       const response = await fetch("/posts");
       if (!response.ok)
         throw new Error(`HTTP error! status: ${response.status}`);
-      const data: Post[] = await response.json();
-      setPosts(data);
+      const data: PostPage = await response.json();
+      setPosts(data.posts);
+      setNextCursor(data.next_cursor ?? "");
     } catch (e) {
       setPosts([]);
+      setNextCursor("");
     }
   }, []);
 
+  const loadMorePosts = useCallback(async () => {
+    if (!nextCursor) return;
+    try {
+      const response = await fetch(
+        `/posts?cursor=${encodeURIComponent(nextCursor)}`
+      );
+      if (!response.ok)
+        throw new Error(`HTTP error! status: ${response.status}`);
+      const data: PostPage = await response.json();
+      setPosts((prevPosts) => [
+        ...prevPosts,
+        ...data.posts.filter(
+          (post) => !prevPosts.some((p) => p.id === post.id)
+        ),
+      ]);
+      setNextCursor(data.next_cursor ?? "");
+    } catch (e) {
+      console.error("Failed to load more posts:", e);
+    }
+  }, [nextCursor]);
+
   useEffect(() => {
     if (!isAuthenticated) {
       setPosts([]);
@@ -66,13 +92,37 @@ export function SSEProvider({ children }: { children: React.ReactNode }) {
       );
     };
 
+    const handleLikePost = (event: MessageEvent) => {
+      const like = JSON.parse(event.data) as LikeEvent;
+      setPosts((prevPosts) =>
+        prevPosts.map((post) =>
+          post.id === like.post_id
+            ? {
+                ...post,
+                like_count: like.like_count,
+                liked_by_me:
+                  like.user_id === userId ? like.liked : post.liked_by_me,
+              }
+            : post
+        )
+      );
+    };
+
+    // The server could not replay the missed events, so reload the posts
+    const handleResync = () => {
+      fetchAllPosts();
+    };
+
     eventSource.addEventListener("new_post", handleNewPost);
     eventSource.addEventListener("update_post", handleUpdatePost);
     eventSource.addEventListener("delete_post", handleDeletePost);
+    eventSource.addEventListener("like_post", handleLikePost);
+    eventSource.addEventListener("resync", handleResync);
 
+    // The browser reconnects by itself and sends the id of the last event,
+    // so the server can replay what was missed
     eventSource.onerror = (err) => {
       console.error("EventSource failed:", err);
-      eventSource.close();
     };
 
     return () => {
@@ -80,11 +130,13 @@ export function SSEProvider({ children }: { children: React.ReactNode }) {
       eventSource.removeEventListener("new_post", handleNewPost);
       eventSource.removeEventListener("update_post", handleUpdatePost);
       eventSource.removeEventListener("delete_post", handleDeletePost);
+      eventSource.removeEventListener("like_post", handleLikePost);
+      eventSource.removeEventListener("resync", handleResync);
       eventSource.close();
     };
-  }, [isAuthenticated]);
+  }, [isAuthenticated, userId]);
 
-  const value = { posts };
+  const value = { posts, hasMorePosts: nextCursor !== "", loadMorePosts };
 
   return <SSEContext.Provider value={value}>{children}</SSEContext.Provider>;
 }
@@ -1,8 +1,26 @@
 export interface Comment {
   id: string;
+  post_id: string;
   user_id: string;
   user_name: string;
   text: string;
   timestamp: string;
   edited: string;
-}
\ No newline at end of file
+  parent_id?: string;
+  reply_count: number;
+  deleted: boolean;
+}
+
+// Payload of delete_comment events. Comments with replies stay as
+// placeholders.
+export interface DeletedComment {
+  id: string;
+  post_id: string;
+  parent_id?: string;
+  placeholder: boolean;
+}
+
+export interface CommentPage {
+  comments: Comment[];
+  next_cursor?: string;
+}
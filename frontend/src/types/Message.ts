@@ -0,0 +1,33 @@
+export interface Message {
+  id: string;
+  conversation_id: string;
+  sender_id: string;
+  sender_name: string;
+  text: string;
+  timestamp: string;
+}
+
+export interface Conversation {
+  id: string;
+  participant_ids: string[];
+  last_message?: Message;
+  last_read_id?: string;
+  unread: boolean;
+}
+
+export interface ConversationPage {
+  conversations: Conversation[];
+  next_cursor?: string;
+}
+
+export interface ReadReceipt {
+  conversation_id: string;
+  user_id: string;
+  last_read_id: string;
+}
+
+export interface MessagePage {
+  messages: Message[];
+  read_by: ReadReceipt[];
+  next_cursor?: string;
+}
@@ -0,0 +1,26 @@
+export interface Notification {
+  id: string;
+  type:
+    | "follow"
+    | "follow_request"
+    | "follow_accepted"
+    | "like"
+    | "comment"
+    | "reply"
+    | "mention";
+  actor_id: string;
+  actor_name: string;
+  post_id?: string;
+  comment_id?: string;
+  timestamp: string;
+  read: boolean;
+}
+
+export interface NotificationPage {
+  notifications: Notification[];
+  next_cursor?: string;
+}
+
+export interface UnreadCount {
+  count: number;
+}
@@ -4,7 +4,64 @@ export interface Post {
   user_name: string;
   text: string;
   timestamp: string;
+  media: Media[];
+  // The first medium, for posts shown by older clients
   image: string;
   image_url: string;
+  thumbnail_url?: string;
+  medium_url?: string;
   edited: string;
-}
\ No newline at end of file
+  like_count: number;
+  liked_by_me: boolean;
+  reference?: PostReference;
+  tags: string[];
+  entities: TextEntity[];
+}
+
+// Size, content type and the smaller variants are missing for images from
+// before they were processed
+export interface Media {
+  key: string;
+  alt_text: string;
+  width?: number;
+  height?: number;
+  content_type?: string;
+  url?: string;
+  thumbnail_url?: string;
+  medium_url?: string;
+}
+
+// Start and end are byte offsets into the UTF-8 encoded text
+export interface TextEntity {
+  type: "hashtag" | "mention";
+  start: number;
+  end: number;
+  tag?: string;
+  user_id?: string;
+  handle?: string;
+}
+
+export interface TrendingTag {
+  tag: string;
+  count: number;
+}
+
+export interface PostReference {
+  kind: "repost" | "quote";
+  user_id: string;
+  post_id: string;
+  unavailable: boolean;
+  post?: Post;
+}
+
+export interface PostPage {
+  posts: Post[];
+  next_cursor?: string;
+}
+
+export interface LikeEvent {
+  post_id: string;
+  user_id: string;
+  like_count: number;
+  liked: boolean;
+}
@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+)
+
+// isSmallAnimation reports whether a GIF has several frames and all of them
+// together stay within MaxSize and MaxPixels. Other GIFs are reduced to their
+// first frame, since decoding every frame could take a lot of memory.
+func isSmallAnimation(data []byte, config image.Config) bool {
+	frames := gifFrameCount(data)
+	return frames > 1 && max(config.Width, config.Height) <= MaxSize && config.Width*config.Height*frames <= MaxPixels
+}
+
+// processAnimation encodes all frames of a GIF anew, which only writes the
+// frames and their timing. Comments and application extensions are dropped.
+// Variants show the first frame.
+func processAnimation(data []byte) (*Result, error) {
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gif image: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	err = gif.EncodeAll(&buffer, animation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode gif image: %w", err)
+	}
+
+	// Frames can cover only part of the canvas
+	first := image.NewRGBA(image.Rect(0, 0, animation.Config.Width, animation.Config.Height))
+	draw.Draw(first, animation.Image[0].Bounds(), animation.Image[0], animation.Image[0].Bounds().Min, draw.Over)
+
+	variants, err := encodeVariants(first)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Image:    newImage(buffer.Bytes(), "image/gif", first.Bounds()),
+		Variants: variants,
+	}, nil
+}
+
+// gifFrameCount counts the frames of a GIF by walking its blocks without
+// decompressing them. Malformed files count as having no frames.
+func gifFrameCount(data []byte) int {
+	// Header and logical screen descriptor, followed by the global color table
+	if len(data) < 13 {
+		return 0
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&7 + 1)
+	}
+
+	frames := 0
+	for pos >= 0 && pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// Extension label followed by data sub-blocks
+			pos = skipSubBlocks(data, pos+2)
+		case 0x2c:
+			// Image descriptor, local color table, LZW code size and the
+			// image data sub-blocks
+			if pos+10 > len(data) {
+				return 0
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&7 + 1)
+			}
+			pos = skipSubBlocks(data, pos+1)
+			frames++
+		case 0x3b:
+			return frames
+		default:
+			return 0
+		}
+	}
+
+	if pos < 0 {
+		return 0
+	}
+	return frames
+}
+
+// skipSubBlocks returns the position after the sub-blocks starting at pos, or
+// -1 if they are cut off
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos += 1 + size
+		if size == 0 {
+			return pos
+		}
+	}
+	return -1
+}
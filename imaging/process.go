@@ -0,0 +1,245 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Names of the variants generated for every image
+const (
+	Medium    = "medium"
+	Thumbnail = "thumbnail"
+)
+
+// Variant is a smaller version of an image that fits into a square of Size
+type Variant struct {
+	Name string
+	Size int
+}
+
+var Variants = []Variant{
+	{Name: Medium, Size: 1024},
+	{Name: Thumbnail, Size: 320},
+}
+
+const (
+	// MaxSize is the longest side of a processed image, larger images are
+	// scaled down
+	MaxSize = 2048
+	// MaxPixels limits the images that are decoded at all, so a small file
+	// cannot claim a huge canvas
+	MaxPixels = 50_000_000
+	// MaxBytes limits the size of the uploaded file
+	MaxBytes = 20 << 20
+)
+
+const jpegQuality = 85
+
+var (
+	ErrUnsupportedFormat = errors.New("file is not a jpeg, png, gif or webp image")
+	ErrTooLarge          = errors.New("image is too large")
+)
+
+// Image is an encoded image
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+type Result struct {
+	// Image is the uploaded image without metadata and at most MaxSize large
+	Image Image
+	// Variants hold the images of Variants in the same order
+	Variants []Image
+}
+
+// Format returns the format of an image by the magic bytes at its start, or
+// an empty string if it is none of the supported formats
+func Format(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp"
+	default:
+		return ""
+	}
+}
+
+// Process checks the real format of an uploaded file and re-encodes it, which
+// drops all metadata such as EXIF and GPS tags. The orientation of JPEG photos
+// is applied to the pixels before, so they keep showing upright.
+func Process(data []byte) (*Result, error) {
+	if len(data) > MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	format := Format(data)
+	if format == "" {
+		return nil, ErrUnsupportedFormat
+	}
+
+	config, err := decodeConfig(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s image: %w", format, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	if format == "gif" && isSmallAnimation(data, config) {
+		return processAnimation(data)
+	}
+
+	img, err := decode(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s image: %w", format, err)
+	}
+
+	// Scaling first keeps the rotation cheap, the longest side is the same
+	// either way
+	img = fit(img, MaxSize)
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	// Photos stay JPEG, everything else becomes a lossless PNG unless it is
+	// a WebP without transparency
+	var encoded Image
+	switch {
+	case format == "jpeg", format == "webp" && isOpaque(img):
+		encoded, err = encodeJPEG(img)
+	default:
+		encoded, err = encodePNG(img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := encodeVariants(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Image: encoded, Variants: variants}, nil
+}
+
+func decodeConfig(format string, data []byte) (image.Config, error) {
+	reader := bytes.NewReader(data)
+	switch format {
+	case "jpeg":
+		return jpeg.DecodeConfig(reader)
+	case "png":
+		return png.DecodeConfig(reader)
+	case "gif":
+		return gif.DecodeConfig(reader)
+	default:
+		return webp.DecodeConfig(reader)
+	}
+}
+
+func decode(format string, data []byte) (image.Image, error) {
+	reader := bytes.NewReader(data)
+	switch format {
+	case "jpeg":
+		return jpeg.Decode(reader)
+	case "png":
+		return png.Decode(reader)
+	case "gif":
+		// Only the first frame
+		return gif.Decode(reader)
+	default:
+		return webp.Decode(reader)
+	}
+}
+
+// encodeVariants scales an image down to every variant. Variants are JPEG
+// unless the image has transparency.
+func encodeVariants(img image.Image) ([]Image, error) {
+	opaque := isOpaque(img)
+
+	variants := make([]Image, 0, len(Variants))
+	for _, variant := range Variants {
+		scaled := fit(img, variant.Size)
+
+		encode := encodePNG
+		if opaque {
+			encode = encodeJPEG
+		}
+
+		encoded, err := encode(scaled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s variant: %w", variant.Name, err)
+		}
+		variants = append(variants, encoded)
+	}
+
+	return variants, nil
+}
+
+// fit scales an image down so its longest side is at most size. Smaller
+// images are returned as they are.
+func fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, xdraw.Src, nil)
+	return scaled
+}
+
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
+
+func encodeJPEG(img image.Image) (Image, error) {
+	var buffer bytes.Buffer
+	err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to encode jpeg image: %w", err)
+	}
+
+	return newImage(buffer.Bytes(), "image/jpeg", img.Bounds()), nil
+}
+
+func encodePNG(img image.Image) (Image, error) {
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, img)
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to encode png image: %w", err)
+	}
+
+	return newImage(buffer.Bytes(), "image/png", img.Bounds()), nil
+}
+
+func newImage(data []byte, contentType string, bounds image.Rectangle) Image {
+	return Image{Data: data, ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy()}
+}
@@ -0,0 +1,283 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+)
+
+// filled returns an image of one color
+func filled(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 100})
+	case "png":
+		err = png.Encode(&buffer, img)
+	}
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", format, err)
+	}
+	return buffer.Bytes()
+}
+
+// animation returns a GIF with a frame of the given size for every color
+func animation(t *testing.T, width, height int, colors ...color.Color) []byte {
+	t.Helper()
+
+	all := &gif.GIF{Config: image.Config{Width: width, Height: height, ColorModel: color.Palette(palette.Plan9)}}
+	for _, c := range colors {
+		frame := image.NewPaletted(image.Rect(0, 0, 1, 1), palette.Plan9)
+		frame.Set(0, 0, c)
+		all.Image = append(all.Image, frame)
+		all.Delay = append(all.Delay, 10)
+	}
+
+	var buffer bytes.Buffer
+	err := gif.EncodeAll(&buffer, all)
+	if err != nil {
+		t.Fatalf("failed to encode gif: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// withExif inserts an APP1 segment after the start of image marker. The
+// little endian TIFF structure holds the orientation and a GPS-like string.
+func withExif(data []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 35.6586 N 139.7454 E"...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	return append(result, data[2:]...)
+}
+
+// near reports whether a color is close to another one, JPEG is lossy
+func near(c color.Color, want color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	diff := func(got uint32, want uint8) bool {
+		d := int(got>>8) - int(want)
+		return d > -48 && d < 48
+	}
+	return diff(r, want.R) && diff(g, want.G) && diff(b, want.B)
+}
+
+func TestFormat(t *testing.T) {
+	formats := map[string][]byte{
+		"jpeg": encode(t, "jpeg", filled(1, 1, red)),
+		"png":  encode(t, "png", filled(1, 1, red)),
+		"gif":  animation(t, 1, 1, red),
+		"webp": []byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+		// The content type or file name of an upload does not matter
+		"": []byte("<html><script>alert(1)</script></html>"),
+	}
+	for want, data := range formats {
+		if got := Format(data); got != want {
+			t.Errorf("Format = %q, want %q", got, want)
+		}
+	}
+
+	for _, data := range [][]byte{nil, []byte("\xff\xd8"), []byte("GIF88a"), []byte("RIFF\x00\x00\x00\x00WAVE")} {
+		if got := Format(data); got != "" {
+			t.Errorf("Format(%q) = %q, want none", data, got)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	// A PNG claiming a canvas of 10000 by 10000 pixels with a valid header
+	huge := encode(t, "png", filled(1, 1, red))
+	binary.BigEndian.PutUint32(huge[16:], 10000)
+	binary.BigEndian.PutUint32(huge[20:], 10000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	tests := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"not an image":    {[]byte("<svg onload=alert(1)>"), ErrUnsupportedFormat},
+		"too many bytes":  {append(encode(t, "jpeg", filled(1, 1, red)), make([]byte, MaxBytes)...), ErrTooLarge},
+		"too many pixels": {huge, ErrTooLarge},
+	}
+	for name, test := range tests {
+		_, err := Process(test.data)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", name, err, test.err)
+		}
+	}
+
+	// Magic bytes alone are not enough
+	_, err := Process([]byte("\x89PNG\r\n\x1a\nnot really"))
+	if err == nil {
+		t.Errorf("broken png was accepted")
+	}
+}
+
+func TestProcessRemovesExifAndRotates(t *testing.T) {
+	// Stored sideways: red on the left, blue on the right. Orientation 6
+	// turns it clockwise, so red ends up on top.
+	img := filled(32, 16, blue)
+	for y := range 16 {
+		for x := range 16 {
+			img.Set(x, y, red)
+		}
+	}
+	data := withExif(encode(t, "jpeg", img), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("test image has orientation %d", jpegOrientation(data))
+	}
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	if bytes.Contains(result.Image.Data, []byte("Exif")) || bytes.Contains(result.Image.Data, []byte("GPS")) {
+		t.Errorf("processed image still holds the EXIF data")
+	}
+	if result.Image.ContentType != "image/jpeg" || result.Image.Width != 16 || result.Image.Height != 32 {
+		t.Fatalf("got %s of %dx%d, want an upright 16x32 jpeg", result.Image.ContentType, result.Image.Width, result.Image.Height)
+	}
+
+	upright, err := jpeg.Decode(bytes.NewReader(result.Image.Data))
+	if err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if !near(upright.At(8, 4), red) || !near(upright.At(8, 28), blue) {
+		t.Errorf("got %v on top and %v at the bottom, want red on top", upright.At(8, 4), upright.At(8, 28))
+	}
+
+	if len(result.Variants) != len(Variants) {
+		t.Errorf("got %d variants, want %d", len(result.Variants), len(Variants))
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Red marks the stored top left corner and green the top right one
+	img := filled(3, 2, blue)
+	img.Set(0, 0, red)
+	img.Set(2, 0, green)
+
+	// Where both corners show for every orientation
+	want := map[int][2]image.Point{
+		1: {{0, 0}, {2, 0}},
+		2: {{2, 0}, {0, 0}},
+		3: {{2, 1}, {0, 1}},
+		4: {{0, 1}, {2, 1}},
+		5: {{0, 0}, {0, 2}},
+		6: {{1, 0}, {1, 2}},
+		7: {{1, 2}, {1, 0}},
+		8: {{0, 2}, {0, 0}},
+	}
+	for orientation, corners := range want {
+		oriented := orient(img, orientation)
+
+		size := oriented.Bounds().Size()
+		wantSize := image.Pt(3, 2)
+		if orientation >= 5 {
+			wantSize = image.Pt(2, 3)
+		}
+		if size != wantSize {
+			t.Errorf("orientation %d: size %v, want %v", orientation, size, wantSize)
+			continue
+		}
+
+		if oriented.At(corners[0].X, corners[0].Y) != color.Color(red) || oriented.At(corners[1].X, corners[1].Y) != color.Color(green) {
+			t.Errorf("orientation %d: corners are not at %v", orientation, corners)
+		}
+	}
+
+	if got := jpegOrientation(encode(t, "jpeg", img)); got != 1 {
+		t.Errorf("photo without EXIF has orientation %d, want 1", got)
+	}
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	single := animation(t, 1, 1, red)
+	three := animation(t, 1, 1, red, green, blue)
+
+	counts := map[string]struct {
+		data []byte
+		want int
+	}{
+		"single":    {single, 1},
+		"animation": {three, 3},
+		// Extensions between the frames are skipped
+		"comment":   {append(append(three[:len(three)-1:len(three)-1], "\x21\xfe\x06secret\x00"...), 0x3b), 3},
+		"truncated": {three[:len(three)-4], 0},
+		"not a gif": {[]byte("GIF89a"), 0},
+	}
+	for name, test := range counts {
+		if got := gifFrameCount(test.data); got != test.want {
+			t.Errorf("%s: got %d frames, want %d", name, got, test.want)
+		}
+	}
+}
+
+func TestProcessAnimation(t *testing.T) {
+	data := animation(t, 1, 1, red, green, blue)
+	data = append(append(data[:len(data)-1:len(data)-1], "\x21\xfe\x06secret\x00"...), 0x3b)
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if result.Image.ContentType != "image/gif" || gifFrameCount(result.Image.Data) != 3 {
+		t.Errorf("got %s with %d frames, want the animation", result.Image.ContentType, gifFrameCount(result.Image.Data))
+	}
+	if bytes.Contains(result.Image.Data, []byte("secret")) {
+		t.Errorf("processed animation still holds the comment")
+	}
+
+	// Decoding every frame of a large canvas would take too much memory, so
+	// only the first frame is kept
+	frames := make([]color.Color, MaxPixels/(2000*2000)+1)
+	for i := range frames {
+		frames[i] = red
+	}
+	result, err = Process(animation(t, 2000, 2000, frames...))
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if result.Image.ContentType == "image/gif" {
+		t.Errorf("large animation was kept")
+	}
+}
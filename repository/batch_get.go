@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BatchGetItem accepts at most 100 keys per request
+const batchGetSize = 100
+
+// batchGetItems reads the items with the given keys in batches and retries
+// unprocessed keys with exponential backoff, like batchWriteItems. Keys must
+// be unique, missing items are left out.
+func batchGetItems(ctx context.Context, db *dynamodb.Client, tableName string, keys []map[string]types.AttributeValue, projection *string) ([]map[string]types.AttributeValue, error) {
+	var allRawItems []map[string]types.AttributeValue
+
+	for start := 0; start < len(keys); start += batchGetSize {
+		requestItems := map[string]types.KeysAndAttributes{
+			tableName: {
+				Keys:                 keys[start:min(start+batchGetSize, len(keys))],
+				ProjectionExpression: projection,
+			},
+		}
+
+		config := DefaultBatchWriteItemConfig()
+		for retries := 0; len(requestItems) > 0; retries++ {
+			if retries > config.MaxRetries {
+				return nil, fmt.Errorf("failed to get all items after %d retries", retries-1)
+			}
+
+			if retries > 0 {
+				// Apply exponential backoff
+				sleepTime := min(config.InitialBackoff*time.Duration(math.Pow(2, float64(retries-1))), config.MaxBackoff)
+				select {
+				case <-time.After(sleepTime):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+
+			result, err := db.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: requestItems})
+			if err != nil {
+				return nil, fmt.Errorf("DynamoDB BatchGetItem failed: %w", err)
+			}
+
+			allRawItems = append(allRawItems, result.Responses[tableName]...)
+			requestItems = result.UnprocessedKeys
+		}
+	}
+
+	return allRawItems, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type BatchWriteItemConfig struct {
+	BatchSize      int
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func DefaultBatchWriteItemConfig() *BatchWriteItemConfig {
+	return &BatchWriteItemConfig{
+		BatchSize:      25,
+		MaxRetries:     5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
+
+// batchWriteItems sends the write requests in batches of config.BatchSize and
+// retries the items DynamoDB could not process with exponential backoff.
+func batchWriteItems(ctx context.Context, db *dynamodb.Client, tableName string, writeRequests []types.WriteRequest, config *BatchWriteItemConfig) error {
+	remainingRequests := writeRequests
+
+	var unprocessedRequests []types.WriteRequest
+
+	for len(remainingRequests) > 0 {
+		// Create a batch of write requests of size config.BatchSize
+		currentBatch := remainingRequests[:min(len(remainingRequests), config.BatchSize)]
+
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				tableName: currentBatch,
+			},
+		}
+
+		// Execute the batch write requests
+		output, err := db.BatchWriteItem(ctx, input)
+		if err != nil {
+			return fmt.Errorf("DynamoDB BatchWriteItem failed: %w", err)
+		}
+
+		remainingRequests = remainingRequests[len(currentBatch):]
+
+		// Collect any items that DynamoDB could not process.
+		if unprocessed := output.UnprocessedItems[tableName]; len(unprocessed) > 0 {
+			unprocessedRequests = append(unprocessedRequests, unprocessed...)
+		}
+	}
+
+	retries := 0
+	for len(unprocessedRequests) > 0 && retries < config.MaxRetries {
+		// Create a new batch from the unprocessedRequests
+		currentBatch := unprocessedRequests[:min(len(unprocessedRequests), config.BatchSize)]
+
+		// Keep track of the remaining unprocessedRequests
+		remainingUnprocessed := unprocessedRequests[len(currentBatch):]
+
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				tableName: currentBatch,
+			},
+		}
+
+		output, err := db.BatchWriteItem(ctx, input)
+		if err != nil {
+			return fmt.Errorf("DynamoDB BatchWriteItem failed: %w", err)
+		}
+
+		// Check if the current batch has unprocessed items again
+		unprocessedAgain := output.UnprocessedItems[tableName]
+
+		// If yes, put them in the front of the unprocessed items so we can retry
+		if len(unprocessedAgain) > 0 {
+			unprocessedRequests = append(unprocessedAgain, remainingUnprocessed...)
+			retries++
+
+			// Apply exponential backoff
+			sleepTime := min(config.InitialBackoff*time.Duration(math.Pow(2, float64(retries-1))), config.MaxBackoff)
+			time.Sleep(sleepTime)
+		} else {
+			// All unprocessed items were successfully processed this time
+			unprocessedRequests = remainingUnprocessed
+			retries = 0
+		}
+	}
+
+	if len(unprocessedRequests) > 0 {
+		return fmt.Errorf("failed to write all items after %d retries, %d items remain unprocessed", config.MaxRetries, len(unprocessedRequests))
+	}
+
+	return nil
+}
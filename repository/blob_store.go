@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/imaging"
+)
+
+// BlobStore keeps uploaded files such as the images of posts. Clients upload
+// and download the files themselves through signed URLs.
+type BlobStore interface {
+	// PresignUpload returns a URL that the file can be uploaded to with a PUT
+	// request. The upload must have the given content type and SHA-256
+	// checksum.
+	PresignUpload(ctx context.Context, key, contentType, checksum string) (string, error)
+	// Head returns the metadata of a file, or ErrBlobNotFound
+	Head(ctx context.Context, key string) (*BlobInfo, error)
+	// Get returns the content of a file, or ErrBlobNotFound. The caller has
+	// to close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put stores a file, replacing any file with the same key
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// SignedURL returns a URL that the file can be downloaded from
+	SignedURL(ctx context.Context, key string) (string, error)
+	// Delete removes a file. Removing a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+type BlobInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// How long signed upload and download URLs stay valid
+const blobURLExpiry = 15 * time.Minute
+
+// Without a BlobStore there is nowhere to keep images
+var errImagesUnsupported = errors.New("images are not supported without a blob storage")
+
+// Clients upload to keys under uploadPrefix followed by their user id.
+// Processing moves an upload to imagePrefix and stores its variants, so only
+// images under imagePrefix have variants.
+const (
+	uploadPrefix  = "uploads/"
+	imagePrefix   = "images/"
+	variantPrefix = "variants/"
+)
+
+// imageVariantKey returns the key of a variant of a processed image
+func imageVariantKey(imageKey, variant string) string {
+	return variantPrefix + variant + "/" + strings.TrimPrefix(imageKey, imagePrefix)
+}
+
+// processImage replaces an upload of a user with an image that has no
+// metadata and is limited in size, and stores its variants next to it. It
+// returns the image as a medium without alt text.
+func processImage(ctx context.Context, blobs BlobStore, userId, uploadKey string) (*entity.Media, error) {
+	if blobs == nil {
+		return nil, errImagesUnsupported
+	}
+
+	// The image of a post is visible to everyone, processing it on behalf of
+	// another user would take it away from the post
+	if userId == "" || !strings.HasPrefix(uploadKey, uploadPrefix+userId+"/") {
+		return nil, fmt.Errorf("%w: %s is not an upload of the user", ErrInvalidImage, uploadKey)
+	}
+
+	body, err := blobs.Get(ctx, uploadKey)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: upload %s not found", ErrInvalidImage, uploadKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload %s: %w", uploadKey, err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, imaging.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload %s: %w", uploadKey, err)
+	}
+
+	result, err := imaging.Process(data)
+	if err != nil {
+		// A rejected upload can never be used, so it is not kept either
+		deleteErr := blobs.Delete(ctx, uploadKey)
+		if deleteErr != nil {
+			log.Printf("Failed to delete rejected upload %s: %v", uploadKey, deleteErr)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+
+	imageKey := imagePrefix + strings.TrimPrefix(uploadKey, uploadPrefix)
+	for i, variant := range imaging.Variants {
+		err = blobs.Put(ctx, imageVariantKey(imageKey, variant.Name), result.Variants[i].ContentType, result.Variants[i].Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s variant: %w", variant.Name, err)
+		}
+	}
+
+	// The image is stored last, so every image has its variants
+	err = blobs.Put(ctx, imageKey, result.Image.ContentType, result.Image.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store image: %w", err)
+	}
+
+	// The upload is no longer needed, a leftover one is never served
+	err = blobs.Delete(ctx, uploadKey)
+	if err != nil {
+		log.Printf("Failed to delete processed upload %s: %v", uploadKey, err)
+	}
+
+	return &entity.Media{
+		Key:         imageKey,
+		Width:       result.Image.Width,
+		Height:      result.Image.Height,
+		ContentType: result.Image.ContentType,
+	}, nil
+}
+
+// validateMedia checks that every image of a post was uploaded
+func validateMedia(ctx context.Context, blobs BlobStore, media []entity.Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	if blobs == nil {
+		return errImagesUnsupported
+	}
+
+	for _, medium := range media {
+		_, err := blobs.Head(ctx, medium.Key)
+		if err != nil {
+			return fmt.Errorf("image %s: %w", medium.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// setImageURL signs the URLs of the images of a post and of their variants.
+// Images from before processing have no variants. The media are replaced
+// rather than changed, since copies of a post share them.
+func setImageURL(ctx context.Context, blobs BlobStore, post *entity.Post) error {
+	if post == nil || len(post.Media) == 0 || blobs == nil {
+		return nil
+	}
+
+	media := slices.Clone(post.Media)
+	for i := range media {
+		medium := &media[i]
+		medium.URL, medium.ThumbnailURL, medium.MediumURL = nil, nil, nil
+
+		url, err := blobs.SignedURL(ctx, medium.Key)
+		if err != nil {
+			log.Printf("Couldn't get signed URL for key %s. Here's why: %v\n", medium.Key, err)
+			return err
+		}
+		medium.URL = &url
+
+		if !strings.HasPrefix(medium.Key, imagePrefix) {
+			continue
+		}
+
+		thumbnailURL, err := blobs.SignedURL(ctx, imageVariantKey(medium.Key, imaging.Thumbnail))
+		if err != nil {
+			return err
+		}
+
+		mediumURL, err := blobs.SignedURL(ctx, imageVariantKey(medium.Key, imaging.Medium))
+		if err != nil {
+			return err
+		}
+
+		medium.ThumbnailURL, medium.MediumURL = &thumbnailURL, &mediumURL
+	}
+
+	post.Media = media
+	return nil
+}
+
+// setImageURLs signs the image URLs of posts and of the posts they reference
+func setImageURLs(ctx context.Context, blobs BlobStore, posts []*entity.Post) error {
+	for _, post := range posts {
+		err := setImageURL(ctx, blobs, post)
+		if err != nil {
+			return fmt.Errorf("failed to set image url: %w", err)
+		}
+
+		err = setImageURL(ctx, blobs, post.Referenced)
+		if err != nil {
+			return fmt.Errorf("failed to set image url: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteMedia deletes all images of a post together with their variants
+func deleteMedia(ctx context.Context, blobs BlobStore, media []entity.Media) error {
+	for _, medium := range media {
+		err := deleteImage(ctx, blobs, medium.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteImage deletes an image together with its variants
+func deleteImage(ctx context.Context, blobs BlobStore, imageKey string) error {
+	if imageKey == "" || blobs == nil {
+		return nil
+	}
+
+	if strings.HasPrefix(imageKey, imagePrefix) {
+		for _, variant := range imaging.Variants {
+			err := blobs.Delete(ctx, imageVariantKey(imageKey, variant.Name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return blobs.Delete(ctx, imageKey)
+}
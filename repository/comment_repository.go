@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
@@ -26,13 +28,15 @@ func NewDefaultCommentRepository(db *dynamodb.Client, tableName string) *Default
 
 type CommentRepository interface {
 	Create(ctx context.Context, comment *entity.Comment) (*entity.Comment, error)
-	GetByPostID(ctx context.Context, postId string) ([]*entity.Comment, error)
-	GetRawByPostID(ctx context.Context, postId string) ([]map[string]types.AttributeValue, error)
+	GetPageByPostID(ctx context.Context, postId, parentId string, limit int32, cursor string) ([]*entity.Comment, string, error)
 	Get(ctx context.Context, postId, commentId string) (*entity.Comment, error)
-	Update(ctx context.Context, postId, commentId, text string) (*entity.Comment, error)
-	Delete(ctx context.Context, postId, commentId string) error
+	Update(ctx context.Context, postId, commentId, text string, mentions []entity.Mention) (*entity.Comment, error)
+	Delete(ctx context.Context, postId, commentId, parentId string) error
+	SoftDelete(ctx context.Context, postId, commentId string) error
 }
 
+// Create stores the comment. Replies also increment the reply count of their
+// parent in the same transaction.
 func (r *DefaultCommentRepository) Create(ctx context.Context, comment *entity.Comment) (*entity.Comment, error) {
 	if comment == nil {
 		return nil, fmt.Errorf("input comment cannot be nil")
@@ -43,51 +47,88 @@ func (r *DefaultCommentRepository) Create(ctx context.Context, comment *entity.C
 		return nil, fmt.Errorf("failed to marshal user to DynamoDB attribute values: %w", err)
 	}
 
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(r.TableName),
+	if comment.ParentID == "" {
+		input := &dynamodb.PutItemInput{
+			Item:      av,
+			TableName: aws.String(r.TableName),
+		}
+
+		_, err = r.DB.PutItem(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", comment.PK, err)
+		}
+
+		return comment, nil
 	}
 
-	_, err = r.DB.PutItem(ctx, input)
+	postId := strings.TrimPrefix(comment.PK, "post#")
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName: aws.String(r.TableName),
+					Item:      av,
+				},
+			},
+			counterUpdate(r.TableName, commentKey(postId, comment.ParentID), "reply_count", 1),
+		},
+	})
+	if conditionFailedAt(err, 1) {
+		return nil, ErrCommentNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", comment.PK, err)
+		return nil, fmt.Errorf("failed to put reply (PK: %s) to DynamoDB: %w", comment.PK, err)
 	}
 
 	return comment, nil
 }
 
-func (r *DefaultCommentRepository) GetByPostID(ctx context.Context, postId string) ([]*entity.Comment, error) {
-	var allRawItems []map[string]types.AttributeValue
-	var comments []*entity.Comment
-
-	partitionKey := "post#" + postId
+// GetPageByPostID returns one page of the direct replies to a comment, or of
+// the top level comments when parentId is empty. Top level comments are
+// newest first, replies are in the order they were written.
+func (r *DefaultCommentRepository) GetPageByPostID(ctx context.Context, postId, parentId string, limit int32, cursor string) ([]*entity.Comment, string, error) {
+	indexKey := entity.CommentThread(postId, parentId)
 
 	input := &dynamodb.QueryInput{
 		TableName:              aws.String(r.TableName),
-		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		IndexName:              aws.String("gsi1"),
+		KeyConditionExpression: aws.String("gsi1_pk = :pk"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
-			":sk_prefix": &types.AttributeValueMemberS{Value: "comment#"},
+			":pk": &types.AttributeValueMemberS{Value: indexKey},
 		},
-		ScanIndexForward: aws.Bool(false),
+		ScanIndexForward: aws.Bool(parentId != ""),
+		Limit:            aws.Int32(limit),
 	}
 
-	paginator := dynamodb.NewQueryPaginator(r.DB, input)
-
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk", "gsi1_pk", "gsi1_sk")
 		if err != nil {
-			return nil, fmt.Errorf("failed to get next page of query results: %w", err)
+			return nil, "", err
 		}
-		allRawItems = append(allRawItems, page.Items...)
+		if values["gsi1_pk"] != indexKey || values["pk"] != "post#"+postId || values["sk"] != "comment#"+values["gsi1_sk"] {
+			return nil, "", ErrInvalidCursor
+		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query comments of post %s: %w", postId, err)
+	}
+
+	var comments []*entity.Comment
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &comments)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
 	}
 
-	err := attributevalue.UnmarshalListOfMaps(allRawItems, &comments)
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
 	}
 
-	return comments, nil
+	return comments, nextCursor, nil
 }
 
 func (r *DefaultCommentRepository) GetRawByPostID(ctx context.Context, postId string) ([]map[string]types.AttributeValue, error) {
@@ -135,7 +176,7 @@ func (r *DefaultCommentRepository) Get(ctx context.Context, postId, commentId st
 	}
 
 	if result.Item == nil {
-		return nil, fmt.Errorf("item not found")
+		return nil, ErrCommentNotFound
 	}
 
 	comment := entity.Comment{}
@@ -147,7 +188,7 @@ func (r *DefaultCommentRepository) Get(ctx context.Context, postId, commentId st
 	return &comment, nil
 }
 
-func (r *DefaultCommentRepository) Update(ctx context.Context, postId, commentId, text string) (*entity.Comment, error) {
+func (r *DefaultCommentRepository) Update(ctx context.Context, postId, commentId, text string, mentions []entity.Mention) (*entity.Comment, error) {
 	key := map[string]types.AttributeValue{
 		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("post#%s", postId)},
 		"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("comment#%s", commentId)},
@@ -155,14 +196,26 @@ func (r *DefaultCommentRepository) Update(ctx context.Context, postId, commentId
 
 	updateExpression := ("SET #text = :text, #edited = :edited")
 	expressionAttributeNames := map[string]string{
-		"#text":   "text",
-		"#edited": "edited",
+		"#text":     "text",
+		"#edited":   "edited",
+		"#mentions": "mentions",
 	}
 	expressionAttributeValues := map[string]types.AttributeValue{
 		":text":   &types.AttributeValueMemberS{Value: text},
 		":edited": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339Nano)},
 	}
 
+	if len(mentions) > 0 {
+		mentionsAv, err := attributevalue.Marshal(mentions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal mentions: %w", err)
+		}
+		updateExpression += ", #mentions = :mentions"
+		expressionAttributeValues[":mentions"] = mentionsAv
+	} else {
+		updateExpression += " REMOVE #mentions"
+	}
+
 	input := &dynamodb.UpdateItemInput{
 		TableName:                 &r.TableName,
 		Key:                       key,
@@ -187,27 +240,67 @@ func (r *DefaultCommentRepository) Update(ctx context.Context, postId, commentId
 	return &updatedComment, nil
 }
 
-func (r *DefaultCommentRepository) Delete(ctx context.Context, postId, commentId string) error {
-	key := map[string]types.AttributeValue{
-		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("post#%s", postId)},
-		"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("comment#%s", commentId)},
+// Delete removes a comment without replies. Replies also decrement the reply
+// count of their parent in the same transaction.
+func (r *DefaultCommentRepository) Delete(ctx context.Context, postId, commentId, parentId string) error {
+	transactItems := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName: aws.String(r.TableName),
+				Key:       commentKey(postId, commentId),
+				// Replies may have been added since the comment was read
+				ConditionExpression: aws.String("attribute_exists(pk) AND (attribute_not_exists(reply_count) OR reply_count = :zero)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":zero": &types.AttributeValueMemberN{Value: "0"},
+				},
+			},
+		},
 	}
 
-	dynamoDbInput := &dynamodb.DeleteItemInput{
-		TableName:    aws.String(r.TableName),
-		Key:          key,
-		ReturnValues: types.ReturnValueAllOld,
+	if parentId != "" {
+		transactItems = append(transactItems, counterUpdate(r.TableName, commentKey(postId, parentId), "reply_count", -1))
 	}
 
-	result, err := r.DB.DeleteItem(ctx, dynamoDbInput)
+	_, err := r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if conditionFailedAt(err, 0) {
+		return ErrCommentHasReplies
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete item: %w", err)
+		return fmt.Errorf("failed to delete comment %s: %w", commentId, err)
+	}
+
+	return nil
+}
+
+// SoftDelete replaces a comment with a placeholder so its replies stay
+// reachable
+func (r *DefaultCommentRepository) SoftDelete(ctx context.Context, postId, commentId string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.TableName),
+		Key:                 commentKey(postId, commentId),
+		UpdateExpression:    aws.String("SET #deleted = :deleted, #text = :text REMOVE #edited, #mentions"),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+		ExpressionAttributeNames: map[string]string{
+			"#deleted":  "deleted",
+			"#text":     "text",
+			"#edited":   "edited",
+			"#mentions": "mentions",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":deleted": &types.AttributeValueMemberBOOL{Value: true},
+			":text":    &types.AttributeValueMemberS{Value: ""},
+		},
 	}
 
-	deletedComment := entity.Comment{}
-	err = attributevalue.UnmarshalMap(result.Attributes, &deletedComment)
+	_, err := r.DB.UpdateItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrCommentNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("error unmarshalling item: %w", err)
+		return fmt.Errorf("failed to soft delete comment %s: %w", commentId, err)
 	}
 
 	return nil
@@ -0,0 +1,1048 @@
+// Package conformance checks that a storage backend behaves like the
+// DynamoDB repositories: the same ordering, pagination, counters, cascades
+// and errors. Every check creates its own users with fresh ids, but the
+// timeline checks expect nobody else to write while they run, so run the
+// suite against a dedicated database or table.
+//
+// go test runs it against memory and SQLite, and against Postgres and
+// DynamoDB when TEST_DATABASE_URL or TEST_TABLE_NAME are set.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/oklog/ulid/v2"
+)
+
+// Check is one behaviour every backend must share
+type Check struct {
+	Name string
+	Run  func(ctx context.Context, repositories *repository.Repositories) error
+}
+
+var Checks = []Check{
+	{"users and handles", checkUsers},
+	{"follows and counters", checkFollows},
+	{"blocks and mutes", checkBlocks},
+	{"follow requests", checkFollowRequests},
+	{"posts and timelines", checkPosts},
+	{"timeline paging", checkTimelinePaging},
+	{"tags", checkTags},
+	{"likes", checkLikes},
+	{"comments and replies", checkComments},
+	{"post delete cascade", checkPostDelete},
+	{"inboxes", checkInboxes},
+	{"notifications", checkNotifications},
+	{"conversations", checkConversations},
+}
+
+// Failure is a check that did not pass
+type Failure struct {
+	Check string
+	Err   error
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s: %v", f.Check, f.Err)
+}
+
+// Run runs every check as a subtest of a backend's test
+func Run(t *testing.T, repositories *repository.Repositories) {
+	for _, check := range Checks {
+		t.Run(check.Name, func(t *testing.T) {
+			err := check.Run(t.Context(), repositories)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// RunAll runs every check and returns those that failed, for running the
+// suite outside of go test
+func RunAll(ctx context.Context, repositories *repository.Repositories) []Failure {
+	var failures []Failure
+	for _, check := range Checks {
+		err := check.Run(ctx, repositories)
+		if err != nil {
+			failures = append(failures, Failure{Check: check.Name, Err: err})
+		}
+	}
+	return failures
+}
+
+func expect(ok bool, format string, args ...any) error {
+	if !ok {
+		return fmt.Errorf(format, args...)
+	}
+	return nil
+}
+
+func expectErr(err, target error) error {
+	if !errors.Is(err, target) {
+		return fmt.Errorf("expected %v, got %v", target, err)
+	}
+	return nil
+}
+
+// first returns the first error, so a check reads as a list of expectations
+func first(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newUsers creates users with fresh ids and no handle
+func newUsers(ctx context.Context, repositories *repository.Repositories, count int) ([]*entity.User, error) {
+	users := make([]*entity.User, 0, count)
+	for i := 0; i < count; i++ {
+		user, _ := entity.NewUser(ulid.Make().String(), fmt.Sprintf("user %d", i), "user@example.com", "")
+		_, err := repositories.UserRepository.Create(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func getUser(ctx context.Context, repositories *repository.Repositories, id string) (*entity.User, error) {
+	user, err := repositories.UserRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", id)
+	}
+	return user, nil
+}
+
+func follow(ctx context.Context, repositories *repository.Repositories, followerID, followingID string) error {
+	f, _ := entity.NewFollow(followerID, followingID)
+	follower, _ := entity.NewFollower(followerID, followingID)
+	_, err := repositories.UserRepository.Follow(ctx, f, follower)
+	return err
+}
+
+func unfollow(ctx context.Context, repositories *repository.Repositories, followerID, followingID string) error {
+	u, _ := entity.NewUnfollow(followerID, followingID)
+	removeFollower, _ := entity.NewRemoveFollower(followerID, followingID)
+	return repositories.UserRepository.Unfollow(ctx, u, removeFollower)
+}
+
+func newPost(ctx context.Context, repositories *repository.Repositories, user *entity.User, text string, reference *entity.PostReference) (*entity.Post, error) {
+	post, _ := entity.NewPost(user.ID, user.Name, text, nil, reference)
+	_, err := repositories.PostRepository.Create(ctx, post)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+	return post, nil
+}
+
+func newComment(ctx context.Context, repositories *repository.Repositories, post *entity.Post, user *entity.User, parentID string) (*entity.Comment, error) {
+	comment, _ := entity.NewComment(post.ID, user.ID, user.Name, "a comment", parentID)
+	_, err := repositories.CommentRepository.Create(ctx, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	return comment, nil
+}
+
+func postIDs(posts []*entity.Post) []string {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	return ids
+}
+
+func commentIDs(comments []*entity.Comment) []string {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	return ids
+}
+
+func checkUsers(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 3)
+	if err != nil {
+		return err
+	}
+
+	// Handles are at most 15 characters, the end of a ULID is random
+	handle := strings.ToLower("h" + ulid.Make().String()[16:])
+	claimed := users[0]
+	claimed.Handle = handle
+	_, err = repositories.UserRepository.Create(ctx, claimed)
+	if err != nil {
+		return err
+	}
+
+	taken, _ := entity.NewUser(ulid.Make().String(), "taken", "taken@example.com", "")
+	taken.Handle = handle
+	_, err = repositories.UserRepository.Create(ctx, taken)
+	if err := expectErr(err, repository.ErrHandleTaken); err != nil {
+		return fmt.Errorf("create with a taken handle: %w", err)
+	}
+
+	if err := expectErr(repositories.UserRepository.ClaimHandle(ctx, users[1].ID, handle), repository.ErrHandleTaken); err != nil {
+		return fmt.Errorf("claim a taken handle: %w", err)
+	}
+
+	secondHandle := strings.ToLower("i" + ulid.Make().String()[16:])
+	err = repositories.UserRepository.ClaimHandle(ctx, users[1].ID, secondHandle)
+	if err != nil {
+		return fmt.Errorf("claim a free handle: %w", err)
+	}
+
+	ids, err := repositories.UserRepository.GetIDsByHandles(ctx, []string{handle, secondHandle, "nobody_" + handle[:5]})
+	if err != nil {
+		return err
+	}
+
+	missing, err := repositories.UserRepository.GetByID(ctx, ulid.Make().String())
+	if err != nil {
+		return err
+	}
+
+	byIDs, err := repositories.UserRepository.GetByIDs(ctx, []string{users[2].ID, ulid.Make().String(), users[0].ID})
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(len(ids) == 2 && ids[handle] == users[0].ID && ids[secondHandle] == users[1].ID, "handles resolved to %v", ids),
+		expect(missing == nil, "expected no user for an unknown id, got %v", missing),
+		expect(len(byIDs) == 2 && byIDs[0].ID == users[2].ID && byIDs[1].ID == users[0].ID, "GetByIDs must keep the order and skip unknown ids"),
+	)
+}
+
+func checkFollows(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 4)
+	if err != nil {
+		return err
+	}
+	target := users[0]
+
+	for _, user := range users[1:] {
+		err := follow(ctx, repositories, user.ID, target.ID)
+		if err != nil {
+			return fmt.Errorf("follow: %w", err)
+		}
+	}
+
+	if err := expectErr(follow(ctx, repositories, users[1].ID, target.ID), repository.ErrAlreadyFollowing); err != nil {
+		return fmt.Errorf("follow twice: %w", err)
+	}
+	if err := expectErr(follow(ctx, repositories, users[1].ID, ulid.Make().String()), repository.ErrUserNotFound); err != nil {
+		return fmt.Errorf("follow an unknown user: %w", err)
+	}
+
+	followed, err := getUser(ctx, repositories, target.ID)
+	if err != nil {
+		return err
+	}
+	follower, err := getUser(ctx, repositories, users[1].ID)
+	if err != nil {
+		return err
+	}
+
+	// Followers are paged in the order of their ids
+	expected := []string{users[1].ID, users[2].ID, users[3].ID}
+	slices.Sort(expected)
+
+	var paged []string
+	cursor := ""
+	for {
+		page, nextCursor, err := repositories.UserRepository.GetFollowersPage(ctx, target.ID, 2, cursor)
+		if err != nil {
+			return err
+		}
+		for _, f := range page {
+			paged = append(paged, f.FollowerID)
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	isFollowing, err := repositories.UserRepository.IsFollowing(ctx, users[1].ID, target.ID)
+	if err != nil {
+		return err
+	}
+
+	err = unfollow(ctx, repositories, users[1].ID, target.ID)
+	if err != nil {
+		return fmt.Errorf("unfollow: %w", err)
+	}
+	if err := expectErr(unfollow(ctx, repositories, users[1].ID, target.ID), repository.ErrNotFollowing); err != nil {
+		return fmt.Errorf("unfollow twice: %w", err)
+	}
+
+	unfollowed, err := getUser(ctx, repositories, target.ID)
+	if err != nil {
+		return err
+	}
+	followerIDs, err := repositories.UserRepository.GetFollowerIDs(ctx, target.ID)
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(followed.FollowersCount == 3, "expected 3 followers, got %d", followed.FollowersCount),
+		expect(follower.FollowingCount == 1, "expected 1 following, got %d", follower.FollowingCount),
+		expect(slices.Equal(paged, expected), "expected followers %v, got %v", expected, paged),
+		expect(isFollowing, "expected the follow to exist"),
+		expect(unfollowed.FollowersCount == 2, "expected 2 followers after unfollow, got %d", unfollowed.FollowersCount),
+		expect(len(followerIDs) == 2 && !slices.Contains(followerIDs, users[1].ID), "unexpected followers %v after unfollow", followerIDs),
+	)
+}
+
+func checkBlocks(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 2)
+	if err != nil {
+		return err
+	}
+	blocker, blocked := users[0], users[1]
+
+	err = first(follow(ctx, repositories, blocker.ID, blocked.ID), follow(ctx, repositories, blocked.ID, blocker.ID))
+	if err != nil {
+		return err
+	}
+
+	request, _ := entity.NewFollowRequest(blocked.ID, blocker.ID)
+	err = repositories.UserRepository.CreateFollowRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	block, _ := entity.NewBlock(blocker.ID, blocked.ID)
+	err = repositories.UserRepository.Block(ctx, block)
+	if err != nil {
+		return fmt.Errorf("block: %w", err)
+	}
+	if err := expectErr(repositories.UserRepository.Block(ctx, block), repository.ErrAlreadyBlocked); err != nil {
+		return fmt.Errorf("block twice: %w", err)
+	}
+
+	following, err := repositories.UserRepository.IsFollowing(ctx, blocked.ID, blocker.ID)
+	if err != nil {
+		return err
+	}
+	isBlocked, err := repositories.UserRepository.IsBlocked(ctx, blocker.ID, blocked.ID)
+	if err != nil {
+		return err
+	}
+	requests, _, err := repositories.UserRepository.GetFollowRequestsPage(ctx, blocker.ID, 10, "")
+	if err != nil {
+		return err
+	}
+	blockerUser, err := getUser(ctx, repositories, blocker.ID)
+	if err != nil {
+		return err
+	}
+	blockers, err := repositories.UserRepository.GetBlockerIDs(ctx, blocked.ID, []string{blocker.ID, ulid.Make().String()})
+	if err != nil {
+		return err
+	}
+
+	err = repositories.UserRepository.Unblock(ctx, blocker.ID, blocked.ID)
+	if err != nil {
+		return fmt.Errorf("unblock: %w", err)
+	}
+	if err := expectErr(repositories.UserRepository.Unblock(ctx, blocker.ID, blocked.ID), repository.ErrNotBlocked); err != nil {
+		return fmt.Errorf("unblock twice: %w", err)
+	}
+
+	mute, _ := entity.NewMute(blocker.ID, blocked.ID)
+	err = repositories.UserRepository.Mute(ctx, mute)
+	if err != nil {
+		return fmt.Errorf("mute: %w", err)
+	}
+	if err := expectErr(repositories.UserRepository.Mute(ctx, mute), repository.ErrAlreadyMuted); err != nil {
+		return fmt.Errorf("mute twice: %w", err)
+	}
+	muted, err := repositories.UserRepository.GetMutedIDs(ctx, blocker.ID)
+	if err != nil {
+		return err
+	}
+
+	unknown, _ := entity.NewMute(blocker.ID, ulid.Make().String())
+	if err := expectErr(repositories.UserRepository.Mute(ctx, unknown), repository.ErrUserNotFound); err != nil {
+		return fmt.Errorf("mute an unknown user: %w", err)
+	}
+
+	err = repositories.UserRepository.Unmute(ctx, blocker.ID, blocked.ID)
+	if err != nil {
+		return fmt.Errorf("unmute: %w", err)
+	}
+
+	return first(
+		expect(!following, "block must remove the follows of both users"),
+		expect(isBlocked, "expected the block to exist"),
+		expect(len(requests) == 0, "block must remove the follow requests between both users"),
+		expect(blockerUser.FollowersCount == 0 && blockerUser.FollowingCount == 0, "block must update the counters, got %d followers and %d following",
+			blockerUser.FollowersCount, blockerUser.FollowingCount),
+		expect(len(blockers) == 1 && blockers[blocker.ID], "unexpected blockers %v", blockers),
+		expect(slices.Equal(muted, []string{blocked.ID}), "unexpected muted users %v", muted),
+		expectErr(repositories.UserRepository.Unmute(ctx, blocker.ID, blocked.ID), repository.ErrNotMuted),
+	)
+}
+
+func checkFollowRequests(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 3)
+	if err != nil {
+		return err
+	}
+	private := users[0]
+
+	for _, user := range users[1:] {
+		request, _ := entity.NewFollowRequest(user.ID, private.ID)
+		err := repositories.UserRepository.CreateFollowRequest(ctx, request)
+		if err != nil {
+			return fmt.Errorf("request: %w", err)
+		}
+	}
+
+	request, _ := entity.NewFollowRequest(users[1].ID, private.ID)
+	if err := expectErr(repositories.UserRepository.CreateFollowRequest(ctx, request), repository.ErrAlreadyRequested); err != nil {
+		return fmt.Errorf("request twice: %w", err)
+	}
+
+	requests, cursor, err := repositories.UserRepository.GetFollowRequestsPage(ctx, private.ID, 1, "")
+	if err != nil {
+		return err
+	}
+	rest, lastCursor, err := repositories.UserRepository.GetFollowRequestsPage(ctx, private.ID, 1, cursor)
+	if err != nil {
+		return err
+	}
+
+	f, _ := entity.NewFollow(users[1].ID, private.ID)
+	follower, _ := entity.NewFollower(users[1].ID, private.ID)
+	err = repositories.UserRepository.ApproveFollowRequest(ctx, f, follower)
+	if err != nil {
+		return fmt.Errorf("approve: %w", err)
+	}
+	if err := expectErr(repositories.UserRepository.ApproveFollowRequest(ctx, f, follower), repository.ErrRequestNotFound); err != nil {
+		return fmt.Errorf("approve twice: %w", err)
+	}
+
+	following, err := repositories.UserRepository.IsFollowing(ctx, users[1].ID, private.ID)
+	if err != nil {
+		return err
+	}
+
+	err = repositories.UserRepository.DeleteFollowRequest(ctx, private.ID, users[2].ID)
+	if err != nil {
+		return fmt.Errorf("reject: %w", err)
+	}
+
+	return first(
+		expect(len(requests) == 1 && len(rest) == 1 && cursor != "" && lastCursor == "", "expected two pages of one request"),
+		expect(requests[0].RequesterID < rest[0].RequesterID, "requests must be ordered by requester"),
+		expect(following, "approving must follow"),
+		expectErr(repositories.UserRepository.DeleteFollowRequest(ctx, private.ID, users[2].ID), repository.ErrRequestNotFound),
+	)
+}
+
+func checkPosts(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 2)
+	if err != nil {
+		return err
+	}
+	author := users[0]
+
+	var posts []*entity.Post
+	for i := 0; i < 3; i++ {
+		post, err := newPost(ctx, repositories, author, fmt.Sprintf("post %d", i), nil)
+		if err != nil {
+			return err
+		}
+		posts = append(posts, post)
+	}
+
+	reference := &entity.PostReference{Kind: entity.ReferenceQuote, UserID: author.ID, PostID: posts[0].ID}
+	quote, err := newPost(ctx, repositories, users[1], "a quote", reference)
+	if err != nil {
+		return err
+	}
+
+	// The timeline is newest first and pages pick up after the cursor
+	timeline, cursor, err := repositories.PostRepository.GetAll(ctx, 2, "")
+	if err != nil {
+		return err
+	}
+	older, _, err := repositories.PostRepository.GetAll(ctx, 2, cursor)
+	if err != nil {
+		return err
+	}
+
+	byUser, err := repositories.PostRepository.GetPageByUserID(ctx, author.ID, posts[2].ID, 10)
+	if err != nil {
+		return err
+	}
+
+	authorUser, err := getUser(ctx, repositories, author.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = repositories.PostRepository.Get(ctx, users[1].ID, posts[0].ID)
+	if err := expectErr(err, repository.ErrPostNotFound); err != nil {
+		return fmt.Errorf("get with the wrong author: %w", err)
+	}
+
+	updated, err := repositories.PostRepository.Update(ctx, author.ID, posts[0].ID, "edited", nil, nil)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	quoted, err := repositories.PostRepository.GetByID(ctx, quote.ID)
+	if err != nil {
+		return err
+	}
+	err = repositories.PostRepository.AttachReferences(ctx, []*entity.Post{quoted})
+	if err != nil {
+		return err
+	}
+
+	err = repositories.PostRepository.Delete(ctx, author.ID, posts[0].ID)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	orphan, err := repositories.PostRepository.GetByID(ctx, quote.ID)
+	if err != nil {
+		return err
+	}
+	err = repositories.PostRepository.AttachReferences(ctx, []*entity.Post{orphan})
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(slices.Equal(postIDs(timeline), []string{quote.ID, posts[2].ID}) && cursor != "", "unexpected first timeline page %v", postIDs(timeline)),
+		expect(len(older) == 2 && older[0].ID == posts[1].ID && older[1].ID == posts[0].ID, "unexpected second timeline page %v", postIDs(older)),
+		expect(slices.Equal(postIDs(byUser), []string{posts[1].ID, posts[0].ID}), "unexpected posts of user %v", postIDs(byUser)),
+		expect(authorUser.PostsCount == 3, "expected 3 posts, got %d", authorUser.PostsCount),
+		expect(updated.Text == "edited" && updated.Edited != nil, "update must change the text and set edited"),
+		expect(quoted.Referenced != nil && quoted.Referenced.Text == "edited", "quotes must reference the current original"),
+		expect(orphan.Referenced == nil, "quotes of deleted posts must have no original"),
+	)
+}
+
+// checkTimelinePaging walks the timeline page by page. Posts created within
+// the same millisecond still page in creation order, and posts created while
+// paging do not shift the later pages.
+func checkTimelinePaging(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 1)
+	if err != nil {
+		return err
+	}
+
+	var want []string
+	for i := 0; i < 7; i++ {
+		post, err := newPost(ctx, repositories, users[0], fmt.Sprintf("post %d", i), nil)
+		if err != nil {
+			return err
+		}
+		want = append(want, post.ID)
+	}
+	slices.Reverse(want)
+
+	// Posts of other checks are older, so paging stops after the own ones
+	var got []string
+	cursor := ""
+	for len(got) < len(want) {
+		posts, nextCursor, err := repositories.PostRepository.GetAll(ctx, 3, cursor)
+		if err != nil {
+			return fmt.Errorf("page after %q: %w", cursor, err)
+		}
+		got = append(got, postIDs(posts)...)
+
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+
+		// A new post is newer than every cursor, so it is not on a later page
+		_, err = newPost(ctx, repositories, users[0], "a newer post", nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, _, err = repositories.PostRepository.GetAll(ctx, 3, cursor+"x")
+
+	return first(
+		expect(len(got) >= len(want) && slices.Equal(got[:len(want)], want), "unexpected timeline pages %v, want %v", got, want),
+		expectErr(err, repository.ErrInvalidCursor),
+	)
+}
+
+func checkTags(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 1)
+	if err != nil {
+		return err
+	}
+
+	// Tags are unique to this run so other data does not show up
+	tag := "t" + ulid.Make().String()[16:]
+	since := time.Now().Add(-time.Minute)
+
+	tagged, err := newPost(ctx, repositories, users[0], "first #"+tag, nil)
+	if err != nil {
+		return err
+	}
+	newer, err := newPost(ctx, repositories, users[0], "second #"+tag, nil)
+	if err != nil {
+		return err
+	}
+
+	// tags are stored lower case
+	tag = entity.ParseTags("#" + tag)[0]
+	posts, _, err := repositories.PostRepository.GetByTag(ctx, tag, 10, "")
+	if err != nil {
+		return err
+	}
+	counts, err := repositories.PostRepository.CountTagsSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	_, err = repositories.PostRepository.Update(ctx, users[0].ID, tagged.ID, "untagged", nil, nil)
+	if err != nil {
+		return err
+	}
+	afterUpdate, _, err := repositories.PostRepository.GetByTag(ctx, tag, 10, "")
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(slices.Equal(postIDs(posts), []string{newer.ID, tagged.ID}), "unexpected tagged posts %v", postIDs(posts)),
+		expect(counts[tag][users[0].ID] == 2, "expected the tag to be counted twice for its author, got %v", counts[tag]),
+		expect(slices.Equal(postIDs(afterUpdate), []string{newer.ID}), "update must remove the tags the text lost, got %v", postIDs(afterUpdate)),
+	)
+}
+
+func checkLikes(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 2)
+	if err != nil {
+		return err
+	}
+
+	post, err := newPost(ctx, repositories, users[0], "likeable", nil)
+	if err != nil {
+		return err
+	}
+
+	like, _ := entity.NewLike(post.ID, users[1].ID)
+	err = repositories.PostRepository.Like(ctx, like, users[0].ID)
+	if err != nil {
+		return fmt.Errorf("like: %w", err)
+	}
+	if err := expectErr(repositories.PostRepository.Like(ctx, like, users[0].ID), repository.ErrAlreadyLiked); err != nil {
+		return fmt.Errorf("like twice: %w", err)
+	}
+
+	liked, err := repositories.PostRepository.GetByID(ctx, post.ID)
+	if err != nil {
+		return err
+	}
+	likedIDs, err := repositories.PostRepository.GetLikedPostIDs(ctx, users[1].ID, []string{post.ID, ulid.Make().String()})
+	if err != nil {
+		return err
+	}
+
+	err = repositories.PostRepository.Unlike(ctx, post.ID, users[1].ID, users[0].ID)
+	if err != nil {
+		return fmt.Errorf("unlike: %w", err)
+	}
+	unliked, err := repositories.PostRepository.GetByID(ctx, post.ID)
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(liked.LikeCount == 1, "expected 1 like, got %d", liked.LikeCount),
+		expect(len(likedIDs) == 1 && likedIDs[post.ID], "unexpected liked posts %v", likedIDs),
+		expect(unliked.LikeCount == 0, "expected no likes after unlike, got %d", unliked.LikeCount),
+		expectErr(repositories.PostRepository.Unlike(ctx, post.ID, users[1].ID, users[0].ID), repository.ErrNotLiked),
+	)
+}
+
+func checkComments(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 1)
+	if err != nil {
+		return err
+	}
+
+	post, err := newPost(ctx, repositories, users[0], "commented", nil)
+	if err != nil {
+		return err
+	}
+
+	var topLevel, replies []*entity.Comment
+	for i := 0; i < 2; i++ {
+		comment, err := newComment(ctx, repositories, post, users[0], "")
+		if err != nil {
+			return err
+		}
+		topLevel = append(topLevel, comment)
+	}
+	for i := 0; i < 2; i++ {
+		reply, err := newComment(ctx, repositories, post, users[0], topLevel[0].ID)
+		if err != nil {
+			return err
+		}
+		replies = append(replies, reply)
+	}
+
+	_, err = newComment(ctx, repositories, post, users[0], ulid.Make().String())
+	if err := expectErr(err, repository.ErrCommentNotFound); err != nil {
+		return fmt.Errorf("reply to an unknown comment: %w", err)
+	}
+
+	// Top level comments are newest first, replies oldest first
+	comments, _, err := repositories.CommentRepository.GetPageByPostID(ctx, post.ID, "", 10, "")
+	if err != nil {
+		return err
+	}
+	firstReplies, cursor, err := repositories.CommentRepository.GetPageByPostID(ctx, post.ID, topLevel[0].ID, 1, "")
+	if err != nil {
+		return err
+	}
+	moreReplies, _, err := repositories.CommentRepository.GetPageByPostID(ctx, post.ID, topLevel[0].ID, 1, cursor)
+	if err != nil {
+		return err
+	}
+
+	parent, err := repositories.CommentRepository.Get(ctx, post.ID, topLevel[0].ID)
+	if err != nil {
+		return err
+	}
+
+	if err := expectErr(repositories.CommentRepository.Delete(ctx, post.ID, topLevel[0].ID, ""), repository.ErrCommentHasReplies); err != nil {
+		return fmt.Errorf("delete a comment with replies: %w", err)
+	}
+
+	err = repositories.CommentRepository.Delete(ctx, post.ID, replies[0].ID, topLevel[0].ID)
+	if err != nil {
+		return fmt.Errorf("delete a reply: %w", err)
+	}
+	err = repositories.CommentRepository.SoftDelete(ctx, post.ID, topLevel[0].ID)
+	if err != nil {
+		return fmt.Errorf("soft delete: %w", err)
+	}
+	placeholder, err := repositories.CommentRepository.Get(ctx, post.ID, topLevel[0].ID)
+	if err != nil {
+		return err
+	}
+
+	edited, err := repositories.CommentRepository.Update(ctx, post.ID, topLevel[1].ID, "edited", nil)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return first(
+		expect(slices.Equal(commentIDs(comments), []string{topLevel[1].ID, topLevel[0].ID}), "unexpected top level comments %v", commentIDs(comments)),
+		expect(slices.Equal(commentIDs(append(firstReplies, moreReplies...)), commentIDs(replies)), "unexpected replies %v %v", commentIDs(firstReplies), commentIDs(moreReplies)),
+		expect(parent.ReplyCount == 2, "expected 2 replies, got %d", parent.ReplyCount),
+		expect(placeholder.Deleted && placeholder.Text == "" && placeholder.ReplyCount == 1, "soft delete must keep a placeholder with the remaining reply"),
+		expect(edited.Text == "edited" && edited.Edited != nil, "update must change the text and set edited"),
+	)
+}
+
+func checkPostDelete(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 2)
+	if err != nil {
+		return err
+	}
+
+	tag := "d" + ulid.Make().String()[16:]
+	post, err := newPost(ctx, repositories, users[0], "doomed #"+tag, nil)
+	if err != nil {
+		return err
+	}
+	tag = post.Tags[0]
+
+	comment, err := newComment(ctx, repositories, post, users[1], "")
+	if err != nil {
+		return err
+	}
+	_, err = newComment(ctx, repositories, post, users[1], comment.ID)
+	if err != nil {
+		return err
+	}
+
+	like, _ := entity.NewLike(post.ID, users[1].ID)
+	err = repositories.PostRepository.Like(ctx, like, users[0].ID)
+	if err != nil {
+		return err
+	}
+
+	if err := expectErr(repositories.PostRepository.Delete(ctx, users[1].ID, post.ID), repository.ErrPostNotFound); err != nil {
+		return fmt.Errorf("delete with the wrong author: %w", err)
+	}
+
+	err = repositories.PostRepository.Delete(ctx, users[0].ID, post.ID)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	_, err = repositories.PostRepository.GetByID(ctx, post.ID)
+	if err := expectErr(err, repository.ErrPostNotFound); err != nil {
+		return fmt.Errorf("get a deleted post: %w", err)
+	}
+	_, err = repositories.CommentRepository.Get(ctx, post.ID, comment.ID)
+	if err := expectErr(err, repository.ErrCommentNotFound); err != nil {
+		return fmt.Errorf("comments must be deleted with their post: %w", err)
+	}
+
+	comments, _, err := repositories.CommentRepository.GetPageByPostID(ctx, post.ID, comment.ID, 10, "")
+	if err != nil {
+		return err
+	}
+	liked, err := repositories.PostRepository.GetLikedPostIDs(ctx, users[1].ID, []string{post.ID})
+	if err != nil {
+		return err
+	}
+	tagged, _, err := repositories.PostRepository.GetByTag(ctx, tag, 10, "")
+	if err != nil {
+		return err
+	}
+	author, err := getUser(ctx, repositories, users[0].ID)
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(len(comments) == 0, "replies must be deleted with their post"),
+		expect(len(liked) == 0, "likes must be deleted with their post"),
+		expect(len(tagged) == 0, "tags must be deleted with their post"),
+		expect(author.PostsCount == 0, "expected no posts after delete, got %d", author.PostsCount),
+	)
+}
+
+func checkInboxes(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 2)
+	if err != nil {
+		return err
+	}
+	author, owner := users[0], users[1]
+
+	var posts []*entity.Post
+	for i := 0; i < 3; i++ {
+		post, err := newPost(ctx, repositories, author, fmt.Sprintf("distributed %d", i), nil)
+		if err != nil {
+			return err
+		}
+		err = repositories.PostRepository.DistributeToInboxes(ctx, post, []string{owner.ID})
+		if err != nil {
+			return fmt.Errorf("distribute: %w", err)
+		}
+		posts = append(posts, post)
+	}
+
+	inbox, cursor, err := repositories.PostRepository.GetInbox(ctx, owner.ID, 2, "")
+	if err != nil {
+		return err
+	}
+	rest, _, err := repositories.PostRepository.GetInbox(ctx, owner.ID, 2, cursor)
+	if err != nil {
+		return err
+	}
+
+	err = repositories.PostRepository.DeleteInboxCopies(ctx, posts[2].ID)
+	if err != nil {
+		return fmt.Errorf("delete inbox copies: %w", err)
+	}
+	afterDelete, _, err := repositories.PostRepository.GetInbox(ctx, owner.ID, 10, "")
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(slices.Equal(postIDs(append(inbox, rest...)), []string{posts[2].ID, posts[1].ID, posts[0].ID}), "unexpected inbox %v %v", postIDs(inbox), postIDs(rest)),
+		expect(slices.Equal(postIDs(afterDelete), []string{posts[1].ID, posts[0].ID}), "unexpected inbox after delete %v", postIDs(afterDelete)),
+	)
+}
+
+func checkNotifications(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 2)
+	if err != nil {
+		return err
+	}
+	recipient, actor := users[0], users[1]
+
+	var ids []string
+	for _, notificationType := range []string{entity.NotificationFollow, entity.NotificationLike, entity.NotificationComment} {
+		notification, _ := entity.NewNotification(notificationType, recipient.ID, actor.ID, actor.Name, "", "")
+		_, err := repositories.NotificationRepository.Create(ctx, notification)
+		if err != nil {
+			return fmt.Errorf("create: %w", err)
+		}
+		ids = append(ids, notification.ID)
+	}
+
+	page, cursor, err := repositories.NotificationRepository.GetPage(ctx, recipient.ID, 2, "")
+	if err != nil {
+		return err
+	}
+	rest, _, err := repositories.NotificationRepository.GetPage(ctx, recipient.ID, 2, cursor)
+	if err != nil {
+		return err
+	}
+
+	latest, err := repositories.NotificationRepository.GetLatestID(ctx, recipient.ID)
+	if err != nil {
+		return err
+	}
+	neverRead, err := repositories.NotificationRepository.GetLastReadID(ctx, recipient.ID)
+	if err != nil {
+		return err
+	}
+
+	// The marker only moves forward
+	err = first(
+		repositories.NotificationRepository.MarkRead(ctx, recipient.ID, ids[1]),
+		repositories.NotificationRepository.MarkRead(ctx, recipient.ID, ids[0]),
+	)
+	if err != nil {
+		return fmt.Errorf("mark read: %w", err)
+	}
+	lastRead, err := repositories.NotificationRepository.GetLastReadID(ctx, recipient.ID)
+	if err != nil {
+		return err
+	}
+	unread, err := repositories.NotificationRepository.CountUnread(ctx, recipient.ID, lastRead, nil)
+	if err != nil {
+		return err
+	}
+	hiddenUnread, err := repositories.NotificationRepository.CountUnread(ctx, recipient.ID, "", []string{actor.ID, "other"})
+	if err != nil {
+		return err
+	}
+
+	pageIDs := []string{}
+	for _, notification := range append(page, rest...) {
+		pageIDs = append(pageIDs, notification.ID)
+	}
+	slices.Reverse(ids)
+
+	return first(
+		expect(slices.Equal(pageIDs, ids), "expected notifications %v, got %v", ids, pageIDs),
+		expect(latest == ids[0], "expected the latest notification %s, got %s", ids[0], latest),
+		expect(neverRead == "", "expected no read marker, got %s", neverRead),
+		expect(lastRead == ids[1], "expected the read marker at %s, got %s", ids[1], lastRead),
+		expect(unread == 1, "expected 1 unread notification, got %d", unread),
+		expect(hiddenUnread == 0, "expected no unread notifications of hidden actors, got %d", hiddenUnread),
+	)
+}
+
+func checkConversations(ctx context.Context, repositories *repository.Repositories) error {
+	users, err := newUsers(ctx, repositories, 3)
+	if err != nil {
+		return err
+	}
+	sender := users[0]
+
+	direct, directMembers, _ := entity.NewConversation(sender.ID, []string{sender.ID, users[1].ID})
+	_, err = repositories.MessageRepository.CreateConversation(ctx, direct, directMembers)
+	if err != nil {
+		return fmt.Errorf("create direct conversation: %w", err)
+	}
+	_, err = repositories.MessageRepository.CreateConversation(ctx, direct, directMembers)
+	if err := expectErr(err, repository.ErrConversationExists); err != nil {
+		return fmt.Errorf("create the direct conversation twice: %w", err)
+	}
+
+	group, groupMembers, _ := entity.NewConversation(sender.ID, []string{sender.ID, users[1].ID, users[2].ID})
+	_, err = repositories.MessageRepository.CreateConversation(ctx, group, groupMembers)
+	if err != nil {
+		return fmt.Errorf("create group: %w", err)
+	}
+
+	// A message moves the direct conversation above the newer group
+	var messages []*entity.Message
+	for i := 0; i < 2; i++ {
+		message, _ := entity.NewMessage(direct.ID, sender.ID, sender.Name, fmt.Sprintf("message %d", i))
+		_, err := repositories.MessageRepository.CreateMessage(ctx, message, direct.ParticipantIDs)
+		if err != nil {
+			return fmt.Errorf("create message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	outsider, _ := entity.NewMessage(direct.ID, users[2].ID, users[2].Name, "not a participant")
+	_, err = repositories.MessageRepository.CreateMessage(ctx, outsider, []string{sender.ID, users[2].ID})
+	if err := expect(err != nil, "expected an error for a message to a user outside the conversation"); err != nil {
+		return err
+	}
+
+	conversations, _, err := repositories.MessageRepository.GetConversationsPage(ctx, users[1].ID, 10, "")
+	if err != nil {
+		return err
+	}
+	page, cursor, err := repositories.MessageRepository.GetMessagesPage(ctx, direct.ID, 1, "")
+	if err != nil {
+		return err
+	}
+	older, _, err := repositories.MessageRepository.GetMessagesPage(ctx, direct.ID, 1, cursor)
+	if err != nil {
+		return err
+	}
+
+	senderEntry, err := repositories.MessageRepository.GetMember(ctx, sender.ID, direct.ID)
+	if err != nil {
+		return err
+	}
+	recipientEntry, err := repositories.MessageRepository.GetMember(ctx, users[1].ID, direct.ID)
+	if err != nil {
+		return err
+	}
+	stranger, err := repositories.MessageRepository.GetMember(ctx, users[2].ID, direct.ID)
+	if err != nil {
+		return err
+	}
+
+	moved, err := repositories.MessageRepository.MarkRead(ctx, users[1].ID, direct.ID, messages[1].ID)
+	if err != nil {
+		return err
+	}
+	movedBack, err := repositories.MessageRepository.MarkRead(ctx, users[1].ID, direct.ID, messages[0].ID)
+	if err != nil {
+		return err
+	}
+
+	stored, err := repositories.MessageRepository.GetConversation(ctx, group.ID)
+	if err != nil {
+		return err
+	}
+
+	return first(
+		expect(len(conversations) == 2 && conversations[0].ConversationID == direct.ID && conversations[1].ConversationID == group.ID,
+			"the most recently active conversation must come first"),
+		expect(conversations[0].LastMessage != nil && conversations[0].LastMessage.ID == messages[1].ID, "the entry must hold the newest message"),
+		expect(len(page) == 1 && len(older) == 1 && page[0].ID == messages[1].ID && older[0].ID == messages[0].ID, "messages must be newest first"),
+		expect(senderEntry.LastReadID == messages[1].ID, "the sender must have read their own message"),
+		expect(recipientEntry.LastReadID == "", "the recipient must not have read the message yet"),
+		expect(stranger == nil, "users outside a conversation have no entry"),
+		expect(moved && !movedBack, "read receipts must only move forward"),
+		expect(stored != nil && len(stored.ParticipantIDs) == 3, "the conversation must keep its participants"),
+	)
+}
@@ -0,0 +1,27 @@
+package conformance_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/database"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository/conformance"
+)
+
+// The checks write data, so they only run against a table set aside for
+// them. AWS_REGION and AWS_ENDPOINT are read like for the API, for example
+// to use DynamoDB Local.
+func TestDynamoDB(t *testing.T) {
+	tableName := os.Getenv("TEST_TABLE_NAME")
+	if tableName == "" {
+		t.Skip("TEST_TABLE_NAME is not set")
+	}
+
+	db, err := database.GetDatabase(t.Context(), os.Getenv("AWS_REGION"), os.Getenv("AWS_ENDPOINT"))
+	if err != nil {
+		t.Fatalf("failed to get database: %v", err)
+	}
+
+	conformance.Run(t, repository.InitRepositories(db, nil, tableName))
+}
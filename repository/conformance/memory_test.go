@@ -0,0 +1,12 @@
+package conformance_test
+
+import (
+	"testing"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository/conformance"
+)
+
+func TestMemory(t *testing.T) {
+	conformance.Run(t, repository.InitMemoryRepositories(nil))
+}
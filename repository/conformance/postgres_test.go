@@ -0,0 +1,26 @@
+package conformance_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository/conformance"
+)
+
+// The checks write data, so they only run against a database set aside for
+// them
+func TestPostgres(t *testing.T) {
+	databaseUrl := os.Getenv("TEST_DATABASE_URL")
+	if databaseUrl == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	store, err := repository.OpenSQLStore(t.Context(), "postgres", databaseUrl)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	conformance.Run(t, repository.InitSQLRepositories(store, nil))
+}
@@ -0,0 +1,20 @@
+package conformance_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository/conformance"
+)
+
+func TestSQLite(t *testing.T) {
+	// A fresh database, so the checks start from an empty schema
+	store, err := repository.OpenSQLStore(t.Context(), "sqlite", filepath.Join(t.TempDir(), "conformance.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	conformance.Run(t, repository.InitSQLRepositories(store, nil))
+}
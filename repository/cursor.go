@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns a LastEvaluatedKey into an opaque token that can be
+// handed to clients. An empty key means there are no more pages.
+func EncodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	values := make(map[string]string, len(key))
+	for name, value := range key {
+		s, ok := value.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", fmt.Errorf("unsupported cursor attribute %s", name)
+		}
+		values[name] = s.Value
+	}
+
+	return EncodeCursorValues(values)
+}
+
+// EncodeCursorValues creates a cursor from plain values, for pages that are
+// not backed by a single DynamoDB query.
+func EncodeCursorValues(values map[string]string) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor turns a token created by EncodeCursor back into the values of
+// its attributes, which toKey turns into an ExclusiveStartKey. The token must
+// contain exactly the given attributes, anything else is rejected with
+// ErrInvalidCursor.
+func DecodeCursor(cursor string, attributes ...string) (map[string]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if len(values) != len(attributes) {
+		return nil, ErrInvalidCursor
+	}
+
+	for _, attribute := range attributes {
+		if values[attribute] == "" {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return values, nil
+}
+
+func toKey(values map[string]string) map[string]types.AttributeValue {
+	key := make(map[string]types.AttributeValue, len(values))
+	for name, value := range values {
+		key[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return key
+}
+
+// encodeKeyCursor creates the cursor of a page that is sorted by a single
+// key, holding the key of the last item of the page
+func encodeKeyCursor(key string) (string, error) {
+	return EncodeCursorValues(map[string]string{"key": key})
+}
+
+func decodeKeyCursor(cursor string) (string, error) {
+	values, err := DecodeCursor(cursor, "key")
+	if err != nil {
+		return "", err
+	}
+	return values["key"], nil
+}
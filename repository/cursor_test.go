@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"pk":      &types.AttributeValueMemberS{Value: "user#1"},
+		"sk":      &types.AttributeValueMemberS{Value: "post#01HZY3K9W6V5T4S3R2Q1P0N9M8"},
+		"gsi1_pk": &types.AttributeValueMemberS{Value: "timeline"},
+		"gsi1_sk": &types.AttributeValueMemberS{Value: "01HZY3K9W6V5T4S3R2Q1P0N9M8"},
+	}
+
+	cursor, err := EncodeCursor(key)
+	if err != nil {
+		t.Fatalf("EncodeCursor: %v", err)
+	}
+
+	startKey, err := decodeTimelineCursor(cursor)
+	if err != nil {
+		t.Fatalf("decodeTimelineCursor: %v", err)
+	}
+	for name, value := range key {
+		got, ok := startKey[name].(*types.AttributeValueMemberS)
+		if !ok || got.Value != value.(*types.AttributeValueMemberS).Value {
+			t.Errorf("attribute %s = %v, want %v", name, startKey[name], value)
+		}
+	}
+
+	cursor, err = EncodeCursor(nil)
+	if err != nil || cursor != "" {
+		t.Errorf("EncodeCursor(nil) = %q, %v, want an empty cursor", cursor, err)
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	cursors := map[string]string{
+		"not base64":        "not a cursor!",
+		"padded base64":     base64.URLEncoding.EncodeToString([]byte(`{"key":"a"}`)),
+		"not json":          encode("key=a"),
+		"not an object":     encode(`["a"]`),
+		"non string values": encode(`{"key":1}`),
+		"missing attribute": encode(`{"other":"a"}`),
+		"extra attribute":   encode(`{"key":"a","other":"b"}`),
+		"empty attribute":   encode(`{"key":""}`),
+		"empty object":      encode(`{}`),
+	}
+
+	for name, cursor := range cursors {
+		_, err := decodeKeyCursor(cursor)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestDecodeTimelineCursorRejectsTampered(t *testing.T) {
+	valid := map[string]string{"pk": "user#1", "sk": "post#01HZY3K9W6V5T4S3R2Q1P0N9M8", "gsi1_pk": "timeline", "gsi1_sk": "01HZY3K9W6V5T4S3R2Q1P0N9M8"}
+
+	tampered := map[string]map[string]string{
+		"other index":     {"gsi1_pk": "tags"},
+		"other partition": {"pk": "inbox#1"},
+		"other item":      {"sk": "follower#2"},
+		"mismatched sort": {"gsi1_sk": "01HZY3K9W6V5T4S3R2Q1P0N9M9"},
+		"not a ulid":      {"sk": "post#01J", "gsi1_sk": "01J"},
+	}
+
+	for name, changes := range tampered {
+		values := withValues(valid, changes)
+		cursor, err := EncodeCursorValues(values)
+		if err != nil {
+			t.Fatalf("EncodeCursorValues: %v", err)
+		}
+
+		_, err = decodeTimelineCursor(cursor)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+// withValues returns a copy of values with changes applied
+func withValues(values, changes map[string]string) map[string]string {
+	result := make(map[string]string, len(values))
+	for name, value := range values {
+		result[name] = value
+	}
+	for name, value := range changes {
+		result[name] = value
+	}
+	return result
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// How often the stream is checked for new shards
+	shardDiscoveryInterval = 10 * time.Second
+	// How often a shard is polled when it had no new records
+	shardPollInterval = time.Second
+)
+
+// StreamsAPI is the part of the DynamoDB Streams client used by the event
+// bus, so a local stand-in can replace it
+type StreamsAPI interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// EventTableAPI is the part of the DynamoDB client used by the event bus, so
+// a local stand-in can replace it
+type EventTableAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// DynamoEventBus fans events out to every API instance. Published events are
+// written to the table and each instance tails the table's stream for the
+// events of the others. Its own events are delivered right away.
+type DynamoEventBus struct {
+	DB        EventTableAPI
+	Streams   StreamsAPI
+	TableName string
+	node      string
+	mu        sync.RWMutex
+	handlers  []func(entity.SSEEvent)
+}
+
+func NewDynamoEventBus(db EventTableAPI, streams StreamsAPI, tableName string) *DynamoEventBus {
+	return &DynamoEventBus{
+		DB:        db,
+		Streams:   streams,
+		TableName: tableName,
+		node:      ulid.Make().String(),
+	}
+}
+
+func (b *DynamoEventBus) Subscribe(handler func(entity.SSEEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *DynamoEventBus) deliver(event entity.SSEEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+}
+
+func (b *DynamoEventBus) Publish(ctx context.Context, event entity.SSEEvent) error {
+	b.deliver(event)
+
+	av, err := attributevalue.MarshalMap(entity.NewBusEvent(b.node, event))
+	if err != nil {
+		return fmt.Errorf("failed to marshal event to DynamoDB attribute values: %w", err)
+	}
+
+	_, err = b.DB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(b.TableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put event into DynamoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Run tails the stream of the table until the context is done. Shards that
+// exist when it starts are read from their latest record, shards created
+// later from their first one.
+func (b *DynamoEventBus) Run(ctx context.Context) error {
+	table, err := b.DB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(b.TableName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe table %s: %w", b.TableName, err)
+	}
+	if table.Table.LatestStreamArn == nil {
+		return fmt.Errorf("table %s has no stream", b.TableName)
+	}
+	streamArn := table.Table.LatestStreamArn
+
+	tailed := map[string]bool{}
+	iteratorType := streamtypes.ShardIteratorTypeLatest
+
+	ticker := time.NewTicker(shardDiscoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		shards, err := b.openShards(ctx, streamArn)
+		if err != nil {
+			log.Printf("failed to list stream shards: %v", err)
+		}
+
+		for _, shardId := range shards {
+			if tailed[shardId] {
+				continue
+			}
+			tailed[shardId] = true
+			go b.tail(ctx, streamArn, shardId, iteratorType)
+		}
+		iteratorType = streamtypes.ShardIteratorTypeTrimHorizon
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// openShards returns the ids of the shards that still receive records
+func (b *DynamoEventBus) openShards(ctx context.Context, streamArn *string) ([]string, error) {
+	var shards []string
+	var startShardId *string
+
+	for {
+		output, err := b.Streams.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             streamArn,
+			ExclusiveStartShardId: startShardId,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, shard := range output.StreamDescription.Shards {
+			if shard.SequenceNumberRange == nil || shard.SequenceNumberRange.EndingSequenceNumber == nil {
+				shards = append(shards, aws.ToString(shard.ShardId))
+			}
+		}
+
+		startShardId = output.StreamDescription.LastEvaluatedShardId
+		if startShardId == nil {
+			return shards, nil
+		}
+	}
+}
+
+// tail delivers the events of other instances from a shard until the shard is
+// closed or the context is done
+func (b *DynamoEventBus) tail(ctx context.Context, streamArn *string, shardId string, iteratorType streamtypes.ShardIteratorType) {
+	var lastSequenceNumber *string
+	var iterator *string
+
+	for {
+		if iterator == nil {
+			input := &dynamodbstreams.GetShardIteratorInput{
+				StreamArn:         streamArn,
+				ShardId:           aws.String(shardId),
+				ShardIteratorType: iteratorType,
+			}
+			// Continue after the last record when the iterator expired
+			if lastSequenceNumber != nil {
+				input.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+				input.SequenceNumber = lastSequenceNumber
+			}
+
+			output, err := b.Streams.GetShardIterator(ctx, input)
+			var notFound *streamtypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				return
+			}
+			if err != nil {
+				log.Printf("failed to get iterator for shard %s: %v", shardId, err)
+				if !sleep(ctx, shardPollInterval) {
+					return
+				}
+				continue
+			}
+			iterator = output.ShardIterator
+		}
+
+		output, err := b.Streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		if err != nil {
+			log.Printf("failed to get records of shard %s: %v", shardId, err)
+			iterator = nil
+			if !sleep(ctx, shardPollInterval) {
+				return
+			}
+			continue
+		}
+
+		for _, record := range output.Records {
+			if record.Dynamodb != nil {
+				lastSequenceNumber = record.Dynamodb.SequenceNumber
+			}
+			b.handleRecord(record)
+		}
+
+		// The shard was closed and all of its records were read
+		iterator = output.NextShardIterator
+		if iterator == nil {
+			return
+		}
+
+		if len(output.Records) == 0 && !sleep(ctx, shardPollInterval) {
+			return
+		}
+	}
+}
+
+// handleRecord delivers the event in a stream record. The stream carries
+// every write to the table, so all other items are skipped.
+func (b *DynamoEventBus) handleRecord(record streamtypes.Record) {
+	if record.EventName != streamtypes.OperationTypeInsert || record.Dynamodb == nil {
+		return
+	}
+
+	pk, ok := record.Dynamodb.Keys["pk"].(*streamtypes.AttributeValueMemberS)
+	if !ok || !strings.HasPrefix(pk.Value, "event#") {
+		return
+	}
+
+	image, err := attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.NewImage)
+	if err != nil {
+		log.Printf("failed to convert stream record: %v", err)
+		return
+	}
+
+	event := new(entity.BusEvent)
+	err = attributevalue.UnmarshalMap(image, event)
+	if err != nil {
+		log.Printf("failed to unmarshal stream record into BusEvent struct: %v", err)
+		return
+	}
+
+	if event.Node == b.node {
+		return
+	}
+
+	b.deliver(event.SSEEvent())
+}
+
+// sleep waits for d and reports false if the context was done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
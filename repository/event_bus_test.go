@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// fakeStream is a table with a stream of a single shard. Shard iterators are
+// positions in the list of records.
+type fakeStream struct {
+	mu        sync.Mutex
+	records   []streamtypes.Record
+	iterators int
+}
+
+func (f *fakeStream) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	image := toStreamMap(params.Item)
+	f.records = append(f.records, streamtypes.Record{
+		EventName: streamtypes.OperationTypeInsert,
+		Dynamodb: &streamtypes.StreamRecord{
+			Keys:           map[string]streamtypes.AttributeValue{"pk": image["pk"], "sk": image["sk"]},
+			NewImage:       image,
+			SequenceNumber: aws.String(strconv.Itoa(len(f.records) + 1)),
+		},
+	})
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeStream) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: &types.TableDescription{LatestStreamArn: aws.String("stream")}}, nil
+}
+
+func (f *fakeStream) DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &streamtypes.StreamDescription{
+		Shards: []streamtypes.Shard{{
+			ShardId:             aws.String("shard"),
+			SequenceNumberRange: &streamtypes.SequenceNumberRange{StartingSequenceNumber: aws.String("1")},
+		}},
+	}}, nil
+}
+
+func (f *fakeStream) GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.iterators++
+
+	position := 0
+	switch params.ShardIteratorType {
+	case streamtypes.ShardIteratorTypeLatest:
+		position = len(f.records)
+	case streamtypes.ShardIteratorTypeAfterSequenceNumber:
+		position, _ = strconv.Atoi(aws.ToString(params.SequenceNumber))
+	}
+
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(strconv.Itoa(position))}, nil
+}
+
+func (f *fakeStream) GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	position, err := strconv.Atoi(aws.ToString(params.ShardIterator))
+	if err != nil {
+		return nil, fmt.Errorf("invalid iterator %q", aws.ToString(params.ShardIterator))
+	}
+
+	return &dynamodbstreams.GetRecordsOutput{
+		Records:           f.records[position:],
+		NextShardIterator: aws.String(strconv.Itoa(len(f.records))),
+	}, nil
+}
+
+func (f *fakeStream) iteratorCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.iterators
+}
+
+// toStreamMap converts an item into the attribute values of a stream record
+func toStreamMap(item map[string]types.AttributeValue) map[string]streamtypes.AttributeValue {
+	image := make(map[string]streamtypes.AttributeValue, len(item))
+	for name, value := range item {
+		image[name] = toStreamValue(value)
+	}
+	return image
+}
+
+func toStreamValue(value types.AttributeValue) streamtypes.AttributeValue {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return &streamtypes.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &streamtypes.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return &streamtypes.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberNULL:
+		return &streamtypes.AttributeValueMemberNULL{Value: v.Value}
+	case *types.AttributeValueMemberL:
+		list := make([]streamtypes.AttributeValue, len(v.Value))
+		for i, element := range v.Value {
+			list[i] = toStreamValue(element)
+		}
+		return &streamtypes.AttributeValueMemberL{Value: list}
+	case *types.AttributeValueMemberM:
+		return &streamtypes.AttributeValueMemberM{Value: toStreamMap(v.Value)}
+	default:
+		panic(fmt.Sprintf("unsupported attribute value %T", value))
+	}
+}
+
+// Two instances share a table, events published on one reach the clients of
+// both exactly once
+func TestDynamoEventBusDeliversBetweenBrokers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := &fakeStream{}
+	first, second := runBuses(ctx, t, stream)
+
+	firstBroker := entity.NewBroker(nil, nil, first)
+	secondBroker := entity.NewBroker(nil, nil, second)
+	local, _ := firstBroker.Subscribe(ctx, "alice", "")
+	remote, _ := secondBroker.Subscribe(ctx, "alice", "")
+	other, _ := secondBroker.Subscribe(ctx, "bob", "")
+
+	// Other items written to the table show up in the stream as well
+	_, err := stream.PutItem(ctx, &dynamodb.PutItemInput{Item: map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "user#alice"},
+		"sk": &types.AttributeValueMemberS{Value: "post#1"},
+	}})
+	if err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+
+	firstBroker.Publish(ctx, entity.SSEEvent{Name: "post", Data: `{"id":"1"}`, Audience: entity.ToUsers("alice"), ActorID: "carol"})
+	secondBroker.Publish(ctx, entity.SSEEvent{Name: "everyone", Data: "{}", Audience: entity.ToEveryone()})
+
+	// Events of other instances arrive later than local ones, so only the
+	// events of each client are compared, not their order
+	for _, s := range []*entity.Subscription{local, remote} {
+		var names []string
+		for _, event := range []entity.SSEEvent{receiveEvent(t, s), receiveEvent(t, s)} {
+			names = append(names, event.Name)
+			if event.Name == "post" && event.ActorID != "carol" {
+				t.Errorf("user %s received the post from actor %q, want carol", s.UserID, event.ActorID)
+			}
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, []string{"everyone", "post"}) {
+			t.Errorf("user %s received %v, want the post and the event to everyone", s.UserID, names)
+		}
+	}
+
+	if event := receiveEvent(t, other); event.Name != "everyone" {
+		t.Errorf("other user received %s, want only the event to everyone", event.Name)
+	}
+
+	// Each instance skips its own events on the stream, so nothing arrives
+	// twice
+	time.Sleep(2 * shardPollInterval)
+	for _, s := range []*entity.Subscription{local, remote, other} {
+		select {
+		case event := <-s.Messages:
+			t.Errorf("user %s received %s again", s.UserID, event.Name)
+		default:
+		}
+	}
+}
+
+// Every instance keeps its own search index, changes made through one are
+// applied to the others
+func TestDynamoEventBusSharesSearchIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := &fakeStream{}
+	first, second := runBuses(ctx, t, stream)
+
+	firstIndex, secondIndex := search.New(), search.New()
+	firstShared := search.Share(firstIndex, first)
+	secondShared := search.Share(secondIndex, second)
+
+	// Index events are not delivered to clients
+	broker := entity.NewBroker(nil, nil, second)
+	s, _ := broker.Subscribe(ctx, "alice", "")
+
+	post, err := entity.NewPost("alice", "Alice", "hello from the first instance", nil, nil)
+	if err != nil {
+		t.Fatalf("NewPost: %v", err)
+	}
+	firstShared.PutPost(ctx, post)
+	comment, _ := entity.NewComment(post.ID, "bob", "Bob", "a reply on the second instance", "")
+	secondShared.PutComment(ctx, post.ID, comment)
+
+	for _, index := range []*search.Index{firstIndex, secondIndex} {
+		waitForHits(t, index, search.TypePost, "hello", 1)
+		waitForHits(t, index, search.TypeComment, "reply", 1)
+	}
+
+	secondShared.DeletePost(ctx, post.ID)
+	waitForHits(t, firstIndex, search.TypePost, "hello", 0)
+	waitForHits(t, firstIndex, search.TypeComment, "reply", 0)
+
+	select {
+	case event := <-s.Messages:
+		t.Errorf("client received %s", event.Name)
+	default:
+	}
+}
+
+// A mute on one instance applies to the connections of the user on the
+// others
+func TestDynamoEventBusRefreshesHiddenUsers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := &fakeStream{}
+	first, second := runBuses(ctx, t, stream)
+
+	var mu sync.Mutex
+	muted := map[string]bool{}
+	hidden := func(ctx context.Context, userID string) (map[string]bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(muted), nil
+	}
+
+	firstBroker := entity.NewBroker(nil, hidden, first)
+	secondBroker := entity.NewBroker(nil, hidden, second)
+	remote, _ := secondBroker.Subscribe(ctx, "alice", "")
+
+	mu.Lock()
+	muted["mallory"] = true
+	mu.Unlock()
+	firstBroker.RefreshHidden(ctx, "alice")
+
+	// The refresh reaches the other instance over the stream
+	time.Sleep(2 * shardPollInterval)
+
+	secondBroker.Publish(ctx, entity.SSEEvent{Name: "post", Data: "{}", Audience: entity.ToUsers("alice"), ActorID: "mallory"})
+	secondBroker.Publish(ctx, entity.SSEEvent{Name: "marker", Data: "{}", Audience: entity.ToUsers("alice")})
+	if event := receiveEvent(t, remote); event.Name != "marker" {
+		t.Errorf("alice received %s from the muted user", event.Name)
+	}
+}
+
+// runBuses starts two instances tailing the same stream
+func runBuses(ctx context.Context, t *testing.T, stream *fakeStream) (*DynamoEventBus, *DynamoEventBus) {
+	t.Helper()
+
+	first := NewDynamoEventBus(stream, stream, "table")
+	second := NewDynamoEventBus(stream, stream, "table")
+	for _, bus := range []*DynamoEventBus{first, second} {
+		go func() {
+			err := bus.Run(ctx)
+			if err != nil {
+				t.Errorf("Run: %v", err)
+			}
+		}()
+	}
+
+	// Events published before an instance tails its shard are not delivered
+	deadline := time.Now().Add(time.Second)
+	for stream.iteratorCount() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("instances did not start tailing the stream")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return first, second
+}
+
+func waitForHits(t *testing.T, index *search.Index, docType, query string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * shardPollInterval)
+	for index.Search(docType, query, 0, 10).Total != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("search for %q in %s found %d, want %d", query, docType, index.Search(docType, query, 0, 10).Total, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receiveEvent(t *testing.T, s *entity.Subscription) entity.SSEEvent {
+	t.Helper()
+
+	select {
+	case event := <-s.Messages:
+		return event
+	case <-time.After(5 * shardPollInterval):
+		t.Fatalf("no event for user %s", s.UserID)
+		return entity.SSEEvent{}
+	}
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidBlobSignature = errors.New("invalid or expired blob signature")
+	ErrBlobChecksumMismatch = errors.New("blob checksum mismatch")
+	errInvalidBlobKey       = errors.New("invalid blob key")
+)
+
+// LocalBlobStore keeps files in a directory on disk. Its signed URLs point at
+// the API itself, which serves them under BaseURL, so no object store is
+// needed. The URLs are signed with an HMAC of Secret.
+type LocalBlobStore struct {
+	Dir     string
+	BaseURL string
+	Secret  []byte
+}
+
+func NewLocalBlobStore(dir, baseURL, secret string) (*LocalBlobStore, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("blob secret cannot be empty")
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob directory %s: %w", dir, err)
+	}
+
+	return &LocalBlobStore{
+		Dir:     dir,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Secret:  []byte(secret),
+	}, nil
+}
+
+func (s *LocalBlobStore) PresignUpload(ctx context.Context, key, contentType, checksum string) (string, error) {
+	return s.signedURL(http.MethodPut, key, url.Values{
+		"content_type": {contentType},
+		"checksum":     {checksum},
+	})
+}
+
+func (s *LocalBlobStore) Head(ctx context.Context, key string) (*BlobInfo, error) {
+	file, info, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	return info, nil
+}
+
+// Get opens the file, the caller has to close it
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, _, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Put stores a file. The content type is sniffed again when it is read.
+func (s *LocalBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	return s.write(key, bytes.NewReader(data), "")
+}
+
+func (s *LocalBlobStore) SignedURL(ctx context.Context, key string) (string, error) {
+	return s.signedURL(http.MethodGet, key, url.Values{})
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// PutSigned stores a file uploaded to a URL of PresignUpload. The upload must
+// have the signed content type and checksum, otherwise nothing is stored.
+func (s *LocalBlobStore) PutSigned(key string, query url.Values, contentType string, body io.Reader) error {
+	err := s.verify(http.MethodPut, key, query)
+	if err != nil {
+		return err
+	}
+
+	if contentType != query.Get("content_type") {
+		return fmt.Errorf("%w: content type %s was not signed", ErrInvalidBlobSignature, contentType)
+	}
+
+	return s.write(key, body, query.Get("checksum"))
+}
+
+// write stores the body under key if it matches the checksum
+func (s *LocalBlobStore) write(key string, body io.Reader, checksum string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// The file is written next to its final path and only moved there once
+	// it is complete, so readers never see a partial upload
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	closeErr := tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, closeErr)
+	}
+
+	if !checksumMatches(checksum, hash.Sum(nil)) {
+		return ErrBlobChecksumMismatch
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// OpenSigned returns a file requested through a URL of SignedURL together
+// with its metadata. The caller has to close the file.
+func (s *LocalBlobStore) OpenSigned(key string, query url.Values) (*os.File, *BlobInfo, error) {
+	err := s.verify(http.MethodGet, key, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.open(key)
+}
+
+func (s *LocalBlobStore) open(key string) (*os.File, *BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat blob %s: %w", key, err)
+	}
+
+	// The content type is sniffed rather than stored, the upload was already
+	// checked against the signed one
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+
+	return file, &BlobInfo{
+		Size:        stat.Size(),
+		ContentType: http.DetectContentType(head[:n]),
+	}, nil
+}
+
+// path maps a key to a file inside Dir. Keys that would leave Dir, or that
+// change when their URL is cleaned, are rejected.
+func (s *LocalBlobStore) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if strings.Contains(key, `\`) || path.Clean(key) != key || !filepath.IsLocal(name) {
+		return "", errInvalidBlobKey
+	}
+
+	return filepath.Join(s.Dir, name), nil
+}
+
+func (s *LocalBlobStore) signedURL(method, key string, query url.Values) (string, error) {
+	_, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	query.Set("expires", strconv.FormatInt(time.Now().Add(blobURLExpiry).Unix(), 10))
+	query.Set("signature", hex.EncodeToString(s.sign(method, key, query)))
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return s.BaseURL + "/" + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+// sign computes the HMAC over everything a signed URL allows
+func (s *LocalBlobStore) sign(method, key string, query url.Values) []byte {
+	mac := hmac.New(sha256.New, s.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, key, query.Get("content_type"), query.Get("checksum"), query.Get("expires"))
+	return mac.Sum(nil)
+}
+
+// verify checks that a URL was signed for the method and key and has not
+// expired yet
+func (s *LocalBlobStore) verify(method, key string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidBlobSignature
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(signature, s.sign(method, key, query)) {
+		return ErrInvalidBlobSignature
+	}
+
+	return nil
+}
+
+// checksumMatches compares a SHA-256 checksum given in hex, as the frontend
+// sends it, or in base64, as S3 expects it. Uploads without a checksum are
+// not checked.
+func checksumMatches(checksum string, sum []byte) bool {
+	if checksum == "" {
+		return true
+	}
+
+	return strings.EqualFold(checksum, hex.EncodeToString(sum)) || checksum == base64.StdEncoding.EncodeToString(sum)
+}
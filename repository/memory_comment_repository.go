@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// MemoryCommentRepository keeps the comments of posts in a MemoryStore
+type MemoryCommentRepository struct {
+	Store *MemoryStore
+}
+
+func NewMemoryCommentRepository(store *MemoryStore) *MemoryCommentRepository {
+	return &MemoryCommentRepository{
+		Store: store,
+	}
+}
+
+// Create stores the comment. Replies also increment the reply count of their
+// parent.
+func (r *MemoryCommentRepository) Create(ctx context.Context, comment *entity.Comment) (*entity.Comment, error) {
+	if comment == nil {
+		return nil, fmt.Errorf("input comment cannot be nil")
+	}
+
+	postId := strings.TrimPrefix(comment.PK, "post#")
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if comment.ParentID != "" {
+		parent, ok := r.Store.comments[postId][comment.ParentID]
+		if !ok {
+			return nil, ErrCommentNotFound
+		}
+		parent.ReplyCount++
+	}
+
+	if r.Store.comments[postId] == nil {
+		r.Store.comments[postId] = map[string]*entity.Comment{}
+	}
+	r.Store.comments[postId][comment.ID] = clone(comment)
+
+	return comment, nil
+}
+
+// GetPageByPostID returns one page of the direct replies to a comment, or of
+// the top level comments when parentId is empty. Top level comments are
+// newest first, replies are in the order they were written.
+func (r *MemoryCommentRepository) GetPageByPostID(ctx context.Context, postId, parentId string, limit int32, cursor string) ([]*entity.Comment, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	var comments []*entity.Comment
+	for _, comment := range r.Store.comments[postId] {
+		if comment.ParentID == parentId {
+			comments = append(comments, clone(comment))
+		}
+	}
+
+	descending := parentId == ""
+	slices.SortFunc(comments, func(a, b *entity.Comment) int {
+		if descending {
+			return strings.Compare(b.ID, a.ID)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return memoryPage(comments, func(comment *entity.Comment) string { return comment.ID }, descending, limit, cursor)
+}
+
+func (r *MemoryCommentRepository) Get(ctx context.Context, postId, commentId string) (*entity.Comment, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	comment, ok := r.Store.comments[postId][commentId]
+	if !ok {
+		return nil, ErrCommentNotFound
+	}
+
+	return clone(comment), nil
+}
+
+func (r *MemoryCommentRepository) Update(ctx context.Context, postId, commentId, text string, mentions []entity.Mention) (*entity.Comment, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	comment, ok := r.Store.comments[postId][commentId]
+	if !ok {
+		return nil, ErrCommentNotFound
+	}
+
+	edited := time.Now()
+	comment.Text = text
+	comment.Edited = &edited
+	comment.Mentions = nil
+	if len(mentions) > 0 {
+		comment.Mentions = mentions
+	}
+
+	return clone(comment), nil
+}
+
+// Delete removes a comment without replies. Replies also decrement the reply
+// count of their parent.
+func (r *MemoryCommentRepository) Delete(ctx context.Context, postId, commentId, parentId string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	comment, ok := r.Store.comments[postId][commentId]
+	if !ok {
+		return ErrCommentNotFound
+	}
+	if comment.ReplyCount > 0 {
+		return ErrCommentHasReplies
+	}
+
+	delete(r.Store.comments[postId], commentId)
+
+	if parent, ok := r.Store.comments[postId][parentId]; ok {
+		parent.ReplyCount--
+	}
+
+	return nil
+}
+
+// SoftDelete replaces a comment with a placeholder so its replies stay
+// reachable
+func (r *MemoryCommentRepository) SoftDelete(ctx context.Context, postId, commentId string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	comment, ok := r.Store.comments[postId][commentId]
+	if !ok {
+		return ErrCommentNotFound
+	}
+
+	comment.Deleted = true
+	comment.Text = ""
+	comment.Edited = nil
+	comment.Mentions = nil
+
+	return nil
+}
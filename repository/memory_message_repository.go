@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// MemoryMessageRepository keeps conversations, their participants and
+// messages in a MemoryStore
+type MemoryMessageRepository struct {
+	Store *MemoryStore
+}
+
+func NewMemoryMessageRepository(store *MemoryStore) *MemoryMessageRepository {
+	return &MemoryMessageRepository{
+		Store: store,
+	}
+}
+
+// CreateConversation stores a conversation together with the entries of its
+// participants. ErrConversationExists is returned if a conversation with the
+// same id already exists.
+func (r *MemoryMessageRepository) CreateConversation(ctx context.Context, conversation *entity.Conversation, members []*entity.ConversationMember) (*entity.Conversation, error) {
+	if conversation == nil {
+		return nil, fmt.Errorf("input conversation cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if _, ok := r.Store.conversations[conversation.ID]; ok {
+		return nil, ErrConversationExists
+	}
+
+	r.Store.conversations[conversation.ID] = clone(conversation)
+	r.Store.members[conversation.ID] = map[string]*entity.ConversationMember{}
+	for _, member := range members {
+		r.Store.members[conversation.ID][member.UserID] = clone(member)
+	}
+
+	return conversation, nil
+}
+
+// GetConversation returns nil if the conversation does not exist
+func (r *MemoryMessageRepository) GetConversation(ctx context.Context, conversationId string) (*entity.Conversation, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	conversation, ok := r.Store.conversations[conversationId]
+	if !ok {
+		return nil, nil
+	}
+
+	return clone(conversation), nil
+}
+
+// GetMember returns the entry of a conversation for one participant, or nil
+// if the user does not take part in it
+func (r *MemoryMessageRepository) GetMember(ctx context.Context, userId, conversationId string) (*entity.ConversationMember, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	member, ok := r.Store.members[conversationId][userId]
+	if !ok {
+		return nil, nil
+	}
+
+	return clone(member), nil
+}
+
+// GetMembers returns the entries of a conversation for the given participants
+func (r *MemoryMessageRepository) GetMembers(ctx context.Context, conversationId string, userIds []string) ([]*entity.ConversationMember, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	members := make([]*entity.ConversationMember, 0, len(userIds))
+	for _, userId := range userIds {
+		if member, ok := r.Store.members[conversationId][userId]; ok {
+			members = append(members, clone(member))
+		}
+	}
+
+	return members, nil
+}
+
+// GetConversationsPage returns one page of the conversations of a user, the
+// most recently active first
+func (r *MemoryMessageRepository) GetConversationsPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.ConversationMember, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	var members []*entity.ConversationMember
+	for _, conversationMembers := range r.Store.members {
+		if member, ok := conversationMembers[userId]; ok {
+			members = append(members, clone(member))
+		}
+	}
+
+	// The index key holds the id of the newest message
+	slices.SortFunc(members, func(a, b *entity.ConversationMember) int {
+		return strings.Compare(b.GSI1SK, a.GSI1SK)
+	})
+
+	return memoryPage(members, func(member *entity.ConversationMember) string { return member.GSI1SK }, true, limit, cursor)
+}
+
+// CreateMessage stores a message and moves its conversation to the top of the
+// list of every participant. The sender has read their own message.
+func (r *MemoryMessageRepository) CreateMessage(ctx context.Context, message *entity.Message, participantIds []string) (*entity.Message, error) {
+	if message == nil {
+		return nil, fmt.Errorf("input message cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	members := r.Store.members[message.ConversationID]
+	for _, userId := range participantIds {
+		if _, ok := members[userId]; !ok {
+			return nil, fmt.Errorf("user %s does not take part in conversation %s", userId, message.ConversationID)
+		}
+	}
+
+	r.Store.messages[message.ConversationID] = append(r.Store.messages[message.ConversationID], clone(message))
+
+	// The entries keep a copy of the message without its keys
+	preview := clone(message)
+	preview.PK = ""
+	preview.SK = ""
+
+	for _, userId := range participantIds {
+		member := members[userId]
+		member.GSI1SK = message.ID
+		member.LastMessage = preview
+		if userId == message.SenderID {
+			member.LastReadID = message.ID
+		}
+	}
+
+	return message, nil
+}
+
+// GetMessagesPage returns one page of the messages of a conversation, newest
+// first
+func (r *MemoryMessageRepository) GetMessagesPage(ctx context.Context, conversationId string, limit int32, cursor string) ([]*entity.Message, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	messages := make([]*entity.Message, 0, len(r.Store.messages[conversationId]))
+	for _, message := range r.Store.messages[conversationId] {
+		messages = append(messages, clone(message))
+	}
+
+	slices.SortFunc(messages, func(a, b *entity.Message) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return memoryPage(messages, func(message *entity.Message) string { return message.ID }, true, limit, cursor)
+}
+
+// MarkRead moves the read receipt of a participant forward to the given
+// message. A receipt that is already further ahead is left alone, which is
+// reported by returning false.
+func (r *MemoryMessageRepository) MarkRead(ctx context.Context, userId, conversationId, messageId string) (bool, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	member, ok := r.Store.members[conversationId][userId]
+	if !ok || member.LastReadID >= messageId {
+		return false, nil
+	}
+
+	member.LastReadID = messageId
+
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// MemoryNotificationRepository keeps the notifications of users and how far
+// they read them in a MemoryStore
+type MemoryNotificationRepository struct {
+	Store *MemoryStore
+}
+
+func NewMemoryNotificationRepository(store *MemoryStore) *MemoryNotificationRepository {
+	return &MemoryNotificationRepository{
+		Store: store,
+	}
+}
+
+func (r *MemoryNotificationRepository) Create(ctx context.Context, notification *entity.Notification) (*entity.Notification, error) {
+	if notification == nil {
+		return nil, fmt.Errorf("input notification cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	r.Store.notifications[notification.UserID] = append(r.Store.notifications[notification.UserID], clone(notification))
+
+	return notification, nil
+}
+
+// GetPage returns one page of the notifications of a user, newest first
+func (r *MemoryNotificationRepository) GetPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.Notification, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return memoryPage(r.newestFirst(userId), func(notification *entity.Notification) string { return notification.ID }, true, limit, cursor)
+}
+
+// newestFirst must be called with the lock of the store held
+func (r *MemoryNotificationRepository) newestFirst(userId string) []*entity.Notification {
+	notifications := make([]*entity.Notification, 0, len(r.Store.notifications[userId]))
+	for _, notification := range r.Store.notifications[userId] {
+		notifications = append(notifications, clone(notification))
+	}
+
+	slices.SortFunc(notifications, func(a, b *entity.Notification) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return notifications
+}
+
+// GetLatestID returns the id of the newest notification of a user, or an
+// empty string if there is none
+func (r *MemoryNotificationRepository) GetLatestID(ctx context.Context, userId string) (string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	notifications := r.newestFirst(userId)
+	if len(notifications) == 0 {
+		return "", nil
+	}
+
+	return notifications[0].ID, nil
+}
+
+// GetLastReadID returns the id up to which the user read their
+// notifications, or an empty string if they never did
+func (r *MemoryNotificationRepository) GetLastReadID(ctx context.Context, userId string) (string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.Store.notificationsRead[userId], nil
+}
+
+// MarkRead moves the read marker of a user forward to the given id. A marker
+// that is already further ahead is left alone.
+func (r *MemoryNotificationRepository) MarkRead(ctx context.Context, userId, notificationId string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if r.Store.notificationsRead[userId] < notificationId {
+		r.Store.notificationsRead[userId] = notificationId
+	}
+
+	return nil
+}
+
+// CountUnread counts the notifications newer than lastReadId, except those of
+// hidden actors
+func (r *MemoryNotificationRepository) CountUnread(ctx context.Context, userId, lastReadId string, hiddenActorIds []string) (int, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	count := 0
+	for _, notification := range r.Store.notifications[userId] {
+		if notification.ID > lastReadId && !slices.Contains(hiddenActorIds, notification.ActorID) {
+			count++
+		}
+	}
+
+	return count, nil
+}
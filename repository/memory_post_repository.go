@@ -0,0 +1,431 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// MemoryPostRepository keeps posts, their likes, tags and inbox entries in a
+// MemoryStore. Images are kept in Blobs, without it posts cannot have images.
+type MemoryPostRepository struct {
+	Store *MemoryStore
+	Blobs BlobStore
+}
+
+func NewMemoryPostRepository(store *MemoryStore, blobs BlobStore) *MemoryPostRepository {
+	return &MemoryPostRepository{
+		Store: store,
+		Blobs: blobs,
+	}
+}
+
+func (r *MemoryPostRepository) Create(ctx context.Context, post *entity.Post) (*entity.Post, error) {
+	if post == nil {
+		return nil, fmt.Errorf("input post cannot be nil")
+	}
+
+	err := validateMedia(ctx, r.Blobs, post.Media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate media: %w", err)
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	user, ok := r.Store.users[post.UserID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	r.Store.posts[post.ID] = clone(post)
+	user.PostsCount++
+	r.syncTags(post.ID, post.Tags, nil)
+
+	r.attachReferences([]*entity.Post{post})
+
+	err = setImageURLs(ctx, r.Blobs, []*entity.Post{post})
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (r *MemoryPostRepository) GetAll(ctx context.Context, limit int32, cursor string) ([]*entity.Post, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.page(ctx, r.filter(func(*entity.Post) bool { return true }), limit, cursor)
+}
+
+func (r *MemoryPostRepository) GetByUserID(ctx context.Context, userID string) ([]*entity.Post, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	posts := r.filter(func(post *entity.Post) bool { return post.UserID == userID })
+	r.attachReferences(posts)
+
+	err := setImageURLs(ctx, r.Blobs, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetPageByUserID returns up to limit posts of a user that are older than
+// the post with beforeID, newest first. An empty beforeID starts at the top.
+func (r *MemoryPostRepository) GetPageByUserID(ctx context.Context, userID, beforeID string, limit int32) ([]*entity.Post, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	posts := r.filter(func(post *entity.Post) bool {
+		return post.UserID == userID && (beforeID == "" || post.ID < beforeID)
+	})
+	posts = posts[:min(len(posts), int(max(limit, 0)))]
+	r.attachReferences(posts)
+
+	err := setImageURLs(ctx, r.Blobs, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (r *MemoryPostRepository) Get(ctx context.Context, userId, postId string) (*entity.Post, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	post, ok := r.Store.posts[postId]
+	if !ok || post.UserID != userId {
+		return nil, ErrPostNotFound
+	}
+
+	return clone(post), nil
+}
+
+func (r *MemoryPostRepository) Update(ctx context.Context, userId, postId, text string, media []entity.Media, mentions []entity.Mention) (*entity.Post, error) {
+	err := validateMedia(ctx, r.Blobs, media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate media: %w", err)
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	post, ok := r.Store.posts[postId]
+	if !ok || post.UserID != userId {
+		return nil, fmt.Errorf("failed to get post to update: %w", ErrPostNotFound)
+	}
+
+	previousTags := post.Tags
+
+	edited := time.Now()
+	post.Text = text
+	post.Media = media
+	post.Edited = &edited
+	post.Tags = entity.ParseTags(text)
+	post.Mentions = nil
+	if len(mentions) > 0 {
+		post.Mentions = mentions
+	}
+
+	r.syncTags(postId, post.Tags, previousTags)
+
+	updatedPost := clone(post)
+	r.attachReferences([]*entity.Post{updatedPost})
+
+	err = setImageURLs(ctx, r.Blobs, []*entity.Post{updatedPost})
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedPost, nil
+}
+
+func (r *MemoryPostRepository) Delete(ctx context.Context, userId, postId string) error {
+	media, err := r.delete(userId, postId)
+	if err != nil {
+		return err
+	}
+
+	// The images are deleted without holding the lock of the store
+	err = deleteMedia(ctx, r.Blobs, media)
+	if err != nil {
+		return fmt.Errorf("failed to delete media: %w", err)
+	}
+
+	return nil
+}
+
+// delete removes the post and returns its media
+func (r *MemoryPostRepository) delete(userId, postId string) ([]entity.Media, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	post, ok := r.Store.posts[postId]
+	if !ok || post.UserID != userId {
+		return nil, fmt.Errorf("failed to get post to delete: %w", ErrPostNotFound)
+	}
+
+	delete(r.Store.comments, postId)
+	delete(r.Store.likes, postId)
+	r.syncTags(postId, nil, post.Tags)
+	delete(r.Store.posts, postId)
+
+	if user, ok := r.Store.users[userId]; ok {
+		user.PostsCount--
+	}
+
+	return post.Media, nil
+}
+
+func (r *MemoryPostRepository) DeleteImage(ctx context.Context, imageKey string) error {
+	return deleteImage(ctx, r.Blobs, imageKey)
+}
+
+func (r *MemoryPostRepository) ProcessImage(ctx context.Context, userId, uploadKey string) (*entity.Media, error) {
+	return processImage(ctx, r.Blobs, userId, uploadKey)
+}
+
+func (r *MemoryPostRepository) GetByID(ctx context.Context, postId string) (*entity.Post, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	post, ok := r.Store.posts[postId]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+
+	return clone(post), nil
+}
+
+// AttachReferences loads the original posts of reposts and quotes. Posts
+// whose original was deleted keep a nil Referenced.
+func (r *MemoryPostRepository) AttachReferences(ctx context.Context, posts []*entity.Post) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	r.attachReferences(posts)
+
+	return setImageURLs(ctx, r.Blobs, posts)
+}
+
+// attachReferences must be called with the lock of the store held
+func (r *MemoryPostRepository) attachReferences(posts []*entity.Post) {
+	for _, post := range posts {
+		if post.Reference == nil {
+			continue
+		}
+
+		post.Referenced = nil
+		if referenced, ok := r.Store.posts[post.Reference.PostID]; ok && referenced.UserID == post.Reference.UserID {
+			post.Referenced = clone(referenced)
+		}
+	}
+}
+
+// Like stores the like of a user and increments the like count of the post.
+// A user can like a post only once.
+func (r *MemoryPostRepository) Like(ctx context.Context, like *entity.Like, authorId string) error {
+	if like == nil {
+		return fmt.Errorf("input like cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if _, ok := r.Store.likes[like.PostID][like.UserID]; ok {
+		return ErrAlreadyLiked
+	}
+
+	post, ok := r.Store.posts[like.PostID]
+	if !ok || post.UserID != authorId {
+		return ErrPostNotFound
+	}
+
+	if r.Store.likes[like.PostID] == nil {
+		r.Store.likes[like.PostID] = map[string]*entity.Like{}
+	}
+	r.Store.likes[like.PostID][like.UserID] = clone(like)
+	post.LikeCount++
+
+	return nil
+}
+
+func (r *MemoryPostRepository) Unlike(ctx context.Context, postId, userId, authorId string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if _, ok := r.Store.likes[postId][userId]; !ok {
+		return ErrNotLiked
+	}
+
+	post, ok := r.Store.posts[postId]
+	if !ok || post.UserID != authorId {
+		return ErrPostNotFound
+	}
+
+	delete(r.Store.likes[postId], userId)
+	post.LikeCount--
+
+	return nil
+}
+
+// GetLikedPostIDs returns which of the given posts the user has liked
+func (r *MemoryPostRepository) GetLikedPostIDs(ctx context.Context, userId string, postIds []string) (map[string]bool, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	liked := map[string]bool{}
+	for _, postId := range postIds {
+		if _, ok := r.Store.likes[postId][userId]; ok {
+			liked[postId] = true
+		}
+	}
+
+	return liked, nil
+}
+
+// GetInbox returns one page of the posts distributed to a user. The inbox
+// points at the stored posts, so it always shows their current version.
+func (r *MemoryPostRepository) GetInbox(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Post, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	inbox := r.Store.inboxes[userID]
+	return r.page(ctx, r.filter(func(post *entity.Post) bool { return inbox[post.ID] }), limit, cursor)
+}
+
+// DistributeToInboxes adds the post to the inbox of every owner
+func (r *MemoryPostRepository) DistributeToInboxes(ctx context.Context, post *entity.Post, ownerIDs []string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	for _, ownerID := range ownerIDs {
+		if r.Store.inboxes[ownerID] == nil {
+			r.Store.inboxes[ownerID] = map[string]bool{}
+		}
+		r.Store.inboxes[ownerID][post.ID] = true
+	}
+
+	return nil
+}
+
+// RefreshInboxCopies has nothing to do, inboxes in memory hold no copies
+func (r *MemoryPostRepository) RefreshInboxCopies(ctx context.Context, post *entity.Post) error {
+	return nil
+}
+
+func (r *MemoryPostRepository) DeleteInboxCopies(ctx context.Context, postId string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	for _, inbox := range r.Store.inboxes {
+		delete(inbox, postId)
+	}
+
+	return nil
+}
+
+// GetByTag returns one page of the posts using a tag, newest first
+func (r *MemoryPostRepository) GetByTag(ctx context.Context, tag string, limit int32, cursor string) ([]*entity.Post, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	tagged := r.Store.tags[tag]
+	return r.page(ctx, r.filter(func(post *entity.Post) bool {
+		_, ok := tagged[post.ID]
+		return ok
+	}), limit, cursor)
+}
+
+// CountTagsSince counts how often every tag was added to a post since the
+// given time, by the author of the post
+func (r *MemoryPostRepository) CountTagsSince(ctx context.Context, since time.Time) (map[string]map[string]int, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	counts := map[string]map[string]int{}
+	for tag, posts := range r.Store.tags {
+		for postId, added := range posts {
+			post, ok := r.Store.posts[postId]
+			if !ok || added.Before(since) {
+				continue
+			}
+			if counts[tag] == nil {
+				counts[tag] = map[string]int{}
+			}
+			counts[tag][post.UserID]++
+		}
+	}
+
+	return counts, nil
+}
+
+// syncTags adds the post to the tags it gained and removes it from those it
+// lost since previousTags. It must be called with the lock of the store held.
+func (r *MemoryPostRepository) syncTags(postId string, tags, previousTags []string) {
+	now := time.Now()
+	for _, tag := range tags {
+		if slices.Contains(previousTags, tag) {
+			continue
+		}
+		if r.Store.tags[tag] == nil {
+			r.Store.tags[tag] = map[string]time.Time{}
+		}
+		r.Store.tags[tag][postId] = now
+	}
+
+	for _, tag := range previousTags {
+		if slices.Contains(tags, tag) {
+			continue
+		}
+		delete(r.Store.tags[tag], postId)
+		if len(r.Store.tags[tag]) == 0 {
+			delete(r.Store.tags, tag)
+		}
+	}
+}
+
+// filter returns copies of the matching posts, newest first. It must be
+// called with the lock of the store held.
+func (r *MemoryPostRepository) filter(match func(*entity.Post) bool) []*entity.Post {
+	var posts []*entity.Post
+	for _, post := range r.Store.posts {
+		if match(post) {
+			posts = append(posts, clone(post))
+		}
+	}
+
+	// Ids are ULIDs, so they sort by creation time
+	slices.SortFunc(posts, func(a, b *entity.Post) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return posts
+}
+
+// page cuts one page out of posts sorted by filter. It must be called with
+// the lock of the store held.
+func (r *MemoryPostRepository) page(ctx context.Context, posts []*entity.Post, limit int32, cursor string) ([]*entity.Post, string, error) {
+	posts, nextCursor, err := memoryPage(posts, func(post *entity.Post) string { return post.ID }, true, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.attachReferences(posts)
+
+	err = setImageURLs(ctx, r.Blobs, posts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return posts, nextCursor, nil
+}
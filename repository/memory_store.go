@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// MemoryStore holds the data of the in-memory repositories. They share one
+// store and one lock, so changes that span several entities, like a follow
+// and the counters of both users, are atomic like a DynamoDB transaction.
+// Everything is lost when the process exits.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	users   map[string]*entity.User
+	handles map[string]string
+	// edges holds the follows, followers, blocks, mutes and follow requests
+	// of a user by the other user. The time is when the edge was created.
+	edges map[memoryEdgeList]map[string]time.Time
+
+	posts map[string]*entity.Post
+	// likes of a post by user
+	likes map[string]map[string]*entity.Like
+	// inboxes hold the ids of the posts distributed to a user
+	inboxes map[string]map[string]bool
+	// tags map the posts using a tag to when the tag was added
+	tags map[string]map[string]time.Time
+
+	// comments of a post by id
+	comments map[string]map[string]*entity.Comment
+
+	notifications     map[string][]*entity.Notification
+	notificationsRead map[string]string
+
+	conversations map[string]*entity.Conversation
+	// members of a conversation by user
+	members  map[string]map[string]*entity.ConversationMember
+	messages map[string][]*entity.Message
+}
+
+// memoryEdgeList identifies the edges of one kind in the partition of a
+// user. Kinds are the sort key prefixes of the DynamoDB items.
+type memoryEdgeList struct {
+	userID string
+	prefix string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:             map[string]*entity.User{},
+		handles:           map[string]string{},
+		edges:             map[memoryEdgeList]map[string]time.Time{},
+		posts:             map[string]*entity.Post{},
+		likes:             map[string]map[string]*entity.Like{},
+		inboxes:           map[string]map[string]bool{},
+		tags:              map[string]map[string]time.Time{},
+		comments:          map[string]map[string]*entity.Comment{},
+		notifications:     map[string][]*entity.Notification{},
+		notificationsRead: map[string]string{},
+		conversations:     map[string]*entity.Conversation{},
+		members:           map[string]map[string]*entity.ConversationMember{},
+		messages:          map[string][]*entity.Message{},
+	}
+}
+
+func (s *MemoryStore) hasEdge(userID, prefix, otherID string) bool {
+	_, ok := s.edges[memoryEdgeList{userID, prefix}][otherID]
+	return ok
+}
+
+func (s *MemoryStore) putEdge(userID, prefix, otherID string, created time.Time) {
+	list := memoryEdgeList{userID, prefix}
+	if s.edges[list] == nil {
+		s.edges[list] = map[string]time.Time{}
+	}
+	s.edges[list][otherID] = created
+}
+
+// edgeIDs returns the other users of the edges of one kind, sorted by id
+func (s *MemoryStore) edgeIDs(userID, prefix string) []string {
+	ids := make([]string, 0, len(s.edges[memoryEdgeList{userID, prefix}]))
+	for id := range s.edges[memoryEdgeList{userID, prefix}] {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// deleteEdge reports whether there was an edge to delete
+func (s *MemoryStore) deleteEdge(userID, prefix, otherID string) bool {
+	list := memoryEdgeList{userID, prefix}
+	if _, ok := s.edges[list][otherID]; !ok {
+		return false
+	}
+	delete(s.edges[list], otherID)
+	return true
+}
+
+// clone copies an entity so that callers cannot change the stored one. Slices
+// are shared, they are only ever replaced as a whole.
+func clone[T any](value *T) *T {
+	c := *value
+	return &c
+}
+
+// memoryPage returns up to limit items after the cursor. The items must be
+// sorted by key in the given direction. The cursor holds the key of the last
+// item of the previous page, so it stays valid when that item is deleted.
+func memoryPage[T any](items []T, key func(T) string, descending bool, limit int32, cursor string) ([]T, string, error) {
+	start := 0
+	if cursor != "" {
+		after, err := decodeKeyCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		start = len(items)
+		for i, item := range items {
+			k := key(item)
+			if descending && k < after || !descending && k > after {
+				start = i
+				break
+			}
+		}
+	}
+
+	end := min(start+int(max(limit, 0)), len(items))
+	page := items[start:end]
+	if len(page) == 0 || end == len(items) {
+		return page, "", nil
+	}
+
+	nextCursor, err := encodeKeyCursor(key(page[len(page)-1]))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return page, nextCursor, nil
+}
@@ -0,0 +1,508 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// MemoryUserRepository keeps users and the edges between them in a
+// MemoryStore
+type MemoryUserRepository struct {
+	Store *MemoryStore
+}
+
+func NewMemoryUserRepository(store *MemoryStore) *MemoryUserRepository {
+	return &MemoryUserRepository{
+		Store: store,
+	}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *entity.User) (*entity.User, error) {
+	if user == nil {
+		return nil, fmt.Errorf("input user cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if user.Handle != "" {
+		if _, ok := r.Store.handles[user.Handle]; ok {
+			return nil, ErrHandleTaken
+		}
+		r.Store.handles[user.Handle] = user.ID
+	}
+
+	r.Store.users[user.ID] = clone(user)
+
+	return user, nil
+}
+
+// ClaimHandle reserves a handle for an existing user without one
+func (r *MemoryUserRepository) ClaimHandle(ctx context.Context, userID, handle string) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if _, ok := r.Store.handles[handle]; ok {
+		return ErrHandleTaken
+	}
+
+	user, ok := r.Store.users[userID]
+	if !ok || user.Handle != "" {
+		return ErrUserNotFound
+	}
+
+	r.Store.handles[handle] = userID
+	user.Handle = handle
+
+	return nil
+}
+
+// GetIDsByHandles maps the given handles to the ids of their users. Handles
+// nobody uses are left out.
+func (r *MemoryUserRepository) GetIDsByHandles(ctx context.Context, handles []string) (map[string]string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	ids := map[string]string{}
+	for _, handle := range handles {
+		if id, ok := r.Store.handles[handle]; ok {
+			ids[handle] = id
+		}
+	}
+
+	return ids, nil
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id string) (*entity.User, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	user, ok := r.Store.users[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return clone(user), nil
+}
+
+func (r *MemoryUserRepository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	users := make([]*entity.User, 0, len(r.Store.users))
+	for _, user := range r.Store.users {
+		users = append(users, clone(user))
+	}
+
+	// Same order as the descending query of the DynamoDB repository
+	slices.SortFunc(users, func(a, b *entity.User) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return users, nil
+}
+
+func (r *MemoryUserRepository) GetFollowing(ctx context.Context, userID string) ([]*entity.Follow, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	ids := r.Store.edgeIDs(userID, "follower#")
+	slices.Reverse(ids)
+
+	following := make([]*entity.Follow, 0, len(ids))
+	for _, id := range ids {
+		follow, _ := entity.NewFollow(userID, id)
+		following = append(following, follow)
+	}
+
+	return following, nil
+}
+
+func (r *MemoryUserRepository) GetFollowers(ctx context.Context, userID string) ([]*entity.Follower, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.followers(r.Store.edgeIDs(userID, "followed_by#"), userID), nil
+}
+
+func (r *MemoryUserRepository) followers(ids []string, userID string) []*entity.Follower {
+	followers := make([]*entity.Follower, 0, len(ids))
+	for _, id := range ids {
+		follower, _ := entity.NewFollower(id, userID)
+		followers = append(followers, follower)
+	}
+	return followers
+}
+
+// GetFollowerIDs returns the ids of all followers of a user
+func (r *MemoryUserRepository) GetFollowerIDs(ctx context.Context, userID string) ([]string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.Store.edgeIDs(userID, "followed_by#"), nil
+}
+
+// IsFollowing reports whether one user follows another
+func (r *MemoryUserRepository) IsFollowing(ctx context.Context, followerID, followingID string) (bool, error) {
+	return r.hasEdge(followerID, "follower#", followingID), nil
+}
+
+// IsBlocked reports whether one user blocked another
+func (r *MemoryUserRepository) IsBlocked(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	return r.hasEdge(blockerID, "block#", blockedID), nil
+}
+
+// IsMuted reports whether one user muted another
+func (r *MemoryUserRepository) IsMuted(ctx context.Context, muterID, mutedID string) (bool, error) {
+	return r.hasEdge(muterID, "mute#", mutedID), nil
+}
+
+func (r *MemoryUserRepository) hasEdge(userID, prefix, otherID string) bool {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.Store.hasEdge(userID, prefix, otherID)
+}
+
+func (r *MemoryUserRepository) GetFollowingPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follow, string, error) {
+	ids, nextCursor, err := r.edgePage(userID, "follower#", limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	following := make([]*entity.Follow, 0, len(ids))
+	for _, id := range ids {
+		follow, _ := entity.NewFollow(userID, id)
+		following = append(following, follow)
+	}
+
+	return following, nextCursor, nil
+}
+
+func (r *MemoryUserRepository) GetFollowersPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follower, string, error) {
+	ids, nextCursor, err := r.edgePage(userID, "followed_by#", limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return r.followers(ids, userID), nextCursor, nil
+}
+
+// edgePage returns one page of the other users of the edges of one kind
+func (r *MemoryUserRepository) edgePage(userID, prefix string, limit int32, cursor string) ([]string, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return memoryPage(r.Store.edgeIDs(userID, prefix), func(id string) string { return id }, false, limit, cursor)
+}
+
+// GetByIDs returns the users with the given ids in the same order. Users that
+// do not exist are left out.
+func (r *MemoryUserRepository) GetByIDs(ctx context.Context, ids []string) ([]*entity.User, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	users := make([]*entity.User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := r.Store.users[id]; ok {
+			users = append(users, clone(user))
+		}
+	}
+
+	return users, nil
+}
+
+// Follow stores the follow edge together with its mirrored Follower item and
+// updates the counters of both users
+func (r *MemoryUserRepository) Follow(ctx context.Context, follow *entity.Follow, follower *entity.Follower) (*entity.Follow, error) {
+	if follow == nil || follower == nil {
+		return nil, fmt.Errorf("input follow cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	err := r.follow(follower.FollowerID, follow.FollowedID)
+	if err != nil {
+		return nil, err
+	}
+
+	return follow, nil
+}
+
+// follow must be called with the lock of the store held
+func (r *MemoryUserRepository) follow(followerID, followingID string) error {
+	if r.Store.hasEdge(followerID, "follower#", followingID) {
+		return ErrAlreadyFollowing
+	}
+
+	followerUser, ok := r.Store.users[followerID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	followingUser, ok := r.Store.users[followingID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	now := time.Now()
+	r.Store.putEdge(followerID, "follower#", followingID, now)
+	r.Store.putEdge(followingID, "followed_by#", followerID, now)
+	followerUser.FollowingCount++
+	followingUser.FollowersCount++
+
+	return nil
+}
+
+// Unfollow removes the follow edge together with its mirrored Follower item
+// and updates the counters of both users
+func (r *MemoryUserRepository) Unfollow(ctx context.Context, unfollow *entity.Unfollow, removeFollower *entity.Unfollow) error {
+	if unfollow == nil || removeFollower == nil {
+		return fmt.Errorf("input unfollow cannot be nil")
+	}
+
+	followerID := strings.TrimPrefix(unfollow.PK, "user#")
+	followingID := strings.TrimPrefix(removeFollower.PK, "user#")
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if !r.unfollow(followerID, followingID) {
+		return ErrNotFollowing
+	}
+
+	return nil
+}
+
+// unfollow reports whether there was a follow to remove. It must be called
+// with the lock of the store held.
+func (r *MemoryUserRepository) unfollow(followerID, followingID string) bool {
+	if !r.Store.deleteEdge(followerID, "follower#", followingID) {
+		return false
+	}
+	r.Store.deleteEdge(followingID, "followed_by#", followerID)
+
+	if user, ok := r.Store.users[followerID]; ok {
+		user.FollowingCount--
+	}
+	if user, ok := r.Store.users[followingID]; ok {
+		user.FollowersCount--
+	}
+
+	return true
+}
+
+// UpdateSettings changes the settings that are set and returns the updated user
+func (r *MemoryUserRepository) UpdateSettings(ctx context.Context, userID string, settings *entity.UserSettings) (*entity.User, error) {
+	if settings == nil {
+		return nil, fmt.Errorf("input settings cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	user, ok := r.Store.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	if settings.DMsFollowingOnly != nil {
+		user.DMsFollowingOnly = *settings.DMsFollowingOnly
+	}
+	if settings.Private != nil {
+		user.Private = *settings.Private
+	}
+
+	return clone(user), nil
+}
+
+// GetBlockedIDs returns the ids of the users a user blocked
+func (r *MemoryUserRepository) GetBlockedIDs(ctx context.Context, userID string) ([]string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.Store.edgeIDs(userID, "block#"), nil
+}
+
+// GetMutedIDs returns the ids of the users a user muted
+func (r *MemoryUserRepository) GetMutedIDs(ctx context.Context, userID string) ([]string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	return r.Store.edgeIDs(userID, "mute#"), nil
+}
+
+// GetBlockerIDs returns which of the candidates blocked a user
+func (r *MemoryUserRepository) GetBlockerIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	blockers := map[string]bool{}
+	for _, candidateID := range candidateIDs {
+		if r.Store.hasEdge(candidateID, "block#", userID) {
+			blockers[candidateID] = true
+		}
+	}
+
+	return blockers, nil
+}
+
+// GetFollowedIDs returns which of the candidates a user follows
+func (r *MemoryUserRepository) GetFollowedIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	followed := map[string]bool{}
+	for _, candidateID := range candidateIDs {
+		if r.Store.hasEdge(userID, "follower#", candidateID) {
+			followed[candidateID] = true
+		}
+	}
+
+	return followed, nil
+}
+
+// Block stores a block and removes the follow edges and requests between both
+// users together with their counters
+func (r *MemoryUserRepository) Block(ctx context.Context, block *entity.Block) error {
+	if block == nil {
+		return fmt.Errorf("input block cannot be nil")
+	}
+
+	blockerID := strings.TrimPrefix(block.PK, "user#")
+	blockedID := block.BlockedID
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if r.Store.hasEdge(blockerID, "block#", blockedID) {
+		return ErrAlreadyBlocked
+	}
+	if _, ok := r.Store.users[blockedID]; !ok {
+		return ErrUserNotFound
+	}
+
+	r.Store.putEdge(blockerID, "block#", blockedID, time.Now())
+
+	for _, edge := range [][2]string{{blockerID, blockedID}, {blockedID, blockerID}} {
+		r.unfollow(edge[0], edge[1])
+		r.Store.deleteEdge(edge[1], "follow_request#", edge[0])
+	}
+
+	return nil
+}
+
+func (r *MemoryUserRepository) Unblock(ctx context.Context, blockerID, blockedID string) error {
+	return r.deleteEdge(blockerID, "block#", blockedID, ErrNotBlocked)
+}
+
+// Mute stores a mute if the muted user exists
+func (r *MemoryUserRepository) Mute(ctx context.Context, mute *entity.Mute) error {
+	if mute == nil {
+		return fmt.Errorf("input mute cannot be nil")
+	}
+
+	muterID := strings.TrimPrefix(mute.PK, "user#")
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if r.Store.hasEdge(muterID, "mute#", mute.MutedID) {
+		return ErrAlreadyMuted
+	}
+	if _, ok := r.Store.users[mute.MutedID]; !ok {
+		return ErrUserNotFound
+	}
+
+	r.Store.putEdge(muterID, "mute#", mute.MutedID, time.Now())
+
+	return nil
+}
+
+func (r *MemoryUserRepository) Unmute(ctx context.Context, muterID, mutedID string) error {
+	return r.deleteEdge(muterID, "mute#", mutedID, ErrNotMuted)
+}
+
+func (r *MemoryUserRepository) deleteEdge(userID, prefix, otherID string, notFound error) error {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if !r.Store.deleteEdge(userID, prefix, otherID) {
+		return notFound
+	}
+
+	return nil
+}
+
+func (r *MemoryUserRepository) CreateFollowRequest(ctx context.Context, request *entity.FollowRequest) error {
+	if request == nil {
+		return fmt.Errorf("input follow request cannot be nil")
+	}
+
+	userID := strings.TrimPrefix(request.PK, "user#")
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if r.Store.hasEdge(userID, "follow_request#", request.RequesterID) {
+		return ErrAlreadyRequested
+	}
+
+	r.Store.putEdge(userID, "follow_request#", request.RequesterID, request.Timestamp)
+
+	return nil
+}
+
+// GetFollowRequestsPage returns one page of the pending follow requests of a
+// user
+func (r *MemoryUserRepository) GetFollowRequestsPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.FollowRequest, string, error) {
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	ids, nextCursor, err := memoryPage(r.Store.edgeIDs(userID, "follow_request#"), func(id string) string { return id }, false, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	requests := make([]*entity.FollowRequest, 0, len(ids))
+	for _, id := range ids {
+		request, _ := entity.NewFollowRequest(id, userID)
+		request.Timestamp = r.Store.edges[memoryEdgeList{userID, "follow_request#"}][id]
+		requests = append(requests, request)
+	}
+
+	return requests, nextCursor, nil
+}
+
+// ApproveFollowRequest replaces a pending request with the follow edge
+func (r *MemoryUserRepository) ApproveFollowRequest(ctx context.Context, follow *entity.Follow, follower *entity.Follower) error {
+	if follow == nil || follower == nil {
+		return fmt.Errorf("input follow cannot be nil")
+	}
+
+	r.Store.mu.Lock()
+	defer r.Store.mu.Unlock()
+
+	if !r.Store.hasEdge(follow.FollowedID, "follow_request#", follower.FollowerID) {
+		return ErrRequestNotFound
+	}
+
+	err := r.follow(follower.FollowerID, follow.FollowedID)
+	if err != nil {
+		return err
+	}
+
+	r.Store.deleteEdge(follow.FollowedID, "follow_request#", follower.FollowerID)
+
+	return nil
+}
+
+// DeleteFollowRequest rejects or withdraws a pending request
+func (r *MemoryUserRepository) DeleteFollowRequest(ctx context.Context, userID, requesterID string) error {
+	return r.deleteEdge(userID, "follow_request#", requesterID, ErrRequestNotFound)
+}
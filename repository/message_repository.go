@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type MessageRepository interface {
+	CreateConversation(ctx context.Context, conversation *entity.Conversation, members []*entity.ConversationMember) (*entity.Conversation, error)
+	GetConversation(ctx context.Context, conversationId string) (*entity.Conversation, error)
+	GetMember(ctx context.Context, userId, conversationId string) (*entity.ConversationMember, error)
+	GetMembers(ctx context.Context, conversationId string, userIds []string) ([]*entity.ConversationMember, error)
+	GetConversationsPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.ConversationMember, string, error)
+	CreateMessage(ctx context.Context, message *entity.Message, participantIds []string) (*entity.Message, error)
+	GetMessagesPage(ctx context.Context, conversationId string, limit int32, cursor string) ([]*entity.Message, string, error)
+	MarkRead(ctx context.Context, userId, conversationId, messageId string) (bool, error)
+}
+
+type DefaultMessageRepository struct {
+	DB        *dynamodb.Client
+	TableName string
+}
+
+func NewDefaultMessageRepository(db *dynamodb.Client, tableName string) *DefaultMessageRepository {
+	return &DefaultMessageRepository{
+		DB:        db,
+		TableName: tableName,
+	}
+}
+
+func conversationKey(conversationId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "conversation#" + conversationId},
+		"sk": &types.AttributeValueMemberS{Value: "meta"},
+	}
+}
+
+func conversationMemberKey(userId, conversationId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "user#" + userId},
+		"sk": &types.AttributeValueMemberS{Value: "conversation#" + conversationId},
+	}
+}
+
+// CreateConversation stores a conversation together with the entries of its
+// participants. ErrConversationExists is returned if a conversation with the
+// same id already exists.
+func (r *DefaultMessageRepository) CreateConversation(ctx context.Context, conversation *entity.Conversation, members []*entity.ConversationMember) (*entity.Conversation, error) {
+	if conversation == nil {
+		return nil, fmt.Errorf("input conversation cannot be nil")
+	}
+
+	av, err := attributevalue.MarshalMap(conversation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal conversation to DynamoDB attribute values: %w", err)
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{Put: &types.Put{
+			Item:                av,
+			TableName:           aws.String(r.TableName),
+			ConditionExpression: aws.String("attribute_not_exists(pk)"),
+		}},
+	}
+
+	for _, member := range members {
+		memberAv, err := attributevalue.MarshalMap(member)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal conversation member to DynamoDB attribute values: %w", err)
+		}
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Put: &types.Put{Item: memberAv, TableName: aws.String(r.TableName)},
+		})
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	switch {
+	case conditionFailedAt(err, 0):
+		return nil, ErrConversationExists
+	case err != nil:
+		return nil, fmt.Errorf("failed to write conversation (PK: %s) to DynamoDB: %w", conversation.PK, err)
+	}
+
+	return conversation, nil
+}
+
+// GetConversation returns nil if the conversation does not exist
+func (r *DefaultMessageRepository) GetConversation(ctx context.Context, conversationId string) (*entity.Conversation, error) {
+	result, err := r.DB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.TableName),
+		Key:       conversationKey(conversationId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation %s: %w", conversationId, err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	conversation := new(entity.Conversation)
+	err = attributevalue.UnmarshalMap(result.Item, conversation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB item into Conversation struct: %w", err)
+	}
+
+	return conversation, nil
+}
+
+// GetMember returns the entry of a conversation for one participant, or nil
+// if the user does not take part in it
+func (r *DefaultMessageRepository) GetMember(ctx context.Context, userId, conversationId string) (*entity.ConversationMember, error) {
+	result, err := r.DB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.TableName),
+		Key:       conversationMemberKey(userId, conversationId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation %s of user %s: %w", conversationId, userId, err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	member := new(entity.ConversationMember)
+	err = attributevalue.UnmarshalMap(result.Item, member)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB item into ConversationMember struct: %w", err)
+	}
+
+	return member, nil
+}
+
+// GetMembers returns the entries of a conversation for the given participants
+func (r *DefaultMessageRepository) GetMembers(ctx context.Context, conversationId string, userIds []string) ([]*entity.ConversationMember, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(userIds))
+	for _, userId := range userIds {
+		keys = append(keys, conversationMemberKey(userId, conversationId))
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*entity.ConversationMember
+	err = attributevalue.UnmarshalListOfMaps(items, &members)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	return members, nil
+}
+
+// GetConversationsPage returns one page of the conversations of a user, the
+// most recently active first
+func (r *DefaultMessageRepository) GetConversationsPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.ConversationMember, string, error) {
+	indexKey := "conversations#" + userId
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		IndexName:              aws.String("gsi1"),
+		KeyConditionExpression: aws.String("gsi1_pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: indexKey},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk", "gsi1_pk", "gsi1_sk")
+		if err != nil {
+			return nil, "", err
+		}
+		if values["gsi1_pk"] != indexKey || values["pk"] != "user#"+userId || !strings.HasPrefix(values["sk"], "conversation#") {
+			return nil, "", ErrInvalidCursor
+		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query conversations of user %s: %w", userId, err)
+	}
+
+	var members []*entity.ConversationMember
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &members)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return members, nextCursor, nil
+}
+
+// CreateMessage stores a message and moves its conversation to the top of the
+// list of every participant. The sender has read their own message.
+func (r *DefaultMessageRepository) CreateMessage(ctx context.Context, message *entity.Message, participantIds []string) (*entity.Message, error) {
+	if message == nil {
+		return nil, fmt.Errorf("input message cannot be nil")
+	}
+
+	av, err := attributevalue.MarshalMap(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message to DynamoDB attribute values: %w", err)
+	}
+
+	// The entries keep a copy of the message without its keys
+	preview := *message
+	preview.PK = ""
+	preview.SK = ""
+	previewAv, err := attributevalue.Marshal(preview)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message preview to DynamoDB attribute values: %w", err)
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{Put: &types.Put{Item: av, TableName: aws.String(r.TableName)}},
+	}
+
+	for _, userId := range participantIds {
+		update := &types.Update{
+			TableName:           aws.String(r.TableName),
+			Key:                 conversationMemberKey(userId, message.ConversationID),
+			UpdateExpression:    aws.String("SET gsi1_sk = :id, last_message = :message"),
+			ConditionExpression: aws.String("attribute_exists(pk)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":id":      &types.AttributeValueMemberS{Value: message.ID},
+				":message": previewAv,
+			},
+		}
+		if userId == message.SenderID {
+			update.UpdateExpression = aws.String("SET gsi1_sk = :id, last_message = :message, last_read_id = :id")
+		}
+		transactItems = append(transactItems, types.TransactWriteItem{Update: update})
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write message (PK: %s) to DynamoDB: %w", message.PK, err)
+	}
+
+	return message, nil
+}
+
+// GetMessagesPage returns one page of the messages of a conversation, newest
+// first
+func (r *DefaultMessageRepository) GetMessagesPage(ctx context.Context, conversationId string, limit int32, cursor string) ([]*entity.Message, string, error) {
+	partitionKey := "conversation#" + conversationId
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "message#"},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk")
+		if err != nil {
+			return nil, "", err
+		}
+		if values["pk"] != partitionKey || !strings.HasPrefix(values["sk"], "message#") {
+			return nil, "", ErrInvalidCursor
+		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query messages of conversation %s: %w", conversationId, err)
+	}
+
+	var messages []*entity.Message
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &messages)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return messages, nextCursor, nil
+}
+
+// MarkRead moves the read receipt of a participant forward to the given
+// message. A receipt that is already further ahead is left alone, which is
+// reported by returning false.
+func (r *DefaultMessageRepository) MarkRead(ctx context.Context, userId, conversationId, messageId string) (bool, error) {
+	input := &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.TableName),
+		Key:                 conversationMemberKey(userId, conversationId),
+		UpdateExpression:    aws.String("SET last_read_id = :id"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND (attribute_not_exists(last_read_id) OR last_read_id < :id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: messageId},
+		},
+	}
+
+	_, err := r.DB.UpdateItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to mark conversation %s of user %s as read: %w", conversationId, userId, err)
+	}
+
+	return true, nil
+}
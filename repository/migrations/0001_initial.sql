@@ -0,0 +1,157 @@
+-- Users and the edges between them. Handles are unique, users without one
+-- keep it NULL.
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	picture TEXT NOT NULL,
+	handle TEXT UNIQUE,
+	followers_count INTEGER NOT NULL DEFAULT 0,
+	following_count INTEGER NOT NULL DEFAULT 0,
+	posts_count INTEGER NOT NULL DEFAULT 0,
+	dms_following_only BOOLEAN NOT NULL DEFAULT FALSE,
+	private BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE follows (
+	follower_id TEXT NOT NULL,
+	followed_id TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	PRIMARY KEY (follower_id, followed_id)
+);
+
+CREATE INDEX follows_followed_id ON follows (followed_id, follower_id);
+
+CREATE TABLE blocks (
+	blocker_id TEXT NOT NULL,
+	blocked_id TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE TABLE mutes (
+	muter_id TEXT NOT NULL,
+	muted_id TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	PRIMARY KEY (muter_id, muted_id)
+);
+
+CREATE TABLE follow_requests (
+	user_id TEXT NOT NULL,
+	requester_id TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	PRIMARY KEY (user_id, requester_id)
+);
+
+-- Post ids are ULIDs, so ordering by id orders by creation time. Tags,
+-- mentions and participant ids are JSON arrays.
+CREATE TABLE posts (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	text TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	image TEXT NOT NULL,
+	edited {{timestamp}},
+	like_count INTEGER NOT NULL DEFAULT 0,
+	reference_kind TEXT NOT NULL DEFAULT '',
+	reference_user_id TEXT NOT NULL DEFAULT '',
+	reference_post_id TEXT NOT NULL DEFAULT '',
+	tags TEXT,
+	mentions TEXT
+);
+
+CREATE INDEX posts_user_id ON posts (user_id, id);
+
+-- Everything that belongs to a post goes away together with it
+CREATE TABLE likes (
+	post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE inbox (
+	owner_id TEXT NOT NULL,
+	post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	PRIMARY KEY (owner_id, post_id)
+);
+
+CREATE INDEX inbox_post_id ON inbox (post_id);
+
+CREATE TABLE post_tags (
+	tag TEXT NOT NULL,
+	post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	PRIMARY KEY (tag, post_id)
+);
+
+CREATE INDEX post_tags_post_id ON post_tags (post_id);
+CREATE INDEX post_tags_timestamp ON post_tags (timestamp);
+
+-- Top level comments have an empty parent_id
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY,
+	post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	text TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL,
+	edited {{timestamp}},
+	parent_id TEXT NOT NULL DEFAULT '',
+	reply_count INTEGER NOT NULL DEFAULT 0,
+	deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	mentions TEXT
+);
+
+CREATE INDEX comments_post_id ON comments (post_id, parent_id, id);
+
+CREATE TABLE notifications (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	actor_id TEXT NOT NULL,
+	actor_name TEXT NOT NULL,
+	post_id TEXT NOT NULL DEFAULT '',
+	comment_id TEXT NOT NULL DEFAULT '',
+	timestamp {{timestamp}} NOT NULL
+);
+
+CREATE INDEX notifications_user_id ON notifications (user_id, id);
+
+CREATE TABLE notifications_read (
+	user_id TEXT PRIMARY KEY,
+	last_read_id TEXT NOT NULL
+);
+
+CREATE TABLE conversations (
+	id TEXT PRIMARY KEY,
+	creator_id TEXT NOT NULL,
+	participant_ids TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL
+);
+
+CREATE TABLE messages (
+	id TEXT PRIMARY KEY,
+	conversation_id TEXT NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+	sender_id TEXT NOT NULL,
+	sender_name TEXT NOT NULL,
+	text TEXT NOT NULL,
+	timestamp {{timestamp}} NOT NULL
+);
+
+CREATE INDEX messages_conversation_id ON messages (conversation_id, id);
+
+-- last_activity holds the id of the newest message, like the index key of
+-- the DynamoDB items
+CREATE TABLE conversation_members (
+	conversation_id TEXT NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	last_activity TEXT NOT NULL,
+	last_message_id TEXT REFERENCES messages (id) ON DELETE SET NULL,
+	last_read_id TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX conversation_members_user_id ON conversation_members (user_id, last_activity);
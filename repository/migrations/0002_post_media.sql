@@ -0,0 +1,4 @@
+-- Posts keep their images in a JSON array of media. The image column only
+-- holds the image of posts from before, which is read as their only medium
+-- and cleared when the post is edited.
+ALTER TABLE posts ADD COLUMN media TEXT;
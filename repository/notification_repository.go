@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *entity.Notification) (*entity.Notification, error)
+	GetPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.Notification, string, error)
+	GetLatestID(ctx context.Context, userId string) (string, error)
+	GetLastReadID(ctx context.Context, userId string) (string, error)
+	MarkRead(ctx context.Context, userId, notificationId string) error
+	CountUnread(ctx context.Context, userId, lastReadId string, hiddenActorIds []string) (int, error)
+}
+
+type DefaultNotificationRepository struct {
+	DB        *dynamodb.Client
+	TableName string
+}
+
+func NewDefaultNotificationRepository(db *dynamodb.Client, tableName string) *DefaultNotificationRepository {
+	return &DefaultNotificationRepository{
+		DB:        db,
+		TableName: tableName,
+	}
+}
+
+func notificationsReadKey(userId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "user#" + userId},
+		"sk": &types.AttributeValueMemberS{Value: "notif_read"},
+	}
+}
+
+func (r *DefaultNotificationRepository) Create(ctx context.Context, notification *entity.Notification) (*entity.Notification, error) {
+	if notification == nil {
+		return nil, fmt.Errorf("input notification cannot be nil")
+	}
+
+	av, err := attributevalue.MarshalMap(notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification to DynamoDB attribute values: %w", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(r.TableName),
+	}
+
+	_, err = r.DB.PutItem(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", notification.PK, err)
+	}
+
+	return notification, nil
+}
+
+// GetPage returns one page of the notifications of a user, newest first
+func (r *DefaultNotificationRepository) GetPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.Notification, string, error) {
+	partitionKey := "user#" + userId
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "notif#"},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk")
+		if err != nil {
+			return nil, "", err
+		}
+		if values["pk"] != partitionKey || !strings.HasPrefix(values["sk"], "notif#") {
+			return nil, "", ErrInvalidCursor
+		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query notifications of user %s: %w", userId, err)
+	}
+
+	var notifications []*entity.Notification
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &notifications)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return notifications, nextCursor, nil
+}
+
+// GetLatestID returns the id of the newest notification of a user, or an
+// empty string if there is none
+func (r *DefaultNotificationRepository) GetLatestID(ctx context.Context, userId string) (string, error) {
+	notifications, _, err := r.GetPage(ctx, userId, 1, "")
+	if err != nil {
+		return "", err
+	}
+
+	if len(notifications) == 0 {
+		return "", nil
+	}
+
+	return notifications[0].ID, nil
+}
+
+// GetLastReadID returns the id up to which the user read their
+// notifications, or an empty string if they never did
+func (r *DefaultNotificationRepository) GetLastReadID(ctx context.Context, userId string) (string, error) {
+	result, err := r.DB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.TableName),
+		Key:       notificationsReadKey(userId),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get read marker of user %s: %w", userId, err)
+	}
+
+	if result.Item == nil {
+		return "", nil
+	}
+
+	read := entity.NotificationsRead{}
+	err = attributevalue.UnmarshalMap(result.Item, &read)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshalling item: %w", err)
+	}
+
+	return read.LastReadID, nil
+}
+
+// MarkRead moves the read marker of a user forward to the given id. Ids are
+// ULIDs, so a marker that is already further ahead is left alone.
+func (r *DefaultNotificationRepository) MarkRead(ctx context.Context, userId, notificationId string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.TableName),
+		Key:                 notificationsReadKey(userId),
+		UpdateExpression:    aws.String("SET last_read_id = :id"),
+		ConditionExpression: aws.String("attribute_not_exists(last_read_id) OR last_read_id < :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: notificationId},
+		},
+	}
+
+	_, err := r.DB.UpdateItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark notifications of user %s as read: %w", userId, err)
+	}
+
+	return nil
+}
+
+// CountUnread counts the notifications newer than lastReadId, except those of
+// hidden actors
+func (r *DefaultNotificationRepository) CountUnread(ctx context.Context, userId, lastReadId string, hiddenActorIds []string) (int, error) {
+	// Appending any character sorts right after the marker itself, and "~"
+	// sorts after every ULID character
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND sk BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":   &types.AttributeValueMemberS{Value: "user#" + userId},
+			":from": &types.AttributeValueMemberS{Value: "notif#" + lastReadId + "#"},
+			":to":   &types.AttributeValueMemberS{Value: "notif#~"},
+		},
+		Select: types.SelectCount,
+	}
+
+	// Users may hide more actors than a filter expression takes, so their
+	// notifications are left out here
+	hidden := map[string]bool{}
+	for _, id := range hiddenActorIds {
+		hidden[id] = true
+	}
+	if len(hidden) > 0 {
+		input.Select = types.SelectSpecificAttributes
+		input.ProjectionExpression = aws.String("actor_id")
+	}
+
+	paginator := dynamodb.NewQueryPaginator(r.DB, input)
+
+	count := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count unread notifications of user %s: %w", userId, err)
+		}
+		if len(hidden) == 0 {
+			count += int(page.Count)
+			continue
+		}
+
+		for _, item := range page.Items {
+			actor, ok := item["actor_id"].(*types.AttributeValueMemberS)
+			if !ok || !hidden[actor.Value] {
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
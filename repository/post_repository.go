@@ -2,10 +2,8 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
-	"math"
+	"strings"
 	"time"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
@@ -13,44 +11,50 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/oklog/ulid/v2"
 )
 
 type PostRepository interface {
 	Create(ctx context.Context, post *entity.Post) (*entity.Post, error)
-	GetAll(ctx context.Context) ([]*entity.Post, error)
+	GetAll(ctx context.Context, limit int32, cursor string) ([]*entity.Post, string, error)
 	GetByUserID(ctx context.Context, userID string) ([]*entity.Post, error)
+	GetPageByUserID(ctx context.Context, userID, beforeID string, limit int32) ([]*entity.Post, error)
 	Get(ctx context.Context, userId, postId string) (*entity.Post, error)
-	Update(ctx context.Context, userId, postId, text, image string) (*entity.Post, error)
+	Update(ctx context.Context, userId, postId, text string, media []entity.Media, mentions []entity.Mention) (*entity.Post, error)
 	Delete(ctx context.Context, userId, postId string) error
 	DeleteImage(ctx context.Context, imageKey string) error
+	// ProcessImage turns an upload of a user into an image with variants and
+	// returns it as a medium without alt text. Keys that are no uploads of the
+	// user are rejected.
+	ProcessImage(ctx context.Context, userId, uploadKey string) (*entity.Media, error)
+	GetByID(ctx context.Context, postId string) (*entity.Post, error)
+	AttachReferences(ctx context.Context, posts []*entity.Post) error
+	Like(ctx context.Context, like *entity.Like, authorId string) error
+	Unlike(ctx context.Context, postId, userId, authorId string) error
+	GetLikedPostIDs(ctx context.Context, userId string, postIds []string) (map[string]bool, error)
+	GetInbox(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Post, string, error)
+	DistributeToInboxes(ctx context.Context, post *entity.Post, ownerIDs []string) error
+	RefreshInboxCopies(ctx context.Context, post *entity.Post) error
+	DeleteInboxCopies(ctx context.Context, postId string) error
+	GetByTag(ctx context.Context, tag string, limit int32, cursor string) ([]*entity.Post, string, error)
+	// CountTagsSince counts how often every tag was added to a post since
+	// the given time, by the author of the post
+	CountTagsSince(ctx context.Context, since time.Time) (map[string]map[string]int, error)
 }
 
 type DefaultPostRepository struct {
 	DB                *dynamodb.Client
-	S3                *s3.Client
-	S3PS              *s3.PresignClient
+	Blobs             BlobStore
 	CommentRepository *DefaultCommentRepository
 	TableName         string
-	BucketName        string
 }
 
-type BatchWriteItemConfig struct {
-	BatchSize      int
-	MaxRetries     int
-	InitialBackoff time.Duration
-	MaxBackoff     time.Duration
-}
-
-func NewDefaultPostRepository(db *dynamodb.Client, s3Client *s3.Client, s3PresignClient *s3.PresignClient, commentRepository *DefaultCommentRepository, tableName, bucketName string) *DefaultPostRepository {
+func NewDefaultPostRepository(db *dynamodb.Client, blobs BlobStore, commentRepository *DefaultCommentRepository, tableName string) *DefaultPostRepository {
 	return &DefaultPostRepository{
 		DB:                db,
-		S3:                s3Client,
-		S3PS:              s3PresignClient,
+		Blobs:             blobs,
 		CommentRepository: commentRepository,
 		TableName:         tableName,
-		BucketName:        bucketName,
 	}
 }
 
@@ -59,9 +63,9 @@ func (r *DefaultPostRepository) Create(ctx context.Context, post *entity.Post) (
 		return nil, fmt.Errorf("input post cannot be nil")
 	}
 
-	err := r.ValidateImage(ctx, post.Image)
+	err := r.ValidateMedia(ctx, post.Media)
 	if err != nil {
-		return nil, fmt.Errorf("failed to validate image: %w", err)
+		return nil, fmt.Errorf("failed to validate media: %w", err)
 	}
 
 	av, err := attributevalue.MarshalMap(post)
@@ -69,12 +73,27 @@ func (r *DefaultPostRepository) Create(ctx context.Context, post *entity.Post) (
 		return nil, fmt.Errorf("failed to marshal user to DynamoDB attribute values: %w", err)
 	}
 
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(r.TableName),
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{Item: av, TableName: aws.String(r.TableName)}},
+			counterUpdate(r.TableName, userKey(post.UserID), "posts_count", 1),
+		},
+	}
+
+	for _, tag := range post.Tags {
+		tagAv, err := attributevalue.MarshalMap(entity.NewTagPost(tag, post))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tag to DynamoDB attribute values: %w", err)
+		}
+		input.TransactItems = append(input.TransactItems, types.TransactWriteItem{
+			Put: &types.Put{Item: tagAv, TableName: aws.String(r.TableName)},
+		})
 	}
 
-	_, err = r.DB.PutItem(ctx, input)
+	_, err = r.DB.TransactWriteItems(ctx, input)
+	if conditionFailedAt(err, 1) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", post.PK, err)
 	}
@@ -84,11 +103,15 @@ func (r *DefaultPostRepository) Create(ctx context.Context, post *entity.Post) (
 		return nil, fmt.Errorf("failed to set image url: %w", err)
 	}
 
+	err = r.AttachReferences(ctx, []*entity.Post{post})
+	if err != nil {
+		return nil, err
+	}
+
 	return post, nil
 }
 
-func (r *DefaultPostRepository) GetAll(ctx context.Context) ([]*entity.Post, error) {
-	var allRawItems []map[string]types.AttributeValue
+func (r *DefaultPostRepository) GetAll(ctx context.Context, limit int32, cursor string) ([]*entity.Post, string, error) {
 	var posts []*entity.Post
 
 	input := &dynamodb.QueryInput{
@@ -99,31 +122,64 @@ func (r *DefaultPostRepository) GetAll(ctx context.Context) ([]*entity.Post, err
 			":pk": &types.AttributeValueMemberS{Value: "timeline"},
 		},
 		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
 	}
 
-	paginator := dynamodb.NewQueryPaginator(r.DB, input)
-
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+	if cursor != "" {
+		startKey, err := decodeTimelineCursor(cursor)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get next page of query results: %w", err)
+			return nil, "", err
 		}
-		allRawItems = append(allRawItems, page.Items...)
+		input.ExclusiveStartKey = startKey
 	}
 
-	err := attributevalue.UnmarshalListOfMaps(allRawItems, &posts)
+	result, err := r.DB.Query(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+		return nil, "", fmt.Errorf("failed to query timeline: %w", err)
+	}
+
+	err = unmarshalPosts(result.Items, &posts)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
 	}
 
 	for _, post := range posts {
 		err = r.SetImageURL(ctx, post)
 		if err != nil {
-			return nil, fmt.Errorf("failed to set image url: %w", err)
+			return nil, "", fmt.Errorf("failed to set image url: %w", err)
 		}
 	}
 
-	return posts, nil
+	err = r.AttachReferences(ctx, posts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return posts, nextCursor, nil
+}
+
+// decodeTimelineCursor only accepts keys that point at a post on the timeline
+// index, so a modified cursor cannot be used to read other partitions.
+func decodeTimelineCursor(cursor string) (map[string]types.AttributeValue, error) {
+	values, err := DecodeCursor(cursor, "pk", "sk", "gsi1_pk", "gsi1_sk")
+	if err != nil {
+		return nil, err
+	}
+
+	if values["gsi1_pk"] != "timeline" || !strings.HasPrefix(values["pk"], "user#") || values["sk"] != "post#"+values["gsi1_sk"] {
+		return nil, ErrInvalidCursor
+	}
+
+	if _, err := ulid.ParseStrict(values["gsi1_sk"]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return toKey(values), nil
 }
 
 func (r *DefaultPostRepository) GetByUserID(ctx context.Context, userID string) ([]*entity.Post, error) {
@@ -152,7 +208,57 @@ func (r *DefaultPostRepository) GetByUserID(ctx context.Context, userID string)
 		allRawItems = append(allRawItems, page.Items...)
 	}
 
-	err := attributevalue.UnmarshalListOfMaps(allRawItems, &posts)
+	err := unmarshalPosts(allRawItems, &posts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	for _, post := range posts {
+		err = r.SetImageURL(ctx, post)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set image url: %w", err)
+		}
+	}
+
+	err = r.AttachReferences(ctx, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetPageByUserID returns up to limit posts of a user that are older than
+// the post with beforeID, newest first. An empty beforeID starts at the top.
+func (r *DefaultPostRepository) GetPageByUserID(ctx context.Context, userID, beforeID string, limit int32) ([]*entity.Post, error) {
+	var posts []*entity.Post
+
+	partitionKey := "user#" + userID
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "post#"},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	if beforeID != "" {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: partitionKey},
+			"sk": &types.AttributeValueMemberS{Value: "post#" + beforeID},
+		}
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts of user %s: %w", userID, err)
+	}
+
+	err = unmarshalPosts(result.Items, &posts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
 	}
@@ -164,6 +270,11 @@ func (r *DefaultPostRepository) GetByUserID(ctx context.Context, userID string)
 		}
 	}
 
+	err = r.AttachReferences(ctx, posts)
+	if err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -188,7 +299,7 @@ func (r *DefaultPostRepository) Get(ctx context.Context, userId, postId string)
 	}
 
 	post := entity.Post{}
-	err = attributevalue.UnmarshalMap(result.Item, &post)
+	err = unmarshalPost(result.Item, &post)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling item: %w", err)
 	}
@@ -196,24 +307,71 @@ func (r *DefaultPostRepository) Get(ctx context.Context, userId, postId string)
 	return &post, nil
 }
 
-func (r *DefaultPostRepository) Update(ctx context.Context, userId, postId, text, image string) (*entity.Post, error) {
+func (r *DefaultPostRepository) Update(ctx context.Context, userId, postId, text string, media []entity.Media, mentions []entity.Mention) (*entity.Post, error) {
+	err := r.ValidateMedia(ctx, media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate media: %w", err)
+	}
+
 	key := map[string]types.AttributeValue{
 		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("user#%s", userId)},
 		"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("post#%s", postId)},
 	}
 
-	updateExpression := ("SET #text = :text, #image = :image, #edited = :edited")
+	tags := entity.ParseTags(text)
+
+	updateExpression := ("SET #text = :text, #edited = :edited")
 	expressionAttributeNames := map[string]string{
-		"#text":   "text",
-		"#image":  "image",
-		"#edited": "edited",
+		"#text":     "text",
+		"#image":    "image",
+		"#edited":   "edited",
+		"#tags":     "tags",
+		"#mentions": "mentions",
+		"#media":    "media",
 	}
 	expressionAttributeValues := map[string]types.AttributeValue{
 		":text":   &types.AttributeValueMemberS{Value: text},
-		":image":  &types.AttributeValueMemberS{Value: image},
 		":edited": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339Nano)},
 	}
 
+	// The image of posts from before media lists is part of the media now
+	removed := []string{"#image"}
+
+	if len(media) > 0 {
+		mediaAv, err := attributevalue.Marshal(media)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal media: %w", err)
+		}
+		updateExpression += ", #media = :media"
+		expressionAttributeValues[":media"] = mediaAv
+	} else {
+		removed = append(removed, "#media")
+	}
+
+	if len(tags) > 0 {
+		tagsAv, err := attributevalue.Marshal(tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tags: %w", err)
+		}
+		updateExpression += ", #tags = :tags"
+		expressionAttributeValues[":tags"] = tagsAv
+	} else {
+		removed = append(removed, "#tags")
+	}
+
+	if len(mentions) > 0 {
+		mentionsAv, err := attributevalue.Marshal(mentions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal mentions: %w", err)
+		}
+		updateExpression += ", #mentions = :mentions"
+		expressionAttributeValues[":mentions"] = mentionsAv
+	} else {
+		removed = append(removed, "#mentions")
+	}
+
+	updateExpression += " REMOVE " + strings.Join(removed, ", ")
+
 	input := &dynamodb.UpdateItemInput{
 		TableName:                 &r.TableName,
 		Key:                       key,
@@ -221,6 +379,13 @@ func (r *DefaultPostRepository) Update(ctx context.Context, userId, postId, text
 		ExpressionAttributeNames:  expressionAttributeNames,
 		ExpressionAttributeValues: expressionAttributeValues,
 		ReturnValues:              types.ReturnValueAllNew,
+		// Without the condition a missing post would be created
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	}
+
+	previous, err := r.Get(ctx, userId, postId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post to update: %w", err)
 	}
 
 	result, err := r.DB.UpdateItem(ctx, input)
@@ -230,16 +395,26 @@ func (r *DefaultPostRepository) Update(ctx context.Context, userId, postId, text
 	}
 
 	updatedPost := entity.Post{}
-	err = attributevalue.UnmarshalMap(result.Attributes, &updatedPost)
+	err = unmarshalPost(result.Attributes, &updatedPost)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling item: %w", err)
 	}
 
+	err = r.syncTags(ctx, &updatedPost, previous.Tags)
+	if err != nil {
+		return nil, err
+	}
+
 	err = r.SetImageURL(ctx, &updatedPost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to set image url: %w", err)
 	}
 
+	err = r.AttachReferences(ctx, []*entity.Post{&updatedPost})
+	if err != nil {
+		return nil, err
+	}
+
 	return &updatedPost, nil
 }
 
@@ -256,12 +431,7 @@ func (r *DefaultPostRepository) Delete(ctx context.Context, userId, postId strin
 		return fmt.Errorf("failed to get post comments: %w", err)
 	}
 
-	config := &BatchWriteItemConfig{
-		BatchSize:      25,
-		MaxRetries:     5,
-		InitialBackoff: 100 * time.Millisecond,
-		MaxBackoff:     5 * time.Second,
-	}
+	config := DefaultBatchWriteItemConfig()
 
 	// Attempt to delete the comments first
 	err = r.DeleteComments(ctx, postId, comments, config)
@@ -269,185 +439,723 @@ func (r *DefaultPostRepository) Delete(ctx context.Context, userId, postId strin
 		return fmt.Errorf("failed to batch delete comments: %w", err)
 	}
 
+	likes, err := r.getRawLikes(ctx, postId)
+	if err != nil {
+		return err
+	}
+
+	// Syncing a copy without tags deletes all tag items of the post
+	untagged := *post
+	untagged.Tags = nil
+	err = r.syncTags(ctx, &untagged, post.Tags)
+	if err != nil {
+		return err
+	}
+
 	key := map[string]types.AttributeValue{
 		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("user#%s", userId)},
 		"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("post#%s", postId)},
 	}
 
-	dynamoDbInput := &dynamodb.DeleteItemInput{
-		TableName:    aws.String(r.TableName),
-		Key:          key,
-		ReturnValues: types.ReturnValueAllOld,
+	dynamoDbInput := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName:           aws.String(r.TableName),
+				Key:                 key,
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			}},
+			counterUpdate(r.TableName, userKey(userId), "posts_count", -1),
+		},
+	}
+
+	// The likes are deleted in the transaction of the post as far as it has
+	// room for them. Once the post is gone no like can be added anymore, so
+	// the remaining ones are deleted right after it.
+	inTransaction := min(len(likes), maxTransactItems-len(dynamoDbInput.TransactItems))
+	for _, like := range likes[:inTransaction] {
+		dynamoDbInput.TransactItems = append(dynamoDbInput.TransactItems, types.TransactWriteItem{
+			Delete: &types.Delete{
+				TableName: aws.String(r.TableName),
+				Key:       like,
+			},
+		})
 	}
 
-	// If the post contained an image, delete the image from S3
-	err = r.DeleteImage(ctx, post.Image)
+	// If the post contained images, delete them from S3
+	err = deleteMedia(ctx, r.Blobs, post.Media)
 	if err != nil {
 		return fmt.Errorf("error deleting s3 item: %w", err)
 	}
 
 	// If all comments were deleted, proceed with deleting the post
-	_, err = r.DB.DeleteItem(ctx, dynamoDbInput)
+	_, err = r.DB.TransactWriteItems(ctx, dynamoDbInput)
 	if err != nil {
 		return fmt.Errorf("failed to delete item: %w", err)
 	}
 
+	err = r.DeleteLikes(ctx, postId, likes[inTransaction:], config)
+	if err != nil {
+		return fmt.Errorf("failed to batch delete likes: %w", err)
+	}
+
 	return nil
 }
 
 func (r *DefaultPostRepository) DeleteComments(ctx context.Context, postId string, comments []map[string]types.AttributeValue, config *BatchWriteItemConfig) error {
-	remainingComments := make([]map[string]types.AttributeValue, len(comments))
-	copy(remainingComments, comments)
-
-	var unprocessedComments []types.WriteRequest
-
-	for len(remainingComments) > 0 {
-		currentBatch := []types.WriteRequest{}
-		// Create a batch of delete write requests of size config.BatchSize
-		for i := 0; i < len(remainingComments) && i < config.BatchSize; i++ {
-			comment := remainingComments[i]
-			writeRequests := types.WriteRequest{
-				DeleteRequest: &types.DeleteRequest{
-					Key: map[string]types.AttributeValue{
-						"pk": comment["pk"],
-						"sk": comment["sk"],
-					},
+	writeRequests := make([]types.WriteRequest, 0, len(comments))
+	for _, comment := range comments {
+		writeRequests = append(writeRequests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"pk": comment["pk"],
+					"sk": comment["sk"],
 				},
-			}
-			currentBatch = append(currentBatch, writeRequests)
-		}
-
-		input := &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				r.TableName: currentBatch,
 			},
-		}
+		})
+	}
+
+	err := batchWriteItems(ctx, r.DB, r.TableName, writeRequests, config)
+	if err != nil {
+		return fmt.Errorf("failed to delete comments of post %s: %w", postId, err)
+	}
 
-		// Execute the batch write requests
-		output, err := r.DB.BatchWriteItem(ctx, input)
+	return nil
+}
+
+func (r *DefaultPostRepository) DeleteLikes(ctx context.Context, postId string, likes []map[string]types.AttributeValue, config *BatchWriteItemConfig) error {
+	writeRequests := make([]types.WriteRequest, 0, len(likes))
+	for _, like := range likes {
+		writeRequests = append(writeRequests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: like},
+		})
+	}
+
+	err := batchWriteItems(ctx, r.DB, r.TableName, writeRequests, config)
+	if err != nil {
+		return fmt.Errorf("failed to delete likes of post %s: %w", postId, err)
+	}
+
+	return nil
+}
+
+// getRawLikes returns the keys of all likes of a post
+func (r *DefaultPostRepository) getRawLikes(ctx context.Context, postId string) ([]map[string]types.AttributeValue, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: "post#" + postId},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "like#"},
+		},
+		ProjectionExpression: aws.String("pk, sk"),
+	}
+
+	var likes []map[string]types.AttributeValue
+
+	paginator := dynamodb.NewQueryPaginator(r.DB, input)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return fmt.Errorf("DynamoDB BatchWriteItem failed: %w", err)
+			return nil, fmt.Errorf("failed to get likes of post %s: %w", postId, err)
 		}
+		likes = append(likes, page.Items...)
+	}
 
-		remainingComments = remainingComments[len(currentBatch):]
+	return likes, nil
+}
 
-		// Collect any items that DynamoDB could not process.
-		if unprocessed := output.UnprocessedItems[r.TableName]; len(unprocessed) > 0 {
-			unprocessedComments = append(unprocessed, unprocessed...)
+// GetByID finds a post without knowing its author through the timeline index
+func (r *DefaultPostRepository) GetByID(ctx context.Context, postId string) (*entity.Post, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		IndexName:              aws.String("gsi1"),
+		KeyConditionExpression: aws.String("gsi1_pk = :pk AND gsi1_sk = :sk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "timeline"},
+			":sk": &types.AttributeValueMemberS{Value: postId},
+		},
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query post %s: %w", postId, err)
+	}
+
+	if len(result.Items) == 0 {
+		return nil, ErrPostNotFound
+	}
+
+	post := entity.Post{}
+	err = unmarshalPost(result.Items[0], &post)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling item: %w", err)
+	}
+
+	return &post, nil
+}
+
+// Like stores the like of a user and increments the like count of the post.
+// A user can like a post only once.
+func (r *DefaultPostRepository) Like(ctx context.Context, like *entity.Like, authorId string) error {
+	if like == nil {
+		return fmt.Errorf("input like cannot be nil")
+	}
+
+	av, err := attributevalue.MarshalMap(like)
+	if err != nil {
+		return fmt.Errorf("failed to marshal like to DynamoDB attribute values: %w", err)
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				Item:                av,
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+			counterUpdate(r.TableName, postKey(authorId, like.PostID), "like_count", 1),
+		},
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, input)
+	switch {
+	case conditionFailedAt(err, 0):
+		return ErrAlreadyLiked
+	case conditionFailedAt(err, 1):
+		return ErrPostNotFound
+	case err != nil:
+		return fmt.Errorf("failed to write like (PK: %s) to DynamoDB: %w", like.PK, err)
+	}
+
+	return nil
+}
+
+func (r *DefaultPostRepository) Unlike(ctx context.Context, postId, userId, authorId string) error {
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: "post#" + postId},
+					"sk": &types.AttributeValueMemberS{Value: "like#" + userId},
+				},
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			}},
+			counterUpdate(r.TableName, postKey(authorId, postId), "like_count", -1),
+		},
+	}
+
+	_, err := r.DB.TransactWriteItems(ctx, input)
+	switch {
+	case conditionFailedAt(err, 0):
+		return ErrNotLiked
+	case conditionFailedAt(err, 1):
+		return ErrPostNotFound
+	case err != nil:
+		return fmt.Errorf("failed to delete like of post %s from DynamoDB: %w", postId, err)
+	}
+
+	return nil
+}
+
+// GetLikedPostIDs returns which of the given posts the user has liked
+func (r *DefaultPostRepository) GetLikedPostIDs(ctx context.Context, userId string, postIds []string) (map[string]bool, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(postIds))
+	seen := map[string]bool{}
+	for _, postId := range postIds {
+		if seen[postId] {
+			continue
 		}
+		seen[postId] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "post#" + postId},
+			"sk": &types.AttributeValueMemberS{Value: "like#" + userId},
+		})
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, aws.String("post_id"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch get likes: %w", err)
 	}
 
-	retries := 0
-	for len(unprocessedComments) > 0 && retries < config.MaxRetries {
-		// Create a new batch from the unprocessedComments
-		var currentBatch []types.WriteRequest
-		if len(unprocessedComments) > config.BatchSize {
-			currentBatch = unprocessedComments[:config.BatchSize]
-		} else {
-			currentBatch = unprocessedComments
+	liked := make(map[string]bool, len(items))
+	for _, item := range items {
+		if postId, ok := item["post_id"].(*types.AttributeValueMemberS); ok {
+			liked[postId.Value] = true
 		}
-		
-		// Keep track of the remaining unprocessedComments
-		remainingUnprocessed := unprocessedComments[len(currentBatch):]
+	}
 
-		input := &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				r.TableName: currentBatch,
-			},
+	return liked, nil
+}
+
+func (r *DefaultPostRepository) GetInbox(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Post, string, error) {
+	var posts []*entity.Post
+
+	partitionKey := "inbox#" + userID
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "post#"},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk")
+		if err != nil {
+			return nil, "", err
+		}
+		if values["pk"] != partitionKey || !strings.HasPrefix(values["sk"], "post#") {
+			return nil, "", ErrInvalidCursor
 		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query inbox of user %s: %w", userID, err)
+	}
+
+	err = unmarshalPosts(result.Items, &posts)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
 
-		output, err := r.DB.BatchWriteItem(ctx, input)
+	err = r.setLikeCounts(ctx, posts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, post := range posts {
+		err = r.SetImageURL(ctx, post)
 		if err != nil {
-			return fmt.Errorf("DynamoDB BatchWriteItem failed: %w", err)
+			return nil, "", fmt.Errorf("failed to set image url: %w", err)
+		}
+	}
+
+	err = r.AttachReferences(ctx, posts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return posts, nextCursor, nil
+}
+
+// setLikeCounts reads the like counts of inbox copies from their posts.
+// Likes only count on the post itself, so the counts of the copies are stale.
+// Copies of deleted posts keep their count.
+func (r *DefaultPostRepository) setLikeCounts(ctx context.Context, posts []*entity.Post) error {
+	keys := make([]map[string]types.AttributeValue, 0, len(posts))
+	for _, post := range posts {
+		keys = append(keys, postKey(post.UserID, post.ID))
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, aws.String("id, like_count"))
+	if err != nil {
+		return fmt.Errorf("failed to get like counts: %w", err)
+	}
+
+	var counts []struct {
+		ID        string `dynamodbav:"id"`
+		LikeCount int    `dynamodbav:"like_count"`
+	}
+	err = attributevalue.UnmarshalListOfMaps(items, &counts)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal like counts: %w", err)
+	}
+
+	likeCounts := make(map[string]int, len(counts))
+	for _, count := range counts {
+		likeCounts[count.ID] = count.LikeCount
+	}
+
+	for _, post := range posts {
+		if likeCount, ok := likeCounts[post.ID]; ok {
+			post.LikeCount = likeCount
 		}
+	}
 
-		// Check if the current batch has unprocessed items again
-		unprocessedAgain := output.UnprocessedItems[r.TableName]
+	return nil
+}
 
-		// If yes, put them in the front of the unprocessed items so we can retry
-		if len(unprocessedAgain) > 0 {
-			unprocessedComments = append(unprocessedAgain, remainingUnprocessed...)
-			retries++
-			
-			// Apply exponential backoff
-			sleepTime := min(config.InitialBackoff * time.Duration(math.Pow(2, float64(retries-1))), config.MaxBackoff)
-			time.Sleep(sleepTime)
-		} else {
-			// All unprocessed items were successfully processed this time
-			unprocessedComments = remainingUnprocessed
-			retries = 0
+// DistributeToInboxes writes a copy of the post into the inbox of every owner
+func (r *DefaultPostRepository) DistributeToInboxes(ctx context.Context, post *entity.Post, ownerIDs []string) error {
+	writeRequests := make([]types.WriteRequest, 0, len(ownerIDs))
+	for _, ownerID := range ownerIDs {
+		av, err := attributevalue.MarshalMap(entity.NewInboxPost(ownerID, post))
+		if err != nil {
+			return fmt.Errorf("failed to marshal inbox post to DynamoDB attribute values: %w", err)
 		}
+		writeRequests = append(writeRequests, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: av},
+		})
 	}
 
-	if len(unprocessedComments) > 0 {
-		return fmt.Errorf("failed to delete all comments after %d retries, %d items remain unprocessed", config.MaxRetries, len(unprocessedComments))
+	err := batchWriteItems(ctx, r.DB, r.TableName, writeRequests, DefaultBatchWriteItemConfig())
+	if err != nil {
+		return fmt.Errorf("failed to distribute post %s: %w", post.ID, err)
 	}
 
 	return nil
 }
 
-func (r *DefaultPostRepository) ValidateImage(ctx context.Context, imageKey string) error {
-	if imageKey == "" {
-		return nil
+// RefreshInboxCopies overwrites the existing inbox copies of a post after it
+// was edited
+func (r *DefaultPostRepository) RefreshInboxCopies(ctx context.Context, post *entity.Post) error {
+	copies, err := r.getRawInboxCopies(ctx, post.ID)
+	if err != nil {
+		return err
 	}
-	
-	input := &s3.HeadObjectInput{
-		Bucket: aws.String(r.BucketName),
-		Key:    aws.String(imageKey),
+
+	ownerIDs := make([]string, 0, len(copies))
+	for _, item := range copies {
+		if owner, ok := item["gsi1_sk"].(*types.AttributeValueMemberS); ok {
+			ownerIDs = append(ownerIDs, owner.Value)
+		}
 	}
 
-	_, err := r.S3.HeadObject(ctx, input)
+	return r.DistributeToInboxes(ctx, post, ownerIDs)
+}
+
+func (r *DefaultPostRepository) DeleteInboxCopies(ctx context.Context, postId string) error {
+	copies, err := r.getRawInboxCopies(ctx, postId)
 	if err != nil {
 		return err
 	}
 
+	writeRequests := make([]types.WriteRequest, 0, len(copies))
+	for _, item := range copies {
+		writeRequests = append(writeRequests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"pk": item["pk"],
+					"sk": item["sk"],
+				},
+			},
+		})
+	}
+
+	err = batchWriteItems(ctx, r.DB, r.TableName, writeRequests, DefaultBatchWriteItemConfig())
+	if err != nil {
+		return fmt.Errorf("failed to delete inbox copies of post %s: %w", postId, err)
+	}
+
 	return nil
 }
 
-func (r *DefaultPostRepository) SetImageURL(ctx context.Context, post *entity.Post) error {
-	if post == nil || post.Image == "" {
-		return nil
+func (r *DefaultPostRepository) getRawInboxCopies(ctx context.Context, postId string) ([]map[string]types.AttributeValue, error) {
+	var allRawItems []map[string]types.AttributeValue
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		IndexName:              aws.String("gsi1"),
+		KeyConditionExpression: aws.String("gsi1_pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "inbox_post#" + postId},
+		},
+		ProjectionExpression: aws.String("pk, sk, gsi1_sk"),
 	}
 
-	presignRequest, err := r.S3PS.PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(r.BucketName),
-		Key:    aws.String(post.Image),
-	}, s3.WithPresignExpires(*aws.Duration(15 * time.Minute)))
+	paginator := dynamodb.NewQueryPaginator(r.DB, input)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next page of query results: %w", err)
+		}
+		allRawItems = append(allRawItems, page.Items...)
+	}
+
+	return allRawItems, nil
+}
+
+// syncTags writes the tag items of tags the post gained and deletes those of
+// tags it lost since previousTags
+func (r *DefaultPostRepository) syncTags(ctx context.Context, post *entity.Post, previousTags []string) error {
+	current := map[string]bool{}
+	for _, tag := range post.Tags {
+		current[tag] = true
+	}
 
+	previous := map[string]bool{}
+	for _, tag := range previousTags {
+		previous[tag] = true
+	}
+
+	var writeRequests []types.WriteRequest
+	for _, tag := range post.Tags {
+		if previous[tag] {
+			continue
+		}
+		av, err := attributevalue.MarshalMap(entity.NewTagPost(tag, post))
+		if err != nil {
+			return fmt.Errorf("failed to marshal tag to DynamoDB attribute values: %w", err)
+		}
+		writeRequests = append(writeRequests, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: av},
+		})
+	}
+
+	for _, tag := range previousTags {
+		if current[tag] {
+			continue
+		}
+		writeRequests = append(writeRequests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: "tag#" + tag},
+					"sk": &types.AttributeValueMemberS{Value: "post#" + post.ID},
+				},
+			},
+		})
+	}
+
+	err := batchWriteItems(ctx, r.DB, r.TableName, writeRequests, DefaultBatchWriteItemConfig())
 	if err != nil {
-		log.Printf("Couldn't get presigned URL for key %s. Here's why: %v\n", post.Image, err)
-		post.ImageURL = nil
-		return err
+		return fmt.Errorf("failed to update tags of post %s: %w", post.ID, err)
 	}
 
-	post.ImageURL = &presignRequest.URL
 	return nil
 }
 
-func (r *DefaultPostRepository) DeleteImage(ctx context.Context, imageKey string) error {
-	if imageKey == "" {
+// GetByTag returns one page of the posts using a tag, newest first
+func (r *DefaultPostRepository) GetByTag(ctx context.Context, tag string, limit int32, cursor string) ([]*entity.Post, string, error) {
+	partitionKey := "tag#" + tag
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "post#"},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(limit),
+	}
+
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk")
+		if err != nil {
+			return nil, "", err
+		}
+		if values["pk"] != partitionKey || !strings.HasPrefix(values["sk"], "post#") {
+			return nil, "", ErrInvalidCursor
+		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query posts with tag %s: %w", tag, err)
+	}
+
+	var tagPosts []*entity.TagPost
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &tagPosts)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	keys := make([]map[string]types.AttributeValue, 0, len(tagPosts))
+	for _, tagPost := range tagPosts {
+		keys = append(keys, postKey(tagPost.UserID, tagPost.PostID))
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get posts with tag %s: %w", tag, err)
+	}
+
+	var unordered []*entity.Post
+	err = unmarshalPosts(items, &unordered)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	postsByID := make(map[string]*entity.Post, len(unordered))
+	for _, post := range unordered {
+		postsByID[post.ID] = post
+	}
+
+	// BatchGetItem does not keep the order of the keys
+	posts := make([]*entity.Post, 0, len(tagPosts))
+	for _, tagPost := range tagPosts {
+		post, ok := postsByID[tagPost.PostID]
+		if !ok {
+			continue
+		}
+
+		err = r.SetImageURL(ctx, post)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to set image url: %w", err)
+		}
+		posts = append(posts, post)
+	}
+
+	err = r.AttachReferences(ctx, posts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return posts, nextCursor, nil
+}
+
+// CountTagsSince counts how often every tag was added to a post since the
+// given time, by the author of the post. The tags are read from the daily
+// shards of gsi1 that overlap with the window.
+func (r *DefaultPostRepository) CountTagsSince(ctx context.Context, since time.Time) (map[string]map[string]int, error) {
+	start, err := ulid.New(ulid.Timestamp(since), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create window start: %w", err)
+	}
+
+	counts := map[string]map[string]int{}
+
+	now := time.Now()
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(now); day = day.Add(24 * time.Hour) {
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(r.TableName),
+			IndexName:              aws.String("gsi1"),
+			KeyConditionExpression: aws.String("gsi1_pk = :pk AND gsi1_sk >= :start"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":    &types.AttributeValueMemberS{Value: entity.TagShard(day)},
+				":start": &types.AttributeValueMemberS{Value: start.String()},
+			},
+			ExpressionAttributeNames: map[string]string{
+				"#tag": "tag",
+			},
+			ProjectionExpression: aws.String("#tag, user_id"),
+		}
+
+		paginator := dynamodb.NewQueryPaginator(r.DB, input)
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get next page of query results: %w", err)
+			}
+
+			var tagPosts []*entity.TagPost
+			err = attributevalue.UnmarshalListOfMaps(page.Items, &tagPosts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+			}
+
+			for _, tagPost := range tagPosts {
+				if counts[tagPost.Tag] == nil {
+					counts[tagPost.Tag] = map[string]int{}
+				}
+				counts[tagPost.Tag][tagPost.UserID]++
+			}
+		}
+	}
+
+	return counts, nil
+}
+
+// AttachReferences loads the original posts of reposts and quotes. Posts
+// whose original was deleted keep a nil Referenced.
+func (r *DefaultPostRepository) AttachReferences(ctx context.Context, posts []*entity.Post) error {
+	keys := []map[string]types.AttributeValue{}
+	seen := map[string]bool{}
+	for _, post := range posts {
+		if post.Reference == nil || seen[post.Reference.PostID] {
+			continue
+		}
+		seen[post.Reference.PostID] = true
+		keys = append(keys, postKey(post.Reference.UserID, post.Reference.PostID))
+	}
+
+	if len(keys) == 0 {
 		return nil
 	}
 
-	err := r.ValidateImage(ctx, imageKey)
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, nil)
 	if err != nil {
-		var notFoundErr *s3Types.NotFound
-		if errors.As(err, &notFoundErr) {
-			return nil
-		} else {
-			return err
+		return fmt.Errorf("failed to get referenced posts: %w", err)
+	}
+
+	var referenced []*entity.Post
+	err = unmarshalPosts(items, &referenced)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	referencedByID := make(map[string]*entity.Post, len(referenced))
+	for _, post := range referenced {
+		err = r.SetImageURL(ctx, post)
+		if err != nil {
+			return fmt.Errorf("failed to set image url: %w", err)
 		}
+		referencedByID[post.ID] = post
 	}
 
-	s3Input := &s3.DeleteObjectInput{
-		Bucket: aws.String(r.BucketName),
-		Key:    aws.String(imageKey),
+	for _, post := range posts {
+		if post.Reference != nil {
+			post.Referenced = referencedByID[post.Reference.PostID]
+		}
 	}
 
-	_, err = r.S3.DeleteObject(ctx, s3Input)
+	return nil
+}
+
+func (r *DefaultPostRepository) ValidateMedia(ctx context.Context, media []entity.Media) error {
+	return validateMedia(ctx, r.Blobs, media)
+}
+
+func (r *DefaultPostRepository) SetImageURL(ctx context.Context, post *entity.Post) error {
+	return setImageURL(ctx, r.Blobs, post)
+}
+
+func (r *DefaultPostRepository) DeleteImage(ctx context.Context, imageKey string) error {
+	return deleteImage(ctx, r.Blobs, imageKey)
+}
+
+func (r *DefaultPostRepository) ProcessImage(ctx context.Context, userId, uploadKey string) (*entity.Media, error) {
+	return processImage(ctx, r.Blobs, userId, uploadKey)
+}
+
+// unmarshalPost reads a post item. Posts from before media lists kept the key
+// of their only image in the image attribute, it is read as their only
+// medium.
+func unmarshalPost(item map[string]types.AttributeValue, post *entity.Post) error {
+	err := attributevalue.UnmarshalMap(item, post)
 	if err != nil {
 		return err
 	}
 
+	image, ok := item["image"].(*types.AttributeValueMemberS)
+	if ok && image.Value != "" && len(post.Media) == 0 {
+		post.Media = []entity.Media{{Key: image.Value}}
+	}
+
+	return nil
+}
+
+func unmarshalPosts(items []map[string]types.AttributeValue, posts *[]*entity.Post) error {
+	*posts = make([]*entity.Post, 0, len(items))
+	for _, item := range items {
+		post := new(entity.Post)
+		err := unmarshalPost(item, post)
+		if err != nil {
+			return err
+		}
+		*posts = append(*posts, post)
+	}
+
 	return nil
 }
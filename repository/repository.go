@@ -2,20 +2,50 @@ package repository
 
 import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type Repositories struct {
-	UserRepository    *DefaultUserRepository
-	PostRepository    *DefaultPostRepository
-	CommentRepository *DefaultCommentRepository
+	UserRepository    UserRepository
+	PostRepository    PostRepository
+	CommentRepository CommentRepository
+	// Notifications are stored in the user partitions
+	NotificationRepository NotificationRepository
+	// Conversations and their messages
+	MessageRepository MessageRepository
 }
 
-func InitRepositories(db *dynamodb.Client, s3Client *s3.Client, s3PresignClient *s3.PresignClient, tableName, bucketName string) *Repositories {
+func InitRepositories(db *dynamodb.Client, blobs BlobStore, tableName string) *Repositories {
 	commentRepository := NewDefaultCommentRepository(db, tableName)
 	return &Repositories{
-		UserRepository:    NewDefaultUserRepository(db, tableName),
-		PostRepository:    NewDefaultPostRepository(db, s3Client, s3PresignClient, commentRepository, tableName, bucketName),
-		CommentRepository: commentRepository,
+		UserRepository:         NewDefaultUserRepository(db, tableName),
+		PostRepository:         NewDefaultPostRepository(db, blobs, commentRepository, tableName),
+		CommentRepository:      commentRepository,
+		NotificationRepository: NewDefaultNotificationRepository(db, tableName),
+		MessageRepository:      NewDefaultMessageRepository(db, tableName),
+	}
+}
+
+// InitMemoryRepositories keeps all data in memory, so the API runs without
+// DynamoDB. Without blobs posts cannot have images.
+func InitMemoryRepositories(blobs BlobStore) *Repositories {
+	store := NewMemoryStore()
+	return &Repositories{
+		UserRepository:         NewMemoryUserRepository(store),
+		PostRepository:         NewMemoryPostRepository(store, blobs),
+		CommentRepository:      NewMemoryCommentRepository(store),
+		NotificationRepository: NewMemoryNotificationRepository(store),
+		MessageRepository:      NewMemoryMessageRepository(store),
+	}
+}
+
+// InitSQLRepositories keeps all data in a SQLite or Postgres database.
+// Without blobs posts cannot have images.
+func InitSQLRepositories(store *SQLStore, blobs BlobStore) *Repositories {
+	return &Repositories{
+		UserRepository:         NewSQLUserRepository(store),
+		PostRepository:         NewSQLPostRepository(store, blobs),
+		CommentRepository:      NewSQLCommentRepository(store),
+		NotificationRepository: NewSQLNotificationRepository(store),
+		MessageRepository:      NewSQLMessageRepository(store),
 	}
 }
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3BlobStore keeps files in an S3 bucket. Clients upload and download them
+// through presigned URLs of the bucket.
+type S3BlobStore struct {
+	S3         *s3.Client
+	S3PS       *s3.PresignClient
+	BucketName string
+}
+
+func NewS3BlobStore(s3Client *s3.Client, s3PresignClient *s3.PresignClient, bucketName string) *S3BlobStore {
+	return &S3BlobStore{
+		S3:         s3Client,
+		S3PS:       s3PresignClient,
+		BucketName: bucketName,
+	}
+}
+
+func (s *S3BlobStore) PresignUpload(ctx context.Context, key, contentType, checksum string) (string, error) {
+	presignRequest, err := s.S3PS.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.BucketName),
+		Key:               aws.String(key),
+		ContentType:       aws.String(contentType),
+		ChecksumAlgorithm: s3Types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(checksum),
+	}, s3.WithPresignExpires(blobURLExpiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload of %s to bucket %s: %w", key, s.BucketName, err)
+	}
+
+	return presignRequest.URL, nil
+}
+
+func (s *S3BlobStore) Head(ctx context.Context, key string) (*BlobInfo, error) {
+	output, err := s.S3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFoundErr *s3Types.NotFound
+		if errors.As(err, &notFoundErr) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Size:        aws.ToInt64(output.ContentLength),
+		ContentType: aws.ToString(output.ContentType),
+	}, nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.S3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKeyErr *s3Types.NoSuchKey
+		if errors.As(err, &noSuchKeyErr) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	_, err := s.S3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.BucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Body:        bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put %s to bucket %s: %w", key, s.BucketName, err)
+	}
+
+	return nil
+}
+
+func (s *S3BlobStore) SignedURL(ctx context.Context, key string) (string, error) {
+	presignRequest, err := s.S3PS.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(blobURLExpiry))
+	if err != nil {
+		return "", err
+	}
+
+	return presignRequest.URL, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	_, err := s.Head(ctx, key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.S3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+const sqlCommentColumns = "id, post_id, user_id, name, text, timestamp, edited, parent_id, reply_count, deleted, mentions"
+
+// SQLCommentRepository stores the comments of posts in a SQLStore
+type SQLCommentRepository struct {
+	Store *SQLStore
+}
+
+func NewSQLCommentRepository(store *SQLStore) *SQLCommentRepository {
+	return &SQLCommentRepository{
+		Store: store,
+	}
+}
+
+func scanComment(row sqlScanner) (*entity.Comment, error) {
+	var postId string
+	var edited sql.NullTime
+	var mentions sql.NullString
+	comment := &entity.Comment{}
+	err := row.Scan(&comment.ID, &postId, &comment.UserID, &comment.UserName, &comment.Text, &comment.Timestamp, &edited,
+		&comment.ParentID, &comment.ReplyCount, &comment.Deleted, &mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.PK = fmt.Sprintf("post#%s", postId)
+	comment.SK = fmt.Sprintf("comment#%s", comment.ID)
+	comment.GSIPK = entity.CommentThread(postId, comment.ParentID)
+	comment.GSISK = comment.ID
+	comment.Edited = timePointer(edited)
+
+	comment.Mentions, err = fromSQLJSON[entity.Mention](mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Create stores the comment. Replies also increment the reply count of their
+// parent.
+func (r *SQLCommentRepository) Create(ctx context.Context, comment *entity.Comment) (*entity.Comment, error) {
+	if comment == nil {
+		return nil, fmt.Errorf("input comment cannot be nil")
+	}
+
+	postId := strings.TrimPrefix(comment.PK, "post#")
+
+	mentions, err := sqlJSON(comment.Mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		if comment.ParentID != "" {
+			updated, err := sqlExec(ctx, tx, `UPDATE comments SET reply_count = reply_count + 1 WHERE post_id = $1 AND id = $2`, postId, comment.ParentID)
+			if err != nil {
+				return err
+			}
+			if updated == 0 {
+				return ErrCommentNotFound
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO comments (`+sqlCommentColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			comment.ID, postId, comment.UserID, comment.UserName, comment.Text, sqlTime(comment.Timestamp), sqlNullTime(comment.Edited),
+			comment.ParentID, comment.ReplyCount, comment.Deleted, mentions)
+		if err != nil {
+			return fmt.Errorf("failed to insert comment: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// GetPageByPostID returns one page of the direct replies to a comment, or of
+// the top level comments when parentId is empty. Top level comments are
+// newest first, replies are in the order they were written.
+func (r *SQLCommentRepository) GetPageByPostID(ctx context.Context, postId, parentId string, limit int32, cursor string) ([]*entity.Comment, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	order := "id > $3 ORDER BY id"
+	if parentId == "" {
+		order = "($3 = '' OR id < $3) ORDER BY id DESC"
+	}
+
+	comments, err := sqlQuery(ctx, r.Store.DB, scanComment, `SELECT `+sqlCommentColumns+` FROM comments WHERE post_id = $1 AND parent_id = $2 AND `+order+` LIMIT $4`,
+		postId, parentId, after, max(limit, 0)+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get comments of post %s: %w", postId, err)
+	}
+
+	return sqlPage(comments, func(comment *entity.Comment) string { return comment.ID }, limit)
+}
+
+func (r *SQLCommentRepository) Get(ctx context.Context, postId, commentId string) (*entity.Comment, error) {
+	return r.get(ctx, r.Store.DB, postId, commentId)
+}
+
+func (r *SQLCommentRepository) get(ctx context.Context, q sqlQuerier, postId, commentId string) (*entity.Comment, error) {
+	comment, err := scanComment(q.QueryRowContext(ctx, `SELECT `+sqlCommentColumns+` FROM comments WHERE post_id = $1 AND id = $2`, postId, commentId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+func (r *SQLCommentRepository) Update(ctx context.Context, postId, commentId, text string, mentions []entity.Mention) (*entity.Comment, error) {
+	mentionsColumn, err := sqlJSON(mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	var comment *entity.Comment
+	err = r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		updated, err := sqlExec(ctx, tx, `UPDATE comments SET text = $1, edited = $2, mentions = $3 WHERE post_id = $4 AND id = $5`,
+			text, sqlTime(time.Now()), mentionsColumn, postId, commentId)
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrCommentNotFound
+		}
+
+		comment, err = r.get(ctx, tx, postId, commentId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Delete removes a comment without replies. Replies also decrement the reply
+// count of their parent.
+func (r *SQLCommentRepository) Delete(ctx context.Context, postId, commentId, parentId string) error {
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		comment, err := r.get(ctx, tx, postId, commentId)
+		if err != nil {
+			return err
+		}
+		if comment.ReplyCount > 0 {
+			return ErrCommentHasReplies
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM comments WHERE post_id = $1 AND id = $2`, postId, commentId)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		if parentId != "" {
+			_, err = tx.ExecContext(ctx, `UPDATE comments SET reply_count = reply_count - 1 WHERE post_id = $1 AND id = $2`, postId, parentId)
+			if err != nil {
+				return fmt.Errorf("failed to update reply count: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// SoftDelete replaces a comment with a placeholder so its replies stay
+// reachable
+func (r *SQLCommentRepository) SoftDelete(ctx context.Context, postId, commentId string) error {
+	updated, err := sqlExec(ctx, r.Store.DB, `UPDATE comments SET deleted = $1, text = '', edited = NULL, mentions = NULL WHERE post_id = $2 AND id = $3`,
+		true, postId, commentId)
+	if err != nil {
+		return fmt.Errorf("failed to soft delete comment: %w", err)
+	}
+	if updated == 0 {
+		return ErrCommentNotFound
+	}
+
+	return nil
+}
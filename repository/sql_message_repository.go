@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// The entry of a member is joined with the participants of its conversation
+// and the newest message
+const sqlMemberQuery = `SELECT m.conversation_id, m.user_id, c.participant_ids, m.last_activity, m.last_read_id,
+	l.id, l.sender_id, l.sender_name, l.text, l.timestamp
+	FROM conversation_members m
+	JOIN conversations c ON c.id = m.conversation_id
+	LEFT JOIN messages l ON l.id = m.last_message_id`
+
+const sqlMessageColumns = "id, conversation_id, sender_id, sender_name, text, timestamp"
+
+// SQLMessageRepository stores conversations, their participants and messages
+// in a SQLStore
+type SQLMessageRepository struct {
+	Store *SQLStore
+}
+
+func NewSQLMessageRepository(store *SQLStore) *SQLMessageRepository {
+	return &SQLMessageRepository{
+		Store: store,
+	}
+}
+
+func scanMember(row sqlScanner) (*entity.ConversationMember, error) {
+	var participantIds sql.NullString
+	var lastId, senderId, senderName, text sql.NullString
+	var timestamp sql.NullTime
+	member := &entity.ConversationMember{}
+	err := row.Scan(&member.ConversationID, &member.UserID, &participantIds, &member.GSI1SK, &member.LastReadID,
+		&lastId, &senderId, &senderName, &text, &timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	member.PK = fmt.Sprintf("user#%s", member.UserID)
+	member.SK = fmt.Sprintf("conversation#%s", member.ConversationID)
+	member.GSI1PK = fmt.Sprintf("conversations#%s", member.UserID)
+
+	member.ParticipantIDs, err = fromSQLJSON[string](participantIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries keep a copy of the message without its keys
+	if lastId.Valid {
+		member.LastMessage = &entity.Message{
+			ID:             lastId.String,
+			ConversationID: member.ConversationID,
+			SenderID:       senderId.String,
+			SenderName:     senderName.String,
+			Text:           text.String,
+			Timestamp:      timestamp.Time,
+		}
+	}
+
+	return member, nil
+}
+
+func scanMessage(row sqlScanner) (*entity.Message, error) {
+	message := &entity.Message{}
+	err := row.Scan(&message.ID, &message.ConversationID, &message.SenderID, &message.SenderName, &message.Text, &message.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	message.PK = fmt.Sprintf("conversation#%s", message.ConversationID)
+	message.SK = fmt.Sprintf("message#%s", message.ID)
+
+	return message, nil
+}
+
+// CreateConversation stores a conversation together with the entries of its
+// participants. ErrConversationExists is returned if a conversation with the
+// same id already exists.
+func (r *SQLMessageRepository) CreateConversation(ctx context.Context, conversation *entity.Conversation, members []*entity.ConversationMember) (*entity.Conversation, error) {
+	if conversation == nil {
+		return nil, fmt.Errorf("input conversation cannot be nil")
+	}
+
+	participantIds, err := sqlJSON(conversation.ParticipantIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		inserted, err := sqlExec(ctx, tx, `INSERT INTO conversations (id, creator_id, participant_ids, timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			conversation.ID, conversation.CreatorID, participantIds, sqlTime(conversation.Timestamp))
+		if err != nil {
+			return err
+		}
+		if inserted == 0 {
+			return ErrConversationExists
+		}
+
+		for _, member := range members {
+			_, err := tx.ExecContext(ctx, `INSERT INTO conversation_members (conversation_id, user_id, last_activity, last_read_id) VALUES ($1, $2, $3, $4)`,
+				conversation.ID, member.UserID, member.GSI1SK, member.LastReadID)
+			if err != nil {
+				return fmt.Errorf("failed to insert conversation member: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+// GetConversation returns nil if the conversation does not exist
+func (r *SQLMessageRepository) GetConversation(ctx context.Context, conversationId string) (*entity.Conversation, error) {
+	var participantIds sql.NullString
+	conversation := &entity.Conversation{}
+	err := r.Store.DB.QueryRowContext(ctx, `SELECT id, creator_id, participant_ids, timestamp FROM conversations WHERE id = $1`, conversationId).
+		Scan(&conversation.ID, &conversation.CreatorID, &participantIds, &conversation.Timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation %s: %w", conversationId, err)
+	}
+
+	conversation.PK = fmt.Sprintf("conversation#%s", conversation.ID)
+	conversation.SK = "meta"
+
+	conversation.ParticipantIDs, err = fromSQLJSON[string](participantIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+// GetMember returns the entry of a conversation for one participant, or nil
+// if the user does not take part in it
+func (r *SQLMessageRepository) GetMember(ctx context.Context, userId, conversationId string) (*entity.ConversationMember, error) {
+	member, err := scanMember(r.Store.DB.QueryRowContext(ctx, sqlMemberQuery+` WHERE m.conversation_id = $1 AND m.user_id = $2`, conversationId, userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member of conversation %s: %w", conversationId, err)
+	}
+
+	return member, nil
+}
+
+// GetMembers returns the entries of a conversation for the given participants
+func (r *SQLMessageRepository) GetMembers(ctx context.Context, conversationId string, userIds []string) ([]*entity.ConversationMember, error) {
+	if len(userIds) == 0 {
+		return []*entity.ConversationMember{}, nil
+	}
+
+	placeholders, args := sqlIn(2, userIds)
+	found, err := sqlQuery(ctx, r.Store.DB, scanMember, sqlMemberQuery+` WHERE m.conversation_id = $1 AND m.user_id IN (`+placeholders+`)`,
+		append([]any{conversationId}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of conversation %s: %w", conversationId, err)
+	}
+
+	byUser := make(map[string]*entity.ConversationMember, len(found))
+	for _, member := range found {
+		byUser[member.UserID] = member
+	}
+
+	members := make([]*entity.ConversationMember, 0, len(found))
+	for _, userId := range userIds {
+		if member, ok := byUser[userId]; ok {
+			members = append(members, member)
+		}
+	}
+
+	return members, nil
+}
+
+// GetConversationsPage returns one page of the conversations of a user, the
+// most recently active first
+func (r *SQLMessageRepository) GetConversationsPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.ConversationMember, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	members, err := sqlQuery(ctx, r.Store.DB, scanMember, sqlMemberQuery+` WHERE m.user_id = $1 AND ($2 = '' OR m.last_activity < $2)
+		ORDER BY m.last_activity DESC LIMIT $3`, userId, after, max(limit, 0)+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get conversations of user %s: %w", userId, err)
+	}
+
+	return sqlPage(members, func(member *entity.ConversationMember) string { return member.GSI1SK }, limit)
+}
+
+// CreateMessage stores a message and moves its conversation to the top of the
+// list of every participant. The sender has read their own message.
+func (r *SQLMessageRepository) CreateMessage(ctx context.Context, message *entity.Message, participantIds []string) (*entity.Message, error) {
+	if message == nil {
+		return nil, fmt.Errorf("input message cannot be nil")
+	}
+
+	err := r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO messages (`+sqlMessageColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+			message.ID, message.ConversationID, message.SenderID, message.SenderName, message.Text, sqlTime(message.Timestamp))
+		if err != nil {
+			return fmt.Errorf("failed to insert message: %w", err)
+		}
+
+		for _, userId := range participantIds {
+			updated, err := sqlExec(ctx, tx, `UPDATE conversation_members SET last_activity = $1, last_message_id = $1,
+				last_read_id = CASE WHEN user_id = $2 THEN $1 ELSE last_read_id END
+				WHERE conversation_id = $3 AND user_id = $4`, message.ID, message.SenderID, message.ConversationID, userId)
+			if err != nil {
+				return err
+			}
+			if updated == 0 {
+				return fmt.Errorf("user %s does not take part in conversation %s", userId, message.ConversationID)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// GetMessagesPage returns one page of the messages of a conversation, newest
+// first
+func (r *SQLMessageRepository) GetMessagesPage(ctx context.Context, conversationId string, limit int32, cursor string) ([]*entity.Message, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	messages, err := sqlQuery(ctx, r.Store.DB, scanMessage, `SELECT `+sqlMessageColumns+` FROM messages
+		WHERE conversation_id = $1 AND ($2 = '' OR id < $2) ORDER BY id DESC LIMIT $3`, conversationId, after, max(limit, 0)+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get messages of conversation %s: %w", conversationId, err)
+	}
+
+	return sqlPage(messages, func(message *entity.Message) string { return message.ID }, limit)
+}
+
+// MarkRead moves the read receipt of a participant forward to the given
+// message. A receipt that is already further ahead is left alone, which is
+// reported by returning false.
+func (r *SQLMessageRepository) MarkRead(ctx context.Context, userId, conversationId, messageId string) (bool, error) {
+	updated, err := sqlExec(ctx, r.Store.DB, `UPDATE conversation_members SET last_read_id = $1
+		WHERE conversation_id = $2 AND user_id = $3 AND last_read_id < $1`, messageId, conversationId, userId)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark conversation %s as read: %w", conversationId, err)
+	}
+
+	return updated > 0, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+const sqlNotificationColumns = "id, user_id, type, actor_id, actor_name, post_id, comment_id, timestamp"
+
+// SQLNotificationRepository stores the notifications of users and how far
+// they read them in a SQLStore
+type SQLNotificationRepository struct {
+	Store *SQLStore
+}
+
+func NewSQLNotificationRepository(store *SQLStore) *SQLNotificationRepository {
+	return &SQLNotificationRepository{
+		Store: store,
+	}
+}
+
+func scanNotification(row sqlScanner) (*entity.Notification, error) {
+	notification := &entity.Notification{}
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.ActorID, &notification.ActorName,
+		&notification.PostID, &notification.CommentID, &notification.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	notification.PK = fmt.Sprintf("user#%s", notification.UserID)
+	notification.SK = fmt.Sprintf("notif#%s", notification.ID)
+
+	return notification, nil
+}
+
+func (r *SQLNotificationRepository) Create(ctx context.Context, notification *entity.Notification) (*entity.Notification, error) {
+	if notification == nil {
+		return nil, fmt.Errorf("input notification cannot be nil")
+	}
+
+	_, err := r.Store.DB.ExecContext(ctx, `INSERT INTO notifications (`+sqlNotificationColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		notification.ID, notification.UserID, notification.Type, notification.ActorID, notification.ActorName,
+		notification.PostID, notification.CommentID, sqlTime(notification.Timestamp))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert notification: %w", err)
+	}
+
+	return notification, nil
+}
+
+// GetPage returns one page of the notifications of a user, newest first
+func (r *SQLNotificationRepository) GetPage(ctx context.Context, userId string, limit int32, cursor string) ([]*entity.Notification, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	notifications, err := sqlQuery(ctx, r.Store.DB, scanNotification, `SELECT `+sqlNotificationColumns+` FROM notifications
+		WHERE user_id = $1 AND ($2 = '' OR id < $2) ORDER BY id DESC LIMIT $3`, userId, after, max(limit, 0)+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get notifications of user %s: %w", userId, err)
+	}
+
+	return sqlPage(notifications, func(notification *entity.Notification) string { return notification.ID }, limit)
+}
+
+// GetLatestID returns the id of the newest notification of a user, or an
+// empty string if there is none
+func (r *SQLNotificationRepository) GetLatestID(ctx context.Context, userId string) (string, error) {
+	return r.getID(ctx, `SELECT id FROM notifications WHERE user_id = $1 ORDER BY id DESC LIMIT 1`, userId)
+}
+
+// GetLastReadID returns the id up to which the user read their
+// notifications, or an empty string if they never did
+func (r *SQLNotificationRepository) GetLastReadID(ctx context.Context, userId string) (string, error) {
+	return r.getID(ctx, `SELECT last_read_id FROM notifications_read WHERE user_id = $1`, userId)
+}
+
+func (r *SQLNotificationRepository) getID(ctx context.Context, query, userId string) (string, error) {
+	var id string
+	err := r.Store.DB.QueryRowContext(ctx, query, userId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get notification id of user %s: %w", userId, err)
+	}
+
+	return id, nil
+}
+
+// MarkRead moves the read marker of a user forward to the given id. A marker
+// that is already further ahead is left alone.
+func (r *SQLNotificationRepository) MarkRead(ctx context.Context, userId, notificationId string) error {
+	_, err := r.Store.DB.ExecContext(ctx, `INSERT INTO notifications_read (user_id, last_read_id) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_read_id = excluded.last_read_id WHERE notifications_read.last_read_id < excluded.last_read_id`,
+		userId, notificationId)
+	if err != nil {
+		return fmt.Errorf("failed to mark notifications of user %s as read: %w", userId, err)
+	}
+
+	return nil
+}
+
+// CountUnread counts the notifications newer than lastReadId, except those of
+// hidden actors
+func (r *SQLNotificationRepository) CountUnread(ctx context.Context, userId, lastReadId string, hiddenActorIds []string) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND id > $2`
+	args := []any{userId, lastReadId}
+	if len(hiddenActorIds) > 0 {
+		placeholders, hiddenArgs := sqlIn(3, hiddenActorIds)
+		query += ` AND actor_id NOT IN (` + placeholders + `)`
+		args = append(args, hiddenArgs...)
+	}
+
+	var count int
+	err := r.Store.DB.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications of user %s: %w", userId, err)
+	}
+
+	return count, nil
+}
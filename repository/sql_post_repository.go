@@ -0,0 +1,544 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+const sqlPostColumns = "p.id, p.user_id, p.name, p.text, p.timestamp, p.image, p.edited, p.like_count, p.reference_kind, p.reference_user_id, p.reference_post_id, p.tags, p.mentions, p.media"
+
+// SQLPostRepository stores posts, their likes, tags and inbox entries in a
+// SQLStore. Likes, tags, inbox entries and comments are deleted together with
+// their post by the foreign keys. Images are kept in Blobs, without it posts
+// cannot have images.
+type SQLPostRepository struct {
+	Store *SQLStore
+	Blobs BlobStore
+}
+
+func NewSQLPostRepository(store *SQLStore, blobs BlobStore) *SQLPostRepository {
+	return &SQLPostRepository{
+		Store: store,
+		Blobs: blobs,
+	}
+}
+
+func scanPost(row sqlScanner) (*entity.Post, error) {
+	var image string
+	var edited sql.NullTime
+	var tags, mentions, media sql.NullString
+	reference := &entity.PostReference{}
+	post := &entity.Post{}
+	err := row.Scan(&post.ID, &post.UserID, &post.UserName, &post.Text, &post.Timestamp, &image, &edited, &post.LikeCount,
+		&reference.Kind, &reference.UserID, &reference.PostID, &tags, &mentions, &media)
+	if err != nil {
+		return nil, err
+	}
+
+	post.PK = fmt.Sprintf("user#%s", post.UserID)
+	post.SK = fmt.Sprintf("post#%s", post.ID)
+	post.GSIPK = "timeline"
+	post.GSISK = post.ID
+	post.Edited = timePointer(edited)
+	if reference.Kind != "" {
+		post.Reference = reference
+	}
+
+	post.Tags, err = fromSQLJSON[string](tags)
+	if err != nil {
+		return nil, err
+	}
+
+	post.Mentions, err = fromSQLJSON[entity.Mention](mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	post.Media, err = sqlPostMedia(image, media)
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// sqlPostMedia reads the media of a post. Posts from before media lists only
+// have the key of their image, which becomes their only medium.
+func sqlPostMedia(image string, media sql.NullString) ([]entity.Media, error) {
+	if image != "" && (!media.Valid || media.String == "") {
+		return []entity.Media{{Key: image}}, nil
+	}
+
+	return fromSQLJSON[entity.Media](media)
+}
+
+func (r *SQLPostRepository) Create(ctx context.Context, post *entity.Post) (*entity.Post, error) {
+	if post == nil {
+		return nil, fmt.Errorf("input post cannot be nil")
+	}
+
+	err := validateMedia(ctx, r.Blobs, post.Media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate media: %w", err)
+	}
+
+	tags, err := sqlJSON(post.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions, err := sqlJSON(post.Mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := sqlJSON(post.Media)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := &entity.PostReference{}
+	if post.Reference != nil {
+		reference = post.Reference
+	}
+
+	err = r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		updated, err := sqlExec(ctx, tx, `UPDATE users SET posts_count = posts_count + 1 WHERE id = $1`, post.UserID)
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrUserNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO posts (id, user_id, name, text, timestamp, image, edited, like_count, reference_kind, reference_user_id, reference_post_id, tags, mentions, media)
+			VALUES ($1, $2, $3, $4, $5, '', $6, $7, $8, $9, $10, $11, $12, $13)`,
+			post.ID, post.UserID, post.UserName, post.Text, sqlTime(post.Timestamp), sqlNullTime(post.Edited), post.LikeCount,
+			reference.Kind, reference.UserID, reference.PostID, tags, mentions, media)
+		if err != nil {
+			return fmt.Errorf("failed to insert post: %w", err)
+		}
+
+		err = r.syncTags(ctx, tx, post, nil)
+		if err != nil {
+			return err
+		}
+
+		return r.attachReferences(ctx, tx, []*entity.Post{post})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = setImageURLs(ctx, r.Blobs, []*entity.Post{post})
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+func (r *SQLPostRepository) GetAll(ctx context.Context, limit int32, cursor string) ([]*entity.Post, string, error) {
+	return r.page(ctx, `SELECT `+sqlPostColumns+` FROM posts p WHERE ($1 = '' OR p.id < $1) ORDER BY p.id DESC LIMIT $2`, nil, limit, cursor)
+}
+
+func (r *SQLPostRepository) GetByUserID(ctx context.Context, userID string) ([]*entity.Post, error) {
+	return r.query(ctx, `SELECT `+sqlPostColumns+` FROM posts p WHERE p.user_id = $1 ORDER BY p.id DESC`, userID)
+}
+
+// GetPageByUserID returns up to limit posts of a user that are older than
+// the post with beforeID, newest first. An empty beforeID starts at the top.
+func (r *SQLPostRepository) GetPageByUserID(ctx context.Context, userID, beforeID string, limit int32) ([]*entity.Post, error) {
+	return r.query(ctx, `SELECT `+sqlPostColumns+` FROM posts p WHERE p.user_id = $1 AND ($2 = '' OR p.id < $2) ORDER BY p.id DESC LIMIT $3`,
+		userID, beforeID, max(limit, 0))
+}
+
+// query returns the posts of a query with their references and image URLs
+// attached
+func (r *SQLPostRepository) query(ctx context.Context, query string, args ...any) ([]*entity.Post, error) {
+	posts, err := sqlQuery(ctx, r.Store.DB, scanPost, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", err)
+	}
+
+	err = r.AttachReferences(ctx, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// page runs a query of posts newest first. The query gets the id to start
+// after as $1, which is empty for the first page, the limit as the last
+// placeholder and args in between.
+func (r *SQLPostRepository) page(ctx context.Context, query string, args []any, limit int32, cursor string) ([]*entity.Post, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args = append(append([]any{after}, args...), max(limit, 0)+1)
+	posts, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sqlPage(posts, func(post *entity.Post) string { return post.ID }, limit)
+}
+
+func (r *SQLPostRepository) Get(ctx context.Context, userId, postId string) (*entity.Post, error) {
+	return r.get(ctx, r.Store.DB, `SELECT `+sqlPostColumns+` FROM posts p WHERE p.id = $1 AND p.user_id = $2`, postId, userId)
+}
+
+func (r *SQLPostRepository) GetByID(ctx context.Context, postId string) (*entity.Post, error) {
+	return r.get(ctx, r.Store.DB, `SELECT `+sqlPostColumns+` FROM posts p WHERE p.id = $1`, postId)
+}
+
+func (r *SQLPostRepository) get(ctx context.Context, q sqlQuerier, query string, args ...any) (*entity.Post, error) {
+	post, err := scanPost(q.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post: %w", err)
+	}
+
+	return post, nil
+}
+
+func (r *SQLPostRepository) Update(ctx context.Context, userId, postId, text string, media []entity.Media, mentions []entity.Mention) (*entity.Post, error) {
+	err := validateMedia(ctx, r.Blobs, media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate media: %w", err)
+	}
+
+	mentionsColumn, err := sqlJSON(mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaColumn, err := sqlJSON(media)
+	if err != nil {
+		return nil, err
+	}
+
+	var post *entity.Post
+	err = r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		post, err = r.get(ctx, tx, `SELECT `+sqlPostColumns+` FROM posts p WHERE p.id = $1 AND p.user_id = $2`, postId, userId)
+		if err != nil {
+			return fmt.Errorf("failed to get post to update: %w", err)
+		}
+
+		previousTags := post.Tags
+
+		edited := time.Now()
+		post.Text = text
+		post.Media = media
+		post.Edited = &edited
+		post.Tags = entity.ParseTags(text)
+		post.Mentions = nil
+		if len(mentions) > 0 {
+			post.Mentions = mentions
+		}
+
+		tags, err := sqlJSON(post.Tags)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET text = $1, image = '', media = $2, edited = $3, tags = $4, mentions = $5 WHERE id = $6`,
+			text, mediaColumn, sqlTime(edited), tags, mentionsColumn, postId)
+		if err != nil {
+			return fmt.Errorf("failed to update post: %w", err)
+		}
+
+		err = r.syncTags(ctx, tx, post, previousTags)
+		if err != nil {
+			return err
+		}
+
+		return r.attachReferences(ctx, tx, []*entity.Post{post})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = setImageURLs(ctx, r.Blobs, []*entity.Post{post})
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// Delete removes the post together with its comments, likes, tags and inbox
+// entries, and decrements the posts count of its author. The images of the
+// post are deleted once the transaction is committed.
+func (r *SQLPostRepository) Delete(ctx context.Context, userId, postId string) error {
+	var image string
+	var media sql.NullString
+	err := r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `DELETE FROM posts WHERE id = $1 AND user_id = $2 RETURNING image, media`, postId, userId).Scan(&image, &media)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get post to delete: %w", ErrPostNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete post: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE users SET posts_count = posts_count - 1 WHERE id = $1`, userId)
+		if err != nil {
+			return fmt.Errorf("failed to update posts count: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	postMedia, err := sqlPostMedia(image, media)
+	if err != nil {
+		return err
+	}
+
+	err = deleteMedia(ctx, r.Blobs, postMedia)
+	if err != nil {
+		return fmt.Errorf("failed to delete media: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLPostRepository) DeleteImage(ctx context.Context, imageKey string) error {
+	return deleteImage(ctx, r.Blobs, imageKey)
+}
+
+func (r *SQLPostRepository) ProcessImage(ctx context.Context, userId, uploadKey string) (*entity.Media, error) {
+	return processImage(ctx, r.Blobs, userId, uploadKey)
+}
+
+// AttachReferences loads the original posts of reposts and quotes. Posts
+// whose original was deleted keep a nil Referenced.
+func (r *SQLPostRepository) AttachReferences(ctx context.Context, posts []*entity.Post) error {
+	err := r.attachReferences(ctx, r.Store.DB, posts)
+	if err != nil {
+		return err
+	}
+
+	return setImageURLs(ctx, r.Blobs, posts)
+}
+
+func (r *SQLPostRepository) attachReferences(ctx context.Context, q sqlQuerier, posts []*entity.Post) error {
+	var ids []string
+	for _, post := range posts {
+		if post.Reference != nil && !slices.Contains(ids, post.Reference.PostID) {
+			ids = append(ids, post.Reference.PostID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders, args := sqlIn(1, ids)
+	referenced, err := sqlQuery(ctx, q, scanPost, `SELECT `+sqlPostColumns+` FROM posts p WHERE p.id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get referenced posts: %w", err)
+	}
+
+	byID := make(map[string]*entity.Post, len(referenced))
+	for _, post := range referenced {
+		byID[post.ID] = post
+	}
+
+	for _, post := range posts {
+		if post.Reference == nil {
+			continue
+		}
+
+		post.Referenced = nil
+		if original, ok := byID[post.Reference.PostID]; ok && original.UserID == post.Reference.UserID {
+			post.Referenced = clone(original)
+		}
+	}
+
+	return nil
+}
+
+// Like stores the like of a user and increments the like count of the post.
+// A user can like a post only once.
+func (r *SQLPostRepository) Like(ctx context.Context, like *entity.Like, authorId string) error {
+	if like == nil {
+		return fmt.Errorf("input like cannot be nil")
+	}
+
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		// Updating the post first makes concurrent likes wait for each other
+		updated, err := sqlExec(ctx, tx, `UPDATE posts SET like_count = like_count + 1 WHERE id = $1 AND user_id = $2`, like.PostID, authorId)
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrPostNotFound
+		}
+
+		inserted, err := sqlExec(ctx, tx, `INSERT INTO likes (post_id, user_id, timestamp) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			like.PostID, like.UserID, sqlTime(like.Timestamp))
+		if err != nil {
+			return err
+		}
+		if inserted == 0 {
+			return ErrAlreadyLiked
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLPostRepository) Unlike(ctx context.Context, postId, userId, authorId string) error {
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		deleted, err := sqlExec(ctx, tx, `DELETE FROM likes WHERE post_id = $1 AND user_id = $2`, postId, userId)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrNotLiked
+		}
+
+		updated, err := sqlExec(ctx, tx, `UPDATE posts SET like_count = like_count - 1 WHERE id = $1 AND user_id = $2`, postId, authorId)
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrPostNotFound
+		}
+
+		return nil
+	})
+}
+
+// GetLikedPostIDs returns which of the given posts the user has liked
+func (r *SQLPostRepository) GetLikedPostIDs(ctx context.Context, userId string, postIds []string) (map[string]bool, error) {
+	liked := map[string]bool{}
+	if len(postIds) == 0 {
+		return liked, nil
+	}
+
+	placeholders, args := sqlIn(2, postIds)
+	ids, err := sqlQuery(ctx, r.Store.DB, scanString, `SELECT post_id FROM likes WHERE user_id = $1 AND post_id IN (`+placeholders+`)`,
+		append([]any{userId}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get likes of user %s: %w", userId, err)
+	}
+
+	for _, id := range ids {
+		liked[id] = true
+	}
+
+	return liked, nil
+}
+
+// GetInbox returns one page of the posts distributed to a user. The inbox
+// points at the stored posts, so it always shows their current version.
+func (r *SQLPostRepository) GetInbox(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Post, string, error) {
+	return r.page(ctx, `SELECT `+sqlPostColumns+` FROM posts p JOIN inbox i ON i.post_id = p.id
+		WHERE ($1 = '' OR p.id < $1) AND i.owner_id = $2 ORDER BY p.id DESC LIMIT $3`, []any{userID}, limit, cursor)
+}
+
+// DistributeToInboxes adds the post to the inbox of every owner
+func (r *SQLPostRepository) DistributeToInboxes(ctx context.Context, post *entity.Post, ownerIDs []string) error {
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		for _, ownerID := range ownerIDs {
+			_, err := tx.ExecContext(ctx, `INSERT INTO inbox (owner_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, ownerID, post.ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert inbox entry: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RefreshInboxCopies has nothing to do, inboxes in SQL hold no copies
+func (r *SQLPostRepository) RefreshInboxCopies(ctx context.Context, post *entity.Post) error {
+	return nil
+}
+
+func (r *SQLPostRepository) DeleteInboxCopies(ctx context.Context, postId string) error {
+	_, err := r.Store.DB.ExecContext(ctx, `DELETE FROM inbox WHERE post_id = $1`, postId)
+	if err != nil {
+		return fmt.Errorf("failed to delete inbox entries: %w", err)
+	}
+
+	return nil
+}
+
+// GetByTag returns one page of the posts using a tag, newest first
+func (r *SQLPostRepository) GetByTag(ctx context.Context, tag string, limit int32, cursor string) ([]*entity.Post, string, error) {
+	return r.page(ctx, `SELECT `+sqlPostColumns+` FROM posts p JOIN post_tags t ON t.post_id = p.id
+		WHERE ($1 = '' OR p.id < $1) AND t.tag = $2 ORDER BY p.id DESC LIMIT $3`, []any{tag}, limit, cursor)
+}
+
+// CountTagsSince counts how often every tag was added to a post since the
+// given time, by the author of the post
+func (r *SQLPostRepository) CountTagsSince(ctx context.Context, since time.Time) (map[string]map[string]int, error) {
+	rows, err := r.Store.DB.QueryContext(ctx, `SELECT t.tag, p.user_id, COUNT(*) FROM post_tags t JOIN posts p ON p.id = t.post_id
+		WHERE t.timestamp >= $1 GROUP BY t.tag, p.user_id`, sqlTime(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]map[string]int{}
+	for rows.Next() {
+		var tag, userId string
+		var count int
+		err := rows.Scan(&tag, &userId, &count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tag count: %w", err)
+		}
+		if counts[tag] == nil {
+			counts[tag] = map[string]int{}
+		}
+		counts[tag][userId] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// syncTags adds the post to the tags it gained and removes it from those it
+// lost since previousTags. Tags the post keeps keep the time they were added.
+func (r *SQLPostRepository) syncTags(ctx context.Context, tx *sql.Tx, post *entity.Post, previousTags []string) error {
+	now := sqlTime(time.Now())
+	for _, tag := range post.Tags {
+		if slices.Contains(previousTags, tag) {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO post_tags (tag, post_id, user_id, timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			tag, post.ID, post.UserID, now)
+		if err != nil {
+			return fmt.Errorf("failed to insert tag %s: %w", tag, err)
+		}
+	}
+
+	for _, tag := range previousTags {
+		if slices.Contains(post.Tags, tag) {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE tag = $1 AND post_id = $2`, tag, post.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete tag %s: %w", tag, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// sqlDialect holds what differs between the supported databases. Queries use
+// $1 style placeholders, which both understand.
+type sqlDialect struct {
+	driver string
+	// timestamp is the column type for points in time
+	timestamp string
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"sqlite":   {driver: "sqlite", timestamp: "TIMESTAMP"},
+	"postgres": {driver: "pgx", timestamp: "TIMESTAMPTZ"},
+}
+
+// SQLStore holds the database of the SQL repositories. SQLite is meant for
+// local runs, Postgres for production.
+type SQLStore struct {
+	DB      *sql.DB
+	dialect sqlDialect
+}
+
+// OpenSQLStore connects to a "sqlite" or "postgres" database and applies the
+// migrations it is missing. For SQLite the dsn is the path of the file.
+func OpenSQLStore(ctx context.Context, dialectName, dsn string) (*SQLStore, error) {
+	dialect, ok := sqlDialects[dialectName]
+	if !ok {
+		return nil, fmt.Errorf("unknown sql dialect %q", dialectName)
+	}
+
+	if dialectName == "sqlite" {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		// Foreign keys are needed for the cascades and are off by default
+		dsn += separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	}
+
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// SQLite allows a single writer, and every connection to :memory: would
+	// get its own database
+	if dialectName == "sqlite" {
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &SQLStore{DB: db, dialect: dialect}
+	err = store.Migrate(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.DB.Close()
+}
+
+// Migrate applies the migrations that are newer than the schema version of
+// the database, each in its own transaction. Migrations are numbered by the
+// prefix of their file name.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, s.schema(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	applied_at {{timestamp}} NOT NULL
+)`))
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	err = s.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	// Names are zero padded, so they are returned in order
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "migrations/"), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid migration name %s", name)
+		}
+		if version <= current {
+			continue
+		}
+
+		content, err := migrations.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, statement := range strings.Split(s.schema(string(content)), ";") {
+				if strings.TrimSpace(statement) == "" {
+					continue
+				}
+				_, err := tx.ExecContext(ctx, statement)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// schema fills the column types of the dialect into a statement
+func (s *SQLStore) schema(statement string) string {
+	return strings.ReplaceAll(statement, "{{timestamp}}", s.dialect.timestamp)
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds. With SQLite
+// there is only one connection, so fn must not use the store outside of tx.
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlScanner is implemented by both *sql.Row and *sql.Rows
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+// sqlQuery reads all rows of a query. The rows are closed before it returns,
+// so the single SQLite connection is free again.
+func sqlQuery[T any](ctx context.Context, q sqlQuerier, scan func(sqlScanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return items, nil
+}
+
+func scanString(row sqlScanner) (string, error) {
+	var s string
+	err := row.Scan(&s)
+	return s, err
+}
+
+// sqlExists reports whether a query returns any row
+func sqlExists(ctx context.Context, q sqlQuerier, query string, args ...any) (bool, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+// sqlExec runs a statement and returns how many rows it changed
+func sqlExec(ctx context.Context, q sqlQuerier, query string, args ...any) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute statement: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// sqlIn returns the placeholders for a list of values that starts at
+// placeholder number first, together with the values as arguments
+func sqlIn(first int, values []string) (string, []any) {
+	placeholders := make([]string, len(values))
+	args := make([]any, len(values))
+	for i, value := range values {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+		args[i] = value
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// sqlPage cuts the extra row that a query with a limit of limit+1 returned
+// when there is a next page, and creates the cursor for it
+func sqlPage[T any](items []T, key func(T) string, limit int32) ([]T, string, error) {
+	limit = max(limit, 0)
+	if len(items) <= int(limit) || limit == 0 {
+		return items[:min(len(items), int(limit))], "", nil
+	}
+
+	items = items[:limit]
+	cursor, err := encodeKeyCursor(key(items[len(items)-1]))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return items, cursor, nil
+}
+
+// sqlAfter decodes the cursor of a page. An empty cursor starts at the first
+// page and results in an empty key.
+func sqlAfter(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	return decodeKeyCursor(cursor)
+}
+
+// Times are stored in UTC, so SQLite can compare them as text
+func sqlTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func sqlNullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func timePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func sqlNullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// sqlJSON stores slices as JSON arrays. Empty slices are stored as NULL.
+func sqlJSON[T any](values []T) (any, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal column: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func fromSQLJSON[T any](data sql.NullString) ([]T, error) {
+	if !data.Valid || data.String == "" {
+		return nil, nil
+	}
+
+	var values []T
+	err := json.Unmarshal([]byte(data.String), &values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal column: %w", err)
+	}
+
+	return values, nil
+}
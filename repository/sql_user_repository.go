@@ -0,0 +1,611 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// sqlEdge is a table of edges between users, seen from the user in
+// userColumn. Follows are stored once and read from both sides.
+type sqlEdge struct {
+	table       string
+	userColumn  string
+	otherColumn string
+}
+
+var (
+	sqlFollowing      = sqlEdge{"follows", "follower_id", "followed_id"}
+	sqlFollowers      = sqlEdge{"follows", "followed_id", "follower_id"}
+	sqlBlocks         = sqlEdge{"blocks", "blocker_id", "blocked_id"}
+	sqlMutes          = sqlEdge{"mutes", "muter_id", "muted_id"}
+	sqlFollowRequests = sqlEdge{"follow_requests", "user_id", "requester_id"}
+)
+
+const sqlUserColumns = "id, name, email, picture, handle, followers_count, following_count, posts_count, dms_following_only, private"
+
+// SQLUserRepository stores users and the edges between them in a SQLStore
+type SQLUserRepository struct {
+	Store *SQLStore
+}
+
+func NewSQLUserRepository(store *SQLStore) *SQLUserRepository {
+	return &SQLUserRepository{
+		Store: store,
+	}
+}
+
+func scanUser(row sqlScanner) (*entity.User, error) {
+	var handle sql.NullString
+	user := &entity.User{}
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Picture, &handle, &user.FollowersCount, &user.FollowingCount, &user.PostsCount, &user.DMsFollowingOnly, &user.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	user.PK = "user"
+	user.SK = user.ID
+	user.Handle = handle.String
+
+	return user, nil
+}
+
+// Create stores the user, replacing an existing one with the same id like a
+// put of the DynamoDB item
+func (r *SQLUserRepository) Create(ctx context.Context, user *entity.User) (*entity.User, error) {
+	if user == nil {
+		return nil, fmt.Errorf("input user cannot be nil")
+	}
+
+	err := r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		if user.Handle != "" {
+			taken, err := sqlExists(ctx, tx, `SELECT 1 FROM users WHERE handle = $1`, user.Handle)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrHandleTaken
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (`+sqlUserColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name, email = excluded.email, picture = excluded.picture, handle = excluded.handle,
+				followers_count = excluded.followers_count, following_count = excluded.following_count, posts_count = excluded.posts_count,
+				dms_following_only = excluded.dms_following_only, private = excluded.private`,
+			user.ID, user.Name, user.Email, user.Picture, sqlNullString(user.Handle), user.FollowersCount, user.FollowingCount, user.PostsCount, user.DMsFollowingOnly, user.Private)
+		return err
+	})
+	if errors.Is(err, ErrHandleTaken) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user %s: %w", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// ClaimHandle reserves a handle for an existing user without one
+func (r *SQLUserRepository) ClaimHandle(ctx context.Context, userID, handle string) error {
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		taken, err := sqlExists(ctx, tx, `SELECT 1 FROM users WHERE handle = $1`, handle)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrHandleTaken
+		}
+
+		updated, err := sqlExec(ctx, tx, `UPDATE users SET handle = $1 WHERE id = $2 AND handle IS NULL`, handle, userID)
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrUserNotFound
+		}
+
+		return nil
+	})
+}
+
+// GetIDsByHandles maps the given handles to the ids of their users. Handles
+// nobody uses are left out.
+func (r *SQLUserRepository) GetIDsByHandles(ctx context.Context, handles []string) (map[string]string, error) {
+	ids := map[string]string{}
+	if len(handles) == 0 {
+		return ids, nil
+	}
+
+	placeholders, args := sqlIn(1, handles)
+	pairs, err := sqlQuery(ctx, r.Store.DB, func(row sqlScanner) ([2]string, error) {
+		var pair [2]string
+		err := row.Scan(&pair[0], &pair[1])
+		return pair, err
+	}, `SELECT handle, id FROM users WHERE handle IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users by handles: %w", err)
+	}
+
+	for _, pair := range pairs {
+		ids[pair[0]] = pair[1]
+	}
+
+	return ids, nil
+}
+
+// GetByID returns nil if the user does not exist
+func (r *SQLUserRepository) GetByID(ctx context.Context, id string) (*entity.User, error) {
+	user, err := scanUser(r.Store.DB.QueryRowContext(ctx, `SELECT `+sqlUserColumns+` FROM users WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", id, err)
+	}
+
+	return user, nil
+}
+
+func (r *SQLUserRepository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	// Same order as the descending query of the DynamoDB repository
+	users, err := sqlQuery(ctx, r.Store.DB, scanUser, `SELECT `+sqlUserColumns+` FROM users ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (r *SQLUserRepository) GetFollowing(ctx context.Context, userID string) ([]*entity.Follow, error) {
+	ids, err := r.edgeIDs(ctx, sqlFollowing, userID)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(ids)
+
+	following := make([]*entity.Follow, 0, len(ids))
+	for _, id := range ids {
+		follow, _ := entity.NewFollow(userID, id)
+		following = append(following, follow)
+	}
+
+	return following, nil
+}
+
+func (r *SQLUserRepository) GetFollowers(ctx context.Context, userID string) ([]*entity.Follower, error) {
+	ids, err := r.edgeIDs(ctx, sqlFollowers, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.followers(ids, userID), nil
+}
+
+func (r *SQLUserRepository) followers(ids []string, userID string) []*entity.Follower {
+	followers := make([]*entity.Follower, 0, len(ids))
+	for _, id := range ids {
+		follower, _ := entity.NewFollower(id, userID)
+		followers = append(followers, follower)
+	}
+	return followers
+}
+
+// GetFollowerIDs returns the ids of all followers of a user
+func (r *SQLUserRepository) GetFollowerIDs(ctx context.Context, userID string) ([]string, error) {
+	return r.edgeIDs(ctx, sqlFollowers, userID)
+}
+
+// edgeIDs returns the other users of the edges of one kind, sorted by id
+func (r *SQLUserRepository) edgeIDs(ctx context.Context, edge sqlEdge, userID string) ([]string, error) {
+	ids, err := sqlQuery(ctx, r.Store.DB, scanString, fmt.Sprintf(`SELECT %[3]s FROM %[1]s WHERE %[2]s = $1 ORDER BY %[3]s`, edge.table, edge.userColumn, edge.otherColumn), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s of user %s: %w", edge.table, userID, err)
+	}
+
+	return ids, nil
+}
+
+// IsFollowing reports whether one user follows another
+func (r *SQLUserRepository) IsFollowing(ctx context.Context, followerID, followingID string) (bool, error) {
+	return r.hasEdge(ctx, sqlFollowing, followerID, followingID)
+}
+
+// IsBlocked reports whether one user blocked another
+func (r *SQLUserRepository) IsBlocked(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	return r.hasEdge(ctx, sqlBlocks, blockerID, blockedID)
+}
+
+// IsMuted reports whether one user muted another
+func (r *SQLUserRepository) IsMuted(ctx context.Context, muterID, mutedID string) (bool, error) {
+	return r.hasEdge(ctx, sqlMutes, muterID, mutedID)
+}
+
+func (r *SQLUserRepository) hasEdge(ctx context.Context, edge sqlEdge, userID, otherID string) (bool, error) {
+	exists, err := sqlExists(ctx, r.Store.DB, fmt.Sprintf(`SELECT 1 FROM %s WHERE %s = $1 AND %s = $2`, edge.table, edge.userColumn, edge.otherColumn), userID, otherID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s of user %s: %w", edge.table, userID, err)
+	}
+
+	return exists, nil
+}
+
+func (r *SQLUserRepository) GetFollowingPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follow, string, error) {
+	ids, nextCursor, err := r.edgePage(ctx, sqlFollowing, userID, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	following := make([]*entity.Follow, 0, len(ids))
+	for _, id := range ids {
+		follow, _ := entity.NewFollow(userID, id)
+		following = append(following, follow)
+	}
+
+	return following, nextCursor, nil
+}
+
+func (r *SQLUserRepository) GetFollowersPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follower, string, error) {
+	ids, nextCursor, err := r.edgePage(ctx, sqlFollowers, userID, limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return r.followers(ids, userID), nextCursor, nil
+}
+
+// edgePage returns one page of the other users of the edges of one kind
+func (r *SQLUserRepository) edgePage(ctx context.Context, edge sqlEdge, userID string, limit int32, cursor string) ([]string, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids, err := sqlQuery(ctx, r.Store.DB, scanString, fmt.Sprintf(`SELECT %[3]s FROM %[1]s WHERE %[2]s = $1 AND %[3]s > $2 ORDER BY %[3]s LIMIT $3`, edge.table, edge.userColumn, edge.otherColumn),
+		userID, after, max(limit, 0)+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get %s of user %s: %w", edge.table, userID, err)
+	}
+
+	return sqlPage(ids, func(id string) string { return id }, limit)
+}
+
+// GetByIDs returns the users with the given ids in the same order. Users that
+// do not exist are left out.
+func (r *SQLUserRepository) GetByIDs(ctx context.Context, ids []string) ([]*entity.User, error) {
+	if len(ids) == 0 {
+		return []*entity.User{}, nil
+	}
+
+	placeholders, args := sqlIn(1, ids)
+	found, err := sqlQuery(ctx, r.Store.DB, scanUser, `SELECT `+sqlUserColumns+` FROM users WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	byID := make(map[string]*entity.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+
+	users := make([]*entity.User, 0, len(found))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// Follow stores the follow edge and updates the counters of both users
+func (r *SQLUserRepository) Follow(ctx context.Context, follow *entity.Follow, follower *entity.Follower) (*entity.Follow, error) {
+	if follow == nil || follower == nil {
+		return nil, fmt.Errorf("input follow cannot be nil")
+	}
+
+	err := r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		return r.follow(ctx, tx, follower.FollowerID, follow.FollowedID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return follow, nil
+}
+
+// follow updates the counters first, so concurrent follows of the same user
+// wait for each other before inserting the edge
+func (r *SQLUserRepository) follow(ctx context.Context, tx *sql.Tx, followerID, followingID string) error {
+	for _, counter := range [][2]string{{followerID, "following_count"}, {followingID, "followers_count"}} {
+		updated, err := sqlExec(ctx, tx, `UPDATE users SET `+counter[1]+` = `+counter[1]+` + 1 WHERE id = $1`, counter[0])
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrUserNotFound
+		}
+	}
+
+	inserted, err := sqlExec(ctx, tx, `INSERT INTO follows (follower_id, followed_id, timestamp) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		followerID, followingID, sqlTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrAlreadyFollowing
+	}
+
+	return nil
+}
+
+// Unfollow removes the follow edge and updates the counters of both users
+func (r *SQLUserRepository) Unfollow(ctx context.Context, unfollow *entity.Unfollow, removeFollower *entity.Unfollow) error {
+	if unfollow == nil || removeFollower == nil {
+		return fmt.Errorf("input unfollow cannot be nil")
+	}
+
+	followerID := strings.TrimPrefix(unfollow.PK, "user#")
+	followingID := strings.TrimPrefix(removeFollower.PK, "user#")
+
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		removed, err := r.unfollow(ctx, tx, followerID, followingID)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return ErrNotFollowing
+		}
+
+		return nil
+	})
+}
+
+// unfollow reports whether there was a follow to remove
+func (r *SQLUserRepository) unfollow(ctx context.Context, tx *sql.Tx, followerID, followingID string) (bool, error) {
+	deleted, err := sqlExec(ctx, tx, `DELETE FROM follows WHERE follower_id = $1 AND followed_id = $2`, followerID, followingID)
+	if err != nil || deleted == 0 {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET following_count = following_count - 1 WHERE id = $1`, followerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update following count: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET followers_count = followers_count - 1 WHERE id = $1`, followingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update followers count: %w", err)
+	}
+
+	return true, nil
+}
+
+// UpdateSettings changes the settings that are set and returns the updated user
+func (r *SQLUserRepository) UpdateSettings(ctx context.Context, userID string, settings *entity.UserSettings) (*entity.User, error) {
+	if settings == nil {
+		return nil, fmt.Errorf("input settings cannot be nil")
+	}
+
+	var user *entity.User
+	err := r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		updated, err := sqlExec(ctx, tx, `UPDATE users SET dms_following_only = COALESCE($1, dms_following_only), private = COALESCE($2, private) WHERE id = $3`,
+			settings.DMsFollowingOnly, settings.Private, userID)
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrUserNotFound
+		}
+
+		user, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+sqlUserColumns+` FROM users WHERE id = $1`, userID))
+		return err
+	})
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update settings of user %s: %w", userID, err)
+	}
+
+	return user, nil
+}
+
+// GetBlockedIDs returns the ids of the users a user blocked
+func (r *SQLUserRepository) GetBlockedIDs(ctx context.Context, userID string) ([]string, error) {
+	return r.edgeIDs(ctx, sqlBlocks, userID)
+}
+
+// GetMutedIDs returns the ids of the users a user muted
+func (r *SQLUserRepository) GetMutedIDs(ctx context.Context, userID string) ([]string, error) {
+	return r.edgeIDs(ctx, sqlMutes, userID)
+}
+
+// GetBlockerIDs returns which of the candidates blocked a user
+func (r *SQLUserRepository) GetBlockerIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error) {
+	return r.candidates(ctx, `SELECT blocker_id FROM blocks WHERE blocked_id = $1 AND blocker_id IN (%s)`, userID, candidateIDs)
+}
+
+// GetFollowedIDs returns which of the candidates a user follows
+func (r *SQLUserRepository) GetFollowedIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error) {
+	return r.candidates(ctx, `SELECT followed_id FROM follows WHERE follower_id = $1 AND followed_id IN (%s)`, userID, candidateIDs)
+}
+
+// candidates returns which of the candidates the query selects. The query
+// gets the user as $1 and the candidates in place of %s.
+func (r *SQLUserRepository) candidates(ctx context.Context, query, userID string, candidateIDs []string) (map[string]bool, error) {
+	matches := map[string]bool{}
+	if len(candidateIDs) == 0 {
+		return matches, nil
+	}
+
+	placeholders, args := sqlIn(2, candidateIDs)
+	ids, err := sqlQuery(ctx, r.Store.DB, scanString, fmt.Sprintf(query, placeholders), append([]any{userID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check candidates of user %s: %w", userID, err)
+	}
+
+	for _, id := range ids {
+		matches[id] = true
+	}
+
+	return matches, nil
+}
+
+// Block stores a block and removes the follow edges and requests between both
+// users together with their counters
+func (r *SQLUserRepository) Block(ctx context.Context, block *entity.Block) error {
+	if block == nil {
+		return fmt.Errorf("input block cannot be nil")
+	}
+
+	blockerID := strings.TrimPrefix(block.PK, "user#")
+	blockedID := block.BlockedID
+
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		err := r.putEdge(ctx, tx, sqlBlocks, blockerID, blockedID, ErrAlreadyBlocked)
+		if err != nil {
+			return err
+		}
+
+		for _, edge := range [][2]string{{blockerID, blockedID}, {blockedID, blockerID}} {
+			_, err := r.unfollow(ctx, tx, edge[0], edge[1])
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, edge[1], edge[0])
+			if err != nil {
+				return fmt.Errorf("failed to delete follow request: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLUserRepository) Unblock(ctx context.Context, blockerID, blockedID string) error {
+	return r.deleteEdge(ctx, sqlBlocks, blockerID, blockedID, ErrNotBlocked)
+}
+
+// Mute stores a mute if the muted user exists
+func (r *SQLUserRepository) Mute(ctx context.Context, mute *entity.Mute) error {
+	if mute == nil {
+		return fmt.Errorf("input mute cannot be nil")
+	}
+
+	muterID := strings.TrimPrefix(mute.PK, "user#")
+
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		return r.putEdge(ctx, tx, sqlMutes, muterID, mute.MutedID, ErrAlreadyMuted)
+	})
+}
+
+func (r *SQLUserRepository) Unmute(ctx context.Context, muterID, mutedID string) error {
+	return r.deleteEdge(ctx, sqlMutes, muterID, mutedID, ErrNotMuted)
+}
+
+// putEdge stores an edge to an existing user, or returns exists if there
+// already is one
+func (r *SQLUserRepository) putEdge(ctx context.Context, tx *sql.Tx, edge sqlEdge, userID, otherID string, exists error) error {
+	found, err := sqlExists(ctx, tx, `SELECT 1 FROM users WHERE id = $1`, otherID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+
+	inserted, err := sqlExec(ctx, tx, fmt.Sprintf(`INSERT INTO %s (%s, %s, timestamp) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, edge.table, edge.userColumn, edge.otherColumn),
+		userID, otherID, sqlTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return exists
+	}
+
+	return nil
+}
+
+func (r *SQLUserRepository) deleteEdge(ctx context.Context, edge sqlEdge, userID, otherID string, notFound error) error {
+	deleted, err := sqlExec(ctx, r.Store.DB, fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND %s = $2`, edge.table, edge.userColumn, edge.otherColumn), userID, otherID)
+	if err != nil {
+		return fmt.Errorf("failed to delete from %s: %w", edge.table, err)
+	}
+	if deleted == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+func (r *SQLUserRepository) CreateFollowRequest(ctx context.Context, request *entity.FollowRequest) error {
+	if request == nil {
+		return fmt.Errorf("input follow request cannot be nil")
+	}
+
+	userID := strings.TrimPrefix(request.PK, "user#")
+
+	inserted, err := sqlExec(ctx, r.Store.DB, `INSERT INTO follow_requests (user_id, requester_id, timestamp) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		userID, request.RequesterID, sqlTime(request.Timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to insert follow request: %w", err)
+	}
+	if inserted == 0 {
+		return ErrAlreadyRequested
+	}
+
+	return nil
+}
+
+// GetFollowRequestsPage returns one page of the pending follow requests of a
+// user
+func (r *SQLUserRepository) GetFollowRequestsPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.FollowRequest, string, error) {
+	after, err := sqlAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	requests, err := sqlQuery(ctx, r.Store.DB, func(row sqlScanner) (*entity.FollowRequest, error) {
+		request, _ := entity.NewFollowRequest("", userID)
+		err := row.Scan(&request.RequesterID, &request.Timestamp)
+		request.SK = "follow_request#" + request.RequesterID
+		return request, err
+	}, `SELECT requester_id, timestamp FROM follow_requests WHERE user_id = $1 AND requester_id > $2 ORDER BY requester_id LIMIT $3`,
+		userID, after, max(limit, 0)+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get follow requests of user %s: %w", userID, err)
+	}
+
+	return sqlPage(requests, func(request *entity.FollowRequest) string { return request.RequesterID }, limit)
+}
+
+// ApproveFollowRequest replaces a pending request with the follow edge
+func (r *SQLUserRepository) ApproveFollowRequest(ctx context.Context, follow *entity.Follow, follower *entity.Follower) error {
+	if follow == nil || follower == nil {
+		return fmt.Errorf("input follow cannot be nil")
+	}
+
+	return r.Store.inTx(ctx, func(tx *sql.Tx) error {
+		deleted, err := sqlExec(ctx, tx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, follow.FollowedID, follower.FollowerID)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrRequestNotFound
+		}
+
+		return r.follow(ctx, tx, follower.FollowerID, follow.FollowedID)
+	})
+}
+
+// DeleteFollowRequest rejects or withdraws a pending request
+func (r *SQLUserRepository) DeleteFollowRequest(ctx context.Context, userID, requesterID string) error {
+	return r.deleteEdge(ctx, sqlFollowRequests, userID, requesterID, ErrRequestNotFound)
+}
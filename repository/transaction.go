@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrAlreadyFollowing   = errors.New("already following this user")
+	ErrNotFollowing       = errors.New("not following this user")
+	ErrPostNotFound       = errors.New("post not found")
+	ErrAlreadyLiked       = errors.New("post already liked")
+	ErrNotLiked           = errors.New("post not liked")
+	ErrCommentNotFound    = errors.New("comment not found")
+	ErrCommentHasReplies  = errors.New("comment has replies")
+	ErrHandleTaken        = errors.New("handle already taken")
+	ErrConversationExists = errors.New("conversation already exists")
+	ErrAlreadyBlocked     = errors.New("user already blocked")
+	ErrNotBlocked         = errors.New("user not blocked")
+	ErrAlreadyMuted       = errors.New("user already muted")
+	ErrNotMuted           = errors.New("user not muted")
+	ErrAlreadyRequested   = errors.New("follow already requested")
+	ErrRequestNotFound    = errors.New("follow request not found")
+	ErrBlobNotFound       = errors.New("blob not found")
+	ErrInvalidImage       = errors.New("invalid image")
+)
+
+func userKey(userID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "user"},
+		"sk": &types.AttributeValueMemberS{Value: userID},
+	}
+}
+
+func handleKey(handle string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "handle"},
+		"sk": &types.AttributeValueMemberS{Value: handle},
+	}
+}
+
+func postKey(userID, postID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "user#" + userID},
+		"sk": &types.AttributeValueMemberS{Value: "post#" + postID},
+	}
+}
+
+func commentKey(postID, commentID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "post#" + postID},
+		"sk": &types.AttributeValueMemberS{Value: "comment#" + commentID},
+	}
+}
+
+// counterUpdate adds delta to a counter on the item with the given key. The
+// update fails the surrounding transaction if the item does not exist.
+func counterUpdate(tableName string, key map[string]types.AttributeValue, counter string, delta int) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:           aws.String(tableName),
+			Key:                 key,
+			UpdateExpression:    aws.String("ADD #counter :delta"),
+			ConditionExpression: aws.String("attribute_exists(pk)"),
+			ExpressionAttributeNames: map[string]string{
+				"#counter": counter,
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":delta": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+			},
+		},
+	}
+}
+
+// conditionFailedAt reports whether a transaction was canceled because the
+// condition of the item at the given index failed.
+func conditionFailedAt(err error, index int) bool {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) || index >= len(canceled.CancellationReasons) {
+		return false
+	}
+
+	code := canceled.CancellationReasons[index].Code
+	return code != nil && *code == "ConditionalCheckFailed"
+}
+
+// A transaction can write at most 100 items
+const maxTransactItems = 100
@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -13,11 +15,34 @@ import (
 
 type UserRepository interface {
 	Create(ctx context.Context, user *entity.User) (*entity.User, error)
+	ClaimHandle(ctx context.Context, userID, handle string) error
+	GetIDsByHandles(ctx context.Context, handles []string) (map[string]string, error)
 	GetByID(ctx context.Context, id string) (*entity.User, error)
 	GetAll(ctx context.Context) ([]*entity.User, error)
-	GetFollowing(ctx context.Context) ([]*entity.Follow, error)
-	Follow(ctx context.Context, follow *entity.Follow) (*entity.Follow, error)
-	Unfollow(ctx context.Context, unfollow *entity.Unfollow) (error)
+	GetFollowing(ctx context.Context, userID string) ([]*entity.Follow, error)
+	GetFollowers(ctx context.Context, userID string) ([]*entity.Follower, error)
+	GetFollowerIDs(ctx context.Context, userID string) ([]string, error)
+	IsFollowing(ctx context.Context, followerID, followingID string) (bool, error)
+	GetFollowedIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error)
+	IsBlocked(ctx context.Context, blockerID, blockedID string) (bool, error)
+	IsMuted(ctx context.Context, muterID, mutedID string) (bool, error)
+	GetBlockedIDs(ctx context.Context, userID string) ([]string, error)
+	GetMutedIDs(ctx context.Context, userID string) ([]string, error)
+	GetBlockerIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error)
+	GetFollowingPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follow, string, error)
+	GetFollowersPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follower, string, error)
+	GetByIDs(ctx context.Context, ids []string) ([]*entity.User, error)
+	Follow(ctx context.Context, follow *entity.Follow, follower *entity.Follower) (*entity.Follow, error)
+	Unfollow(ctx context.Context, unfollow *entity.Unfollow, removeFollower *entity.Unfollow) error
+	UpdateSettings(ctx context.Context, userID string, settings *entity.UserSettings) (*entity.User, error)
+	Block(ctx context.Context, block *entity.Block) error
+	Unblock(ctx context.Context, blockerID, blockedID string) error
+	Mute(ctx context.Context, mute *entity.Mute) error
+	Unmute(ctx context.Context, muterID, mutedID string) error
+	CreateFollowRequest(ctx context.Context, request *entity.FollowRequest) error
+	GetFollowRequestsPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.FollowRequest, string, error)
+	ApproveFollowRequest(ctx context.Context, follow *entity.Follow, follower *entity.Follower) error
+	DeleteFollowRequest(ctx context.Context, userID, requesterID string) error
 }
 
 type DefaultUserRepository struct {
@@ -42,12 +67,38 @@ func (r *DefaultUserRepository) Create(ctx context.Context, user *entity.User) (
 		return nil, fmt.Errorf("failed to marshal user to DynamoDB attribute values: %w", err)
 	}
 
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(r.TableName),
+	if user.Handle == "" {
+		input := &dynamodb.PutItemInput{
+			Item:      av,
+			TableName: aws.String(r.TableName),
+		}
+
+		_, err = r.DB.PutItem(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", user.PK, err)
+		}
+
+		return user, nil
 	}
 
-	_, err = r.DB.PutItem(ctx, input)
+	handleAv, err := attributevalue.MarshalMap(entity.NewUserHandle(user.Handle, user.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal handle to DynamoDB attribute values: %w", err)
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{Item: av, TableName: aws.String(r.TableName)}},
+			{Put: &types.Put{
+				Item:                handleAv,
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+		},
+	})
+	if conditionFailedAt(err, 1) {
+		return nil, ErrHandleTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", user.PK, err)
 	}
@@ -55,6 +106,79 @@ func (r *DefaultUserRepository) Create(ctx context.Context, user *entity.User) (
 	return user, nil
 }
 
+// ClaimHandle reserves a handle for an existing user without one
+func (r *DefaultUserRepository) ClaimHandle(ctx context.Context, userID, handle string) error {
+	handleAv, err := attributevalue.MarshalMap(entity.NewUserHandle(handle, userID))
+	if err != nil {
+		return fmt.Errorf("failed to marshal handle to DynamoDB attribute values: %w", err)
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				Item:                handleAv,
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+			{Update: &types.Update{
+				TableName:           aws.String(r.TableName),
+				Key:                 userKey(userID),
+				UpdateExpression:    aws.String("SET handle = :handle"),
+				ConditionExpression: aws.String("attribute_exists(pk) AND attribute_not_exists(handle)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":handle": &types.AttributeValueMemberS{Value: handle},
+				},
+			}},
+		},
+	})
+	switch {
+	case conditionFailedAt(err, 0):
+		return ErrHandleTaken
+	case conditionFailedAt(err, 1):
+		return ErrUserNotFound
+	case err != nil:
+		return fmt.Errorf("failed to claim handle %s: %w", handle, err)
+	}
+
+	return nil
+}
+
+// GetIDsByHandles maps the given handles to the ids of their users. Handles
+// nobody uses are left out.
+func (r *DefaultUserRepository) GetIDsByHandles(ctx context.Context, handles []string) (map[string]string, error) {
+	ids := map[string]string{}
+	if len(handles) == 0 {
+		return ids, nil
+	}
+
+	keys := make([]map[string]types.AttributeValue, 0, len(handles))
+	seen := map[string]bool{}
+	for _, handle := range handles {
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		keys = append(keys, handleKey(handle))
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch get handles: %w", err)
+	}
+
+	var userHandles []*entity.UserHandle
+	err = attributevalue.UnmarshalListOfMaps(items, &userHandles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	for _, userHandle := range userHandles {
+		ids[userHandle.SK] = userHandle.UserID
+	}
+
+	return ids, nil
+}
+
 func (r *DefaultUserRepository) GetByID(ctx context.Context, id string) (*entity.User, error) {
 	key := map[string]types.AttributeValue{
 		"pk": &types.AttributeValueMemberS{Value: "user"},
@@ -149,51 +273,695 @@ func (r *DefaultUserRepository) GetFollowing(ctx context.Context, userID string)
     return followers, nil
 }
 
-func (r *DefaultUserRepository) Follow(ctx context.Context, follow *entity.Follow) (*entity.Follow, error) {
-	if follow == nil {
+func (r *DefaultUserRepository) GetFollowers(ctx context.Context, userID string) ([]*entity.Follower, error) {
+	var allRawItems []map[string]types.AttributeValue
+	var followers []*entity.Follower
+
+	partitionKey := "user#" + userID
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: "followed_by#"},
+		},
+	}
+
+	paginator := dynamodb.NewQueryPaginator(r.DB, input)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next page of query results for user %s: %w", userID, err)
+		}
+		allRawItems = append(allRawItems, page.Items...)
+	}
+
+	err := attributevalue.UnmarshalListOfMaps(allRawItems, &followers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB items into Follower struct: %w", err)
+	}
+
+	return followers, nil
+}
+
+// GetFollowerIDs returns the ids of all followers of a user
+func (r *DefaultUserRepository) GetFollowerIDs(ctx context.Context, userID string) ([]string, error) {
+	followers, err := r.GetFollowers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(followers))
+	for _, follower := range followers {
+		ids = append(ids, follower.FollowerID)
+	}
+
+	return ids, nil
+}
+
+// IsFollowing reports whether one user follows another
+func (r *DefaultUserRepository) IsFollowing(ctx context.Context, followerID, followingID string) (bool, error) {
+	return r.hasEdge(ctx, followerID, "follower#", followingID)
+}
+
+// IsBlocked reports whether one user blocked another
+func (r *DefaultUserRepository) IsBlocked(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	return r.hasEdge(ctx, blockerID, "block#", blockedID)
+}
+
+// IsMuted reports whether one user muted another
+func (r *DefaultUserRepository) IsMuted(ctx context.Context, muterID, mutedID string) (bool, error) {
+	return r.hasEdge(ctx, muterID, "mute#", mutedID)
+}
+
+// hasEdge reports whether the partition of a user holds the edge with the
+// given prefix to another user
+func (r *DefaultUserRepository) hasEdge(ctx context.Context, userID, prefix, otherID string) (bool, error) {
+	result, err := r.DB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.TableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "user#" + userID},
+			"sk": &types.AttributeValueMemberS{Value: prefix + otherID},
+		},
+		ProjectionExpression: aws.String("pk"),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get edge %s%s of user %s: %w", prefix, otherID, userID, err)
+	}
+
+	return result.Item != nil, nil
+}
+
+func (r *DefaultUserRepository) GetFollowingPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follow, string, error) {
+	var following []*entity.Follow
+
+	items, nextCursor, err := r.queryEdgePage(ctx, userID, "follower#", limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = attributevalue.UnmarshalListOfMaps(items, &following)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items into Follow struct: %w", err)
+	}
+
+	return following, nextCursor, nil
+}
+
+func (r *DefaultUserRepository) GetFollowersPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.Follower, string, error) {
+	var followers []*entity.Follower
+
+	items, nextCursor, err := r.queryEdgePage(ctx, userID, "followed_by#", limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = attributevalue.UnmarshalListOfMaps(items, &followers)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items into Follower struct: %w", err)
+	}
+
+	return followers, nextCursor, nil
+}
+
+// queryEdgePage reads one page of the items with the given sort key prefix
+// from the partition of a user
+func (r *DefaultUserRepository) queryEdgePage(ctx context.Context, userID, prefix string, limit int32, cursor string) ([]map[string]types.AttributeValue, string, error) {
+	partitionKey := "user#" + userID
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: partitionKey},
+			":sk_prefix": &types.AttributeValueMemberS{Value: prefix},
+		},
+		Limit: aws.Int32(limit),
+	}
+
+	if cursor != "" {
+		values, err := DecodeCursor(cursor, "pk", "sk")
+		if err != nil {
+			return nil, "", err
+		}
+		if values["pk"] != partitionKey || !strings.HasPrefix(values["sk"], prefix) {
+			return nil, "", ErrInvalidCursor
+		}
+		input.ExclusiveStartKey = toKey(values)
+	}
+
+	result, err := r.DB.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query %s items of user %s: %w", prefix, userID, err)
+	}
+
+	nextCursor, err := EncodeCursor(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return result.Items, nextCursor, nil
+}
+
+// GetByIDs returns the users with the given ids in the same order. Users that
+// do not exist are left out.
+func (r *DefaultUserRepository) GetByIDs(ctx context.Context, ids []string) ([]*entity.User, error) {
+	if len(ids) == 0 {
+		return []*entity.User{}, nil
+	}
+
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		keys = append(keys, userKey(id))
+	}
+
+	allRawItems, err := batchGetItems(ctx, r.DB, r.TableName, keys, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch get users: %w", err)
+	}
+
+	var users []*entity.User
+	err = attributevalue.UnmarshalListOfMaps(allRawItems, &users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB items: %w", err)
+	}
+
+	usersByID := make(map[string]*entity.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	ordered := make([]*entity.User, 0, len(users))
+	for _, id := range ids {
+		if user, ok := usersByID[id]; ok {
+			ordered = append(ordered, user)
+		}
+	}
+
+	return ordered, nil
+}
+
+// Follow stores the follow edge together with its mirrored Follower item and
+// updates the counters of both users
+func (r *DefaultUserRepository) Follow(ctx context.Context, follow *entity.Follow, follower *entity.Follower) (*entity.Follow, error) {
+	if follow == nil || follower == nil {
 		return nil, fmt.Errorf("input follow cannot be nil")
 	}
 
-	av, err := attributevalue.MarshalMap(follow)
+	followAv, err := attributevalue.MarshalMap(follow)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal follow to DynamoDB attribute values: %w", err)
 	}
 
-	input := &dynamodb.PutItemInput{
-		Item:      av,
+	followerAv, err := attributevalue.MarshalMap(follower)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal follower to DynamoDB attribute values: %w", err)
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: r.followItems(followAv, followerAv, follow, follower),
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, input)
+	switch {
+	case conditionFailedAt(err, 0):
+		return nil, ErrAlreadyFollowing
+	case conditionFailedAt(err, 3):
+		return nil, ErrUserNotFound
+	case err != nil:
+		return nil, fmt.Errorf("failed to write follow (PK: %s) to DynamoDB: %w", follow.PK, err)
+	}
+
+	return follow, nil
+}
+
+// followItems writes a follow edge with its mirrored Follower item and
+// updates the counters of both users
+func (r *DefaultUserRepository) followItems(followAv, followerAv map[string]types.AttributeValue, follow *entity.Follow, follower *entity.Follower) []types.TransactWriteItem {
+	return []types.TransactWriteItem{
+		{Put: &types.Put{
+			Item:                followAv,
+			TableName:           aws.String(r.TableName),
+			ConditionExpression: aws.String("attribute_not_exists(pk)"),
+		}},
+		{Put: &types.Put{Item: followerAv, TableName: aws.String(r.TableName)}},
+		counterUpdate(r.TableName, userKey(follower.FollowerID), "following_count", 1),
+		// Also makes sure that the followed user exists
+		counterUpdate(r.TableName, userKey(follow.FollowedID), "followers_count", 1),
+	}
+}
+
+// Unfollow removes the follow edge together with its mirrored Follower item
+// and updates the counters of both users
+func (r *DefaultUserRepository) Unfollow(ctx context.Context, unfollow *entity.Unfollow, removeFollower *entity.Unfollow) error {
+	if unfollow == nil || removeFollower == nil {
+		return fmt.Errorf("input unfollow cannot be nil")
+	}
+
+	followerID := strings.TrimPrefix(unfollow.PK, "user#")
+	followingID := strings.TrimPrefix(removeFollower.PK, "user#")
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				Key:                 unfollowKey(unfollow),
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			}},
+			{Delete: &types.Delete{Key: unfollowKey(removeFollower), TableName: aws.String(r.TableName)}},
+			counterUpdate(r.TableName, userKey(followerID), "following_count", -1),
+			counterUpdate(r.TableName, userKey(followingID), "followers_count", -1),
+		},
+	}
+
+	_, err := r.DB.TransactWriteItems(ctx, input)
+	switch {
+	case conditionFailedAt(err, 0):
+		return ErrNotFollowing
+	case err != nil:
+		return fmt.Errorf("failed to delete follow (PK: %s) from DynamoDB: %w", unfollow.PK, err)
+	}
+
+	return nil
+}
+
+func unfollowKey(unfollow *entity.Unfollow) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: unfollow.PK},
+		"sk": &types.AttributeValueMemberS{Value: unfollow.SK},
+	}
+}
+
+// UpdateSettings changes the settings that are set and returns the updated user
+func (r *DefaultUserRepository) UpdateSettings(ctx context.Context, userID string, settings *entity.UserSettings) (*entity.User, error) {
+	if settings == nil {
+		return nil, fmt.Errorf("input settings cannot be nil")
+	}
+
+	var assignments []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+
+	if settings.DMsFollowingOnly != nil {
+		assignments = append(assignments, "dms_following_only = :dms_following_only")
+		values[":dms_following_only"] = &types.AttributeValueMemberBOOL{Value: *settings.DMsFollowingOnly}
+	}
+
+	if settings.Private != nil {
+		assignments = append(assignments, "#private = :private")
+		names["#private"] = "private"
+		values[":private"] = &types.AttributeValueMemberBOOL{Value: *settings.Private}
+	}
+
+	if len(assignments) == 0 {
+		user, err := r.GetByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.TableName),
+		Key:                       userKey(userID),
+		UpdateExpression:          aws.String("SET " + strings.Join(assignments, ", ")),
+		ConditionExpression:       aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	}
+	// DynamoDB rejects an empty map of names
+	if len(names) > 0 {
+		input.ExpressionAttributeNames = names
+	}
+
+	result, err := r.DB.UpdateItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update settings of user %s: %w", userID, err)
+	}
+
+	var user entity.User
+	err = attributevalue.UnmarshalMap(result.Attributes, &user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DynamoDB item (pk: user, sk: %s): %w", userID, err)
+	}
+
+	return &user, nil
+}
+
+// GetBlockedIDs returns the ids of the users a user blocked
+func (r *DefaultUserRepository) GetBlockedIDs(ctx context.Context, userID string) ([]string, error) {
+	return r.getEdgeIDs(ctx, userID, "block#")
+}
+
+// GetMutedIDs returns the ids of the users a user muted
+func (r *DefaultUserRepository) GetMutedIDs(ctx context.Context, userID string) ([]string, error) {
+	return r.getEdgeIDs(ctx, userID, "mute#")
+}
+
+func (r *DefaultUserRepository) getEdgeIDs(ctx context.Context, userID, prefix string) ([]string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :sk_prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":        &types.AttributeValueMemberS{Value: "user#" + userID},
+			":sk_prefix": &types.AttributeValueMemberS{Value: prefix},
+		},
+		ProjectionExpression: aws.String("id"),
+	}
+
+	paginator := dynamodb.NewQueryPaginator(r.DB, input)
+
+	var ids []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next page of query results for user %s: %w", userID, err)
+		}
+		for _, item := range page.Items {
+			if id, ok := item["id"].(*types.AttributeValueMemberS); ok {
+				ids = append(ids, id.Value)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// GetBlockerIDs returns which of the candidates blocked a user
+func (r *DefaultUserRepository) GetBlockerIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(candidateIDs))
+	seen := map[string]bool{}
+	for _, candidateID := range candidateIDs {
+		if seen[candidateID] {
+			continue
+		}
+		seen[candidateID] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "user#" + candidateID},
+			"sk": &types.AttributeValueMemberS{Value: "block#" + userID},
+		})
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, aws.String("pk"))
+	if err != nil {
+		return nil, err
+	}
+
+	blockers := make(map[string]bool, len(items))
+	for _, item := range items {
+		if pk, ok := item["pk"].(*types.AttributeValueMemberS); ok {
+			blockers[strings.TrimPrefix(pk.Value, "user#")] = true
+		}
+	}
+
+	return blockers, nil
+}
+
+// Number of times a block is retried when a follow edge changed meanwhile
+const blockAttempts = 3
+
+// Block stores a block and removes the follow edges and requests between both
+// users together with their counters
+func (r *DefaultUserRepository) Block(ctx context.Context, block *entity.Block) error {
+	if block == nil {
+		return fmt.Errorf("input block cannot be nil")
+	}
+
+	blockerID := strings.TrimPrefix(block.PK, "user#")
+	blockedID := block.BlockedID
+
+	av, err := attributevalue.MarshalMap(block)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block to DynamoDB attribute values: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		transactItems := []types.TransactWriteItem{
+			{Put: &types.Put{
+				Item:                av,
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+			{ConditionCheck: &types.ConditionCheck{
+				Key:                 userKey(blockedID),
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			}},
+		}
+
+		for _, edge := range [][2]string{{blockerID, blockedID}, {blockedID, blockerID}} {
+			followerID, followingID := edge[0], edge[1]
+
+			following, err := r.IsFollowing(ctx, followerID, followingID)
+			if err != nil {
+				return err
+			}
+			if !following {
+				continue
+			}
+
+			unfollow, _ := entity.NewUnfollow(followerID, followingID)
+			removeFollower, _ := entity.NewRemoveFollower(followerID, followingID)
+			transactItems = append(transactItems,
+				types.TransactWriteItem{Delete: &types.Delete{
+					Key:                 unfollowKey(unfollow),
+					TableName:           aws.String(r.TableName),
+					ConditionExpression: aws.String("attribute_exists(pk)"),
+				}},
+				types.TransactWriteItem{Delete: &types.Delete{Key: unfollowKey(removeFollower), TableName: aws.String(r.TableName)}},
+				counterUpdate(r.TableName, userKey(followerID), "following_count", -1),
+				counterUpdate(r.TableName, userKey(followingID), "followers_count", -1),
+			)
+		}
+
+		// Pending follow requests go away as well
+		for _, edge := range [][2]string{{blockerID, blockedID}, {blockedID, blockerID}} {
+			transactItems = append(transactItems, types.TransactWriteItem{Delete: &types.Delete{
+				Key:       followRequestKey(edge[1], edge[0]),
+				TableName: aws.String(r.TableName),
+			}})
+		}
+
+		_, err := r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+		switch {
+		case err == nil:
+			return nil
+		case conditionFailedAt(err, 0):
+			return ErrAlreadyBlocked
+		case conditionFailedAt(err, 1):
+			return ErrUserNotFound
+		}
+
+		// One of the users unfollowed the other meanwhile
+		var canceled *types.TransactionCanceledException
+		if !errors.As(err, &canceled) || attempt == blockAttempts {
+			return fmt.Errorf("failed to write block (PK: %s) to DynamoDB: %w", block.PK, err)
+		}
+	}
+}
+
+func (r *DefaultUserRepository) Unblock(ctx context.Context, blockerID, blockedID string) error {
+	return r.deleteEdge(ctx, blockerID, "block#", blockedID, ErrNotBlocked)
+}
+
+// Mute stores a mute if the muted user exists
+func (r *DefaultUserRepository) Mute(ctx context.Context, mute *entity.Mute) error {
+	if mute == nil {
+		return fmt.Errorf("input mute cannot be nil")
+	}
+
+	av, err := attributevalue.MarshalMap(mute)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mute to DynamoDB attribute values: %w", err)
+	}
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				Item:                av,
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+			{ConditionCheck: &types.ConditionCheck{
+				Key:                 userKey(mute.MutedID),
+				TableName:           aws.String(r.TableName),
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			}},
+		},
+	})
+	switch {
+	case conditionFailedAt(err, 0):
+		return ErrAlreadyMuted
+	case conditionFailedAt(err, 1):
+		return ErrUserNotFound
+	case err != nil:
+		return fmt.Errorf("failed to write mute (PK: %s) to DynamoDB: %w", mute.PK, err)
+	}
+
+	return nil
+}
+
+func (r *DefaultUserRepository) Unmute(ctx context.Context, muterID, mutedID string) error {
+	return r.deleteEdge(ctx, muterID, "mute#", mutedID, ErrNotMuted)
+}
+
+// deleteEdge removes an edge from the partition of a user, or returns
+// notFound if there is none
+func (r *DefaultUserRepository) deleteEdge(ctx context.Context, userID, prefix, otherID string, notFound error) error {
+	_, err := r.DB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(r.TableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "user#" + userID},
+			"sk": &types.AttributeValueMemberS{Value: prefix + otherID},
+		},
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return notFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete edge %s%s of user %s: %w", prefix, otherID, userID, err)
 	}
 
-	_, err = r.DB.PutItem(ctx, input)
+	return nil
+}
+
+// GetFollowedIDs returns which of the candidates a user follows
+func (r *DefaultUserRepository) GetFollowedIDs(ctx context.Context, userID string, candidateIDs []string) (map[string]bool, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(candidateIDs))
+	seen := map[string]bool{}
+	for _, candidateID := range candidateIDs {
+		if seen[candidateID] {
+			continue
+		}
+		seen[candidateID] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "user#" + userID},
+			"sk": &types.AttributeValueMemberS{Value: "follower#" + candidateID},
+		})
+	}
+
+	items, err := batchGetItems(ctx, r.DB, r.TableName, keys, aws.String("id"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to put item (PK: %s) to DynamoDB: %w", follow.PK, err)
+		return nil, err
 	}
 
-	return follow, nil
+	followed := make(map[string]bool, len(items))
+	for _, item := range items {
+		if id, ok := item["id"].(*types.AttributeValueMemberS); ok {
+			followed[id.Value] = true
+		}
+	}
+
+	return followed, nil
 }
 
-func (r *DefaultUserRepository) Unfollow(ctx context.Context, unfollow *entity.Unfollow) error {
-    if unfollow == nil {
-        return fmt.Errorf("input unfollow cannot be nil")
-    }
+func followRequestKey(userID, requesterID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "user#" + userID},
+		"sk": &types.AttributeValueMemberS{Value: "follow_request#" + requesterID},
+	}
+}
 
-    key, err := attributevalue.MarshalMap(map[string]interface{}{
-        "pk": unfollow.PK,
-        "sk": unfollow.SK,
-    })
-    if err != nil {
-        return fmt.Errorf("failed to marshal key: %w", err)
-    }
+func (r *DefaultUserRepository) CreateFollowRequest(ctx context.Context, request *entity.FollowRequest) error {
+	if request == nil {
+		return fmt.Errorf("input follow request cannot be nil")
+	}
 
-    input := &dynamodb.DeleteItemInput{
-        Key:       key,
-        TableName: aws.String(r.TableName),
-    }
+	av, err := attributevalue.MarshalMap(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal follow request to DynamoDB attribute values: %w", err)
+	}
 
-    _, err = r.DB.DeleteItem(ctx, input)
-    if err != nil {
-        return fmt.Errorf("failed to delete item (PK: %s) from DynamoDB: %w", unfollow.PK, err)
-    }
+	_, err = r.DB.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(r.TableName),
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrAlreadyRequested
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put follow request (PK: %s) to DynamoDB: %w", request.PK, err)
+	}
+
+	return nil
+}
+
+// GetFollowRequestsPage returns one page of the pending follow requests of a
+// user
+func (r *DefaultUserRepository) GetFollowRequestsPage(ctx context.Context, userID string, limit int32, cursor string) ([]*entity.FollowRequest, string, error) {
+	var requests []*entity.FollowRequest
+
+	items, nextCursor, err := r.queryEdgePage(ctx, userID, "follow_request#", limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = attributevalue.UnmarshalListOfMaps(items, &requests)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal DynamoDB items into FollowRequest struct: %w", err)
+	}
+
+	return requests, nextCursor, nil
+}
+
+// ApproveFollowRequest replaces a pending request with the follow edge
+func (r *DefaultUserRepository) ApproveFollowRequest(ctx context.Context, follow *entity.Follow, follower *entity.Follower) error {
+	if follow == nil || follower == nil {
+		return fmt.Errorf("input follow cannot be nil")
+	}
+
+	followAv, err := attributevalue.MarshalMap(follow)
+	if err != nil {
+		return fmt.Errorf("failed to marshal follow to DynamoDB attribute values: %w", err)
+	}
+
+	followerAv, err := attributevalue.MarshalMap(follower)
+	if err != nil {
+		return fmt.Errorf("failed to marshal follower to DynamoDB attribute values: %w", err)
+	}
+
+	transactItems := append(r.followItems(followAv, followerAv, follow, follower), types.TransactWriteItem{
+		Delete: &types.Delete{
+			Key:                 followRequestKey(follow.FollowedID, follower.FollowerID),
+			TableName:           aws.String(r.TableName),
+			ConditionExpression: aws.String("attribute_exists(pk)"),
+		},
+	})
+
+	_, err = r.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	switch {
+	case conditionFailedAt(err, 4):
+		return ErrRequestNotFound
+	case conditionFailedAt(err, 0):
+		return ErrAlreadyFollowing
+	case conditionFailedAt(err, 2), conditionFailedAt(err, 3):
+		return ErrUserNotFound
+	case err != nil:
+		return fmt.Errorf("failed to approve follow request (PK: %s) in DynamoDB: %w", follow.PK, err)
+	}
+
+	return nil
+}
 
-    return nil
+// DeleteFollowRequest rejects or withdraws a pending request
+func (r *DefaultUserRepository) DeleteFollowRequest(ctx context.Context, userID, requesterID string) error {
+	return r.deleteEdge(ctx, userID, "follow_request#", requesterID, ErrRequestNotFound)
 }
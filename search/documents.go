@@ -0,0 +1,91 @@
+package search
+
+import (
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// PostDocument returns the document of a post, or nil for reposts since they
+// have no text of their own
+func PostDocument(post *entity.Post) *Document {
+	if post.Reference != nil && post.Reference.Kind == entity.ReferenceRepost {
+		return nil
+	}
+
+	return &Document{
+		Type: TypePost,
+		ID:   post.ID,
+		Fields: map[string]string{
+			"text":      post.Text,
+			"user_name": post.UserName,
+		},
+		Stored: map[string]string{
+			"user_id":   post.UserID,
+			"timestamp": post.Timestamp.Format(time.RFC3339Nano),
+		},
+	}
+}
+
+// CommentDocument returns the document of a comment, or nil for placeholders
+// of deleted comments
+func CommentDocument(postId string, comment *entity.Comment) *Document {
+	if comment.Deleted {
+		return nil
+	}
+
+	return &Document{
+		Type: TypeComment,
+		ID:   comment.ID,
+		Fields: map[string]string{
+			"text":      comment.Text,
+			"user_name": comment.UserName,
+		},
+		Stored: map[string]string{
+			"post_id":   postId,
+			"parent_id": comment.ParentID,
+			"user_id":   comment.UserID,
+			"timestamp": comment.Timestamp.Format(time.RFC3339Nano),
+		},
+	}
+}
+
+func UserDocument(user *entity.User) *Document {
+	return &Document{
+		Type: TypeUser,
+		ID:   user.ID,
+		Fields: map[string]string{
+			"name": user.Name,
+		},
+		Stored: map[string]string{
+			"picture": user.Picture,
+		},
+	}
+}
+
+// PutPost indexes a post, removing it again if it is no longer searchable
+func (i *Index) PutPost(post *entity.Post) {
+	doc := PostDocument(post)
+	if doc == nil {
+		i.Delete(TypePost, post.ID)
+		return
+	}
+	i.Put(doc)
+}
+
+// PutComment indexes a comment, removing it again if it is no longer
+// searchable
+func (i *Index) PutComment(postId string, comment *entity.Comment) {
+	doc := CommentDocument(postId, comment)
+	if doc == nil {
+		i.Delete(TypeComment, comment.ID)
+		return
+	}
+	i.Put(doc)
+}
+
+// DeletePost removes a post and its comments
+func (i *Index) DeletePost(postId string) {
+	i.Delete(TypePost, postId)
+	i.DeleteWhere(TypeComment, "post_id", postId)
+}
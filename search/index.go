@@ -0,0 +1,340 @@
+package search
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Document types that can be searched
+const (
+	TypePost    = "posts"
+	TypeUser    = "users"
+	TypeComment = "comments"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document is a single searchable item. Fields are tokenized and highlighted,
+// Stored values are only returned with the results.
+type Document struct {
+	Type   string
+	ID     string
+	Fields map[string]string
+	Stored map[string]string
+	Length int
+}
+
+type Hit struct {
+	Document   *Document
+	Score      float64
+	Highlights map[string]string
+}
+
+type Result struct {
+	Total int
+	Hits  []*Hit
+}
+
+// segment holds the documents and postings of one document type
+type segment struct {
+	Documents   map[string]*Document
+	Postings    map[string]map[string]int
+	TotalLength int
+}
+
+func newSegment() *segment {
+	return &segment{
+		Documents: map[string]*Document{},
+		Postings:  map[string]map[string]int{},
+	}
+}
+
+// Index is an in-memory inverted index that can be persisted to a file. It is
+// safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	path     string
+	segments map[string]*segment
+	dirty    bool
+}
+
+func New() *Index {
+	return &Index{segments: map[string]*segment{}}
+}
+
+// Open loads the index stored at path. A missing file gives an empty index
+// that will be written to path on Save. An empty path keeps the index in
+// memory only.
+func Open(path string) (*Index, error) {
+	index := New()
+	index.path = path
+
+	if path == "" {
+		return index, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+	defer file.Close()
+
+	err = gob.NewDecoder(file).Decode(&index.segments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode search index: %w", err)
+	}
+
+	return index, nil
+}
+
+// Save writes the index to the file it was opened from
+func (i *Index) Save() error {
+	if i.path == "" {
+		return nil
+	}
+	return i.SaveTo(i.path)
+}
+
+// SaveTo writes the index to path. The file is replaced atomically so a crash
+// never leaves a partial index behind.
+func (i *Index) SaveTo(path string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create search index file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = gob.NewEncoder(tmp).Encode(i.segments)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode search index: %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to replace search index: %w", err)
+	}
+
+	i.dirty = false
+	return nil
+}
+
+// AutoSave saves the index every interval if it was changed, until the
+// context is done. Changes since the last save are saved before it returns.
+func (i *Index) AutoSave(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			i.saveIfDirty()
+			return
+		case <-ticker.C:
+			i.saveIfDirty()
+		}
+	}
+}
+
+func (i *Index) saveIfDirty() {
+	i.mu.RLock()
+	dirty := i.dirty
+	i.mu.RUnlock()
+
+	if !dirty {
+		return
+	}
+
+	err := i.Save()
+	if err != nil {
+		log.Printf("failed to save search index: %v", err)
+	}
+}
+
+// Put adds the document to the index, replacing an older version with the
+// same type and id
+func (i *Index) Put(doc *Document) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	seg, ok := i.segments[doc.Type]
+	if !ok {
+		seg = newSegment()
+		i.segments[doc.Type] = seg
+	}
+
+	seg.remove(doc.ID)
+
+	frequencies := map[string]int{}
+	doc.Length = 0
+	for _, text := range doc.Fields {
+		for _, token := range tokenize(text) {
+			frequencies[token.term]++
+			doc.Length++
+		}
+	}
+
+	for term, frequency := range frequencies {
+		postings, ok := seg.Postings[term]
+		if !ok {
+			postings = map[string]int{}
+			seg.Postings[term] = postings
+		}
+		postings[doc.ID] = frequency
+	}
+
+	seg.Documents[doc.ID] = doc
+	seg.TotalLength += doc.Length
+	i.dirty = true
+}
+
+// Delete removes the document with the given type and id, if it exists
+func (i *Index) Delete(docType, id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	seg, ok := i.segments[docType]
+	if !ok {
+		return
+	}
+
+	if seg.remove(id) {
+		i.dirty = true
+	}
+}
+
+// DeleteWhere removes the documents of a type whose stored value matches
+func (i *Index) DeleteWhere(docType, field, value string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	seg, ok := i.segments[docType]
+	if !ok {
+		return
+	}
+
+	for id, doc := range seg.Documents {
+		if doc.Stored[field] == value && seg.remove(id) {
+			i.dirty = true
+		}
+	}
+}
+
+func (s *segment) remove(id string) bool {
+	doc, ok := s.Documents[id]
+	if !ok {
+		return false
+	}
+
+	for _, text := range doc.Fields {
+		for _, token := range tokenize(text) {
+			postings := s.Postings[token.term]
+			delete(postings, id)
+			if len(postings) == 0 {
+				delete(s.Postings, token.term)
+			}
+		}
+	}
+
+	delete(s.Documents, id)
+	s.TotalLength -= doc.Length
+	return true
+}
+
+// Search ranks the documents of a type that contain any of the query terms
+// with BM25 and returns the hits in [offset, offset+limit). Ties are broken
+// by id so pages stay stable.
+func (i *Index) Search(docType, query string, offset, limit int) *Result {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	result := &Result{Hits: []*Hit{}}
+
+	seg, ok := i.segments[docType]
+	if !ok || len(seg.Documents) == 0 {
+		return result
+	}
+
+	terms := uniqueTerms(query)
+	averageLength := float64(seg.TotalLength) / float64(len(seg.Documents))
+	scores := map[string]float64{}
+
+	for _, term := range terms {
+		postings := seg.Postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		n := float64(len(postings))
+		idf := math.Log(1 + (float64(len(seg.Documents))-n+0.5)/(n+0.5))
+
+		for id, frequency := range postings {
+			tf := float64(frequency)
+			length := float64(seg.Documents[id].Length)
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/averageLength))
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		if scores[ids[a]] != scores[ids[b]] {
+			return scores[ids[a]] > scores[ids[b]]
+		}
+		return ids[a] > ids[b]
+	})
+
+	result.Total = len(ids)
+	if offset >= len(ids) {
+		return result
+	}
+
+	for _, id := range ids[offset:min(offset+limit, len(ids))] {
+		doc := seg.Documents[id]
+		result.Hits = append(result.Hits, &Hit{
+			Document:   doc,
+			Score:      scores[id],
+			Highlights: highlightFields(doc.Fields, terms),
+		})
+	}
+
+	return result
+}
+
+func uniqueTerms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, token := range tokenize(query) {
+		if !seen[token.term] {
+			seen[token.term] = true
+			terms = append(terms, token.term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+)
+
+// EventName is the name of the bus events that carry changes to the index
+const EventName = "search_index"
+
+// Operations of an update
+const (
+	opPut        = "put"
+	opDelete     = "delete"
+	opDeletePost = "delete_post"
+)
+
+// update is one change to the index as it is passed between instances
+type update struct {
+	Op       string    `json:"op"`
+	Document *Document `json:"document,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	ID       string    `json:"id,omitempty"`
+}
+
+// Shared keeps the indexes of all API instances in sync. Changes are
+// published on the event bus and every instance applies them to its own
+// index, including the one that published them, so search finds a post no
+// matter which instance it was written through.
+type Shared struct {
+	index *Index
+	bus   entity.EventBus
+}
+
+// Share applies the changes published on the bus to the index
+func Share(index *Index, bus entity.EventBus) *Shared {
+	s := &Shared{index: index, bus: bus}
+	bus.Subscribe(s.apply)
+	return s
+}
+
+// PutPost indexes a post, removing it again if it is no longer searchable
+func (s *Shared) PutPost(ctx context.Context, post *entity.Post) {
+	doc := PostDocument(post)
+	if doc == nil {
+		s.publish(ctx, update{Op: opDelete, Type: TypePost, ID: post.ID})
+		return
+	}
+	s.publish(ctx, update{Op: opPut, Document: doc})
+}
+
+// PutComment indexes a comment, removing it again if it is no longer
+// searchable
+func (s *Shared) PutComment(ctx context.Context, postId string, comment *entity.Comment) {
+	doc := CommentDocument(postId, comment)
+	if doc == nil {
+		s.publish(ctx, update{Op: opDelete, Type: TypeComment, ID: comment.ID})
+		return
+	}
+	s.publish(ctx, update{Op: opPut, Document: doc})
+}
+
+func (s *Shared) PutUser(ctx context.Context, user *entity.User) {
+	s.publish(ctx, update{Op: opPut, Document: UserDocument(user)})
+}
+
+// Delete removes the document with the given type and id
+func (s *Shared) Delete(ctx context.Context, docType, id string) {
+	s.publish(ctx, update{Op: opDelete, Type: docType, ID: id})
+}
+
+// DeletePost removes a post and its comments
+func (s *Shared) DeletePost(ctx context.Context, postId string) {
+	s.publish(ctx, update{Op: opDeletePost, ID: postId})
+}
+
+func (s *Shared) publish(ctx context.Context, change update) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Printf("failed to marshal search index update: %v", err)
+		return
+	}
+
+	// The bus delivers the event to this instance as well, even when the
+	// other instances cannot be reached
+	err = s.bus.Publish(ctx, entity.SSEEvent{Name: EventName, Data: string(data), Audience: entity.ToInstances()})
+	if err != nil {
+		log.Printf("failed to publish search index update: %v", err)
+	}
+}
+
+// apply makes a change published by any instance to the local index
+func (s *Shared) apply(event entity.SSEEvent) {
+	if event.Name != EventName || event.Audience.Kind != entity.AudienceInstances {
+		return
+	}
+
+	var change update
+	err := json.Unmarshal([]byte(event.Data), &change)
+	if err != nil {
+		log.Printf("failed to unmarshal search index update: %v", err)
+		return
+	}
+
+	switch change.Op {
+	case opPut:
+		if change.Document != nil {
+			s.index.Put(change.Document)
+		}
+	case opDelete:
+		s.index.Delete(change.Type, change.ID)
+	case opDeletePost:
+		s.index.DeletePost(change.ID)
+	}
+}
+
+// Search searches the index of this instance, see Index.Search
+func (s *Shared) Search(docType, query string, offset, limit int) *Result {
+	return s.index.Search(docType, query, offset, limit)
+}
@@ -0,0 +1,113 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Highlighted terms are wrapped in these tags, the rest of the snippet is
+// HTML escaped
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+)
+
+// Number of bytes of context shown on each side of the first match
+const snippetContext = 60
+
+type token struct {
+	term  string
+	start int
+	end   int
+}
+
+// tokenize splits text into lower case words of letters and digits, keeping
+// the byte offsets of every word
+func tokenize(text string) []token {
+	var tokens []token
+
+	start := -1
+	for offset, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = offset
+		}
+		if !isWordRune && start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:offset]), start: start, end: offset})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+
+	return tokens
+}
+
+// highlightFields returns a snippet for every field that contains one of the
+// terms
+func highlightFields(fields map[string]string, terms []string) map[string]string {
+	highlights := map[string]string{}
+	for name, text := range fields {
+		snippet, ok := highlight(text, terms)
+		if ok {
+			highlights[name] = snippet
+		}
+	}
+	return highlights
+}
+
+// highlight marks the terms in a window of text around the first match
+func highlight(text string, terms []string) (string, bool) {
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	var matches []token
+	for _, token := range tokenize(text) {
+		if wanted[token.term] {
+			matches = append(matches, token)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	from := runeBoundary(text, max(0, matches[0].start-snippetContext))
+	to := runeBoundary(text, min(len(text), matches[0].end+snippetContext))
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+
+	position := from
+	for _, match := range matches {
+		if match.start < from || match.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[position:match.start]))
+		b.WriteString(highlightStart)
+		b.WriteString(html.EscapeString(text[match.start:match.end]))
+		b.WriteString(highlightEnd)
+		position = match.end
+	}
+	b.WriteString(html.EscapeString(text[position:to]))
+
+	if to < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String(), true
+}
+
+// runeBoundary moves offset back to the start of the rune it points into
+func runeBoundary(text string, offset int) int {
+	for offset > 0 && offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	return offset
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+)
+
+var ErrBlocked = errors.New("one of the users blocked the other")
+
+// checkNotBlocked returns ErrBlocked if either user blocked the other
+func checkNotBlocked(ctx context.Context, users repository.UserRepository, userId, otherId string) error {
+	for _, pair := range [][2]string{{userId, otherId}, {otherId, userId}} {
+		blocked, err := users.IsBlocked(ctx, pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// hiddenUserIDs returns the users whose posts and comments a viewer does not
+// see, because the viewer muted or blocked them
+func hiddenUserIDs(ctx context.Context, users repository.UserRepository, viewerId string) (map[string]bool, error) {
+	hidden := map[string]bool{}
+	if viewerId == "" {
+		return hidden, nil
+	}
+
+	muted, err := users.GetMutedIDs(ctx, viewerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get muted users: %w", err)
+	}
+
+	blocked, err := users.GetBlockedIDs(ctx, viewerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocked users: %w", err)
+	}
+
+	for _, id := range append(muted, blocked...) {
+		hidden[id] = true
+	}
+
+	return hidden, nil
+}
+
+// HiddenUsersFunc lets the broker leave out the live events of users a viewer
+// muted or blocked
+func HiddenUsersFunc(users repository.UserRepository) entity.HiddenFunc {
+	return func(ctx context.Context, userID string) (map[string]bool, error) {
+		return hiddenUserIDs(ctx, users, userID)
+	}
+}
+
+// withoutHiddenPosts drops the posts of hidden users. Pages may come out
+// shorter than requested, their cursors stay valid.
+func withoutHiddenPosts(posts []*entity.Post, hidden map[string]bool) []*entity.Post {
+	if len(hidden) == 0 {
+		return posts
+	}
+
+	visible := make([]*entity.Post, 0, len(posts))
+	for _, post := range posts {
+		if !hidden[post.UserID] {
+			visible = append(visible, post)
+		}
+	}
+	return visible
+}
@@ -2,87 +2,232 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
 )
 
 type CommentService interface {
 	Create(ctx context.Context, postId, userId, userName string, request *dto.SaveCommentRequest) (*dto.Comment, error)
-	GetByPostID(ctx context.Context, postId string) ([]*dto.Comment, error)
+	GetByPostID(ctx context.Context, viewerId, postId, parentId string, limit int32, cursor string) (*dto.CommentPage, error)
 	Update(ctx context.Context, postId, commentId string, request *dto.SaveCommentRequest) (*entity.Comment, error)
-	Delete(ctx context.Context, postId, commentId string) (error)
+	Delete(ctx context.Context, postId, commentId string) ([]*dto.DeletedComment, error)
 }
 
+var ErrCommentNotFound = repository.ErrCommentNotFound
+
 type DefaultCommentService struct {
-	repository repository.DefaultCommentRepository
+	repository    repository.CommentRepository
+	posts         repository.PostRepository
+	users         repository.UserRepository
+	index         *search.Shared
+	notifications NotificationService
 }
 
-func NewDefaultCommentService(repository repository.DefaultCommentRepository) *DefaultCommentService {
+func NewDefaultCommentService(repository repository.CommentRepository, posts repository.PostRepository, users repository.UserRepository, index *search.Shared, notifications NotificationService) *DefaultCommentService {
 	return &DefaultCommentService{
-		repository: repository,
+		repository:    repository,
+		posts:         posts,
+		users:         users,
+		index:         index,
+		notifications: notifications,
 	}
 }
 
 func (s *DefaultCommentService) Create(ctx context.Context, postId, userId, userName string, request *dto.SaveCommentRequest) (*dto.Comment, error) {
-	comment, err := entity.NewComment(postId, userId, userName, request.Text)
+	post, err := getVisiblePost(ctx, s.posts, s.users, userId, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNotBlocked(ctx, s.users, userId, post.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replies notify the author of the parent instead of the post author
+	notificationType := entity.NotificationComment
+	recipientId := post.UserID
+
+	if request.ParentID != "" {
+		parent, err := s.repository.Get(ctx, postId, request.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.Deleted {
+			return nil, ErrCommentNotFound
+		}
+		err = checkNotBlocked(ctx, s.users, userId, parent.UserID)
+		if err != nil {
+			return nil, err
+		}
+		notificationType = entity.NotificationReply
+		recipientId = parent.UserID
+	}
+
+	comment, err := entity.NewComment(postId, userId, userName, request.Text, request.ParentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create comment entity: %w", err)
 	}
 
+	comment.Mentions, err = resolveMentions(ctx, s.users, userId, comment.Text)
+	if err != nil {
+		return nil, err
+	}
+
 	createdComment, err := s.repository.Create(ctx, comment)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.notifications.Notify(ctx, notificationType, recipientId, userId, userName, postId, createdComment.ID)
+	if err != nil {
+		log.Printf("failed to notify user %s about comment: %v", recipientId, err)
+	}
+
+	// The recipient of the comment notification is not notified twice
+	notifyMentions(ctx, s.notifications, s.users, createdComment.Mentions, []entity.Mention{{UserID: recipientId}}, post.UserID, userId, userName, postId, createdComment.ID)
+
+	s.index.PutComment(ctx, postId, createdComment)
+
 	commentDto := new(dto.Comment)
 	commentDto.FromEntity(createdComment)
 
 	return commentDto, nil
 }
 
-func (s *DefaultCommentService) GetByPostID(ctx context.Context, postId string) ([]*dto.Comment, error) {
-	comments, err := s.repository.GetByPostID(ctx, postId)
+// GetByPostID returns a page of comments without the ones of users the viewer
+// muted or blocked. Comments on posts the viewer cannot see are not found.
+func (s *DefaultCommentService) GetByPostID(ctx context.Context, viewerId, postId, parentId string, limit int32, cursor string) (*dto.CommentPage, error) {
+	_, err := getVisiblePost(ctx, s.posts, s.users, viewerId, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, nextCursor, err := s.repository.GetPageByPostID(ctx, postId, parentId, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := hiddenUserIDs(ctx, s.users, viewerId)
 	if err != nil {
 		return nil, err
 	}
 
 	commentDtos := make([]*dto.Comment, 0, len(comments))
 	for _, comment := range comments {
+		if hidden[comment.UserID] {
+			continue
+		}
 		commentDto := new(dto.Comment)
 		commentDto.FromEntity(comment)
 		commentDtos = append(commentDtos, commentDto)
 	}
 
-	return commentDtos, nil
+	return &dto.CommentPage{Comments: commentDtos, NextCursor: nextCursor}, nil
 }
 
 func (s *DefaultCommentService) Update(ctx context.Context, postId, commentId string, request *dto.SaveCommentRequest) (*entity.Comment, error) {
-	_, err := s.repository.Get(ctx, postId, commentId)
+	comment, err := s.repository.Get(ctx, postId, commentId)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find comment to update: %w", err)
 	}
 
-	updatedComment, err := s.repository.Update(ctx, postId, commentId, request.Text)
+	if comment.Deleted {
+		return nil, fmt.Errorf("cannot find comment to update: %w", ErrCommentNotFound)
+	}
+
+	post, err := s.posts.GetByID(ctx, postId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find post of comment to update: %w", err)
+	}
+
+	mentions, err := resolveMentions(ctx, s.users, comment.UserID, request.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedComment, err := s.repository.Update(ctx, postId, commentId, request.Text, mentions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update comment: %w", err)
 	}
 
+	notifyMentions(ctx, s.notifications, s.users, updatedComment.Mentions, comment.Mentions, post.UserID, updatedComment.UserID, updatedComment.UserName, postId, commentId)
+
+	s.index.PutComment(ctx, postId, updatedComment)
+
 	return updatedComment, nil
 }
 
-func (s *DefaultCommentService) Delete(ctx context.Context, postId, commentId string) (error) {
-	_, err := s.repository.Get(ctx, postId, commentId)
+// Delete removes the comment, or keeps a placeholder when it has replies.
+// Placeholders are cleaned up once their last reply is gone. It returns every
+// comment that was removed or turned into a placeholder.
+func (s *DefaultCommentService) Delete(ctx context.Context, postId, commentId string) ([]*dto.DeletedComment, error) {
+	comment, err := s.repository.Get(ctx, postId, commentId)
 	if err != nil {
-		return fmt.Errorf("cannot find comment to delete: %w", err)
+		return nil, fmt.Errorf("cannot find comment to delete: %w", err)
+	}
+
+	if comment.Deleted {
+		return nil, fmt.Errorf("cannot find comment to delete: %w", ErrCommentNotFound)
+	}
+
+	var deleted []*dto.DeletedComment
+	for comment != nil {
+		placeholder := comment.ReplyCount > 0
+		if placeholder {
+			err = s.repository.SoftDelete(ctx, postId, comment.ID)
+		} else {
+			err = s.repository.Delete(ctx, postId, comment.ID, comment.ParentID)
+		}
+		if errors.Is(err, repository.ErrCommentHasReplies) {
+			placeholder = true
+			err = s.repository.SoftDelete(ctx, postId, comment.ID)
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		s.index.Delete(ctx, search.TypeComment, comment.ID)
+
+		deleted = append(deleted, &dto.DeletedComment{
+			ID:          comment.ID,
+			PostID:      postId,
+			ParentID:    comment.ParentID,
+			Placeholder: placeholder,
+		})
+
+		comment, err = s.deletedParent(ctx, postId, comment.ParentID)
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// deletedParent returns the parent if it is a placeholder without replies
+func (s *DefaultCommentService) deletedParent(ctx context.Context, postId, parentId string) (*entity.Comment, error) {
+	if parentId == "" {
+		return nil, nil
 	}
 
-	err = s.repository.Delete(ctx, postId, commentId)
+	parent, err := s.repository.Get(ctx, postId, parentId)
+	if errors.Is(err, ErrCommentNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete comment: %w", err)
+		return nil, fmt.Errorf("failed to get parent comment: %w", err)
+	}
+
+	if !parent.Deleted || parent.ReplyCount > 0 {
+		return nil, nil
 	}
 
-	return nil
+	return parent, nil
 }
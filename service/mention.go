@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+)
+
+// resolveMentions finds the users mentioned in a text. Handles that belong to
+// nobody or to users who blocked the author stay plain text, and only the
+// first entity.MaxMentions handles are looked up.
+func resolveMentions(ctx context.Context, users repository.UserRepository, authorId, text string) ([]entity.Mention, error) {
+	parsed := entity.ParseMentions(text)
+	if len(parsed) == 0 {
+		return nil, nil
+	}
+
+	var handles []string
+	seen := map[string]bool{}
+	for _, mention := range parsed {
+		if seen[mention.Handle] || len(handles) == entity.MaxMentions {
+			continue
+		}
+		seen[mention.Handle] = true
+		handles = append(handles, mention.Handle)
+	}
+
+	ids, err := users.GetIDsByHandles(ctx, handles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+
+	mentionedIds := make([]string, 0, len(ids))
+	for _, userId := range ids {
+		mentionedIds = append(mentionedIds, userId)
+	}
+
+	blockers, err := users.GetBlockerIDs(ctx, authorId, mentionedIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check blocks of mentioned users: %w", err)
+	}
+
+	var mentions []entity.Mention
+	for _, mention := range parsed {
+		userId, ok := ids[mention.Handle]
+		if !ok || blockers[userId] {
+			continue
+		}
+		mention.UserID = userId
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, nil
+}
+
+// notifyMentions notifies every mentioned user once. Users that were already
+// mentioned in previous are skipped, so editing a text does not notify them
+// again. Users who cannot see the posts of the post author are mentioned
+// without a notification, since they could not open the post.
+func notifyMentions(ctx context.Context, notifications NotificationService, users repository.UserRepository, mentions, previous []entity.Mention, postAuthorId, actorId, actorName, postId, commentId string) {
+	notified := map[string]bool{}
+	for _, mention := range previous {
+		notified[mention.UserID] = true
+	}
+
+	for _, mention := range mentions {
+		if notified[mention.UserID] {
+			continue
+		}
+		notified[mention.UserID] = true
+
+		err := checkCanSeePosts(ctx, users, mention.UserID, postAuthorId)
+		if errors.Is(err, ErrPrivateAccount) {
+			continue
+		}
+		if err != nil {
+			log.Printf("failed to check if user %s can see post %s: %v", mention.UserID, postId, err)
+			continue
+		}
+
+		err = notifications.Notify(ctx, entity.NotificationMention, mention.UserID, actorId, actorName, postId, commentId)
+		if err != nil {
+			log.Printf("failed to notify user %s about mention: %v", mention.UserID, err)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrInvalidParticipants  = errors.New("participants must be other existing users")
+	ErrTooManyParticipants  = fmt.Errorf("a conversation has at most %d participants", entity.MaxConversationParticipants)
+	ErrDMsRestricted        = errors.New("user only accepts messages from accounts they follow")
+	ErrInvalidMessageID     = errors.New("invalid message id")
+)
+
+type MessageService interface {
+	CreateConversation(ctx context.Context, userId string, request *dto.CreateConversationRequest) (*dto.Conversation, error)
+	ListConversations(ctx context.Context, userId string, limit int32, cursor string) (*dto.ConversationPage, error)
+	ListMessages(ctx context.Context, userId, conversationId string, limit int32, cursor string) (*dto.MessagePage, error)
+	Send(ctx context.Context, userId, userName, conversationId string, request *dto.SendMessageRequest) (*dto.Message, error)
+	MarkRead(ctx context.Context, userId, conversationId string, request *dto.MarkConversationReadRequest) error
+}
+
+type DefaultMessageService struct {
+	repository     repository.MessageRepository
+	userRepository repository.UserRepository
+	broker         *entity.Broker
+}
+
+func NewDefaultMessageService(repository repository.MessageRepository, userRepository repository.UserRepository, broker *entity.Broker) *DefaultMessageService {
+	return &DefaultMessageService{
+		repository:     repository,
+		userRepository: userRepository,
+		broker:         broker,
+	}
+}
+
+// CreateConversation starts a conversation between the user and the given
+// participants. Starting a direct conversation that already exists returns
+// it instead.
+func (s *DefaultMessageService) CreateConversation(ctx context.Context, userId string, request *dto.CreateConversationRequest) (*dto.Conversation, error) {
+	participantIds := []string{userId}
+	for _, participantId := range request.ParticipantIDs {
+		if participantId == "" || participantId == userId {
+			return nil, ErrInvalidParticipants
+		}
+		if !slices.Contains(participantIds, participantId) {
+			participantIds = append(participantIds, participantId)
+		}
+	}
+
+	if len(participantIds) < 2 {
+		return nil, ErrInvalidParticipants
+	}
+	if len(participantIds) > entity.MaxConversationParticipants {
+		return nil, ErrTooManyParticipants
+	}
+
+	if len(participantIds) == 2 {
+		member, err := s.repository.GetMember(ctx, userId, entity.DirectConversationID(userId, participantIds[1]))
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			conversationDto := new(dto.Conversation)
+			conversationDto.FromEntity(member)
+			return conversationDto, nil
+		}
+	}
+
+	err := s.checkRecipients(ctx, userId, participantIds, true)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, members, err := entity.NewConversation(userId, participantIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation entity: %w", err)
+	}
+
+	_, err = s.repository.CreateConversation(ctx, conversation, members)
+	if errors.Is(err, repository.ErrConversationExists) {
+		// The other user started the same direct conversation meanwhile
+		member, err := s.repository.GetMember(ctx, userId, conversation.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			return nil, ErrConversationNotFound
+		}
+		members = []*entity.ConversationMember{member}
+	} else if err != nil {
+		return nil, err
+	}
+
+	conversationDto := new(dto.Conversation)
+	for _, member := range members {
+		if member.UserID == userId {
+			conversationDto.FromEntity(member)
+		}
+	}
+
+	return conversationDto, nil
+}
+
+// checkRecipients makes sure that the other participants exist, did not block
+// the sender and, if they restricted their messages, follow the sender
+func (s *DefaultMessageService) checkRecipients(ctx context.Context, userId string, participantIds []string, mustExist bool) error {
+	recipientIds := otherParticipants(userId, participantIds)
+
+	recipients, err := s.userRepository.GetByIDs(ctx, recipientIds)
+	if err != nil {
+		return err
+	}
+
+	if mustExist && len(recipients) != len(recipientIds) {
+		return ErrInvalidParticipants
+	}
+
+	err = s.checkNotBlockedBy(ctx, userId, recipientIds)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		if !recipient.DMsFollowingOnly {
+			continue
+		}
+
+		following, err := s.userRepository.IsFollowing(ctx, recipient.ID, userId)
+		if err != nil {
+			return err
+		}
+		if !following {
+			return ErrDMsRestricted
+		}
+	}
+
+	return nil
+}
+
+// checkNotBlockedBy returns ErrBlocked if any of the recipients blocked the
+// sender
+func (s *DefaultMessageService) checkNotBlockedBy(ctx context.Context, userId string, recipientIds []string) error {
+	blockers, err := s.userRepository.GetBlockerIDs(ctx, userId, recipientIds)
+	if err != nil {
+		return err
+	}
+	if len(blockers) > 0 {
+		return ErrBlocked
+	}
+	return nil
+}
+
+func otherParticipants(userId string, participantIds []string) []string {
+	var others []string
+	for _, participantId := range participantIds {
+		if participantId != userId {
+			others = append(others, participantId)
+		}
+	}
+	return others
+}
+
+func (s *DefaultMessageService) ListConversations(ctx context.Context, userId string, limit int32, cursor string) (*dto.ConversationPage, error) {
+	members, nextCursor, err := s.repository.GetConversationsPage(ctx, userId, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	conversationDtos := make([]*dto.Conversation, 0, len(members))
+	for _, member := range members {
+		conversationDto := new(dto.Conversation)
+		conversationDto.FromEntity(member)
+		conversationDtos = append(conversationDtos, conversationDto)
+	}
+
+	return &dto.ConversationPage{Conversations: conversationDtos, NextCursor: nextCursor}, nil
+}
+
+// member returns the entry of a conversation for the user, or
+// ErrConversationNotFound if they do not take part in it
+func (s *DefaultMessageService) member(ctx context.Context, userId, conversationId string) (*entity.ConversationMember, error) {
+	member, err := s.repository.GetMember(ctx, userId, conversationId)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrConversationNotFound
+	}
+	return member, nil
+}
+
+func (s *DefaultMessageService) ListMessages(ctx context.Context, userId, conversationId string, limit int32, cursor string) (*dto.MessagePage, error) {
+	member, err := s.member(ctx, userId, conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, nextCursor, err := s.repository.GetMessagesPage(ctx, conversationId, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.repository.GetMembers(ctx, conversationId, member.ParticipantIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	messageDtos := make([]*dto.Message, 0, len(messages))
+	for _, message := range messages {
+		messageDto := new(dto.Message)
+		messageDto.FromEntity(message)
+		messageDtos = append(messageDtos, messageDto)
+	}
+
+	receipts := make([]*dto.ReadReceipt, 0, len(members))
+	for _, member := range members {
+		receipt := new(dto.ReadReceipt)
+		receipt.FromEntity(member)
+		receipts = append(receipts, receipt)
+	}
+
+	return &dto.MessagePage{Messages: messageDtos, ReadBy: receipts, NextCursor: nextCursor}, nil
+}
+
+// Send stores a message and pushes it to the clients of the participants
+func (s *DefaultMessageService) Send(ctx context.Context, userId, userName, conversationId string, request *dto.SendMessageRequest) (*dto.Message, error) {
+	member, err := s.member(ctx, userId, conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	// The recipient of a direct conversation may have restricted their
+	// messages after it started. Members of a group agreed to it when they
+	// were added, but may have blocked the sender since then.
+	if len(member.ParticipantIDs) == 2 {
+		err = s.checkRecipients(ctx, userId, member.ParticipantIDs, false)
+	} else {
+		err = s.checkNotBlockedBy(ctx, userId, otherParticipants(userId, member.ParticipantIDs))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := entity.NewMessage(conversationId, userId, userName, request.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message entity: %w", err)
+	}
+
+	createdMessage, err := s.repository.CreateMessage(ctx, message, member.ParticipantIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	messageDto := new(dto.Message)
+	messageDto.FromEntity(createdMessage)
+
+	s.publish(ctx, "new_message", member.ParticipantIDs, messageDto)
+
+	return messageDto, nil
+}
+
+func (s *DefaultMessageService) MarkRead(ctx context.Context, userId, conversationId string, request *dto.MarkConversationReadRequest) error {
+	member, err := s.member(ctx, userId, conversationId)
+	if err != nil {
+		return err
+	}
+
+	if member.LastMessage == nil {
+		return nil
+	}
+
+	upTo := request.UpTo
+	if upTo == "" {
+		upTo = member.LastMessage.ID
+	}
+
+	if _, err := ulid.ParseStrict(upTo); err != nil {
+		return ErrInvalidMessageID
+	}
+
+	// Ids are ordered by time, a receipt past the last message would also
+	// mark messages sent later as read
+	if upTo > member.LastMessage.ID {
+		upTo = member.LastMessage.ID
+	}
+
+	moved, err := s.repository.MarkRead(ctx, userId, conversationId, upTo)
+	if err != nil {
+		return err
+	}
+
+	if moved {
+		s.publish(ctx, "message_read", member.ParticipantIDs, &dto.ReadReceipt{
+			ConversationID: conversationId,
+			UserID:         userId,
+			LastReadID:     upTo,
+		})
+	}
+
+	return nil
+}
+
+// publish sends an event to the participants of a conversation. The change
+// itself already succeeded, so failures are only logged.
+func (s *DefaultMessageService) publish(ctx context.Context, name string, participantIds []string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("failed to marshal %s event: %v", name, err)
+		return
+	}
+
+	s.broker.Publish(ctx, entity.SSEEvent{
+		Name:     name,
+		Data:     string(data),
+		Audience: entity.ToUsers(participantIds...),
+	})
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/oklog/ulid/v2"
+)
+
+var ErrInvalidNotificationID = errors.New("invalid notification id")
+
+type NotificationService interface {
+	Notify(ctx context.Context, notificationType, userId, actorId, actorName, postId, commentId string) error
+	List(ctx context.Context, userId string, limit int32, cursor string) (*dto.NotificationPage, error)
+	MarkRead(ctx context.Context, userId string, request *dto.MarkReadRequest) error
+	UnreadCount(ctx context.Context, userId string) (*dto.UnreadCount, error)
+}
+
+type DefaultNotificationService struct {
+	repository repository.NotificationRepository
+	users      repository.UserRepository
+	broker     *entity.Broker
+}
+
+func NewDefaultNotificationService(repository repository.NotificationRepository, users repository.UserRepository, broker *entity.Broker) *DefaultNotificationService {
+	return &DefaultNotificationService{
+		repository: repository,
+		users:      users,
+		broker:     broker,
+	}
+}
+
+// Notify stores a notification and pushes it to the clients of the
+// recipient. Users are not notified about their own actions, nor about the
+// actions of users they muted or blocked.
+func (s *DefaultNotificationService) Notify(ctx context.Context, notificationType, userId, actorId, actorName, postId, commentId string) error {
+	if userId == actorId {
+		return nil
+	}
+
+	muted, err := s.users.IsMuted(ctx, userId, actorId)
+	if err != nil {
+		return err
+	}
+
+	blocked, err := s.users.IsBlocked(ctx, userId, actorId)
+	if err != nil {
+		return err
+	}
+
+	if muted || blocked {
+		return nil
+	}
+
+	notification, err := entity.NewNotification(notificationType, userId, actorId, actorName, postId, commentId)
+	if err != nil {
+		return fmt.Errorf("failed to create notification entity: %w", err)
+	}
+
+	createdNotification, err := s.repository.Create(ctx, notification)
+	if err != nil {
+		return err
+	}
+
+	notificationDto := new(dto.Notification)
+	notificationDto.FromEntity(createdNotification, "")
+
+	data, err := json.Marshal(notificationDto)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	s.broker.Publish(ctx, entity.SSEEvent{
+		Name:     "notification",
+		Data:     string(data),
+		Audience: entity.ToUsers(userId),
+	})
+
+	return nil
+}
+
+func (s *DefaultNotificationService) List(ctx context.Context, userId string, limit int32, cursor string) (*dto.NotificationPage, error) {
+	notifications, nextCursor, err := s.repository.GetPage(ctx, userId, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	lastReadId, err := s.repository.GetLastReadID(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hides what users did before they were muted
+	hidden, err := hiddenUserIDs(ctx, s.users, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	notificationDtos := make([]*dto.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		if hidden[notification.ActorID] {
+			continue
+		}
+		notificationDto := new(dto.Notification)
+		notificationDto.FromEntity(notification, lastReadId)
+		notificationDtos = append(notificationDtos, notificationDto)
+	}
+
+	return &dto.NotificationPage{Notifications: notificationDtos, NextCursor: nextCursor}, nil
+}
+
+func (s *DefaultNotificationService) MarkRead(ctx context.Context, userId string, request *dto.MarkReadRequest) error {
+	upTo := request.UpTo
+	if upTo != "" {
+		if _, err := ulid.ParseStrict(upTo); err != nil {
+			return ErrInvalidNotificationID
+		}
+	}
+
+	latestId, err := s.repository.GetLatestID(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if latestId == "" {
+		return nil
+	}
+
+	// Ids are ordered by time, a marker past the newest notification would
+	// also mark notifications created later as read
+	if upTo == "" || upTo > latestId {
+		upTo = latestId
+	}
+
+	return s.repository.MarkRead(ctx, userId, upTo)
+}
+
+func (s *DefaultNotificationService) UnreadCount(ctx context.Context, userId string) (*dto.UnreadCount, error) {
+	lastReadId, err := s.repository.GetLastReadID(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Counts only what List shows
+	hidden, err := hiddenUserIDs(ctx, s.users, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repository.CountUnread(ctx, userId, lastReadId, slices.Collect(maps.Keys(hidden)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.UnreadCount{Count: count}, nil
+}
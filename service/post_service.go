@@ -2,50 +2,156 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
 )
 
 type PostService interface {
 	Create(ctx context.Context, userID, userName string, request *dto.CreatePostRequest) (*dto.Post, error)
-	GetAll(ctx context.Context) ([]*dto.Post, error)
-	GetByUserID(ctx context.Context, userId string) ([]*dto.Post, error)
-	Update(ctx context.Context, userId, postId, text, image string) (*dto.Post, error)
+	GetAll(ctx context.Context, viewerId string, limit int32, cursor string) (*dto.PostPage, error)
+	GetByUserID(ctx context.Context, viewerId, userId string) ([]*dto.Post, error)
+	GetByTag(ctx context.Context, viewerId, tag string, limit int32, cursor string) (*dto.PostPage, error)
+	Update(ctx context.Context, userId, postId string, request *dto.UpdatePostRequest) (*dto.Post, error)
 	Delete(ctx context.Context, userId, postId string) (error)
+	Like(ctx context.Context, userId, userName, postId string) (*dto.Like, error)
+	Unlike(ctx context.Context, userId, postId string) (*dto.Like, error)
+	CheckCanSeePost(ctx context.Context, viewerId, postId string) error
 }
 
+var ErrPostNotFound = repository.ErrPostNotFound
+var ErrAlreadyLiked = repository.ErrAlreadyLiked
+var ErrNotLiked = repository.ErrNotLiked
+var ErrInvalidTag = errors.New("invalid tag")
+var ErrInvalidImage = repository.ErrInvalidImage
+var ErrInvalidMedia = errors.New("invalid media")
+
 type DefaultPostService struct {
-	repository repository.DefaultPostRepository
+	repository    repository.PostRepository
+	users         repository.UserRepository
+	timeline      TimelineService
+	index         *search.Shared
+	notifications NotificationService
 }
 
-func NewDefaultPostService(repository repository.DefaultPostRepository) *DefaultPostService {
+func NewDefaultPostService(repository repository.PostRepository, users repository.UserRepository, timeline TimelineService, index *search.Shared, notifications NotificationService) *DefaultPostService {
 	return &DefaultPostService{
-		repository: repository,
+		repository:    repository,
+		users:         users,
+		timeline:      timeline,
+		index:         index,
+		notifications: notifications,
 	}
 }
 
 func (s *DefaultPostService) Create(ctx context.Context, userID, userName string, request *dto.CreatePostRequest) (*dto.Post, error) {
-	post, err := entity.NewPost(userID, userName, request.Text, request.Image)
+	reference, err := s.resolveReference(ctx, userID, request)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := request.Media
+	if len(requested) == 0 {
+		requested = legacyMedia(request.Image, nil)
+	}
+
+	media, err := s.resolveMedia(ctx, userID, requested, nil)
 	if err != nil {
+		return nil, err
+	}
+
+	post, err := entity.NewPost(userID, userName, request.Text, media, reference)
+	if err != nil {
+		s.deleteImages(ctx, processedKeys(media, nil))
 		return nil, fmt.Errorf("failed to create post entity: %w", err)
 	}
 
+	post.Mentions, err = resolveMentions(ctx, s.users, userID, post.Text)
+	if err != nil {
+		s.deleteImages(ctx, processedKeys(media, nil))
+		return nil, err
+	}
+
 	createdPost, err := s.repository.Create(ctx, post)
 	if err != nil {
+		s.deleteImages(ctx, processedKeys(media, nil))
 		return nil, err
 	}
 
+	notifyMentions(ctx, s.notifications, s.users, createdPost.Mentions, nil, userID, userID, userName, createdPost.ID, "")
+
+	// The post itself was stored, so a failed fan-out only affects home timelines
+	err = s.timeline.Distribute(ctx, createdPost)
+	if err != nil {
+		log.Printf("failed to distribute post %s: %v", createdPost.ID, err)
+	}
+
+	s.index.PutPost(ctx, createdPost)
+
 	postDto := new(dto.Post)
 	postDto.FromEntity(createdPost)
 
 	return postDto, nil
 }
 
-func (s *DefaultPostService) GetAll(ctx context.Context) ([]*dto.Post, error) {
-	posts, err := s.repository.GetAll(ctx)
+// resolveReference finds the author of the referenced post. Reposting a
+// repost references the original post instead. Posts the creator cannot see
+// are reported as not found.
+func (s *DefaultPostService) resolveReference(ctx context.Context, userID string, request *dto.CreatePostRequest) (*entity.PostReference, error) {
+	if request.ReferencedPostID == "" {
+		return nil, nil
+	}
+
+	referenced, err := getVisiblePost(ctx, s.repository, s.users, userID, request.ReferencedPostID)
+	if err != nil {
+		return nil, err
+	}
+
+	isRepost := referenced.Reference != nil && referenced.Reference.Kind == entity.ReferenceRepost
+	if isRepost {
+		referenced, err = getVisiblePost(ctx, s.repository, s.users, userID, referenced.Reference.PostID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kind := entity.ReferenceQuote
+	if request.Text == "" && request.Image == "" && len(request.Media) == 0 {
+		kind = entity.ReferenceRepost
+	}
+
+	return &entity.PostReference{
+		Kind:   kind,
+		UserID: referenced.UserID,
+		PostID: referenced.ID,
+	}, nil
+}
+
+func (s *DefaultPostService) GetAll(ctx context.Context, viewerId string, limit int32, cursor string) (*dto.PostPage, error) {
+	posts, nextCursor, err := s.repository.GetAll(ctx, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := hiddenUserIDs(ctx, s.users, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	posts = withoutHiddenPosts(posts, hidden)
+
+	posts, err = withoutPrivatePosts(ctx, s.users, viewerId, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withoutPrivateReferences(ctx, s.users, viewerId, posts)
 	if err != nil {
 		return nil, err
 	}
@@ -57,15 +163,32 @@ func (s *DefaultPostService) GetAll(ctx context.Context) ([]*dto.Post, error) {
 		postDtos = append(postDtos, postDto)
 	}
 
-	return postDtos, nil
+	err = markLiked(ctx, s.repository, viewerId, postDtos)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.PostPage{Posts: postDtos, NextCursor: nextCursor}, nil
 }
 
-func (s *DefaultPostService) GetByUserID(ctx context.Context, userId string) ([]*dto.Post, error) {
+// GetByUserID returns the posts of a user, or ErrPrivateAccount if the user
+// is private and the viewer does not follow them
+func (s *DefaultPostService) GetByUserID(ctx context.Context, viewerId, userId string) ([]*dto.Post, error) {
+	err := checkCanSeePosts(ctx, s.users, viewerId, userId)
+	if err != nil {
+		return nil, err
+	}
+
 	posts, err := s.repository.GetByUserID(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
+	err = withoutPrivateReferences(ctx, s.users, viewerId, posts)
+	if err != nil {
+		return nil, err
+	}
+
 	postDtos := make([]*dto.Post, 0, len(posts))
 	for _, post := range posts {
 		postDto := new(dto.Post)
@@ -73,34 +196,202 @@ func (s *DefaultPostService) GetByUserID(ctx context.Context, userId string) ([]
 		postDtos = append(postDtos, postDto)
 	}
 
+	err = markLiked(ctx, s.repository, viewerId, postDtos)
+	if err != nil {
+		return nil, err
+	}
+
 	return postDtos, nil
 }
 
+func (s *DefaultPostService) GetByTag(ctx context.Context, viewerId, tag string, limit int32, cursor string) (*dto.PostPage, error) {
+	tag, ok := entity.NormalizeTag(tag)
+	if !ok {
+		return nil, ErrInvalidTag
+	}
+
+	posts, nextCursor, err := s.repository.GetByTag(ctx, tag, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := hiddenUserIDs(ctx, s.users, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	posts = withoutHiddenPosts(posts, hidden)
+
+	posts, err = withoutPrivatePosts(ctx, s.users, viewerId, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withoutPrivateReferences(ctx, s.users, viewerId, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	postDtos := make([]*dto.Post, 0, len(posts))
+	for _, post := range posts {
+		postDto := new(dto.Post)
+		postDto.FromEntity(post)
+		postDtos = append(postDtos, postDto)
+	}
+
+	err = markLiked(ctx, s.repository, viewerId, postDtos)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.PostPage{Posts: postDtos, NextCursor: nextCursor}, nil
+}
+
 func (s *DefaultPostService) Update(ctx context.Context, userId, postId string, request *dto.UpdatePostRequest) (*dto.Post, error) {
 	post, err := s.repository.Get(ctx, userId, postId)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find post to update: %w", err)
 	}
 
-	updatedPost, err := s.repository.Update(ctx, userId, postId, request.Text, request.Image)
+	mentions, err := resolveMentions(ctx, s.users, userId, request.Text)
 	if err != nil {
+		return nil, err
+	}
+
+	requested := request.Media
+	if requested == nil {
+		requested = legacyMedia(request.Image, post.Media)
+	}
+
+	media, err := s.resolveMedia(ctx, userId, requested, post.Media)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedPost, err := s.repository.Update(ctx, userId, postId, request.Text, media, mentions)
+	if err != nil {
+		s.deleteImages(ctx, processedKeys(media, post.Media))
 		return nil, fmt.Errorf("failed to update post: %w", err)
 	}
 
-	// If the image was updated, delete the old image
-	if post.Image != request.Image && post.Image != "" {
-		err = s.repository.DeleteImage(ctx, post.Image)
-		if err != nil {
-			return nil, fmt.Errorf("failed to remove old image: %w", err)
-		}
+	notifyMentions(ctx, s.notifications, s.users, updatedPost.Mentions, post.Mentions, userId, userId, updatedPost.UserName, postId, "")
+
+	err = s.timeline.Refresh(ctx, updatedPost)
+	if err != nil {
+		log.Printf("failed to refresh distributed post %s: %v", postId, err)
 	}
 
+	s.index.PutPost(ctx, updatedPost)
+
+	// Delete the images that were removed or replaced. The post is already
+	// updated, so a leftover image is only logged.
+	s.deleteImages(ctx, processedKeys(post.Media, media))
+
 	postDto := new(dto.Post)
 	postDto.FromEntity(updatedPost)
 
+	err = markLiked(ctx, s.repository, userId, []*dto.Post{postDto})
+	if err != nil {
+		return nil, err
+	}
+
 	return postDto, nil
 }
 
+// resolveMedia turns the requested media into the media of a post. Images
+// the post already has keep their stored details, every other key must be an
+// upload of the author, which is processed. When a request fails, the images
+// processed for it are deleted again.
+func (s *DefaultPostService) resolveMedia(ctx context.Context, userId string, requested []*dto.MediaRequest, existing []entity.Media) ([]entity.Media, error) {
+	if len(requested) > entity.MaxMedia {
+		return nil, fmt.Errorf("%w: a post can have at most %d images", ErrInvalidMedia, entity.MaxMedia)
+	}
+
+	for i, request := range requested {
+		if request == nil || request.Key == "" {
+			return nil, fmt.Errorf("%w: image without a key", ErrInvalidMedia)
+		}
+		if len(request.AltText) > entity.MaxAltTextLength {
+			return nil, fmt.Errorf("%w: alt text exceeds the maximum", ErrInvalidMedia)
+		}
+		for _, other := range requested[:i] {
+			if other.Key == request.Key {
+				return nil, fmt.Errorf("%w: image %s is attached twice", ErrInvalidMedia, request.Key)
+			}
+		}
+	}
+
+	media := make([]entity.Media, 0, len(requested))
+	var processed []string
+	for _, request := range requested {
+		index := slices.IndexFunc(existing, func(medium entity.Media) bool { return medium.Key == request.Key })
+		if index >= 0 {
+			medium := existing[index]
+			medium.AltText = request.AltText
+			media = append(media, medium)
+			continue
+		}
+
+		medium, err := s.repository.ProcessImage(ctx, userId, request.Key)
+		if err != nil {
+			s.deleteImages(ctx, processed)
+			return nil, err
+		}
+		processed = append(processed, medium.Key)
+
+		medium.AltText = request.AltText
+		media = append(media, *medium)
+	}
+
+	return media, nil
+}
+
+// processedKeys returns the keys of the media that are not in existing
+func processedKeys(media, existing []entity.Media) []string {
+	var keys []string
+	for _, medium := range media {
+		if !hasMedium(existing, medium.Key) {
+			keys = append(keys, medium.Key)
+		}
+	}
+	return keys
+}
+
+// deleteImages removes images that were processed for a failed request or
+// are no longer used by a post, failures are only logged
+func (s *DefaultPostService) deleteImages(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		err := s.repository.DeleteImage(ctx, key)
+		if err != nil {
+			log.Printf("failed to delete image %s: %v", key, err)
+		}
+	}
+}
+
+// legacyMedia reads the image of a client from before media lists. The image
+// stands for the first medium of the post, the others are kept as they are.
+func legacyMedia(image string, existing []entity.Media) []*dto.MediaRequest {
+	requested := []*dto.MediaRequest{}
+	if image != "" {
+		request := &dto.MediaRequest{Key: image}
+		if len(existing) > 0 && existing[0].Key == image {
+			request.AltText = existing[0].AltText
+		}
+		requested = append(requested, request)
+	}
+
+	for i, medium := range existing {
+		if i > 0 && medium.Key != image {
+			requested = append(requested, &dto.MediaRequest{Key: medium.Key, AltText: medium.AltText})
+		}
+	}
+
+	return requested
+}
+
+func hasMedium(media []entity.Media, key string) bool {
+	return slices.ContainsFunc(media, func(medium entity.Media) bool { return medium.Key == key })
+}
+
 func (s *DefaultPostService) Delete(ctx context.Context, userId, postId string) (error) {
 	_, err := s.repository.Get(ctx, userId, postId)
 	if err != nil {
@@ -112,5 +403,144 @@ func (s *DefaultPostService) Delete(ctx context.Context, userId, postId string)
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
 
+	s.index.DeletePost(ctx, postId)
+
+	// The post is gone either way, leftover inbox copies are skipped when
+	// reading the timeline
+	err = s.timeline.Retract(ctx, postId)
+	if err != nil {
+		log.Printf("failed to retract post %s from timelines: %v", postId, err)
+	}
+
+	return nil
+}
+
+func (s *DefaultPostService) Like(ctx context.Context, userId, userName, postId string) (*dto.Like, error) {
+	post, err := getVisiblePost(ctx, s.repository, s.users, userId, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	like, err := entity.NewLike(postId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create like entity: %w", err)
+	}
+
+	err = s.repository.Like(ctx, like, post.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.notifications.Notify(ctx, entity.NotificationLike, post.UserID, userId, userName, postId, "")
+	if err != nil {
+		log.Printf("failed to notify user %s about like: %v", post.UserID, err)
+	}
+
+	return s.likeState(ctx, userId, post.UserID, postId, true)
+}
+
+func (s *DefaultPostService) Unlike(ctx context.Context, userId, postId string) (*dto.Like, error) {
+	post, err := s.repository.GetByID(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repository.Unlike(ctx, postId, userId, post.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.likeState(ctx, userId, post.UserID, postId, false)
+}
+
+// likeState reads the like count after a like or unlike
+func (s *DefaultPostService) likeState(ctx context.Context, userId, authorId, postId string, liked bool) (*dto.Like, error) {
+	post, err := s.repository.Get(ctx, authorId, postId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get liked post: %w", err)
+	}
+
+	return &dto.Like{
+		PostID:    postId,
+		UserID:    userId,
+		LikeCount: post.LikeCount,
+		LikedByMe: liked,
+		AuthorID:  authorId,
+	}, nil
+}
+
+// CheckCanSeePost returns ErrPostNotFound if the post does not exist or the
+// viewer cannot see it
+func (s *DefaultPostService) CheckCanSeePost(ctx context.Context, viewerId, postId string) error {
+	_, err := getVisiblePost(ctx, s.repository, s.users, viewerId, postId)
+	return err
+}
+
+// EventAudience returns who receives the live events of the posts of a user.
+// Events of private users only go to their approved followers, also when
+// the privacy of the user cannot be read.
+func (s *DefaultPostService) EventAudience(ctx context.Context, authorId string) entity.Audience {
+	author, err := s.users.GetByID(ctx, authorId)
+	if err != nil {
+		log.Printf("failed to get author %s of post event: %v", authorId, err)
+		return entity.ToFollowers(authorId)
+	}
+	if author != nil && author.Private {
+		return entity.ToFollowers(authorId)
+	}
+	return entity.ToEveryone()
+}
+
+// PostEvent returns the live event of a new or updated post. Not every
+// receiver may see an original of a private user, so it is left out and
+// clients load it with the post.
+func (s *DefaultPostService) PostEvent(ctx context.Context, name string, post *dto.Post) (entity.SSEEvent, error) {
+	event := *post
+	if post.Reference != nil && post.Reference.Post != nil {
+		hidden, err := privateAuthorIDs(ctx, s.users, "", []string{post.Reference.UserID})
+		if err != nil {
+			return entity.SSEEvent{}, err
+		}
+		if hidden[post.Reference.UserID] {
+			reference := *post.Reference
+			reference.Post = nil
+			reference.Unavailable = true
+			event.Reference = &reference
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return entity.SSEEvent{}, err
+	}
+
+	return entity.SSEEvent{
+		Name:     name,
+		Data:     string(data),
+		Audience: s.EventAudience(ctx, post.UserID),
+		ActorID:  post.UserID,
+	}, nil
+}
+
+// markLiked sets LikedByMe on the posts the viewer has liked
+func markLiked(ctx context.Context, repository repository.PostRepository, viewerId string, posts []*dto.Post) error {
+	if viewerId == "" || len(posts) == 0 {
+		return nil
+	}
+
+	postIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.ID)
+	}
+
+	liked, err := repository.GetLikedPostIDs(ctx, viewerId, postIds)
+	if err != nil {
+		return fmt.Errorf("failed to get likes: %w", err)
+	}
+
+	for _, post := range posts {
+		post.LikedByMe = liked[post.ID]
+	}
+
 	return nil
 }
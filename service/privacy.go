@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+)
+
+var ErrPrivateAccount = errors.New("this account is private")
+
+// checkCanSeePosts returns ErrPrivateAccount if the author is private and the
+// viewer is neither the author nor an approved follower
+func checkCanSeePosts(ctx context.Context, users repository.UserRepository, viewerId, authorId string) error {
+	if viewerId == authorId {
+		return nil
+	}
+
+	author, err := users.GetByID(ctx, authorId)
+	if err != nil {
+		return err
+	}
+	if author == nil || !author.Private {
+		return nil
+	}
+
+	if viewerId != "" {
+		following, err := users.IsFollowing(ctx, viewerId, authorId)
+		if err != nil {
+			return err
+		}
+		if following {
+			return nil
+		}
+	}
+
+	return ErrPrivateAccount
+}
+
+// getVisiblePost returns a post, or ErrPostNotFound if the viewer cannot see
+// it because its author is private
+func getVisiblePost(ctx context.Context, posts repository.PostRepository, users repository.UserRepository, viewerId, postId string) (*entity.Post, error) {
+	post, err := posts.GetByID(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCanSeePosts(ctx, users, viewerId, post.UserID)
+	if errors.Is(err, ErrPrivateAccount) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// withoutPrivatePosts drops the posts of private users the viewer does not
+// follow
+func withoutPrivatePosts(ctx context.Context, users repository.UserRepository, viewerId string, posts []*entity.Post) ([]*entity.Post, error) {
+	authorIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		authorIds = append(authorIds, post.UserID)
+	}
+
+	hidden, err := privateAuthorIDs(ctx, users, viewerId, authorIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutHiddenPosts(posts, hidden), nil
+}
+
+// withoutPrivateReferences removes the embedded originals of private users
+// the viewer does not follow, so reposts and quotes of them show up as
+// unavailable
+func withoutPrivateReferences(ctx context.Context, users repository.UserRepository, viewerId string, posts []*entity.Post) error {
+	var authorIds []string
+	for _, post := range posts {
+		if post.Referenced != nil {
+			authorIds = append(authorIds, post.Referenced.UserID)
+		}
+	}
+
+	hidden, err := privateAuthorIDs(ctx, users, viewerId, authorIds)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		if post.Referenced != nil && hidden[post.Referenced.UserID] {
+			post.Referenced = nil
+		}
+	}
+
+	return nil
+}
+
+// privateAuthorIDs returns which of the authors are private users the viewer
+// does not follow
+func privateAuthorIDs(ctx context.Context, users repository.UserRepository, viewerId string, authorIds []string) (map[string]bool, error) {
+	var candidateIds []string
+	seen := map[string]bool{}
+	for _, id := range authorIds {
+		if id == viewerId || seen[id] {
+			continue
+		}
+		seen[id] = true
+		candidateIds = append(candidateIds, id)
+	}
+
+	hidden := map[string]bool{}
+	if len(candidateIds) == 0 {
+		return hidden, nil
+	}
+
+	authors, err := users.GetByIDs(ctx, candidateIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authors: %w", err)
+	}
+
+	var privateIds []string
+	for _, author := range authors {
+		if author.Private {
+			privateIds = append(privateIds, author.ID)
+		}
+	}
+	if len(privateIds) == 0 {
+		return hidden, nil
+	}
+
+	followed := map[string]bool{}
+	if viewerId != "" {
+		followed, err = users.GetFollowedIDs(ctx, viewerId, privateIds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get follows: %w", err)
+		}
+	}
+
+	for _, id := range privateIds {
+		if !followed[id] {
+			hidden[id] = true
+		}
+	}
+
+	return hidden, nil
+}
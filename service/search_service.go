@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
+)
+
+var ErrEmptyQuery = errors.New("search query cannot be empty")
+var ErrInvalidSearchType = errors.New("search type must be posts, users or comments")
+
+type SearchService interface {
+	Search(ctx context.Context, viewerId, docType, query string, limit int32, cursor string) (*dto.SearchPage, error)
+}
+
+type DefaultSearchService struct {
+	index *search.Shared
+	posts repository.PostRepository
+	users repository.UserRepository
+}
+
+func NewDefaultSearchService(index *search.Shared, posts repository.PostRepository, users repository.UserRepository) *DefaultSearchService {
+	return &DefaultSearchService{
+		index: index,
+		posts: posts,
+		users: users,
+	}
+}
+
+// Search returns one page of ranked hits. Results are ranked on every
+// request, so the cursor is the offset of the next page. Posts of private
+// users the viewer does not follow, and the comments on them, are left out
+// after ranking, so a page may hold fewer hits than requested.
+func (s *DefaultSearchService) Search(ctx context.Context, viewerId, docType, query string, limit int32, cursor string) (*dto.SearchPage, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	switch docType {
+	case search.TypePost, search.TypeUser, search.TypeComment:
+	default:
+		return nil, ErrInvalidSearchType
+	}
+
+	offset := 0
+	if cursor != "" {
+		values, err := repository.DecodeCursor(cursor, "offset")
+		if err != nil {
+			return nil, err
+		}
+		offset, err = strconv.Atoi(values["offset"])
+		if err != nil || offset < 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	result := s.index.Search(docType, query, offset, int(limit))
+
+	hits, err := s.withoutPrivateHits(ctx, viewerId, docType, result.Hits)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &dto.SearchPage{
+		Hits:  make([]*dto.SearchHit, 0, len(hits)),
+		Total: result.Total,
+	}
+	for _, hit := range hits {
+		hitDto := new(dto.SearchHit)
+		hitDto.FromHit(hit)
+		page.Hits = append(page.Hits, hitDto)
+	}
+
+	next := offset + len(result.Hits)
+	if next < result.Total {
+		nextCursor, err := repository.EncodeCursorValues(map[string]string{"offset": strconv.Itoa(next)})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = nextCursor
+	}
+
+	return page, nil
+}
+
+// withoutPrivateHits drops the posts of private users the viewer does not
+// follow and the comments on them. Users are always found.
+func (s *DefaultSearchService) withoutPrivateHits(ctx context.Context, viewerId, docType string, hits []*search.Hit) ([]*search.Hit, error) {
+	if docType == search.TypeUser {
+		return hits, nil
+	}
+
+	// The author whose privacy decides if a hit is shown
+	authorIds := make(map[*search.Hit]string, len(hits))
+	postAuthorIds := map[string]string{}
+	for _, hit := range hits {
+		if docType == search.TypePost {
+			authorIds[hit] = hit.Document.Stored["user_id"]
+			continue
+		}
+
+		postId := hit.Document.Stored["post_id"]
+		if _, ok := postAuthorIds[postId]; !ok {
+			post, err := s.posts.GetByID(ctx, postId)
+			if errors.Is(err, repository.ErrPostNotFound) {
+				// The index still holds comments of a deleted post
+				postAuthorIds[postId] = ""
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get post %s: %w", postId, err)
+			}
+			postAuthorIds[postId] = post.UserID
+		}
+		authorIds[hit] = postAuthorIds[postId]
+	}
+
+	hidden, err := privateAuthorIDs(ctx, s.users, viewerId, slices.Collect(maps.Values(authorIds)))
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]*search.Hit, 0, len(hits))
+	for _, hit := range hits {
+		authorId, ok := authorIds[hit]
+		if ok && authorId != "" && !hidden[authorId] {
+			visible = append(visible, hit)
+		}
+	}
+
+	return visible, nil
+}
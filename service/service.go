@@ -1,17 +1,42 @@
 package service
 
-import "github.com/HENNGE/snsclone-202506-golang-luca/repository"
+import (
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = repository.ErrInvalidCursor
 
 type Services struct {
-	UserService    *DefaultUserService
-	PostService    *DefaultPostService
-	CommentService *DefaultCommentService
+	UserService     *DefaultUserService
+	PostService     *DefaultPostService
+	CommentService  *DefaultCommentService
+	TimelineService TimelineService
+	SearchService   *DefaultSearchService
+	TrendingService *DefaultTrendingService
+	// NotificationService is shared by the services that notify users
+	NotificationService *DefaultNotificationService
+	MessageService      *DefaultMessageService
 }
 
-func InitServices(repositories *repository.Repositories) *Services {
-	return &Services{
-		UserService:    NewDefaultUserService(*repositories.UserRepository),
-		PostService:    NewDefaultPostService(*repositories.PostRepository),
-		CommentService: NewDefaultCommentService(*repositories.CommentRepository),
+func InitServices(repositories *repository.Repositories, timelineStrategy string, index *search.Shared, broker *entity.Broker) (*Services, error) {
+	timelineService, err := NewTimelineService(timelineStrategy, repositories.PostRepository, repositories.UserRepository)
+	if err != nil {
+		return nil, err
 	}
+
+	notificationService := NewDefaultNotificationService(repositories.NotificationRepository, repositories.UserRepository, broker)
+
+	return &Services{
+		UserService:         NewDefaultUserService(repositories.UserRepository, index, notificationService, broker),
+		PostService:         NewDefaultPostService(repositories.PostRepository, repositories.UserRepository, timelineService, index, notificationService),
+		CommentService:      NewDefaultCommentService(repositories.CommentRepository, repositories.PostRepository, repositories.UserRepository, index, notificationService),
+		TimelineService:     timelineService,
+		SearchService:       NewDefaultSearchService(index, repositories.PostRepository, repositories.UserRepository),
+		TrendingService:     NewDefaultTrendingService(repositories.PostRepository, repositories.UserRepository),
+		NotificationService: notificationService,
+		MessageService:      NewDefaultMessageService(repositories.MessageRepository, repositories.UserRepository, broker),
+	}, nil
 }
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/oklog/ulid/v2"
+)
+
+// TimelineService builds the home timeline of a user, i.e. the posts of the
+// users they follow plus their own. Implementations decide how the feed is
+// assembled so that the strategy can be changed without touching the API.
+type TimelineService interface {
+	Home(ctx context.Context, userID string, limit int32, cursor string) (*dto.PostPage, error)
+	// Distribute is called after a post was created
+	Distribute(ctx context.Context, post *entity.Post) error
+	// Refresh is called after a post was edited
+	Refresh(ctx context.Context, post *entity.Post) error
+	// Retract is called after a post was deleted
+	Retract(ctx context.Context, postId string) error
+}
+
+// Timeline strategies that can be selected through the TIMELINE_STRATEGY
+// environment variable
+const (
+	TimelineFanOutOnRead  = "read"
+	TimelineFanOutOnWrite = "write"
+)
+
+func NewTimelineService(strategy string, postRepository repository.PostRepository, userRepository repository.UserRepository) (TimelineService, error) {
+	switch strategy {
+	case "", TimelineFanOutOnRead:
+		return NewFanOutOnReadTimelineService(postRepository, userRepository), nil
+	case TimelineFanOutOnWrite:
+		return NewFanOutOnWriteTimelineService(postRepository, userRepository), nil
+	default:
+		return nil, fmt.Errorf("unknown timeline strategy %q", strategy)
+	}
+}
+
+// Maximum number of partitions that are queried at the same time
+const fanOutConcurrency = 8
+
+// FanOutOnReadTimelineService merges the post partitions of every followed
+// user when the timeline is requested.
+type FanOutOnReadTimelineService struct {
+	postRepository repository.PostRepository
+	userRepository repository.UserRepository
+}
+
+func NewFanOutOnReadTimelineService(postRepository repository.PostRepository, userRepository repository.UserRepository) *FanOutOnReadTimelineService {
+	return &FanOutOnReadTimelineService{
+		postRepository: postRepository,
+		userRepository: userRepository,
+	}
+}
+
+func (s *FanOutOnReadTimelineService) Home(ctx context.Context, userID string, limit int32, cursor string) (*dto.PostPage, error) {
+	beforeID, err := decodeHomeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	following, err := s.userRepository.GetFollowing(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get following: %w", err)
+	}
+
+	// Muted users can still be followed, their posts are left out
+	hidden, err := hiddenUserIDs(ctx, s.userRepository, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	authorIDs := make([]string, 0, len(following)+1)
+	authorIDs = append(authorIDs, userID)
+	for _, follow := range following {
+		if !hidden[follow.FollowedID] {
+			authorIDs = append(authorIDs, follow.FollowedID)
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		merged   []*entity.Post
+		firstErr error
+		hasMore  bool
+	)
+
+	semaphore := make(chan struct{}, fanOutConcurrency)
+	for _, authorID := range authorIDs {
+		wg.Add(1)
+		go func(authorID string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			posts, err := s.postRepository.GetPageByUserID(ctx, authorID, beforeID, limit)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			// A full page means this author may have older posts left
+			if int32(len(posts)) == limit {
+				hasMore = true
+			}
+			merged = append(merged, posts...)
+		}(authorID)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", firstErr)
+	}
+
+	// ULIDs sort lexicographically by creation time
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ID > merged[j].ID
+	})
+
+	if int32(len(merged)) > limit {
+		merged = merged[:limit]
+		hasMore = true
+	}
+
+	err = withoutPrivateReferences(ctx, s.userRepository, userID, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &dto.PostPage{Posts: make([]*dto.Post, 0, len(merged))}
+	for _, post := range merged {
+		postDto := new(dto.Post)
+		postDto.FromEntity(post)
+		page.Posts = append(page.Posts, postDto)
+	}
+
+	err = markLiked(ctx, s.postRepository, userID, page.Posts)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasMore && len(merged) > 0 {
+		page.NextCursor, err = repository.EncodeCursorValues(map[string]string{"before": merged[len(merged)-1].ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
+		}
+	}
+
+	return page, nil
+}
+
+// Posts are read from their author's partition, nothing has to be written
+func (s *FanOutOnReadTimelineService) Distribute(ctx context.Context, post *entity.Post) error {
+	return nil
+}
+
+func (s *FanOutOnReadTimelineService) Refresh(ctx context.Context, post *entity.Post) error {
+	return nil
+}
+
+func (s *FanOutOnReadTimelineService) Retract(ctx context.Context, postId string) error {
+	return nil
+}
+
+// FanOutOnWriteTimelineService copies every new post into the inbox of the
+// author and each of their followers, so reading the timeline is a single
+// query.
+type FanOutOnWriteTimelineService struct {
+	postRepository repository.PostRepository
+	userRepository repository.UserRepository
+}
+
+func NewFanOutOnWriteTimelineService(postRepository repository.PostRepository, userRepository repository.UserRepository) *FanOutOnWriteTimelineService {
+	return &FanOutOnWriteTimelineService{
+		postRepository: postRepository,
+		userRepository: userRepository,
+	}
+}
+
+func (s *FanOutOnWriteTimelineService) Home(ctx context.Context, userID string, limit int32, cursor string) (*dto.PostPage, error) {
+	following, err := s.userRepository.GetFollowing(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get following: %w", err)
+	}
+
+	hidden, err := hiddenUserIDs(ctx, s.userRepository, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inbox copies are not removed on unfollow, so skip them here. Muted
+	// users can still be followed, their posts are left out as well.
+	authorIDs := map[string]bool{userID: true}
+	for _, follow := range following {
+		if !hidden[follow.FollowedID] {
+			authorIDs[follow.FollowedID] = true
+		}
+	}
+
+	// Skipped copies would leave the page short, so the inbox is read until
+	// the page is full. Only the missing posts are requested each time, so
+	// the cursor of the inbox stays the cursor of the page.
+	page := &dto.PostPage{Posts: make([]*dto.Post, 0, max(limit, 0)), NextCursor: cursor}
+	for {
+		posts, nextCursor, err := s.postRepository.GetInbox(ctx, userID, limit-int32(len(page.Posts)), page.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+
+		err = withoutPrivateReferences(ctx, s.userRepository, userID, posts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, post := range posts {
+			if !authorIDs[post.UserID] {
+				continue
+			}
+			postDto := new(dto.Post)
+			postDto.FromEntity(post)
+			page.Posts = append(page.Posts, postDto)
+		}
+
+		page.NextCursor = nextCursor
+		if nextCursor == "" || int32(len(page.Posts)) >= limit {
+			break
+		}
+	}
+
+	err = markLiked(ctx, s.postRepository, userID, page.Posts)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (s *FanOutOnWriteTimelineService) Distribute(ctx context.Context, post *entity.Post) error {
+	followers, err := s.userRepository.GetFollowers(ctx, post.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get followers: %w", err)
+	}
+
+	ownerIDs := make([]string, 0, len(followers)+1)
+	ownerIDs = append(ownerIDs, post.UserID)
+	for _, follower := range followers {
+		ownerIDs = append(ownerIDs, follower.FollowerID)
+	}
+
+	return s.postRepository.DistributeToInboxes(ctx, post, ownerIDs)
+}
+
+func (s *FanOutOnWriteTimelineService) Refresh(ctx context.Context, post *entity.Post) error {
+	return s.postRepository.RefreshInboxCopies(ctx, post)
+}
+
+func (s *FanOutOnWriteTimelineService) Retract(ctx context.Context, postId string) error {
+	return s.postRepository.DeleteInboxCopies(ctx, postId)
+}
+
+// decodeHomeCursor returns the ID of the last post of the previous page
+func decodeHomeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+
+	values, err := repository.DecodeCursor(cursor, "before")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := ulid.ParseStrict(values["before"]); err != nil {
+		return "", ErrInvalidCursor
+	}
+
+	return values["before"], nil
+}
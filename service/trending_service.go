@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
+	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+)
+
+// Tags are ranked by how often they were used within this window
+const trendingWindow = 24 * time.Hour
+
+// How often the ranking is recomputed
+const trendingInterval = 5 * time.Minute
+
+// Number of tags kept in the ranking
+const trendingSize = 50
+
+type TrendingService interface {
+	Trending(ctx context.Context, limit int) []*dto.TrendingTag
+	Run(ctx context.Context)
+}
+
+// DefaultTrendingService serves the ranking computed by the last run of its
+// background loop, so requests never count tags themselves
+type DefaultTrendingService struct {
+	repository repository.PostRepository
+	users      repository.UserRepository
+	mu         sync.RWMutex
+	ranking    []*dto.TrendingTag
+}
+
+func NewDefaultTrendingService(repository repository.PostRepository, users repository.UserRepository) *DefaultTrendingService {
+	return &DefaultTrendingService{
+		repository: repository,
+		users:      users,
+		ranking:    []*dto.TrendingTag{},
+	}
+}
+
+func (s *DefaultTrendingService) Trending(ctx context.Context, limit int) []*dto.TrendingTag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ranking[:min(limit, len(s.ranking))]
+}
+
+// Run recomputes the ranking every trendingInterval until the context is done
+func (s *DefaultTrendingService) Run(ctx context.Context) {
+	ticker := time.NewTicker(trendingInterval)
+	defer ticker.Stop()
+
+	for {
+		err := s.refresh(ctx)
+		if err != nil {
+			log.Printf("failed to compute trending tags: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DefaultTrendingService) refresh(ctx context.Context) error {
+	counts, err := s.repository.CountTagsSince(ctx, time.Now().Add(-trendingWindow))
+	if err != nil {
+		return err
+	}
+
+	// The ranking is public, so the posts of private users are not counted
+	var authorIds []string
+	seen := map[string]bool{}
+	for _, authors := range counts {
+		for authorId := range authors {
+			if !seen[authorId] {
+				seen[authorId] = true
+				authorIds = append(authorIds, authorId)
+			}
+		}
+	}
+
+	authors, err := s.users.GetByIDs(ctx, authorIds)
+	if err != nil {
+		return fmt.Errorf("failed to get authors: %w", err)
+	}
+
+	private := map[string]bool{}
+	for _, author := range authors {
+		if author.Private {
+			private[author.ID] = true
+		}
+	}
+
+	ranking := make([]*dto.TrendingTag, 0, len(counts))
+	for tag, authors := range counts {
+		count := 0
+		for authorId, uses := range authors {
+			if !private[authorId] {
+				count += uses
+			}
+		}
+		if count > 0 {
+			ranking = append(ranking, &dto.TrendingTag{Tag: tag, Count: count})
+		}
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Count != ranking[j].Count {
+			return ranking[i].Count > ranking[j].Count
+		}
+		return ranking[i].Tag < ranking[j].Tag
+	})
+
+	s.mu.Lock()
+	s.ranking = ranking[:min(trendingSize, len(ranking))]
+	s.mu.Unlock()
+
+	return nil
+}
@@ -3,44 +3,87 @@ package service
 import (
 	"context"
 	"errors"
+	"log"
 
 	"github.com/HENNGE/snsclone-202506-golang-luca/dto"
 	"github.com/HENNGE/snsclone-202506-golang-luca/entity"
 	"github.com/HENNGE/snsclone-202506-golang-luca/repository"
+	"github.com/HENNGE/snsclone-202506-golang-luca/search"
 )
 
-var ErrUserNotFound = errors.New("user not found")
+var ErrUserNotFound = repository.ErrUserNotFound
+var ErrAlreadyFollowing = repository.ErrAlreadyFollowing
+var ErrNotFollowing = repository.ErrNotFollowing
+var ErrCannotFollowSelf = errors.New("cannot follow yourself")
+var ErrAlreadyBlocked = repository.ErrAlreadyBlocked
+var ErrNotBlocked = repository.ErrNotBlocked
+var ErrAlreadyMuted = repository.ErrAlreadyMuted
+var ErrNotMuted = repository.ErrNotMuted
+var ErrCannotBlockSelf = errors.New("cannot block yourself")
+var ErrCannotMuteSelf = errors.New("cannot mute yourself")
+var ErrAlreadyRequested = repository.ErrAlreadyRequested
+var ErrRequestNotFound = repository.ErrRequestNotFound
 
 type UserService interface {
 	Create(ctx context.Context, request *dto.CreateUserRequest) (*dto.User, error)
 	GetByID(ctx context.Context, id string) (*dto.User, error)
 	GetAll(ctx context.Context) ([]*dto.User, error)
-	GetFollowing(ctx context.Context, userID string) ([]*dto.Follow, error)
+	GetFollowing(ctx context.Context, userID string) (*dto.Following, error)
+	ListFollowing(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error)
+	ListFollowers(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error)
 	Follow(ctx context.Context, userID string, request *dto.FollowRequest) (*dto.Follow, error)
 	Unfollow(ctx context.Context, userID string, request *dto.UnfollowRequest) (error)
+	UpdateSettings(ctx context.Context, userID string, request *dto.UpdateSettingsRequest) (*dto.UserSettings, error)
+	GetBlockedIDs(ctx context.Context, userID string) ([]string, error)
+	GetMutedIDs(ctx context.Context, userID string) ([]string, error)
+	Block(ctx context.Context, userID, blockedID string) error
+	Unblock(ctx context.Context, userID, blockedID string) error
+	Mute(ctx context.Context, userID, mutedID string) error
+	Unmute(ctx context.Context, userID, mutedID string) error
+	ListFollowRequests(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error)
+	ApproveFollowRequest(ctx context.Context, userID, requesterID string) error
+	RejectFollowRequest(ctx context.Context, userID, requesterID string) error
 }
 
 type DefaultUserService struct {
-	repository repository.DefaultUserRepository
+	repository    repository.UserRepository
+	index         *search.Shared
+	notifications NotificationService
+	broker        *entity.Broker
 }
 
-func NewDefaultUserService(repository repository.DefaultUserRepository) *DefaultUserService {
+func NewDefaultUserService(repository repository.UserRepository, index *search.Shared, notifications NotificationService, broker *entity.Broker) *DefaultUserService {
 	return &DefaultUserService{
-		repository: repository,
+		repository:    repository,
+		index:         index,
+		notifications: notifications,
+		broker:        broker,
 	}
 }
 
+// Number of handles tried before creating a user fails
+const handleAttempts = 20
+
 func (s *DefaultUserService) Create(ctx context.Context, request *dto.CreateUserRequest) (*dto.User, error) {
 	user, err := entity.NewUser(request.ID, request.Name, request.Email, request.Picture)
 	if err != nil {
 		return nil, err
 	}
 
-	createdUser, err := s.repository.Create(ctx, user)
+	var createdUser *entity.User
+	for _, handle := range entity.HandleCandidates(request.Name, handleAttempts) {
+		user.Handle = handle
+		createdUser, err = s.repository.Create(ctx, user)
+		if !errors.Is(err, repository.ErrHandleTaken) {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	s.index.PutUser(ctx, createdUser)
+
 	userDto := new(dto.User)
 	userDto.FromEntity(createdUser)
 
@@ -91,17 +134,89 @@ func (s *DefaultUserService) GetFollowing(ctx context.Context, userID string) (*
 	return followingDto, nil
 }
 
+func (s *DefaultUserService) ListFollowing(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error) {
+	following, nextCursor, err := s.repository.GetFollowingPage(ctx, userID, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(following))
+	for _, follow := range following {
+		ids = append(ids, follow.FollowedID)
+	}
+
+	return s.userPage(ctx, ids, nextCursor)
+}
+
+func (s *DefaultUserService) ListFollowers(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error) {
+	followers, nextCursor, err := s.repository.GetFollowersPage(ctx, userID, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(followers))
+	for _, follower := range followers {
+		ids = append(ids, follower.FollowerID)
+	}
+
+	return s.userPage(ctx, ids, nextCursor)
+}
+
+func (s *DefaultUserService) userPage(ctx context.Context, ids []string, nextCursor string) (*dto.UserPage, error) {
+	users, err := s.repository.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	userDtos := make([]*dto.User, 0, len(users))
+	for _, user := range users {
+		userDto := new(dto.User)
+		userDto.FromEntity(user)
+		userDtos = append(userDtos, userDto)
+	}
+
+	return &dto.UserPage{Users: userDtos, NextCursor: nextCursor}, nil
+}
+
 func (s *DefaultUserService) Follow(ctx context.Context, userID string, request *dto.FollowRequest) (*dto.Follow, error) {
+	if userID == request.FollowingID {
+		return nil, ErrCannotFollowSelf
+	}
+
+	err := checkNotBlocked(ctx, s.repository, userID, request.FollowingID)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.repository.GetByID(ctx, request.FollowingID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if target.Private {
+		return s.requestFollow(ctx, userID, request.FollowingID)
+	}
+
 	follow, err := entity.NewFollow(userID, request.FollowingID)
 	if err != nil {
 		return nil, err
 	}
 
-	createdFollow, err := s.repository.Follow(ctx, follow)
+	follower, err := entity.NewFollower(userID, request.FollowingID)
 	if err != nil {
 		return nil, err
 	}
 
+	createdFollow, err := s.repository.Follow(ctx, follow, follower)
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyFollow(ctx, userID, request.FollowingID)
+
 	followDto := new(dto.Follow)
 	followDto.FromEntity(createdFollow)
 
@@ -114,10 +229,240 @@ func (s *DefaultUserService) Unfollow(ctx context.Context, userID string, reques
 		return err
 	}
 
-	err = s.repository.Unfollow(ctx, unfollow)
+	removeFollower, err := entity.NewRemoveFollower(userID, request.UnfollowingID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.Unfollow(ctx, unfollow, removeFollower)
+	if errors.Is(err, ErrNotFollowing) {
+		// Withdraws a request that is still pending
+		err = s.repository.DeleteFollowRequest(ctx, request.UnfollowingID, userID)
+		if errors.Is(err, ErrRequestNotFound) {
+			return ErrNotFollowing
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// notifyFollow tells a user about a new follower. The follow itself already
+// succeeded, so failures are only logged.
+func (s *DefaultUserService) notifyFollow(ctx context.Context, followerId, followingId string) {
+	s.notify(ctx, entity.NotificationFollow, followingId, followerId)
+}
+
+// notify tells a user about something another user did. The change itself
+// already succeeded, so failures are only logged.
+func (s *DefaultUserService) notify(ctx context.Context, notificationType, userId, actorId string) {
+	actor, err := s.repository.GetByID(ctx, actorId)
+	if err != nil || actor == nil {
+		log.Printf("failed to get user %s: %v", actorId, err)
+		return
+	}
+
+	err = s.notifications.Notify(ctx, notificationType, userId, actorId, actor.Name, "", "")
+	if err != nil {
+		log.Printf("failed to notify user %s about %s: %v", userId, notificationType, err)
+	}
+}
+
+func (s *DefaultUserService) UpdateSettings(ctx context.Context, userID string, request *dto.UpdateSettingsRequest) (*dto.UserSettings, error) {
+	user, err := s.repository.UpdateSettings(ctx, userID, &entity.UserSettings{
+		DMsFollowingOnly: request.DMsFollowingOnly,
+		Private:          request.Private,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A public account has no follow requests, new follows go straight through
+	if request.Private != nil && !*request.Private {
+		s.approveFollowRequests(ctx, userID)
+	}
+
+	settingsDto := new(dto.UserSettings)
+	settingsDto.FromEntity(user)
+
+	return settingsDto, nil
+}
+
+func (s *DefaultUserService) GetBlockedIDs(ctx context.Context, userID string) ([]string, error) {
+	ids, err := s.repository.GetBlockedIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
+}
+
+func (s *DefaultUserService) GetMutedIDs(ctx context.Context, userID string) ([]string, error) {
+	ids, err := s.repository.GetMutedIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
+}
+
+// Block stops another user from interacting with the user. Follows in both
+// directions are removed.
+func (s *DefaultUserService) Block(ctx context.Context, userID, blockedID string) error {
+	if userID == blockedID {
+		return ErrCannotBlockSelf
+	}
+
+	block, err := entity.NewBlock(userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.Block(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	s.broker.RefreshHidden(ctx, userID)
+	return nil
+}
+
+func (s *DefaultUserService) Unblock(ctx context.Context, userID, blockedID string) error {
+	err := s.repository.Unblock(ctx, userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	s.broker.RefreshHidden(ctx, userID)
+	return nil
+}
+
+// Mute hides the posts, comments and notifications of another user from the
+// user. Follows are kept.
+func (s *DefaultUserService) Mute(ctx context.Context, userID, mutedID string) error {
+	if userID == mutedID {
+		return ErrCannotMuteSelf
+	}
+
+	mute, err := entity.NewMute(userID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.Mute(ctx, mute)
+	if err != nil {
+		return err
+	}
+
+	s.broker.RefreshHidden(ctx, userID)
+	return nil
+}
+
+func (s *DefaultUserService) Unmute(ctx context.Context, userID, mutedID string) error {
+	err := s.repository.Unmute(ctx, userID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	s.broker.RefreshHidden(ctx, userID)
+	return nil
+}
+
+// requestFollow asks a private user to approve a follow
+func (s *DefaultUserService) requestFollow(ctx context.Context, userID, followingID string) (*dto.Follow, error) {
+	following, err := s.repository.IsFollowing(ctx, userID, followingID)
+	if err != nil {
+		return nil, err
+	}
+	if following {
+		return nil, ErrAlreadyFollowing
+	}
+
+	request, err := entity.NewFollowRequest(userID, followingID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repository.CreateFollowRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(ctx, entity.NotificationFollowRequest, followingID, userID)
+
+	return &dto.Follow{FollowingID: followingID, Pending: true}, nil
+}
+
+func (s *DefaultUserService) ListFollowRequests(ctx context.Context, userID string, limit int32, cursor string) (*dto.UserPage, error) {
+	requests, nextCursor, err := s.repository.GetFollowRequestsPage(ctx, userID, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(requests))
+	for _, request := range requests {
+		ids = append(ids, request.RequesterID)
+	}
+
+	return s.userPage(ctx, ids, nextCursor)
+}
+
+// ApproveFollowRequest turns a pending request into a follow
+func (s *DefaultUserService) ApproveFollowRequest(ctx context.Context, userID, requesterID string) error {
+	follow, err := entity.NewFollow(requesterID, userID)
 	if err != nil {
 		return err
 	}
 
+	follower, err := entity.NewFollower(requesterID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.ApproveFollowRequest(ctx, follow, follower)
+	if err != nil {
+		return err
+	}
+
+	s.notify(ctx, entity.NotificationFollowAccepted, requesterID, userID)
+
 	return nil
 }
+
+// approveFollowRequests approves every pending follow request of a user. The
+// settings were already changed, so failures are only logged.
+func (s *DefaultUserService) approveFollowRequests(ctx context.Context, userID string) {
+	var requesterIds []string
+	cursor := ""
+	for {
+		requests, nextCursor, err := s.repository.GetFollowRequestsPage(ctx, userID, 100, cursor)
+		if err != nil {
+			log.Printf("failed to get follow requests of user %s: %v", userID, err)
+			return
+		}
+		for _, request := range requests {
+			requesterIds = append(requesterIds, request.RequesterID)
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	for _, requesterId := range requesterIds {
+		err := s.ApproveFollowRequest(ctx, userID, requesterId)
+		if err != nil {
+			log.Printf("failed to approve follow request of user %s: %v", requesterId, err)
+		}
+	}
+}
+
+func (s *DefaultUserService) RejectFollowRequest(ctx context.Context, userID, requesterID string) error {
+	return s.repository.DeleteFollowRequest(ctx, userID, requesterID)
+}
@@ -0,0 +1,325 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// client is the raw side of a test connection, it writes and reads frames
+// byte by byte
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	// errs receives the error that ended ReadMessage on the server
+	errs chan error
+}
+
+// dial starts a server that echoes text messages and connects to it
+func dial(t *testing.T) *client {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Accept(w, r)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				conn.Close(CloseGoingAway, "")
+				return
+			}
+			conn.WriteMessage(message)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: "+testKey+"\r\n\r\n")
+	if err != nil {
+		t.Fatalf("failed to write handshake: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("failed to read handshake: %v", err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status %d", response.StatusCode)
+	}
+
+	hash := sha1.Sum([]byte(testKey + acceptGUID))
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != base64.StdEncoding.EncodeToString(hash[:]) {
+		t.Fatalf("unexpected Sec-WebSocket-Accept %q", accept)
+	}
+
+	return &client{t: t, conn: conn, reader: reader, errs: errs}
+}
+
+// write sends a masked frame
+func (c *client) write(fin bool, opcode byte, payload []byte) {
+	c.t.Helper()
+	c.writeRaw(fin, opcode, payload, true)
+}
+
+func (c *client) writeRaw(fin bool, opcode byte, payload []byte, masked bool) {
+	c.t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if masked {
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.conn.Write(frame)
+	if err != nil {
+		c.t.Fatalf("failed to write frame: %v", err)
+	}
+}
+
+// read returns the next frame of the server
+func (c *client) read() (byte, []byte) {
+	c.t.Helper()
+
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.reader, header)
+	if err != nil {
+		c.t.Fatalf("failed to read frame: %v", err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		c.t.Fatalf("server frames must be final and unmasked, got %x", header)
+	}
+
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		io.ReadFull(c.reader, extended)
+		length = int(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		io.ReadFull(c.reader, extended)
+		length = int(binary.BigEndian.Uint64(extended))
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+	if err != nil {
+		c.t.Fatalf("failed to read payload: %v", err)
+	}
+
+	return header[0] & 0x0F, payload
+}
+
+// expectClose reads the close frame of the server and returns its code, or
+// CloseNoStatus for an empty one
+func (c *client) expectClose() int {
+	c.t.Helper()
+
+	opcode, payload := c.read()
+	if opcode != opClose {
+		c.t.Fatalf("expected a close frame, got opcode %x", opcode)
+	}
+	if len(payload) == 0 {
+		return CloseNoStatus
+	}
+	if len(payload) == 1 {
+		c.t.Fatalf("close payload of a single byte")
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+// serverError returns the error ReadMessage ended with
+func (c *client) serverError() error {
+	c.t.Helper()
+
+	select {
+	case err := <-c.errs:
+		return err
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("server is still reading")
+		return nil
+	}
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func TestEcho(t *testing.T) {
+	c := dial(t)
+
+	c.write(true, opText, []byte("hello"))
+	if opcode, payload := c.read(); opcode != opText || string(payload) != "hello" {
+		t.Errorf("got %x %q, want the text echoed", opcode, payload)
+	}
+
+	// Fragments are joined, control frames may come in between
+	c.write(false, opText, []byte("hel"))
+	c.write(true, opPing, []byte("ping"))
+	c.write(true, opContinuation, []byte("lo"))
+	if opcode, payload := c.read(); opcode != opPong || string(payload) != "ping" {
+		t.Errorf("got %x %q, want a pong with the ping payload", opcode, payload)
+	}
+	if opcode, payload := c.read(); opcode != opText || string(payload) != "hello" {
+		t.Errorf("got %x %q, want the fragmented text echoed", opcode, payload)
+	}
+
+	long := strings.Repeat("a", 1000)
+	c.write(true, opText, []byte(long))
+	if _, payload := c.read(); string(payload) != long {
+		t.Errorf("got %d bytes, want the long text echoed", len(payload))
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		reply   int
+		err     int
+	}{
+		{"normal", closePayload(CloseNormal, "bye"), CloseNormal, CloseNormal},
+		{"application code", closePayload(4000, ""), 4000, 4000},
+		{"no code", nil, CloseNoStatus, CloseNoStatus},
+		{"single byte", []byte{0x03}, CloseProtocolError, CloseProtocolError},
+		{"no status", closePayload(1005, ""), CloseProtocolError, CloseProtocolError},
+		{"abnormal", closePayload(1006, ""), CloseProtocolError, CloseProtocolError},
+		{"tls failure", closePayload(1015, ""), CloseProtocolError, CloseProtocolError},
+		{"reserved", closePayload(1004, ""), CloseProtocolError, CloseProtocolError},
+		{"undefined", closePayload(2000, ""), CloseProtocolError, CloseProtocolError},
+		{"out of range", closePayload(5000, ""), CloseProtocolError, CloseProtocolError},
+		{"invalid reason", closePayload(CloseNormal, "\xff"), CloseInvalidPayload, CloseInvalidPayload},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := dial(t)
+			c.write(true, opClose, test.payload)
+
+			if code := c.expectClose(); code != test.reply {
+				t.Errorf("replied with %d, want %d", code, test.reply)
+			}
+
+			var closeErr *CloseError
+			if err := c.serverError(); !errors.As(err, &closeErr) || closeErr.Code != test.err {
+				t.Errorf("ReadMessage returned %v, want code %d", err, test.err)
+			}
+		})
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		send  func(c *client)
+		reply int
+	}{
+		{"unmasked", func(c *client) { c.writeRaw(true, opText, []byte("a"), false) }, CloseProtocolError},
+		{"reserved bits", func(c *client) { c.write(true, 0x40|opText, []byte("a")) }, CloseProtocolError},
+		{"unknown opcode", func(c *client) { c.write(true, 0x3, nil) }, CloseProtocolError},
+		{"fragmented control", func(c *client) { c.write(false, opPing, nil) }, CloseProtocolError},
+		{"long control", func(c *client) { c.write(true, opPing, make([]byte, 126)) }, CloseProtocolError},
+		{"lone continuation", func(c *client) { c.write(true, opContinuation, []byte("a")) }, CloseProtocolError},
+		{"interleaved text", func(c *client) {
+			c.write(false, opText, []byte("a"))
+			c.write(true, opText, []byte("b"))
+		}, CloseProtocolError},
+		{"binary", func(c *client) { c.write(true, opBinary, []byte{0}) }, CloseUnsupportedData},
+		{"invalid utf-8", func(c *client) { c.write(true, opText, []byte{0xff}) }, CloseInvalidPayload},
+		{"too big", func(c *client) { c.write(true, opText, make([]byte, MaxMessageSize+1)) }, CloseMessageTooBig},
+		{"too big in fragments", func(c *client) {
+			c.write(false, opText, make([]byte, MaxMessageSize))
+			c.write(true, opContinuation, []byte("a"))
+		}, CloseMessageTooBig},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := dial(t)
+			test.send(c)
+
+			if code := c.expectClose(); code != test.reply {
+				t.Errorf("closed with %d, want %d", code, test.reply)
+			}
+			c.serverError()
+		})
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	timeout := ReadTimeout
+	ReadTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { ReadTimeout = timeout })
+
+	c := dial(t)
+
+	// Pongs keep the connection alive
+	for range 3 {
+		time.Sleep(ReadTimeout / 2)
+		c.write(true, opPong, nil)
+	}
+	c.write(true, opText, []byte("alive"))
+	if _, payload := c.read(); string(payload) != "alive" {
+		t.Fatalf("got %q, want the text echoed", payload)
+	}
+
+	// A silent client is disconnected
+	var netErr net.Error
+	if err := c.serverError(); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("ReadMessage returned %v, want a timeout", err)
+	}
+	if code := c.expectClose(); code != CloseGoingAway {
+		t.Errorf("closed with %d, want %d", code, CloseGoingAway)
+	}
+}